@@ -0,0 +1,350 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// usersRoot holds the user profiles, their folder names are the user names
+// that -anonymize looks for in the collected files.
+var usersRoot = `C:\Users`
+
+// builtinAccounts are the accounts every Windows machine has, they don't
+// identify anyone and are left as they are.
+var builtinAccounts = map[string]bool{"administrator": true, "guest": true, "defaultaccount": true, "wdagutilityaccount": true}
+
+var (
+	ipv4Re = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	// ipv6Re matches anything that could be an IPv6 address, net.ParseIP
+	// tells the addresses apart.
+	ipv6Re = regexp.MustCompile(`[0-9A-Fa-f]*:[0-9A-Fa-f:]*:[0-9A-Fa-f]*`)
+)
+
+// redactionDictionary replaces the host name, the user names and the IP
+// addresses in the bundle with tokens, the same name or address always
+// gets the same token so the files can still be read together.
+type redactionDictionary struct {
+	tokens map[string]string
+	// wordsRe matches the host and user names, nil when there are none.
+	wordsRe *regexp.Regexp
+}
+
+// newRedactionDictionary returns the dictionary for hostname and users.
+func newRedactionDictionary(hostname string, users []string) *redactionDictionary {
+	d := &redactionDictionary{tokens: make(map[string]string)}
+	add := func(name, token string) {
+		if name != "" {
+			d.tokens[strings.ToLower(name)] = token
+		}
+	}
+	for _, u := range users {
+		if !builtinAccounts[strings.ToLower(u)] && !sharedProfiles[strings.ToLower(u)] {
+			add(u, userToken(u))
+		}
+	}
+	// The host name goes last, it wins over a user with the same name.
+	add(hostname, hostToken(hostname))
+	if i := strings.Index(hostname, "."); i > 0 {
+		add(hostname[:i], hostToken(hostname[:i]))
+	}
+
+	words := make([]string, 0, len(d.tokens))
+	for w := range d.tokens {
+		words = append(words, regexp.QuoteMeta(w))
+	}
+	if len(words) > 0 {
+		// Longest first, so a FQDN is replaced before the host name in it.
+		sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+		d.wordsRe = regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+	}
+	return d
+}
+
+// localUsers lists the user names of the profiles under usersRoot and the
+// user running the tool.
+func localUsers() []string {
+	users := []string{os.Getenv("USERNAME")}
+	infos, err := ioutil.ReadDir(usersRoot)
+	if err != nil {
+		return users
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			users = append(users, info.Name())
+		}
+	}
+	return users
+}
+
+// hostToken is a stable stand in for a host name, host names are case
+// insensitive. Like userToken, it is keyed with tokenKey.
+func hostToken(name string) string {
+	return token("host", []byte(strings.ToLower(name)))
+}
+
+// ipToken is a stable stand in for an IP address, keyed with tokenKey.
+func ipToken(ip net.IP) string {
+	return token("ip", ip.To16())
+}
+
+// identifyingIP reports whether ip tells something about the machine or its
+// network. The unspecified, loopback and multicast addresses, netmasks and
+// the metadata server are the same everywhere.
+func identifyingIP(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil && (v4[0] == 255 || v4.Equal(net.IPv4(169, 254, 169, 254))) {
+		return false
+	}
+	return true
+}
+
+// redact returns s with the host name, user names and IP addresses
+// replaced with their tokens.
+func (d *redactionDictionary) redact(s string) string {
+	if d.wordsRe != nil {
+		s = d.replaceWords(s)
+	}
+	// Profiles of users that weren't found, such as deleted ones. The ones
+	// replaced above already hold a token.
+	s = userSegmentRe.ReplaceAllStringFunc(s, func(m string) string {
+		parts := userSegmentRe.FindStringSubmatch(m)
+		if sharedProfiles[strings.ToLower(parts[2])] || strings.HasPrefix(parts[2], "user-") {
+			return m
+		}
+		return parts[1] + userToken(parts[2])
+	})
+	replaceIP := func(m string) string {
+		if ip := net.ParseIP(m); ip != nil && identifyingIP(ip) {
+			return ipToken(ip)
+		}
+		return m
+	}
+	s = ipv6Re.ReplaceAllStringFunc(s, replaceIP)
+	return ipv4Re.ReplaceAllStringFunc(s, replaceIP)
+}
+
+// replaceWords replaces the host and user names that are whole words in s,
+// delimited by anything but a letter or a digit. Unlike \b, an underscore
+// delimits them too, as in WIN-DB1_cluster.log.
+func (d *redactionDictionary) replaceWords(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range d.wordsRe.FindAllStringIndex(s, -1) {
+		if (m[0] > 0 && isAlnum(s[m[0]-1])) || (m[1] < len(s) && isAlnum(s[m[1]])) {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(d.tokens[strings.ToLower(s[m[0]:m[1]])])
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Encodings of the collected files, see fileEncoding.
+const (
+	encodingBinary = iota
+	encodingUTF8
+	encodingUTF16LE
+	encodingUTF16BE
+)
+
+// fileEncoding tells from its start whether the file at path is text, in
+// UTF-8 or in UTF-16 as msinfo32, reg export and many PowerShell outputs
+// write it, or binary. Event logs, traces and dumps are binary, they can't
+// be anonymized and are left out with -anonymize.
+func fileEncoding(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return encodingBinary, err
+	}
+	defer f.Close()
+	head := make([]byte, 8192)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return encodingBinary, err
+	}
+	return sniffEncoding(head[:n]), nil
+}
+
+// sniffEncoding returns the encoding of a file starting with head.
+func sniffEncoding(head []byte) int {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return encodingUTF16LE
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return encodingUTF16BE
+	case bytes.IndexByte(head, 0) < 0:
+		return encodingUTF8
+	}
+	// UTF-16 without a byte order mark is told apart by the zero high
+	// byte of the ASCII characters, that most of the text is made of.
+	var zeroHigh, pairs int
+	for i := 0; i+1 < len(head); i += 2 {
+		if head[i] == 0 && head[i+1] == 0 {
+			return encodingBinary
+		}
+		if head[i+1] == 0 {
+			zeroHigh++
+		}
+		pairs++
+	}
+	if pairs > 0 && zeroHigh*10 >= pairs*9 {
+		return encodingUTF16LE
+	}
+	return encodingBinary
+}
+
+// leaveOutBinaries returns logs without the binary files, and the paths of
+// the files left out.
+func leaveOutBinaries(logs []logFolder) ([]logFolder, []string) {
+	var kept []logFolder
+	var left []string
+	for _, folder := range logs {
+		files := make([]string, 0, len(folder.files))
+		for _, path := range folder.files {
+			// A file that can't be read is left out as well, there is no
+			// telling what it holds.
+			if enc, err := fileEncoding(path); err != nil || enc == encodingBinary {
+				left = append(left, path)
+				continue
+			}
+			files = append(files, path)
+		}
+		folder.files = files
+		kept = append(kept, folder)
+	}
+	return kept, left
+}
+
+// anonymizeFolders copies the files of logs into dir with their names and
+// contents redacted and returns the folders of the copies. Each folder gets
+// its own subfolder, two folders can hold files of the same name.
+func anonymizeFolders(logs []logFolder, d *redactionDictionary, dir string) ([]logFolder, error) {
+	var anonymized []logFolder
+	for i, folder := range logs {
+		folderDir := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.MkdirAll(folderDir, 0755); err != nil {
+			return nil, err
+		}
+		files := make([]string, 0, len(folder.files))
+		for _, path := range folder.files {
+			out := filepath.Join(folderDir, d.redact(filepath.Base(path)))
+			if err := anonymizeFile(path, out, d); err != nil {
+				return nil, err
+			}
+			files = append(files, out)
+		}
+		folder.files = files
+		anonymized = append(anonymized, folder)
+	}
+	return anonymized, nil
+}
+
+// anonymizeFile writes the redacted contents of the text file at path to
+// out, a line at a time, in the encoding of the file.
+func anonymizeFile(path, out string, d *redactionDictionary) (err error) {
+	enc, err := fileEncoding(path)
+	if err != nil {
+		return err
+	}
+	if enc == encodingUTF16LE || enc == encodingUTF16BE {
+		return anonymizeUTF16File(path, out, enc, d)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}()
+
+	r := bufio.NewReader(in)
+	w := bufio.NewWriter(f)
+	for {
+		line, rErr := r.ReadString('\n')
+		if _, err := w.WriteString(d.redact(line)); err != nil {
+			return err
+		}
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			return rErr
+		}
+	}
+	return w.Flush()
+}
+
+// anonymizeUTF16File is anonymizeFile for UTF-16 files, which are decoded
+// whole. The byte order mark is kept if there is one.
+func anonymizeUTF16File(path, out string, enc int, d *redactionDictionary) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if enc == encodingUTF16BE {
+		order = binary.BigEndian
+	}
+	bom := len(data) >= 2 && order.Uint16(data) == 0xFEFF
+	if bom {
+		data = data[2:]
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(utf16.Decode(units)), "\n") {
+		b.WriteString(d.redact(line))
+	}
+	redacted := utf16.Encode([]rune(b.String()))
+	if bom {
+		redacted = append([]uint16{0xFEFF}, redacted...)
+	}
+	buf := make([]byte, 2*len(redacted))
+	for i, u := range redacted {
+		order.PutUint16(buf[2*i:], u)
+	}
+	return ioutil.WriteFile(out, buf, 0644)
+}
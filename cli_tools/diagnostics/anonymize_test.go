@@ -0,0 +1,182 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestRedact(t *testing.T) {
+	d := newRedactionDictionary("WIN-DB1.corp.example.com", []string{"jdoe", "Administrator", "Public"})
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"Host Name: WIN-DB1", "Host Name: " + hostToken("WIN-DB1")},
+		{"win-db1.corp.example.com resolves", hostToken("WIN-DB1.corp.example.com") + " resolves"},
+		{"WIN-DB10 is another host", "WIN-DB10 is another host"},
+		{`C:\Users\JDoe\AppData\Local\Temp`, `C:\Users\` + userToken("jdoe") + `\AppData\Local\Temp`},
+		{`C:\Users\olduser\ntuser.dat`, `C:\Users\` + userToken("olduser") + `\ntuser.dat`},
+		{`Owner: jdoe`, `Owner: ` + userToken("jdoe")},
+		{`C:\Users\Public\Desktop, run as Administrator`, `C:\Users\Public\Desktop, run as Administrator`},
+		{"IPv4 Address: 10.128.0.5(Preferred)", "IPv4 Address: " + ipToken(net.ParseIP("10.128.0.5")) + "(Preferred)"},
+		{"Subnet Mask: 255.255.240.0, loopback 127.0.0.1, metadata 169.254.169.254", "Subnet Mask: 255.255.240.0, loopback 127.0.0.1, metadata 169.254.169.254"},
+		{"Link-local IPv6 Address: fe80::4c1a:2bff:fe3d:5e6f%4", "Link-local IPv6 Address: " + ipToken(net.ParseIP("fe80::4c1a:2bff:fe3d:5e6f")) + "%4"},
+		{"Collected: 2019-06-01T08:00:01Z, build 10.0.17763.1", "Collected: 2019-06-01T08:00:01Z, build 10.0.17763.1"},
+	} {
+		if got := d.redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHostAndIPTokensKeyed(t *testing.T) {
+	// An unkeyed hash could be reversed by hashing the host names of the
+	// domain or a whole subnet.
+	host := sha256.Sum256([]byte("win-db1"))
+	if got := hostToken("WIN-DB1"); got == fmt.Sprintf("host-%x", host[:4]) {
+		t.Errorf("hostToken(WIN-DB1) = %q, the unkeyed hash of the name", got)
+	}
+	ip := net.ParseIP("10.128.0.5")
+	addr := sha256.Sum256(ip.To16())
+	if got := ipToken(ip); got == fmt.Sprintf("ip-%x", addr[:4]) {
+		t.Errorf("ipToken(10.128.0.5) = %q, the unkeyed hash of the address", got)
+	}
+}
+
+// utf16LE encodes s in UTF-16LE, after a byte order mark if bom is set.
+func utf16LE(s string, bom bool) string {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return string(b)
+}
+
+func TestSniffEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		head string
+		want int
+	}{
+		{"Host Name: WIN-DB1\r\n", encodingUTF8},
+		{utf16LE("System Summary\r\n", true), encodingUTF16LE},
+		{"\xFE\xFF\x00S", encodingUTF16BE},
+		{utf16LE("Windows Registry Editor Version 5.00\r\n", false), encodingUTF16LE},
+		{"ElfFile\x00\x00WIN-DB1", encodingBinary},
+		{"MDMP\x93\xa7\x00\x00\x0e\x00\x00\x00", encodingBinary},
+	} {
+		if got := sniffEncoding([]byte(tc.head)); got != tc.want {
+			t.Errorf("sniffEncoding(%q) = %d, want %d", tc.head, got, tc.want)
+		}
+	}
+}
+
+func TestAnonymizedBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anonymize_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const host, user, ip = "WIN-DB1", "jdoe", "10.128.0.5"
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	logs := []logFolder{
+		{name: "System", files: []string{
+			write("systeminfo.txt", "# Command: systeminfo.exe\r\n# Hostname: WIN-DB1\r\nHost Name: WIN-DB1\r\nRegistered Owner: jdoe"),
+			write("msinfo32.txt", utf16LE("System Name\tWIN-DB1\r\nUser Name\tWIN-DB1\\jdoe\r\n", true)),
+		}},
+		{name: "Registry", files: []string{write("winlogon.reg", utf16LE("[HKLM\\Winlogon]\r\n\"DefaultUserName\"=\"jdoe\"\r\n", false))}},
+		{name: "Network", files: []string{write("ipconfig.txt", "IPv4 Address. . . : 10.128.0.5"), write("System.evtx", "ElfFile\x00\x00WIN-DB1")}},
+		{name: "Cluster", files: []string{write("WIN-DB1_cluster.log", "node WIN-DB1 joined from 10.128.0.5")}},
+		{name: "", files: []string{write(manifestFileName, "System/systeminfo.txt\t"+`C:\Users\jdoe\AppData\Local\Temp\diagnostics1\systeminfo.txt`)}},
+	}
+
+	logs, left := leaveOutBinaries(logs)
+	if len(left) != 1 || filepath.Base(left[0]) != "System.evtx" {
+		t.Errorf("expected the event log to be left out, got %v", left)
+	}
+	logs, err = anonymizeFolders(logs, newRedactionDictionary(host, []string{user}), filepath.Join(dir, "anonymized"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "logs.zip")
+	if err := archiveFiles(logs, out, formatZip, flate.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.File) != 6 {
+		t.Errorf("expected the 6 text files in the bundle, got %d", len(r.File))
+	}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc := sniffEncoding(data); enc == encodingUTF16LE {
+			bom := data[0] == 0xFF && data[1] == 0xFE
+			if want := filepath.Base(f.Name) == "msinfo32.txt"; bom != want {
+				t.Errorf("%s: byte order mark = %v, want %v", f.Name, bom, want)
+			}
+			units := make([]uint16, len(data)/2)
+			for i := range units {
+				units[i] = binary.LittleEndian.Uint16(data[2*i:])
+			}
+			data = []byte(string(utf16.Decode(units)))
+			if !strings.Contains(string(data), "\r\n") {
+				t.Errorf("%s: expected the redacted UTF-16 text, got %q", f.Name, data)
+			}
+		} else if enc != encodingUTF8 {
+			t.Errorf("%s: encoding = %d, want text", f.Name, enc)
+		}
+		for _, s := range []string{host, user, ip} {
+			if strings.Contains(strings.ToLower(f.Name), strings.ToLower(s)) {
+				t.Errorf("%q left in the file name %s", s, f.Name)
+			}
+			if strings.Contains(strings.ToLower(string(data)), strings.ToLower(s)) {
+				t.Errorf("%q left in %s:\n%s", s, f.Name, data)
+			}
+		}
+	}
+}
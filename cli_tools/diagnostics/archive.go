@@ -0,0 +1,159 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	formatZip   = "zip"
+	formatTarGz = "tar.gz"
+)
+
+// reproducibleModTime is the modification time of every entry of a
+// -reproducible bundle, the earliest a zip can hold.
+var reproducibleModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// collectionTime returns the time of the collection written in the summary,
+// the report and the file headers, reproducibleModTime with -reproducible.
+func collectionTime() string {
+	if opts.reproducible {
+		return reproducibleModTime.Format(time.RFC3339)
+	}
+	return collectionClock().Format(time.RFC3339)
+}
+
+// collectionClock is time.Now, tests stand in for it.
+var collectionClock = time.Now
+
+// archiveWriter writes the files of the bundle into an archive.
+type archiveWriter interface {
+	// add writes the next file of the archive, size is the number of bytes
+	// r will produce.
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	// close finishes the archive, it doesn't close the underlying writer.
+	close() error
+}
+
+// newArchiveWriter returns an archiveWriter for format writing to w with the
+// given compression level, 0 (store) to 9 or flate.DefaultCompression.
+func newArchiveWriter(w io.Writer, format string, level int) (archiveWriter, error) {
+	if level < flate.DefaultCompression || level > flate.BestCompression {
+		return nil, fmt.Errorf("invalid compression level %d, expected 0-9", level)
+	}
+	switch format {
+	case formatZip:
+		zw := zip.NewWriter(w)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+		return zipArchive{zw, level}, nil
+	case formatTarGz:
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		return tarGzArchive{tar.NewWriter(gw), gw}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %q, expected %s or %s", format, formatZip, formatTarGz)
+	}
+}
+
+// archiveFileName is the name of the bundle for format.
+func archiveFileName(format string) string {
+	return "logs." + format
+}
+
+type zipArchive struct {
+	w     *zip.Writer
+	level int
+}
+
+func (a zipArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	f, err := a.create(name, modTime)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// create starts the next file of the archive, its content is written to the
+// returned writer until the next file is started or the archive closed.
+func (a zipArchive) create(name string, modTime time.Time) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	header.SetModTime(modTime)
+	if a.level == flate.NoCompression {
+		header.Method = zip.Store
+	}
+	return a.w.CreateHeader(header)
+}
+
+func (a zipArchive) close() error {
+	return a.w.Close()
+}
+
+type tarGzArchive struct {
+	tw *tar.Writer
+	gw *gzip.Writer
+}
+
+func (a tarGzArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// A file that grew since it was stat'ed is cut at size, tar needs the
+	// size up front.
+	_, err := io.Copy(a.tw, io.LimitReader(r, size))
+	return err
+}
+
+func (a tarGzArchive) close() error {
+	if err := a.tw.Close(); err != nil {
+		a.gw.Close()
+		return err
+	}
+	return a.gw.Close()
+}
+
+// openForArchive opens path and returns it along with its size and
+// modification time.
+func openForArchive(path string) (*os.File, os.FileInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
@@ -0,0 +1,238 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestFolders creates a couple of files in dir and returns the folders
+// holding them along with the contents expected in the archive.
+func writeTestFolders(t *testing.T, dir string) ([]logFolder, map[string]string) {
+	t.Helper()
+	contents := map[string]string{
+		"System/systeminfo.txt": strings.Repeat("Host Name: test\r\n", 200),
+		"summary.txt":           "Errors (0):\r\n",
+	}
+	var folders []logFolder
+	for name, content := range contents {
+		path := filepath.Join(dir, filepath.Base(name))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		folder := ""
+		if i := strings.Index(name, "/"); i >= 0 {
+			folder = name[:i]
+		}
+		folders = append(folders, logFolder{name: folder, files: []string{path}})
+	}
+	return folders, contents
+}
+
+func readZip(t *testing.T, path string) (map[string]string, []uint16) {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got := make(map[string]string)
+	var methods []uint16
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[f.Name] = string(data)
+		methods = append(methods, f.Method)
+	}
+	return got, methods
+}
+
+func readTarGz(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	got := make(map[string]string)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[h.Name] = string(data)
+	}
+	return got
+}
+
+func TestArchiveFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	folders, want := writeTestFolders(t, dir)
+
+	tests := []struct {
+		name   string
+		format string
+		level  int
+	}{
+		{"zip default", formatZip, flate.DefaultCompression},
+		{"zip best", formatZip, flate.BestCompression},
+		{"zip store", formatZip, flate.NoCompression},
+		{"tar.gz default", formatTarGz, flate.DefaultCompression},
+		{"tar.gz store", formatTarGz, flate.NoCompression},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(dir, "out", archiveFileName(tt.format))
+			if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(filepath.Dir(out))
+
+			if err := archiveFiles(folders, out, tt.format, tt.level); err != nil {
+				t.Fatalf("archiveFiles() error = %v", err)
+			}
+
+			var got map[string]string
+			if tt.format == formatZip {
+				var methods []uint16
+				got, methods = readZip(t, out)
+				wantMethod := zip.Deflate
+				if tt.level == flate.NoCompression {
+					wantMethod = zip.Store
+				}
+				for _, m := range methods {
+					if m != wantMethod {
+						t.Errorf("zip entry method = %d, want %d", m, wantMethod)
+					}
+				}
+			} else {
+				got = readTarGz(t, out)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("archive contents = %v, want %v", got, want)
+			}
+
+			info, err := os.Stat(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload := int64(0)
+			for _, c := range want {
+				payload += int64(len(c))
+			}
+			if stored := info.Size() >= payload; stored != (tt.level == flate.NoCompression) {
+				t.Errorf("archive is %d bytes for %d bytes of content at level %d", info.Size(), payload, tt.level)
+			}
+		})
+	}
+}
+
+func TestNewArchiveWriterInvalid(t *testing.T) {
+	tests := []struct {
+		format string
+		level  int
+	}{
+		{"rar", flate.DefaultCompression},
+		{formatZip, 10},
+		{formatTarGz, -2},
+	}
+	for _, tt := range tests {
+		if _, err := newArchiveWriter(ioutil.Discard, tt.format, tt.level); err == nil {
+			t.Errorf("newArchiveWriter(%q, %d) expected an error", tt.format, tt.level)
+		}
+	}
+}
+
+func TestArchiveFilesReproducible(t *testing.T) {
+	oldOpts := opts
+	defer func() { opts = oldOpts }()
+	dir, err := ioutil.TempDir("", "archive_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	folders, _ := writeTestFolders(t, dir)
+	reversed := []logFolder{folders[1], folders[0]}
+
+	// archive writes the folders in the given order, after setting the
+	// modification time of their files.
+	archive := func(name, format string, folders []logFolder, modTime time.Time) []byte {
+		for _, f := range folders {
+			for _, p := range f.files {
+				if err := os.Chtimes(p, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		out := filepath.Join(dir, name+"."+format)
+		if err := archiveFiles(folders, out, format, flate.DefaultCompression); err != nil {
+			t.Fatalf("archiveFiles() error = %v", err)
+		}
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	for _, format := range []string{formatZip, formatTarGz} {
+		opts.reproducible = true
+		first := archive("first", format, folders, time.Now())
+		second := archive("second", format, reversed, time.Now().Add(-time.Hour))
+		if !bytes.Equal(first, second) {
+			t.Errorf("%s: two -reproducible archives of the same files differ", format)
+		}
+
+		opts.reproducible = false
+		if bytes.Equal(first, archive("plain", format, reversed, time.Now().Add(-2*time.Hour))) {
+			t.Errorf("%s: expected the entry order and times to change the archive without -reproducible", format)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+)
+
+// recoveryPasswordRe matches BitLocker recovery passwords, 8 groups of 6
+// digits.
+var recoveryPasswordRe = regexp.MustCompile(`\b\d{6}(-\d{6}){7}\b`)
+
+const redactedRecoveryPassword = "<recovery password removed>"
+
+// bitlocker reports the encryption and lock state of the volumes. Neither
+// "manage-bde -status" nor the properties of Win32_EncryptableVolume include
+// recovery keys, getting those takes "-protectors -get" or a method call,
+// the sections are still wrapped in noRecoveryKeys as a safety net.
+var bitlocker = group{"bitlocker.txt", []section{
+	noRecoveryKeys{cmd{path: `C:\Windows\System32\manage-bde.exe`, args: "-status", admin: adminRequired}},
+	noRecoveryKeys{wmiQuery{class: "Win32_EncryptableVolume", namespace: `root\CIMV2\Security\MicrosoftVolumeEncryption`}},
+}}
+
+// noRecoveryKeys blanks out anything that looks like a BitLocker recovery
+// password in the output of its section.
+type noRecoveryKeys struct {
+	section
+}
+
+func (s noRecoveryKeys) writeOutput(ctx context.Context, w io.Writer) error {
+	var buf bytes.Buffer
+	err := s.section.writeOutput(ctx, &buf)
+	if _, wErr := w.Write(recoveryPasswordRe.ReplaceAll(buf.Bytes(), []byte(redactedRecoveryPassword))); err == nil {
+		err = wErr
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	sampleRecoveryPassword = "123456-234567-345678-456789-567890-678901-789012-890123"
+	sampleManageBde        = `BitLocker Drive Encryption: Configuration Tool version 10.0.17763
+Volume C: []
+[OS Volume]
+
+    Size:                 49.45 GB
+    BitLocker Version:    2.0
+    Conversion Status:    Fully Encrypted
+    Percentage Encrypted: 100.0%
+    Encryption Method:    XTS-AES 128
+    Protection Status:    Protection On
+    Lock Status:          Unlocked
+    Identification Field: Unknown
+    Key Protectors:
+        TPM
+        Numerical Password
+            Password:
+              ` + sampleRecoveryPassword + `
+`
+)
+
+func TestGatherDiskLogsBitlocker(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.outputs = map[string]string{`C:\Windows\System32\manage-bde.exe -status`: sampleManageBde}
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"Win32_EncryptableVolume": {{{"DriveLetter", "C:"}, {"ProtectionStatus", "1"}, {"Note", sampleRecoveryPassword}}},
+	}}
+
+	folder := runGatherer(t, gatherDiskLogs)
+	got := readFolderFile(t, folder, "bitlocker.txt")
+	for _, want := range []string{
+		"Protection Status:    Protection On",
+		"Queried wmi objects [Win32_EncryptableVolume] from namespace root\\CIMV2\\Security\\MicrosoftVolumeEncryption",
+		"ProtectionStatus: 1",
+		redactedRecoveryPassword,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in bitlocker.txt:\n%s", want, got)
+		}
+	}
+	if recoveryPasswordRe.MatchString(got) {
+		t.Errorf("bitlocker.txt contains a recovery password:\n%s", got)
+	}
+}
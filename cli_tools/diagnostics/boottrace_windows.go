@@ -0,0 +1,99 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// bootTraceStateFile records that a boot trace was registered so the next run,
+// after the reboot, knows to stop and collect it.
+var bootTraceStateFile = `C:\ProgramData\Google\diagnostics\boottrace.json`
+
+type bootTraceState struct {
+	Registered time.Time `json:"registered"`
+}
+
+func readBootTraceState() (*bootTraceState, error) {
+	data, err := ioutil.ReadFile(bootTraceStateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state bootTraceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func writeBootTraceState(state bootTraceState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(bootTraceStateFile), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bootTraceStateFile, data, 0644)
+}
+
+// bootTraceRegister registers the wpr boot trace of -boot-trace, and
+// bootTraceStop stops it into boottrace.etl after the reboot.
+var (
+	bootTraceRegister = cmd{path: `C:\Windows\System32\wpr.exe`, args: "-boottrace -addboot GeneralProfile -filemode", outputFileName: "boottrace_register.txt", mutates: true}
+	bootTraceStop     = cmd{path: `C:\Windows\System32\wpr.exe`, args: "-boottrace -stopboot boottrace.etl", outputFileName: "boottrace.etl", cmdProducesFile: true, mutates: true}
+)
+
+// gatherBootTraceLogs captures a wpr trace across a reboot in two runs. The
+// first run registers the boot trace and saves a state file, the run after
+// the reboot finds the state file, stops the trace and collects it.
+func gatherBootTraceLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	state, err := readBootTraceState()
+	if err != nil {
+		errs <- err
+		logs <- logFolder{name: "Trace", files: nil}
+		return
+	}
+
+	if state == nil {
+		paths := resultPaths(runAll(ctx, []runner{bootTraceRegister}, errs))
+		if len(paths) > 0 {
+			if err := writeBootTraceState(bootTraceState{Registered: time.Now()}); err != nil {
+				errs <- err
+			} else {
+				log.Print("Boot trace registered. Reboot and run again with -boot-trace to collect it.")
+				summary.notef("Boot trace registered, reboot and run again with -boot-trace to collect it")
+			}
+		}
+		logs <- logFolder{name: "Trace", files: paths}
+		return
+	}
+
+	paths := resultPaths(runAll(ctx, []runner{bootTraceStop}, errs))
+	if err := os.Remove(bootTraceStateFile); err != nil {
+		errs <- err
+	}
+	summary.notef("Boot trace registered at %s was collected", state.Registered.Format(time.RFC3339))
+	logs <- logFolder{name: "Trace", files: paths}
+}
@@ -0,0 +1,62 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGatherBootTraceLogsTwoPhases(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	oldState := bootTraceStateFile
+	defer func() { bootTraceStateFile = oldState }()
+	bootTraceStateFile = filepath.Join(tmpFolder, "state", "boottrace.json")
+
+	register := `C:\Windows\System32\wpr.exe -boottrace -addboot GeneralProfile -filemode`
+	stop := `C:\Windows\System32\wpr.exe -boottrace -stopboot ` + filepath.Join(tmpFolder, "boottrace.etl")
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+
+	// First run, before the reboot.
+	gatherBootTraceLogs(context.Background(), logs, errs)
+	<-logs
+	if fake.callCount(register) != 1 || fake.callCount(stop) != 0 {
+		t.Fatalf("first run should only register the boot trace, calls: %v", fake.calls)
+	}
+	if _, err := os.Stat(bootTraceStateFile); err != nil {
+		t.Fatalf("expected state file after registering: %v", err)
+	}
+
+	// Second run, after the reboot.
+	gatherBootTraceLogs(context.Background(), logs, errs)
+	folder := <-logs
+	if fake.callCount(register) != 1 || fake.callCount(stop) != 1 {
+		t.Fatalf("second run should only stop the boot trace, calls: %v", fake.calls)
+	}
+	if want := filepath.Join(tmpFolder, "boottrace.etl"); !stringArrayIncludesString(folder.files, want) {
+		t.Errorf("expected %s in Trace folder, got %v", want, folder.files)
+	}
+	if _, err := os.Stat(bootTraceStateFile); !os.IsNotExist(err) {
+		t.Errorf("expected state file to be removed, got %v", err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("unexpected error: %v", <-errs)
+	}
+}
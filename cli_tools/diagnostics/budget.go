@@ -0,0 +1,119 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// archiveOverhead is an upper bound of what an archive adds for each
+	// file, a tar header and the padding of its content.
+	archiveOverhead = 1024
+	// bundleReserve is kept out of the budget for the files written at the
+	// end of the run, such as the summary and the report.
+	bundleReserve = 1 << 20
+)
+
+// dropPriority orders the folders to drop files from when the bundle is over
+// budget, lowest first. The root folder is never dropped, and folders not
+// listed go after the ones listed.
+var dropPriority = map[string]int{
+	"CrashDump": 0,
+	"Event":     1,
+	"Trace":     2,
+}
+
+const defaultDropPriority = 3
+
+// filePriority returns the drop priority of path in folder. Memory dumps go
+// first wherever they are collected, MEMORY.dmp is in the Kubernetes folder.
+func filePriority(folder, path string) int {
+	if strings.EqualFold(filepath.Ext(path), ".dmp") {
+		return dropPriority["CrashDump"]
+	}
+	if priority, ok := dropPriority[folder]; ok {
+		return priority
+	}
+	return defaultDropPriority
+}
+
+// droppedFile is a file left out of the bundle to keep it under budget.
+type droppedFile struct {
+	folder string
+	path   string
+	size   int64
+}
+
+// fitBundle drops files from logs, lowest priority files first and the
+// largest files of a folder first, until the bundle fits in maxBytes before
+// compression. It returns the folders left and what was dropped.
+func fitBundle(logs []logFolder, maxBytes int64) ([]logFolder, []droppedFile) {
+	type candidate struct {
+		droppedFile
+		priority int
+	}
+	var candidates []candidate
+	total := int64(bundleReserve)
+	for _, folder := range logs {
+		for _, path := range folder.files {
+			info, err := os.Stat(path)
+			if err != nil {
+				// archiveFiles reports it.
+				continue
+			}
+			total += info.Size() + archiveOverhead
+			if folder.name != "" {
+				candidates = append(candidates, candidate{droppedFile{folder.name, path, info.Size()}, filePriority(folder.name, path)})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].size > candidates[j].size
+	})
+
+	var dropped []droppedFile
+	drop := make(map[string]bool)
+	for _, c := range candidates {
+		if total <= maxBytes {
+			break
+		}
+		total -= c.size + archiveOverhead
+		dropped = append(dropped, c.droppedFile)
+		drop[c.folder+"\x00"+c.path] = true
+	}
+	if len(dropped) == 0 {
+		return logs, nil
+	}
+
+	kept := make([]logFolder, 0, len(logs))
+	for _, folder := range logs {
+		f := folder
+		f.files = nil
+		for _, path := range folder.files {
+			if !drop[folder.name+"\x00"+path] {
+				f.files = append(f.files, path)
+			}
+		}
+		kept = append(kept, f)
+	}
+	return kept, dropped
+}
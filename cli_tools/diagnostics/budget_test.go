@@ -0,0 +1,159 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFitBundleDropOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "budget_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := func(name string, size int) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	dump := file("MEMORY.dmp", 400000)
+	system := file("System.evtx", 300000)
+	application := file("Application.evtx", 200000)
+	trace := file("trace.etl", 300000)
+	systeminfo := file("systeminfo.txt", 10000)
+	summaryFile := file("summary.txt", 1000)
+	logs := []logFolder{
+		{name: "System", files: []string{systeminfo}},
+		{name: "Trace", files: []string{trace}},
+		{name: "Event", files: []string{application, system}},
+		{name: "CrashDump", files: []string{dump}},
+		{name: "", files: []string{summaryFile}},
+	}
+
+	tests := []struct {
+		name        string
+		maxBytes    int64
+		wantDropped []string
+	}{
+		{"under budget", 10 << 20, nil},
+		{"crash dumps first", bundleReserve + 811000 + 5*archiveOverhead, []string{dump}},
+		{"then the largest event log", bundleReserve + 511000 + 4*archiveOverhead, []string{dump, system}},
+		{"then traces", bundleReserve + 11000 + 2*archiveOverhead, []string{dump, system, application, trace}},
+		{"then the rest, never the root", 1, []string{dump, system, application, trace, systeminfo}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, dropped := fitBundle(logs, tt.maxBytes)
+			var gotDropped []string
+			for _, d := range dropped {
+				gotDropped = append(gotDropped, d.path)
+			}
+			if !reflect.DeepEqual(gotDropped, tt.wantDropped) {
+				t.Errorf("dropped %v, want %v", gotDropped, tt.wantDropped)
+			}
+			remaining := make(map[string]bool)
+			for _, f := range kept {
+				for _, p := range f.files {
+					remaining[p] = true
+				}
+			}
+			for _, p := range tt.wantDropped {
+				if remaining[p] {
+					t.Errorf("%s was dropped but is still in the bundle", p)
+				}
+			}
+			if !remaining[summaryFile] {
+				t.Errorf("the root files must never be dropped")
+			}
+			if len(remaining)+len(tt.wantDropped) != 6 {
+				t.Errorf("kept %d files and dropped %d, want all 6 accounted for", len(remaining), len(tt.wantDropped))
+			}
+		})
+	}
+}
+
+func TestFitBundleArchiveUnderBudget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "budget_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var logs []logFolder
+	for _, name := range []string{"CrashDump", "Event", "Trace", "System"} {
+		p := filepath.Join(dir, name+".bin")
+		if err := ioutil.WriteFile(p, make([]byte, 300000), 0644); err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, logFolder{name: name, files: []string{p}})
+	}
+	maxBytes := int64(bundleReserve + 700000)
+
+	kept, dropped := fitBundle(logs, maxBytes)
+	if len(dropped) != 2 || dropped[0].folder != "CrashDump" || dropped[1].folder != "Event" {
+		t.Fatalf("dropped %v, want the CrashDump and Event files", dropped)
+	}
+	for _, format := range []string{formatZip, formatTarGz} {
+		archive := filepath.Join(dir, archiveFileName(format))
+		if err := archiveFiles(kept, archive, format, 0); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > maxBytes {
+			t.Errorf("%s bundle is %d bytes, over the %d budget", format, info.Size(), maxBytes)
+		}
+	}
+}
+
+func TestFitBundleDropsKubernetesMemoryDumpFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "budget_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, size int) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	dump := write("MEMORY.dmp", 900000)
+	logs := []logFolder{
+		{name: "Event", files: []string{write("System.evtx", 1000), write("Application.evtx", 1000)}},
+		{name: "Kubernetes", files: []string{write("kubelet.log", 1000), dump}},
+	}
+
+	kept, dropped := fitBundle(logs, int64(bundleReserve+100000))
+	if len(dropped) != 1 || dropped[0].path != dump {
+		t.Fatalf("dropped %v, want only %s", dropped, dump)
+	}
+	var files int
+	for _, folder := range kept {
+		files += len(folder.files)
+	}
+	if files != 3 {
+		t.Errorf("kept %d files, want the 3 small ones", files)
+	}
+}
@@ -0,0 +1,47 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import "fmt"
+
+// The build is identified at link time, e.g. with
+//
+//	go build -ldflags "-X main.version=1.0.1 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// A build without them is reported as a dev build.
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// versionCommand is the subcommand that prints the build info and exits.
+const versionCommand = "version"
+
+// BuildInfo identifies the build of the tool that produced a bundle.
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// buildInfo returns the build info set by the linker.
+func buildInfo() BuildInfo {
+	return BuildInfo{Version: version, Commit: commit, Date: buildDate}
+}
+
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", b.Version, b.Commit, b.Date)
+}
@@ -0,0 +1,57 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	oldVersion, oldCommit, oldDate := version, commit, buildDate
+	defer func() { version, commit, buildDate = oldVersion, oldCommit, oldDate }()
+
+	b := buildInfo()
+	if b.Version == "" || b.Commit == "" || b.Date == "" {
+		t.Errorf("buildInfo() = %+v, want every field set even without -ldflags", b)
+	}
+
+	version, commit, buildDate = "1.0.1", "4d50c86", "2019-06-01T08:00:00Z"
+	want := "1.0.1 (commit 4d50c86, built 2019-06-01T08:00:00Z)"
+	if got := buildInfo().String(); got != want {
+		t.Errorf("buildInfo().String() = %q, want %q", got, want)
+	}
+
+	dir, err := ioutil.TempDir("", "buildinfo_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := createManifest(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.f.Close()
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "diagnostics "+want) {
+		t.Errorf("expected the build info in the manifest header:\n%s", data)
+	}
+}
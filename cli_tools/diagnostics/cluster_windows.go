@@ -0,0 +1,46 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+)
+
+// clusterServicePath is the failover cluster service, it is only there when
+// the Failover Clustering feature is installed.
+var clusterServicePath = `C:\Windows\Cluster\clussvc.exe`
+
+// clusterRunners are the collectors of the Cluster folder.
+func clusterRunners() []runner {
+	return []runner{
+		installed{clusterServicePath, cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-ClusterNode | Format-List *"`, outputFileName: "cluster_nodes.txt", admin: adminRequired}},
+		installed{clusterServicePath, cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-ClusterResource | Format-List *"`, outputFileName: "cluster_resources.txt", admin: adminRequired}},
+		// Get-ClusterLog names the log after the node, it is moved to
+		// cluster.log, which is replaced with the output path.
+		installed{clusterServicePath, cmd{
+			path:            powershell,
+			args:            `-NoProfile -NonInteractive -Command "$log = Get-ClusterLog -Node $env:COMPUTERNAME -Destination $env:TEMP -TimeSpan 1440 -UseLocalTime; Move-Item $log.FullName 'cluster.log' -Force"`,
+			outputFileName:  "cluster.log",
+			cmdProducesFile: true,
+			admin:           adminRequired,
+		}},
+	}
+}
+
+// gatherClusterLogs collects the state and log of the Windows Server Failover
+// Cluster the instance is part of, if any.
+func gatherClusterLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	logs <- logFolder{name: "Cluster", files: resultPaths(runAll(ctx, clusterRunners(), errs))}
+}
@@ -0,0 +1,92 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withClusterService(t *testing.T, present bool) func() {
+	old := clusterServicePath
+	clusterServicePath = filepath.Join(tmpFolder, "clussvc.exe")
+	if present {
+		if err := ioutil.WriteFile(clusterServicePath, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() { clusterServicePath = old }
+}
+
+func TestGatherClusterLogs(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withClusterService(t, true)()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherClusterLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", <-errs)
+	}
+	if folder.name != "Cluster" {
+		t.Errorf("folder name = %q, want Cluster", folder.name)
+	}
+	for _, name := range []string{"cluster_nodes.txt", "cluster_resources.txt", "cluster.log"} {
+		if !stringArrayIncludesString(folder.files, filepath.Join(tmpFolder, name)) {
+			t.Errorf("expected %s in the Cluster folder, got %v", name, folder.files)
+		}
+	}
+	for _, name := range []string{"cluster_nodes.txt", "cluster_resources.txt"} {
+		if got := readFolderFile(t, folder, name); !strings.Contains(got, "output of") {
+			t.Errorf("expected the command output in %s, got %q", name, got)
+		}
+	}
+
+	// Get-ClusterLog writes the file itself, the output path must be passed
+	// in its place and nothing captured from stdout.
+	var clusterLog string
+	for _, c := range fake.calls {
+		if strings.Contains(c, "Get-ClusterLog") {
+			clusterLog = c
+		}
+	}
+	if want := "Move-Item $log.FullName '" + filepath.Join(tmpFolder, "cluster.log") + "' -Force"; !strings.Contains(clusterLog, want) {
+		t.Errorf("expected Get-ClusterLog to write to the output path, got %q", clusterLog)
+	}
+}
+
+func TestGatherClusterLogsNotInstalled(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withClusterService(t, false)()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherClusterLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	if len(fake.calls) != 0 {
+		t.Errorf("expected nothing to run without the cluster feature, calls: %v", fake.calls)
+	}
+	if len(errs) != 0 || len(folder.files) != 0 {
+		t.Errorf("expected an empty folder and no errors, got files %v, %d errors", folder.files, len(errs))
+	}
+}
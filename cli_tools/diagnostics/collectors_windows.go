@@ -0,0 +1,338 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// folderCollectors are the collectors that run into a folder of the bundle.
+type folderCollectors struct {
+	folder string
+	// flag is the flag the folder is only collected with, empty for the
+	// folders always collected.
+	flag    string
+	runners []runner
+}
+
+// registeredCollectors returns the collectors of each folder, as the
+// gatherers run them with the current flags. The files the gatherers copy
+// as they are, such as the event logs, are not collectors.
+func registeredCollectors() ([]folderCollectors, error) {
+	folders := []folderCollectors{
+		{folder: "System", runners: systemRunners()},
+		{folder: "Event", runners: eventRunners()},
+		{folder: "Network", runners: networkRunners()},
+		{folder: "Disk", runners: diskRunners()},
+		{folder: "Program", runners: programRunners()},
+		{folder: "Kubernetes", runners: containerRuntimeRunners()},
+		{folder: "GCE/startup_scripts", runners: startupScriptRunners()},
+		{folder: "GCE", runners: osConfigRunners()},
+		{folder: "Cluster", runners: clusterRunners()},
+		{folder: "HyperV", runners: hyperVRunners()},
+		{folder: "IIS", runners: iisRunners()},
+		{folder: "CrashDump", runners: crashDumpRunners()},
+		{folder: "System/registry", flag: "-export-registry", runners: registryExportRunners()},
+		{folder: "Trace", flag: "-trace", runners: []runner{traceStart, traceStop}},
+		{folder: "Trace", flag: "-boot-trace", runners: []runner{bootTraceRegister, bootTraceStop}},
+	}
+	if opts.pluginDir != "" {
+		runners, err := pluginRunners(opts.pluginDir)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folderCollectors{folder: "Plugins", flag: "-plugin-dir", runners: runners})
+	}
+	return folders, nil
+}
+
+// collectorInfo is the metadata of a collector listed by list-collectors.
+type collectorInfo struct {
+	// Name is the name of the output file of the collector in Folder.
+	Name   string `json:"name"`
+	Folder string `json:"folder"`
+	// Command is the command line of the collectors that run a single
+	// command.
+	Command string `json:"command,omitempty"`
+	// Network is set for the collectors making outbound network calls,
+	// which -no-network skips.
+	Network bool `json:"network"`
+	// Mutates is set for the collectors changing the state of the system,
+	// which -read-only skips.
+	Mutates bool `json:"mutates"`
+	// Admin is none, limited or required, see adminNeed.
+	Admin string `json:"admin"`
+	// Timeout is the timeout of an attempt of the collector with the
+	// current flags, it is empty for the collectors only bounded by
+	// -max-duration-per-folder.
+	Timeout string `json:"timeout,omitempty"`
+	// Flag is the flag the collector only runs with, if any.
+	Flag string `json:"flag,omitempty"`
+	// Formats are the formats -output-format can ask of the collector,
+	// empty for the collectors that only write their own format.
+	Formats []string `json:"formats,omitempty"`
+}
+
+// adminNames are the names of the adminNeed values in list-collectors.
+var adminNames = map[adminNeed]string{
+	adminNone:     "none",
+	adminLimited:  "limited",
+	adminRequired: "required",
+}
+
+// collectorInfos returns the metadata of the registered collectors, in the
+// order they run in within each folder.
+func collectorInfos() ([]collectorInfo, error) {
+	folders, err := registeredCollectors()
+	if err != nil {
+		return nil, err
+	}
+	var infos []collectorInfo
+	for _, f := range folders {
+		for _, r := range f.runners {
+			name := collectorName(r)
+			network, mutates, admin, _ := collectorTraits(r)
+			info := collectorInfo{
+				Name:    name,
+				Folder:  f.folder,
+				Network: network,
+				Mutates: mutates,
+				Admin:   adminNames[admin],
+				Flag:    f.flag,
+			}
+			if c, ok := unwrapRunner(r).(cmd); ok {
+				info.Command = describeRunner(c)
+			}
+			if formattable(r) {
+				info.Formats = []string{outputText, outputCSV, outputJSON}
+			}
+			if d := collectorTimeout(r, name); d > 0 {
+				info.Timeout = d.String()
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// unwrapRunner returns the runner doing the work of r, for the runners that
+// only decide whether or how to run another.
+func unwrapRunner(r runner) runner {
+	switch r := r.(type) {
+	case installed:
+		return unwrapRunner(r.runner)
+	case carriedForward:
+		return unwrapRunner(r.runner)
+	case registryExport:
+		return r.export
+	}
+	return r
+}
+
+// formattable reports whether -output-format can ask r for CSV or JSON.
+func formattable(r runner) bool {
+	switch r := unwrapRunner(r).(type) {
+	case cmd:
+		_, ok := withOutputFormat(r, outputCSV)
+		return ok
+	case windowsFeatures:
+		_, server := withOutputFormat(serverFeatures, outputCSV)
+		_, client := withOutputFormat(clientFeatures, outputCSV)
+		return server && client
+	}
+	return false
+}
+
+// collectorName returns the name of the output file of r.
+func collectorName(r runner) string {
+	r = unwrapRunner(r)
+	switch r := r.(type) {
+	case eventChannel:
+		return r.fileName()
+	case processDump:
+		return r.fileName()
+	}
+	// The other runners keep the name in an outputFileName field.
+	if v := reflect.ValueOf(r); v.Kind() == reflect.Struct {
+		if f := v.FieldByName("outputFileName"); f.IsValid() && f.Kind() == reflect.String {
+			return f.String()
+		}
+	}
+	return fmt.Sprint(r)
+}
+
+// collectorTraits returns whether s makes outbound network calls or changes
+// the state of the system, and how it copes without administrator
+// privileges. A group has the traits of all its sections. ok is false for
+// the types it doesn't know, every runner and section type needs a case.
+func collectorTraits(s interface{}) (network, mutates bool, admin adminNeed, ok bool) {
+	switch s := s.(type) {
+	case cmd:
+		return s.network, s.mutates, s.admin, true
+	case group:
+		return sectionTraits(s.sections)
+	case installed:
+		return collectorTraits(s.runner)
+	case carriedForward:
+		return collectorTraits(s.runner)
+	case registryExport:
+		return collectorTraits(s.export)
+	case scanOnly:
+		return collectorTraits(s.command)
+	case cappedSection:
+		return collectorTraits(s.section)
+	case noRecoveryKeys:
+		return collectorTraits(s.section)
+	case ioLatency:
+		return collectorTraits(s.command())
+	case domainDiagnostics:
+		return sectionTraits(domainChecks(""))
+	case windowsFeatures:
+		// Which command runs depends on the SKU, the client one needs
+		// privileges.
+		return sectionTraits([]section{serverFeatures, clientFeatures})
+	case processDump:
+		return false, false, adminRequired, true
+	case pktmonCapture:
+		return true, true, adminRequired, true
+	case pacScript, wpadLookup, pmtuSweep, nameResolution, metadataScripts, osConfigInventory:
+		return true, false, adminNone, true
+	case wmiQuery, regQuery, eventChannel, memoryTrend, osVersion, spaceUsage, iisConfigCopy,
+		cpuClockSpeed, bugcheckHistory, rdpRedirection, routeTable, schannelProtocols, tcpConnections, dumpConfig:
+		return false, false, adminNone, true
+	}
+	return false, false, adminNone, false
+}
+
+// sectionTraits returns the traits of sections together, see
+// collectorTraits.
+func sectionTraits(sections []section) (network, mutates bool, admin adminNeed, ok bool) {
+	ok = true
+	for _, section := range sections {
+		n, m, a, known := collectorTraits(section)
+		network, mutates, ok = network || n, mutates || m, ok && known
+		if a > admin {
+			admin = a
+		}
+	}
+	return network, mutates, admin, ok
+}
+
+// collectorTimeout returns the timeout of an attempt of s, named name, 0 for
+// the collectors without one. A group has its -collector-timeout, if any, or
+// the longest of its sections.
+func collectorTimeout(s interface{}, name string) time.Duration {
+	switch s := s.(type) {
+	case cmd:
+		return resolvePolicy(collectorPolicy(name, s.policy), cmdDefaultPolicy).Timeout
+	case wmiQuery:
+		return resolvePolicy(collectorPolicy(name, s.policy), wmiDefaultPolicy).Timeout
+	case group:
+		if d, ok := opts.collectorTimeouts[name]; ok {
+			return d
+		}
+		var longest time.Duration
+		for _, section := range s.sections {
+			if d := collectorTimeout(section, ""); d > longest {
+				longest = d
+			}
+		}
+		return longest
+	case installed:
+		return collectorTimeout(s.runner, name)
+	case carriedForward:
+		return collectorTimeout(s.runner, name)
+	case registryExport:
+		return collectorTimeout(s.export, name)
+	case scanOnly:
+		return collectorTimeout(s.command, name)
+	case cappedSection:
+		return collectorTimeout(s.section, name)
+	case noRecoveryKeys:
+		return collectorTimeout(s.section, name)
+	case ioLatency:
+		return collectorTimeout(s.command(), name)
+	case domainDiagnostics:
+		return collectorTimeout(group{sections: domainChecks("")}, name)
+	case windowsFeatures:
+		return collectorTimeout(clientFeatures, name)
+	}
+	return 0
+}
+
+// checkCollectorNames returns an error for the names given to
+// -collector-timeout or -output-format that no registered collector has,
+// most likely misspelled, and for the -output-format of a collector that
+// can't write the format.
+func checkCollectorNames() error {
+	if len(opts.collectorTimeouts) == 0 && len(opts.outputFormats) == 0 {
+		return nil
+	}
+	infos, err := collectorInfos()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]collectorInfo)
+	for _, i := range infos {
+		byName[i.Name] = i
+	}
+	var unmatched []string
+	for name := range opts.collectorTimeouts {
+		if _, ok := byName[name]; !ok {
+			unmatched = append(unmatched, name)
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return fmt.Errorf("-collector-timeout %s, no collector has that name, it names the output file of a collector such as systeminfo.txt, see list-collectors", strings.Join(unmatched, ", "))
+	}
+	for name, format := range opts.outputFormats {
+		if i, ok := byName[name]; !ok || (len(i.Formats) == 0 && format != outputText) {
+			unmatched = append(unmatched, name)
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return fmt.Errorf("-output-format %s, no PowerShell collector able to write CSV or JSON has that name, it names the output file of a collector such as vms.txt, see list-collectors", strings.Join(unmatched, ", "))
+	}
+	return nil
+}
+
+// listCollectors writes the metadata of the registered collectors to w, as
+// JSON or as a table.
+func listCollectors(w io.Writer, asJSON bool) error {
+	infos, err := collectorInfos()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tNAME\tNETWORK\tMUTATES\tADMIN\tTIMEOUT\tFLAG")
+	for _, i := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%s\t%s\t%s\n", i.Folder, i.Name, i.Network, i.Mutates, i.Admin, i.Timeout, i.Flag)
+	}
+	return tw.Flush()
+}
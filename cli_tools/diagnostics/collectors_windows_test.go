@@ -0,0 +1,271 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListCollectorsJSON(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	plugins := tmpFolder
+	if err := ioutil.WriteFile(filepath.Join(plugins, "check.ps1"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts.pluginDir = plugins
+	plugin, _ := pluginCommand(filepath.Join(plugins, "check.ps1"))
+	opts.collectorTimeouts = timeoutMap{"tracert_gstatic.txt": 20 * time.Minute}
+
+	var buf bytes.Buffer
+	if err := listCollectors(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	var infos []collectorInfo
+	if err := json.Unmarshal(buf.Bytes(), &infos); err != nil {
+		t.Fatalf("list-collectors -json is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("listing the collectors ran %v", fake.calls)
+	}
+
+	byPath := make(map[string]collectorInfo)
+	for _, i := range infos {
+		if i.Name == "" || i.Folder == "" || strings.ContainsAny(i.Name, "{} ") {
+			t.Errorf("collector without a proper name or folder: %+v", i)
+		}
+		if i.Admin != "none" && i.Admin != "limited" && i.Admin != "required" {
+			t.Errorf("%s/%s: admin = %q", i.Folder, i.Name, i.Admin)
+		}
+		path := i.Folder + "/" + i.Name
+		// The trace is started and stopped into the same file.
+		if _, ok := byPath[path]; ok && path != "Trace/trace.etl" {
+			t.Errorf("%s is listed twice", path)
+		}
+		byPath[path] = i
+	}
+
+	for path, want := range map[string]collectorInfo{
+		"System/systeminfo.txt":                    {Command: `C:\Windows\System32\systeminfo.exe`, Admin: "none", Timeout: "10m0s"},
+		"System/bcdedit.txt":                       {Command: `C:\Windows\System32\bcdedit.exe`, Admin: "required", Timeout: "10m0s"},
+		"System/users.txt":                         {Admin: "none", Timeout: "5m0s"},
+		"System/time_sync.txt":                     {Network: true, Admin: "none", Timeout: "10m0s"},
+		"System/domain.txt":                        {Network: true, Admin: "none", Timeout: "10m0s"},
+		"System/features.txt":                      {Admin: "required", Timeout: "10m0s", Formats: []string{"text", "csv", "json"}},
+		"Network/tracert_gstatic.txt":              {Command: `C:\Windows\System32\tracert.exe www.gstatic.com`, Network: true, Admin: "none", Timeout: "20m0s"},
+		"Network/netstat.txt":                      {Command: `C:\Windows\System32\netstat.exe -anb`, Admin: "limited", Timeout: "10m0s"},
+		"Network/pktmon.etl":                       {Network: true, Mutates: true, Admin: "required"},
+		"Disk/volume_health.txt":                   {Mutates: true, Admin: "required", Timeout: "10m0s"},
+		"GCE/startup_scripts/metadata_scripts.txt": {Network: true, Admin: "none"},
+		"Trace/boottrace_register.txt":             {Command: `C:\Windows\System32\wpr.exe -boottrace -addboot GeneralProfile -filemode`, Mutates: true, Admin: "none", Timeout: "10m0s", Flag: "-boot-trace"},
+		"HyperV/vms.txt":                           {Command: powershell + ` -NoProfile -NonInteractive -Command "Get-VM | Format-List *"`, Admin: "required", Timeout: "10m0s", Formats: []string{"text", "csv", "json"}},
+		"Plugins/check.txt":                        {Command: describeRunner(plugin), Admin: "none", Timeout: "10m0s", Flag: "-plugin-dir"},
+	} {
+		got, ok := byPath[path]
+		if !ok {
+			t.Errorf("%s is not listed", path)
+			continue
+		}
+		want.Name, want.Folder = filepath.Base(path), filepath.ToSlash(filepath.Dir(path))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %+v, want %+v", path, got, want)
+		}
+	}
+	if i := byPath["Trace/trace.etl"]; i.Flag != "-trace" || !i.Mutates {
+		t.Errorf("Trace/trace.etl = %+v, want it mutating with -trace", i)
+	}
+}
+
+// allCollectors turns on the flags adding collectors and returns them all.
+func allCollectors(t *testing.T) []folderCollectors {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(tmpFolder, "check.ps1"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts.pluginDir = tmpFolder
+	opts.resolveNames = stringList{"metadata.google.internal"}
+	opts.eventChannels = stringList{"Microsoft-Windows-DNS-Client/Operational"}
+	opts.dumpProcess = "GCEAgent"
+	opts.registryExports = stringList{`HKLM\SOFTWARE\Google`}
+	opts.pktmonDuration = time.Millisecond
+
+	folders, err := registeredCollectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return folders
+}
+
+func TestCollectorTraitsKnown(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	folders := allCollectors(t)
+	for _, f := range folders {
+		for _, r := range f.runners {
+			t.Run(f.folder+"/"+collectorName(r), func(t *testing.T) {
+				if _, _, _, ok := collectorTraits(r); !ok {
+					t.Errorf("collectorTraits has no case for %T, or a section of it", unwrapRunner(r))
+				}
+			})
+		}
+	}
+}
+
+// TestCollectorTraitsGating runs every collector with and without each of
+// -no-network, -read-only and administrator privileges, and checks that the
+// flag changes what the collector does exactly when its traits say so.
+func TestCollectorTraitsGating(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withFakeMetadata(t, nil)()
+	oldResolver := nameResolver
+	defer func() { nameResolver = oldResolver }()
+	nameResolver = &fakeResolver{}
+	oldClock, oldProcdump := collectionClock, procdumpPath
+	defer func() { collectionClock, procdumpPath = oldClock, oldProcdump }()
+	collectionClock = func() time.Time { return time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC) }
+	// Give the collectors what they look for before gating themselves: a
+	// domain, ProcDump, and a client SKU, where listing the features needs
+	// privileges.
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"Win32_ComputerSystem": {{{"Domain", "corp.example.com"}, {"PartOfDomain", true}}},
+	}}
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		currentVersionKey: {"InstallationType": "Client"},
+	}}
+	procdumpPath = filepath.Join(tmpFolder, "procdump.exe")
+	if err := ioutil.WriteFile(procdumpPath, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The system volume is walked, it mustn't grow with the outputs.
+	volume, err := ioutil.TempDir("", "collectors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(volume)
+	systemVolume = volume
+	folders := allCollectors(t)
+	base := opts
+
+	// effect runs r with opts set by gate, and describes what it did: whether
+	// it was skipped, the commands it ran, its output and what it left in the
+	// summary.
+	effect := func(r runner, gate func()) string {
+		opts, elevated, fake.calls, summary = base, true, nil, &runSummary{}
+		gate()
+		defer func() { elevated = true }()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		path, err := r.run(ctx)
+		_, skipped := err.(skipError)
+		var output []byte
+		if path != "" {
+			output, _ = ioutil.ReadFile(path)
+		}
+		errors, warnings, notes := summary.lines()
+		return fmt.Sprintf("skipped: %v\nran: %q\noutput: %q\nsummary: %q %q %q", skipped, fake.calls, output, errors, warnings, notes)
+	}
+	for _, f := range folders {
+		for _, r := range f.runners {
+			name := collectorName(r)
+			r := unwrapRunner(r)
+			t.Run(f.folder+"/"+name, func(t *testing.T) {
+				network, mutates, admin, _ := collectorTraits(r)
+				for _, g := range []struct {
+					flag  string
+					trait bool
+					set   func()
+				}{
+					{"-no-network", network, func() { opts.noNetwork = true }},
+					{"-read-only", mutates, func() { opts.readOnly = true }},
+					{"no administrator privileges", admin != adminNone, func() { elevated = false }},
+				} {
+					without, with := effect(r, func() {}), effect(r, g.set)
+					if gated := with != without; gated != g.trait {
+						t.Errorf("%s changes the collector = %v, its traits say %v\nwithout:\n%s\nwith:\n%s", g.flag, gated, g.trait, without, with)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCheckCollectorNames(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		timeouts timeoutMap
+		formats  formatMap
+		wantErr  string
+	}{
+		{name: "none"},
+		{name: "known", timeouts: timeoutMap{"tracert_gstatic.txt": time.Minute}, formats: formatMap{"vms.txt": outputJSON, "features.txt": outputCSV, "ipconfig.txt": outputText}},
+		{name: "misspelled timeout", timeouts: timeoutMap{"tracert_gstatic.txt": time.Minute, "tracert.txt": time.Minute, "typo.txt": time.Minute}, wantErr: "-collector-timeout tracert.txt, typo.txt, "},
+		{name: "misspelled format", formats: formatMap{"vm.txt": outputJSON}, wantErr: "-output-format vm.txt, "},
+		{name: "format not written", formats: formatMap{"systeminfo.txt": outputCSV}, wantErr: "-output-format systeminfo.txt, "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			opts.collectorTimeouts, opts.outputFormats = tt.timeouts, tt.formats
+
+			err := checkCollectorNames()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkCollectorNames() = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Errorf("checkCollectorNames() = %v, want an error starting with %q", err, tt.wantErr)
+			}
+			if len(fake.calls) != 0 {
+				t.Errorf("checking the names ran %v", fake.calls)
+			}
+		})
+	}
+}
+
+func TestListCollectorsTable(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	if err := listCollectors(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if got := strings.Fields(lines[0]); !reflect.DeepEqual(got, []string{"FOLDER", "NAME", "NETWORK", "MUTATES", "ADMIN", "TIMEOUT", "FLAG"}) {
+		t.Errorf("table header = %q", got)
+	}
+	found := false
+	for _, line := range lines[1:] {
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "Network" && fields[1] == "tracert_gstatic.txt" {
+			found = true
+			if want := []string{"Network", "tracert_gstatic.txt", "true", "false", "none", "10m0s"}; !reflect.DeepEqual(fields, want) {
+				t.Errorf("tracert_gstatic.txt row = %q, want %q", fields, want)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected a row for tracert_gstatic.txt:\n%s", buf.String())
+	}
+}
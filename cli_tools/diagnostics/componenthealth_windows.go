@@ -0,0 +1,100 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// repairFlagRe matches the DISM and sfc flags that repair or clean up the
+// system rather than only check it.
+var repairFlagRe = regexp.MustCompile(`(?i)/(RestoreHealth|StartComponentCleanup|ResetBase|RevertPendingActions|scannow|scanfile)\b`)
+
+// scanOnly runs a command that checks the health of the system, refusing to
+// run it if its args ask for a repair. Repairs replace system files and are
+// for the owner of the machine to decide on, not a diagnostics tool.
+type scanOnly struct {
+	command cmd
+}
+
+func (s scanOnly) title() string {
+	return s.command.title()
+}
+
+func (s scanOnly) writeOutput(ctx context.Context, w io.Writer) error {
+	for _, args := range []string{s.command.args, s.command.unelevatedArgs} {
+		if flag := repairFlagRe.FindString(args); flag != "" {
+			return fmt.Errorf("refusing to run %s, %s repairs the system", s.title(), flag)
+		}
+	}
+	return s.command.writeOutput(ctx, w)
+}
+
+// componentHealth checks the component store and the protected system files
+// for corruption, without repairing anything. Both checks need privileges
+// and the DISM scan can take several minutes.
+var componentHealth = group{"component_health.txt", []section{
+	scanOnly{cmd{path: dismPath, args: "/Online /Cleanup-Image /ScanHealth", admin: adminRequired, inspect: checkComponentHealth}},
+	scanOnly{cmd{path: `C:\Windows\System32\sfc.exe`, args: "/verifyonly", admin: adminRequired, inspect: checkComponentHealth}},
+}}
+
+// checkComponentHealth raises the corruption found by DISM or sfc in the
+// summary. sfc writes UTF-16 when its output is redirected, the NULs are
+// dropped before matching.
+func checkComponentHealth(output string) {
+	output = strings.Replace(output, "\x00", "", -1)
+	switch {
+	case strings.Contains(output, "The component store cannot be repaired"):
+		summary.errorf("DISM found corruption in the component store that can't be repaired, see System/component_health.txt")
+	case strings.Contains(output, "The component store is repairable"):
+		summary.warnf("DISM found corruption in the component store, see System/component_health.txt")
+	case strings.Contains(output, "found integrity violations"):
+		summary.warnf("sfc found corrupt or modified system files, see System/component_health.txt")
+	}
+}
+
+// componentStore analyzes the component store (WinSxS), which grows with
+// every update on long lived images, without cleaning it up. The analysis
+// needs privileges and can take a few minutes.
+var componentStore = group{"component_store.txt", []section{
+	scanOnly{cmd{path: dismPath, args: "/Online /Cleanup-Image /AnalyzeComponentStore", admin: adminRequired, inspect: checkComponentStore}},
+}}
+
+var (
+	cleanupRecommendedRe = regexp.MustCompile(`Component Store Cleanup Recommended\s*:\s*Yes`)
+	actualStoreSizeRe    = regexp.MustCompile(`Actual Size of Component Store\s*:\s*(.+?)\s*\r?\n`)
+	reclaimablePackageRe = regexp.MustCompile(`Number of Reclaimable Packages\s*:\s*(\d+)`)
+)
+
+// checkComponentStore raises in the summary that DISM recommends a cleanup
+// of the component store.
+func checkComponentStore(output string) {
+	output = strings.Replace(output, "\x00", "", -1)
+	if !cleanupRecommendedRe.MatchString(output) {
+		return
+	}
+	size, packages := "unknown", "unknown"
+	if m := actualStoreSizeRe.FindStringSubmatch(output); m != nil {
+		size = m[1]
+	}
+	if m := reclaimablePackageRe.FindStringSubmatch(output); m != nil {
+		packages = m[1]
+	}
+	summary.warnf("DISM recommends cleaning up the component store (WinSxS) of %s with %s reclaimable packages, see Disk/component_store.txt. DISM /Online /Cleanup-Image /StartComponentCleanup reclaims the space.", size, packages)
+}
@@ -0,0 +1,97 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGatherSystemLogsComponentHealth(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	// sfc writes UTF-16.
+	sfcOutput := strings.Join(strings.Split("Windows Resource Protection found integrity violations.\r\n", ""), "\x00")
+	fake.outputs = map[string]string{`C:\Windows\System32\sfc.exe /verifyonly`: sfcOutput}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "component_health.txt")
+	for _, want := range []string{dismPath + " /Online /Cleanup-Image /ScanHealth", `C:\Windows\System32\sfc.exe /verifyonly`} {
+		if !stringArrayIncludesString(fake.calls, want) {
+			t.Errorf("expected %s to run, got %v", want, fake.calls)
+		}
+		if !strings.Contains(got, "==== "+want+" ====") {
+			t.Errorf("expected a section for %s in component_health.txt:\n%s", want, got)
+		}
+	}
+	for _, c := range fake.calls {
+		if repairFlagRe.MatchString(c) {
+			t.Errorf("%s repairs the system, only scans may run", c)
+		}
+	}
+	if !strings.Contains(summary.String(), "sfc found corrupt or modified system files") {
+		t.Errorf("expected the sfc integrity violations in the summary:\n%s", summary.String())
+	}
+}
+
+func TestScanOnlyRefusesRepairs(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	for _, c := range []cmd{
+		{path: dismPath, args: "/Online /Cleanup-Image /RestoreHealth"},
+		{path: `C:\Windows\System32\sfc.exe`, args: "/SCANNOW"},
+		{path: dismPath, args: "/Online /Cleanup-Image /ScanHealth", unelevatedArgs: "/Online /Cleanup-Image /StartComponentCleanup"},
+	} {
+		var out bytes.Buffer
+		err := scanOnly{c}.writeOutput(context.Background(), &out)
+		if err == nil || !strings.Contains(err.Error(), "refusing to run") {
+			t.Errorf("scanOnly{%s %s} error = %v, want it refused", c.path, c.args, err)
+		}
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("expected no command to run, got %v", fake.calls)
+	}
+}
+
+func TestGatherDiskLogsComponentStore(t *testing.T) {
+	analyze := dismPath + " /Online /Cleanup-Image /AnalyzeComponentStore"
+	for _, recommended := range []string{"Yes", "No"} {
+		fake, cleanup := withFakeExecutor(t)
+		fake.outputs = map[string]string{analyze: "Component Store (WinSxS) information:\r\n\r\n" +
+			"Windows Explorer Reported Size of Component Store : 8.06 GB\r\n\r\n" +
+			"Actual Size of Component Store : 7.88 GB\r\n\r\n" +
+			"Number of Reclaimable Packages : 5\r\n" +
+			"Component Store Cleanup Recommended : " + recommended + "\r\n"}
+
+		folder := runGatherer(t, gatherDiskLogs)
+		got := readFolderFile(t, folder, "component_store.txt")
+		if !stringArrayIncludesString(fake.calls, analyze) || !strings.Contains(got, "Actual Size of Component Store : 7.88 GB") {
+			t.Errorf("expected the analysis of the component store in component_store.txt, calls %v:\n%s", fake.calls, got)
+		}
+		for _, c := range fake.calls {
+			if repairFlagRe.MatchString(c) {
+				t.Errorf("%s cleans up the system, only the analysis may run", c)
+			}
+		}
+		warned := strings.Contains(summary.String(), "DISM recommends cleaning up the component store (WinSxS) of 7.88 GB with 5 reclaimable packages")
+		if warned != (recommended == "Yes") {
+			t.Errorf("cleanup recommended %s: warned = %v, summary:\n%s", recommended, warned, summary.String())
+		}
+		cleanup()
+	}
+}
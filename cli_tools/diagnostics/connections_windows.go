@@ -0,0 +1,130 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// tcpStates names the State values of MSFT_NetTCPConnection.
+var tcpStates = map[int64]string{
+	1:   "Closed",
+	2:   "Listen",
+	3:   "SynSent",
+	4:   "SynReceived",
+	5:   "Established",
+	6:   "FinWait1",
+	7:   "FinWait2",
+	8:   "CloseWait",
+	9:   "Closing",
+	10:  "LastAck",
+	11:  "TimeWait",
+	12:  "DeleteTCB",
+	100: "Bound",
+}
+
+// tcpConnections lists the TCP connections and listeners with the process
+// that owns each, as a CSV file. netstat -anb has the same but can't be
+// parsed easily.
+type tcpConnections struct {
+	outputFileName string
+}
+
+var tcpConnectionsHeader = []string{"LocalAddress", "LocalPort", "RemoteAddress", "RemotePort", "State", "PID", "Process"}
+
+func (c tcpConnections) run(ctx context.Context) (outPath string, err error) {
+	outPath = filepath.Join(tmpFolder, c.outputFileName)
+	connections, err := wmiQuery{class: "MSFT_NetTCPConnection", namespace: `root\StandardCimv2`}.objects(ctx)
+	if err != nil {
+		return outPath, err
+	}
+	processes, err := wmiQuery{class: "Win32_Process", namespace: `root\CIMv2`}.objects(ctx)
+	if err != nil {
+		return outPath, err
+	}
+
+	f, err := createOutput(ctx, outPath)
+	if err != nil {
+		return outPath, err
+	}
+	defer func() {
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}()
+	w := csv.NewWriter(f)
+	w.UseCRLF = true
+	if err := w.Write(tcpConnectionsHeader); err != nil {
+		return outPath, err
+	}
+	return outPath, w.WriteAll(connectionRows(connections, processes))
+}
+
+// connectionRows joins the connections with the names of their processes,
+// sorted by process name, PID, then local port.
+func connectionRows(connections, processes []wmiObject) [][]string {
+	names := make(map[int64]string)
+	for _, p := range processes {
+		names[wmiInt(p, "ProcessId")] = fmt.Sprint(p.get("Name"))
+	}
+
+	type connection struct {
+		row       []string
+		pid       int64
+		localPort int64
+	}
+	var conns []connection
+	for _, c := range connections {
+		pid := wmiInt(c, "OwningProcess")
+		name, ok := names[pid]
+		if !ok {
+			// The process exited between the two queries.
+			name = "unknown"
+		}
+		state, ok := tcpStates[wmiInt(c, "State")]
+		if !ok {
+			state = fmt.Sprint(c.get("State"))
+		}
+		conns = append(conns, connection{
+			row: []string{
+				fmt.Sprint(c.get("LocalAddress")), fmt.Sprint(c.get("LocalPort")),
+				fmt.Sprint(c.get("RemoteAddress")), fmt.Sprint(c.get("RemotePort")),
+				state, strconv.FormatInt(pid, 10), name,
+			},
+			pid:       pid,
+			localPort: wmiInt(c, "LocalPort"),
+		})
+	}
+	sort.SliceStable(conns, func(i, j int) bool {
+		a, b := conns[i], conns[j]
+		if a.row[6] != b.row[6] {
+			return a.row[6] < b.row[6]
+		}
+		if a.pid != b.pid {
+			return a.pid < b.pid
+		}
+		return a.localPort < b.localPort
+	})
+	rows := make([][]string, 0, len(conns))
+	for _, c := range conns {
+		rows = append(rows, c.row)
+	}
+	return rows
+}
@@ -0,0 +1,52 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatherNetworkLogsConnections(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"MSFT_NetTCPConnection": {
+			{{"LocalAddress", "10.128.0.5"}, {"LocalPort", uint16(49721)}, {"RemoteAddress", "169.254.169.254"}, {"RemotePort", uint16(80)}, {"State", uint8(5)}, {"OwningProcess", uint32(2412)}},
+			{{"LocalAddress", "0.0.0.0"}, {"LocalPort", uint16(3389)}, {"RemoteAddress", "0.0.0.0"}, {"RemotePort", uint16(0)}, {"State", uint8(2)}, {"OwningProcess", uint32(1044)}},
+			{{"LocalAddress", "::"}, {"LocalPort", uint16(445)}, {"RemoteAddress", "::"}, {"RemotePort", uint16(0)}, {"State", uint8(2)}, {"OwningProcess", uint32(4)}},
+			{{"LocalAddress", "10.128.0.5"}, {"LocalPort", uint16(50112)}, {"RemoteAddress", "142.250.1.95"}, {"RemotePort", uint16(443)}, {"State", uint8(11)}, {"OwningProcess", uint32(9999)}},
+		},
+		"Win32_Process": {
+			{{"ProcessId", uint32(4)}, {"Name", "System"}},
+			{{"ProcessId", uint32(1044)}, {"Name", "svchost.exe"}},
+			{{"ProcessId", uint32(2412)}, {"Name", "GCEWindowsAgent.exe"}},
+		},
+	}}
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "connections.csv")
+	want := "LocalAddress,LocalPort,RemoteAddress,RemotePort,State,PID,Process\r\n" +
+		"10.128.0.5,49721,169.254.169.254,80,Established,2412,GCEWindowsAgent.exe\r\n" +
+		"::,445,::,0,Listen,4,System\r\n" +
+		"0.0.0.0,3389,0.0.0.0,0,Listen,1044,svchost.exe\r\n" +
+		"10.128.0.5,50112,142.250.1.95,443,TimeWait,9999,unknown\r\n"
+	if got != want {
+		t.Errorf("connections.csv =\n%s\nwant\n%s", got, want)
+	}
+	if strings.Contains(got, "# Command") {
+		t.Errorf("connections.csv should be a plain CSV file:\n%s", got)
+	}
+}
@@ -0,0 +1,60 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// The container runtime of Windows Kubernetes nodes, any of them can be
+// missing on other machines.
+var (
+	crictlPath       = `C:\etc\kubernetes\node\bin\crictl.exe`
+	ctrPath          = `C:\Program Files\containerd\ctr.exe`
+	containerdConfig = `C:\Program Files\containerd\config.toml`
+)
+
+// installed runs its runner only if the program at path exists, skipping it
+// otherwise.
+type installed struct {
+	path string
+	runner
+}
+
+func (i installed) run(ctx context.Context) (string, error) {
+	if _, err := os.Stat(i.path); err != nil {
+		return "", skipError(fmt.Sprintf("%s is not installed", i.path))
+	}
+	return i.runner.run(ctx)
+}
+
+// containerRuntimeRunners collect the pods, containers and images known to
+// the container runtime.
+func containerRuntimeRunners() []runner {
+	return []runner{
+		installed{crictlPath, group{"crictl.txt", []section{
+			cmd{path: crictlPath, args: "pods"},
+			cmd{path: crictlPath, args: "ps -a"},
+			cmd{path: crictlPath, args: "images"},
+		}}},
+		// Kubernetes keeps its containers in the k8s.io namespace.
+		installed{ctrPath, group{"ctr.txt", []section{
+			cmd{path: ctrPath, args: "-n k8s.io containers list"},
+			cmd{path: ctrPath, args: "-n k8s.io images list"},
+		}}},
+	}
+}
@@ -0,0 +1,99 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withContainerRuntime points the container runtime paths into the test's
+// temporary folder, creating the files when present is set.
+func withContainerRuntime(t *testing.T, present bool) func() {
+	oldCrictl, oldCtr, oldConfig := crictlPath, ctrPath, containerdConfig
+	crictlPath = filepath.Join(tmpFolder, "crictl.exe")
+	ctrPath = filepath.Join(tmpFolder, "ctr.exe")
+	containerdConfig = filepath.Join(tmpFolder, "config.toml")
+	if present {
+		for _, p := range []string{crictlPath, ctrPath, containerdConfig} {
+			if err := ioutil.WriteFile(p, []byte("fake"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return func() {
+		crictlPath, ctrPath, containerdConfig = oldCrictl, oldCtr, oldConfig
+	}
+}
+
+func TestContainerRuntimePresent(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withContainerRuntime(t, true)()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherKubernetesLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	for _, c := range []string{
+		crictlPath + " pods",
+		crictlPath + " ps -a",
+		crictlPath + " images",
+		ctrPath + " -n k8s.io containers list",
+		ctrPath + " -n k8s.io images list",
+	} {
+		if !stringArrayIncludesString(fake.calls, c) {
+			t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+		}
+	}
+	for _, name := range []string{"crictl.txt", "ctr.txt", "config.toml"} {
+		if !stringArrayIncludesString(folder.files, filepath.Join(tmpFolder, name)) {
+			t.Errorf("expected %s in the Kubernetes folder, got %v", name, folder.files)
+		}
+	}
+}
+
+func TestContainerRuntimeAbsent(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withContainerRuntime(t, false)()
+
+	errs := make(chan error, 10)
+	results := runAll(context.Background(), containerRuntimeRunners(), errs)
+
+	if len(fake.calls) != 0 {
+		t.Errorf("expected nothing to run without the binaries, calls: %v", fake.calls)
+	}
+	if len(errs) != 0 {
+		t.Errorf("missing binaries should not be errors, got %v", <-errs)
+	}
+	for _, r := range results {
+		if !r.Skipped {
+			t.Errorf("expected %v to be skipped, got %+v", r.Runner, r)
+		}
+	}
+
+	logs := make(chan logFolder, 1)
+	gatherKubernetesLogs(context.Background(), logs, make(chan error, 10))
+	for _, f := range (<-logs).files {
+		if strings.HasSuffix(f, "config.toml") || strings.HasSuffix(f, "crictl.txt") {
+			t.Errorf("unexpected %s without a container runtime", f)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// throttledClockRatio is the fraction of its maximum clock speed under which
+// a processor is flagged as throttled.
+const throttledClockRatio = 0.8
+
+// cpuClockSpeed lists the processors and flags those running well below
+// their maximum clock speed, a sign of power or thermal throttling.
+type cpuClockSpeed struct{}
+
+func (cpuClockSpeed) title() string {
+	return "Clock speed and load of the processors (Win32_Processor)"
+}
+
+func (cpuClockSpeed) writeOutput(ctx context.Context, w io.Writer) error {
+	processors, err := wmiQuery{class: "Win32_Processor", namespace: `root\CIMv2`}.objects(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, formatWmiObjects(processors)); err != nil {
+		return err
+	}
+	for _, p := range processors {
+		current, cErr := strconv.ParseFloat(fmt.Sprint(p.get("CurrentClockSpeed")), 64)
+		max, mErr := strconv.ParseFloat(fmt.Sprint(p.get("MaxClockSpeed")), 64)
+		if cErr != nil || mErr != nil || max <= 0 || current >= max*throttledClockRatio {
+			continue
+		}
+		msg := fmt.Sprintf("%v runs at %.0f of %.0f MHz (%.0f%%), it may be throttled", p.get("DeviceID"), current, max, current/max*100)
+		fmt.Fprintf(w, "%s\r\n", msg)
+		summary.warnf("%s", msg)
+	}
+	return nil
+}
+
+// cpu reports the processors clock speed and load, for instances that are
+// slow for no clear reason.
+var cpu = group{"cpu.txt", []section{
+	cpuClockSpeed{},
+	wmiQuery{class: "Win32_PerfFormattedData_Counters_ProcessorInformation", namespace: `root\CIMv2`},
+}}
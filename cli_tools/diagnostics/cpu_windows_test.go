@@ -0,0 +1,58 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatherSystemLogsCPU(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"Win32_Processor": {
+			{{"DeviceID", "CPU0"}, {"CurrentClockSpeed", uint32(2200)}, {"MaxClockSpeed", uint32(2200)}, {"LoadPercentage", uint16(12)}},
+			{{"DeviceID", "CPU1"}, {"CurrentClockSpeed", uint32(1100)}, {"MaxClockSpeed", uint32(2200)}, {"LoadPercentage", uint16(97)}},
+			// Unknown speeds are left alone.
+			{{"DeviceID", "CPU2"}, {"CurrentClockSpeed", nil}, {"MaxClockSpeed", uint32(2200)}},
+		},
+		"Win32_PerfFormattedData_Counters_ProcessorInformation": {
+			{{"Name", "0,0"}, {"PercentProcessorPerformance", uint64(50)}, {"PercentofMaximumFrequency", uint64(50)}},
+		},
+	}}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "cpu.txt")
+	for _, want := range []string{
+		"CurrentClockSpeed: 1100",
+		"LoadPercentage: 97",
+		"CPU1 runs at 1100 of 2200 MHz (50%), it may be throttled",
+		"PercentofMaximumFrequency: 50",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in cpu.txt:\n%s", want, got)
+		}
+	}
+	for _, id := range []string{"CPU0 runs", "CPU2 runs"} {
+		if strings.Contains(got, id) {
+			t.Errorf("%s should not be flagged:\n%s", id, got)
+		}
+	}
+	s := summary.String()
+	if !strings.Contains(s, "CPU1 runs at 1100 of 2200 MHz") || strings.Count(s, "may be throttled") != 1 {
+		t.Errorf("expected only CPU1 to be flagged in the summary:\n%s", s)
+	}
+}
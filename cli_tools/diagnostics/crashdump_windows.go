@@ -0,0 +1,178 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+)
+
+const crashControlKey = `SYSTEM\CurrentControlSet\Control\CrashControl`
+
+// werRoots hold the Windows Error Reporting reports and the user-mode dumps
+// of crashed applications and services.
+var werRoots = []string{
+	`C:\ProgramData\Microsoft\Windows\WER\ReportArchive`,
+	`C:\ProgramData\Microsoft\Windows\WER\LocalDumps`,
+}
+
+// werMaxFiles and werMaxBytes cap the WER files collected, a crash looping
+// service can leave behind thousands of reports and dumps. The newest files
+// are kept.
+var (
+	werMaxFiles       = 200
+	werMaxBytes int64 = 2 << 30
+)
+
+var bugcheckCodeRe = regexp.MustCompile(`(?i)bugcheck was: (0x[0-9a-f]+)`)
+
+// bugcheckHistory lists the bugchecks recorded by Reliability Monitor, newest
+// first. MEMORY.dmp only holds the latest crash, this shows the ones before.
+type bugcheckHistory struct{}
+
+func (bugcheckHistory) title() string {
+	return "Bugchecks recorded by Reliability Monitor (Win32_ReliabilityRecords)"
+}
+
+func (bugcheckHistory) writeOutput(ctx context.Context, w io.Writer) error {
+	records, err := wmiQuery{
+		class:     "Win32_ReliabilityRecords",
+		namespace: `root\CIMv2`,
+		where:     sinceWQL("SourceName = 'Microsoft-Windows-WER-SystemErrorReporting'", "TimeGenerated"),
+	}.objects(ctx)
+	if err != nil {
+		return err
+	}
+
+	type bugcheck struct{ date, code string }
+	var bugchecks []bugcheck
+	for _, r := range records {
+		message := fmt.Sprint(r.get("Message"))
+		code := "unknown"
+		if m := bugcheckCodeRe.FindStringSubmatch(message); m != nil {
+			code = m[1]
+		}
+		bugchecks = append(bugchecks, bugcheck{formatWmiDate(r.get("TimeGenerated")), code})
+	}
+	if len(bugchecks) == 0 {
+		_, err := io.WriteString(w, "No bugchecks recorded.\r\n")
+		return err
+	}
+	sort.Slice(bugchecks, func(i, j int) bool { return bugchecks[i].date > bugchecks[j].date })
+	for _, b := range bugchecks {
+		fmt.Fprintf(w, "%s  %s\r\n", b.date, b.code)
+	}
+	return nil
+}
+
+// formatWmiDate turns a CIM datetime (yyyymmddHHMMSS.mmmmmmsUUU) into
+// "yyyy-mm-dd HH:MM:SS", values it doesn't recognize are returned as is.
+func formatWmiDate(v interface{}) string {
+	s := fmt.Sprint(v)
+	if len(s) < 14 {
+		return s
+	}
+	return fmt.Sprintf("%s-%s-%s %s:%s:%s", s[0:4], s[4:6], s[6:8], s[8:10], s[10:12], s[12:14])
+}
+
+// newestFiles returns the newest of paths that fit in maxFiles and maxBytes,
+// and the number of files left out. Files modified before opts.since, when
+// set, are left out without being counted. A file that can't be looked at,
+// usually as WER pruned it since it was listed, is skipped with its error
+// and the caps apply to the others.
+func newestFiles(paths []string, maxFiles int, maxBytes int64) ([]string, int, []error) {
+	type file struct {
+		path string
+		info os.FileInfo
+	}
+	var files []file
+	var errs []error
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !opts.since.IsZero() && info.ModTime().Before(opts.since) {
+			continue
+		}
+		files = append(files, file{p, info})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].info.ModTime().After(files[j].info.ModTime()) })
+
+	var kept []string
+	var size int64
+	for _, f := range files {
+		if len(kept) == maxFiles || size+f.info.Size() > maxBytes {
+			continue
+		}
+		kept = append(kept, f.path)
+		size += f.info.Size()
+	}
+	return kept, len(files) - len(kept), errs
+}
+
+// cappedFiles collects the files under roots, keeping the newest that fit
+// in maxFiles and maxBytes. Roots that don't exist and files removed while
+// collecting are noted in the summary, what is a name for the files in the
+// summary.
+func cappedFiles(what string, roots []string, maxFiles int, maxBytes int64, errs chan error) []string {
+	paths, ers := collectFilePaths(roots)
+	for _, err := range ers {
+		if os.IsNotExist(err) {
+			summary.notef("Not collected, it does not exist: %v", err)
+			continue
+		}
+		errs <- err
+	}
+	kept, dropped, ers := newestFiles(paths, maxFiles, maxBytes)
+	for _, err := range ers {
+		if os.IsNotExist(err) {
+			summary.notef("Not collected, it was removed while collecting: %v", err)
+			continue
+		}
+		errs <- err
+	}
+	if dropped > 0 {
+		summary.warnf("%d older %s files were not collected, over the cap of %d files or %d bytes", dropped, what, maxFiles, maxBytes)
+	}
+	return kept
+}
+
+// crashDumpRunners are the collectors of the CrashDump folder, on top of the
+// WER reports.
+func crashDumpRunners() []runner {
+	commands := []runner{
+		group{"crash_history.txt", []section{
+			regQuery{key: crashControlKey},
+			bugcheckHistory{},
+		}},
+		dumpConfig{"dump_config.txt"},
+	}
+	if opts.dumpProcess != "" {
+		commands = append(commands, processDump{opts.dumpProcess})
+	}
+	return commands
+}
+
+func gatherCrashDumpLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	files := resultPaths(runAll(ctx, crashDumpRunners(), errs))
+	files = append(files, cappedFiles("WER", werRoots, werMaxFiles, werMaxBytes, errs)...)
+	logs <- logFolder{name: "CrashDump", files: files}
+}
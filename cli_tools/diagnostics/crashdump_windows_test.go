@@ -0,0 +1,206 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGatherCrashDumpLogsHistory(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"Win32_ReliabilityRecords": {
+			{
+				{"SourceName", "Microsoft-Windows-WER-SystemErrorReporting"},
+				{"TimeGenerated", "20190601080910.000000-000"},
+				{"Message", "The computer has rebooted from a bugcheck.  The bugcheck was: 0x0000007e (0xffffffffc0000005, 0x0, 0x0, 0x0)."},
+			},
+			{
+				{"SourceName", "Microsoft-Windows-WER-SystemErrorReporting"},
+				{"TimeGenerated", "20190901121314.000000-000"},
+				{"Message", "The computer has rebooted from a bugcheck.  The bugcheck was: 0x000000d1 (0x0, 0x2, 0x0, 0x0)."},
+			},
+		},
+	}}
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		crashControlKey: {"CrashDumpEnabled": uint64(1), "DumpFile": `%SystemRoot%\MEMORY.DMP`},
+	}}
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherCrashDumpLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	want := filepath.Join(tmpFolder, "crash_history.txt")
+	if folder.name != "CrashDump" || !stringArrayIncludesString(folder.files, want) {
+		t.Fatalf("expected %s in CrashDump folder, got %v", want, folder)
+	}
+	data, err := ioutil.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, s := range []string{
+		"CrashDumpEnabled: 1",
+		`DumpFile: %SystemRoot%\MEMORY.DMP`,
+		"2019-09-01 12:13:14  0x000000d1\r\n2019-06-01 08:09:10  0x0000007e",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("expected %q in %s:\n%s", s, want, got)
+		}
+	}
+}
+
+func TestGatherCrashDumpLogsWer(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	oldRoots, oldFiles, oldBytes := werRoots, werMaxFiles, werMaxBytes
+	defer func() { werRoots, werMaxFiles, werMaxBytes = oldRoots, oldFiles, oldBytes }()
+
+	archive := filepath.Join(tmpFolder, "WER", "ReportArchive")
+	dumps := filepath.Join(tmpFolder, "WER", "LocalDumps")
+	werRoots = []string{archive, dumps, filepath.Join(tmpFolder, "WER", "ReportQueue")}
+	werMaxFiles, werMaxBytes = 3, 250
+
+	now := time.Now()
+	files := []struct {
+		path string
+		size int
+		age  time.Duration
+	}{
+		{filepath.Join(archive, "AppCrash_app.exe_1", "Report.wer"), 50, 1 * time.Hour},
+		{filepath.Join(archive, "AppCrash_app.exe_2", "Report.wer"), 50, 2 * time.Hour},
+		{filepath.Join(dumps, "app.exe.1234.dmp"), 100, 3 * time.Hour},
+		// Over the size cap once the three above are in.
+		{filepath.Join(dumps, "app.exe.1200.dmp"), 100, 4 * time.Hour},
+		// Fits the size cap, but over the count cap.
+		{filepath.Join(archive, "AppCrash_app.exe_0", "Report.wer"), 10, 5 * time.Hour},
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f.path, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-f.age)
+		if err := os.Chtimes(f.path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherCrashDumpLogs(context.Background(), logs, errs)
+	folder := <-logs
+	close(errs)
+	for err := range errs {
+		if _, ok := err.(*os.PathError); ok && strings.Contains(err.Error(), "ReportQueue") {
+			t.Errorf("missing WER folder should be a note, got error %v", err)
+		}
+	}
+
+	var got []string
+	for _, f := range folder.files {
+		if strings.HasPrefix(f, filepath.Join(tmpFolder, "WER")) {
+			got = append(got, f)
+		}
+	}
+	want := []string{files[0].path, files[1].path, files[2].path}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WER files = %v, want %v", got, want)
+	}
+	s := summary.String()
+	for _, want := range []string{"2 older WER files were not collected", "Not collected, it does not exist"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in the summary:\n%s", want, s)
+		}
+	}
+}
+
+func TestNewestFilesSince(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	now := time.Now()
+	var paths []string
+	for i, age := range []time.Duration{time.Hour, 48 * time.Hour} {
+		p := filepath.Join(tmpFolder, fmt.Sprintf("Report%d.wer", i))
+		if err := ioutil.WriteFile(p, []byte("report"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	opts.since = now.Add(-24 * time.Hour)
+
+	got, dropped, errs := newestFiles(paths, 10, 1<<20)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if !reflect.DeepEqual(got, paths[:1]) || dropped != 0 {
+		t.Errorf("newestFiles() = %v, %d, want %v, 0", got, dropped, paths[:1])
+	}
+}
+
+func TestNewestFilesDangling(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	now := time.Now()
+	var paths []string
+	for i, age := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour} {
+		p := filepath.Join(tmpFolder, fmt.Sprintf("Report%d.wer", i))
+		if err := ioutil.WriteFile(p, []byte("report"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	// WER prunes the newest report after it was listed.
+	if err := os.Remove(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, dropped, errs := newestFiles(paths, 1, 1<<20)
+	if !reflect.DeepEqual(got, paths[1:2]) || dropped != 1 {
+		t.Errorf("newestFiles() = %v, %d, want %v, 1", got, dropped, paths[1:2])
+	}
+	if len(errs) != 1 || !os.IsNotExist(errs[0]) {
+		t.Errorf("newestFiles() errors = %v, want the removed report", errs)
+	}
+
+	errCh := make(chan error, 10)
+	if got := cappedFiles("WER", []string{tmpFolder}, 10, 1<<20, errCh); len(got) != 2 {
+		t.Errorf("cappedFiles() = %v, want the 2 reports left", got)
+	}
+	if len(errCh) != 0 {
+		t.Errorf("expected no errors, got %d", len(errCh))
+	}
+}
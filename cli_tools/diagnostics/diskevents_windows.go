@@ -0,0 +1,114 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxDiskEvents bounds the events collected from each log, a disk going bad
+// logs an event for every failed read.
+const maxDiskEvents = 500
+
+// diskEventProviders log the disk errors to the System log. Ntfs logs as
+// Microsoft-Windows-Ntfs on recent builds.
+var diskEventProviders = []string{"disk", "Ntfs", "Microsoft-Windows-Ntfs", "volmgr"}
+
+// diskCorruption are the events that mean data was lost or the file system
+// is damaged, keyed by provider and ID.
+var diskCorruption = map[diskEvent]string{
+	{"disk", 7}:   "bad block",
+	{"ntfs", 55}:  "file system structure corrupt",
+	{"ntfs", 57}:  "failed flush of the transaction log",
+	{"ntfs", 98}:  "volume needing chkdsk",
+	{"ntfs", 137}: "transactional resource manager corrupt",
+	{"ntfs", 140}: "failed flush of the transaction log",
+}
+
+type diskEvent struct {
+	provider string
+	id       int
+}
+
+// diskEvents collects the NTFS journal and the disk, Ntfs and volmgr events
+// of the System log.
+func diskEvents() group {
+	since := ""
+	if !opts.since.IsZero() {
+		since = fmt.Sprintf("; StartTime=[datetime]'%s'", opts.since.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	providers := "'" + strings.Join(diskEventProviders, "','") + "'"
+	getWinEvent := func(filter string) cmd {
+		return cmd{
+			path:    powershell,
+			args:    fmt.Sprintf(`-NoProfile -NonInteractive -Command "Get-WinEvent -FilterHashtable @{%s%s} -MaxEvents %d -ErrorAction SilentlyContinue | Format-List TimeCreated, ProviderName, Id, LevelDisplayName, Message"`, filter, since, maxDiskEvents),
+			inspect: checkDiskEvents,
+		}
+	}
+	return group{"disk_events.txt", []section{
+		getWinEvent("LogName='Microsoft-Windows-Ntfs/Operational'"),
+		getWinEvent("LogName='System'; ProviderName=" + providers),
+	}}
+}
+
+// checkDiskEvents raises the bad block and corruption events in the summary.
+// Ntfs logs 98 for healthy volumes too, it only counts when it isn't
+// informational.
+func checkDiskEvents(output string) {
+	counts := make(map[diskEvent]int)
+	var e diskEvent
+	level := ""
+	record := func() {
+		if _, ok := diskCorruption[e]; ok && !(e == diskEvent{"ntfs", 98} && level == "Information") {
+			counts[e]++
+		}
+		e, level = diskEvent{}, ""
+	}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "TimeCreated":
+			record()
+		case "ProviderName":
+			e.provider = strings.TrimPrefix(strings.ToLower(value), "microsoft-windows-")
+		case "Id":
+			e.id, _ = strconv.Atoi(value)
+		case "LevelDisplayName":
+			level = value
+		}
+	}
+	record()
+
+	var found []string
+	total := 0
+	for e, n := range counts {
+		found = append(found, fmt.Sprintf("%d %s (%s %d)", n, diskCorruption[e], e.provider, e.id))
+		total += n
+	}
+	if total == 0 {
+		return
+	}
+	sort.Strings(found)
+	summary.errorf("%d bad block or corruption events were logged, see Disk/disk_events.txt: %s", total, strings.Join(found, ", "))
+}
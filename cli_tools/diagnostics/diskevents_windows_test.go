@@ -0,0 +1,107 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleNtfsOperationalEvents = `
+
+TimeCreated      : 6/1/2019 8:00:01 AM
+ProviderName     : Microsoft-Windows-Ntfs
+Id               : 98
+LevelDisplayName : Information
+Message          : Volume C: (\Device\HarddiskVolume2) is healthy.  No action is needed.
+`
+
+const sampleSystemDiskEvents = `
+
+TimeCreated      : 6/1/2019 9:00:00 AM
+ProviderName     : disk
+Id               : 7
+LevelDisplayName : Error
+Message          : The device, \Device\Harddisk1\DR1, has a bad block.
+
+TimeCreated      : 6/1/2019 9:00:05 AM
+ProviderName     : disk
+Id               : 7
+LevelDisplayName : Error
+Message          : The device, \Device\Harddisk1\DR1, has a bad block.
+
+TimeCreated      : 6/1/2019 9:01:00 AM
+ProviderName     : Ntfs
+Id               : 55
+LevelDisplayName : Error
+Message          : A corruption was discovered in the file system structure on volume D:.
+
+TimeCreated      : 6/1/2019 9:02:00 AM
+ProviderName     : Microsoft-Windows-Ntfs
+Id               : 98
+LevelDisplayName : Error
+Message          : Volume D: (\Device\HarddiskVolume4) needs to be taken offline to perform a Full Chkdsk.
+
+TimeCreated      : 6/1/2019 9:03:00 AM
+ProviderName     : disk
+Id               : 153
+LevelDisplayName : Warning
+Message          : The IO operation at logical block address 0x1 for Disk 1 was retried.
+`
+
+func TestGatherDiskLogsDiskEvents(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	sections := diskEvents().sections
+	ntfs, system := commandCall(sections[0].(cmd)), commandCall(sections[1].(cmd))
+	fake.outputs = map[string]string{ntfs: sampleNtfsOperationalEvents, system: sampleSystemDiskEvents}
+
+	folder := runGatherer(t, gatherDiskLogs)
+	got := readFolderFile(t, folder, "disk_events.txt")
+	for _, want := range []string{
+		"LogName='Microsoft-Windows-Ntfs/Operational'",
+		"LogName='System'; ProviderName='disk','Ntfs','Microsoft-Windows-Ntfs','volmgr'",
+		"has a bad block.",
+		"is healthy.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in disk_events.txt:\n%s", want, got)
+		}
+	}
+	if !stringArrayIncludesString(fake.calls, ntfs) || !stringArrayIncludesString(fake.calls, system) {
+		t.Errorf("expected both Get-WinEvent calls, got %v", fake.calls)
+	}
+
+	errors, _, _ := summary.lines()
+	want := "4 bad block or corruption events were logged, see Disk/disk_events.txt: 1 file system structure corrupt (ntfs 55), 1 volume needing chkdsk (ntfs 98), 2 bad block (disk 7)"
+	if !stringArrayIncludesString(errors, want) {
+		t.Errorf("expected %q in the summary errors, got %v", want, errors)
+	}
+	if len(errors) != 1 {
+		t.Errorf("expected only the System events flagged, the healthy volume and the retried IO aren't corruption, got %v", errors)
+	}
+}
+
+func TestDiskEventsSince(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.since = time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, s := range diskEvents().sections {
+		if args := s.(cmd).args; !strings.Contains(args, "StartTime=[datetime]'2019-06-01T00:00:00Z'") {
+			t.Errorf("expected the -since StartTime in %s", args)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+const dismPath = `C:\Windows\System32\Dism.exe`
+
+// maxDismBytes caps the output of each DISM listing, the capabilities
+// alone run to thousands of lines on recent builds.
+const maxDismBytes = 1 << 20
+
+// dismFeatures lists the Features on Demand and the optional features with
+// their state, as DISM sees them.
+var dismFeatures = group{"dism_features.txt", []section{
+	cappedSection{cmd{path: dismPath, args: "/Online /Get-Capabilities /Format:Table", admin: adminRequired}, maxDismBytes},
+	cappedSection{cmd{path: dismPath, args: "/Online /Get-Features /Format:Table", admin: adminRequired}, maxDismBytes},
+}}
+
+// cappedSection writes at most maxBytes of the output of a section, noting
+// how much was left out after it.
+type cappedSection struct {
+	section
+	maxBytes int64
+}
+
+func (c cappedSection) writeOutput(ctx context.Context, w io.Writer) error {
+	cw := &capWriter{w: w, remaining: c.maxBytes}
+	err := c.section.writeOutput(ctx, cw)
+	if cw.dropped > 0 {
+		fmt.Fprintf(w, "\r\n[Output truncated at %d bytes, %d bytes were left out.]\r\n", c.maxBytes, cw.dropped)
+	}
+	return err
+}
+
+// capWriter passes on the first remaining bytes written to it and counts the
+// ones it drops. The writes past the cap don't fail, so the command writing
+// to it runs to the end.
+type capWriter struct {
+	w         io.Writer
+	remaining int64
+	dropped   int64
+}
+
+func (c *capWriter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	if n > c.remaining {
+		c.dropped += n - c.remaining
+		p = p[:c.remaining]
+	}
+	c.remaining -= int64(len(p))
+	if _, err := c.w.Write(p); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
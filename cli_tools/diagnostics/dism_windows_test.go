@@ -0,0 +1,53 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGatherSystemLogsDismFeatures(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	capability := "Language.Basic~~~en-US~0.0.1.0 | Installed\r\n"
+	capabilities := strings.Repeat(capability, maxDismBytes/len(capability)+10)
+	features := "Feature Name | State\r\nMicrosoft-Hyper-V | Disabled\r\n"
+	fake.outputs = map[string]string{
+		dismPath + " /Online /Get-Capabilities /Format:Table": capabilities,
+		dismPath + " /Online /Get-Features /Format:Table":     features,
+	}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "dism_features.txt")
+	for _, c := range []string{dismPath + " /Online /Get-Capabilities /Format:Table", dismPath + " /Online /Get-Features /Format:Table"} {
+		if !stringArrayIncludesString(fake.calls, c) {
+			t.Errorf("expected %s to run, got %v", c, fake.calls)
+		}
+	}
+	// The capabilities are cut at the cap, the features that follow are
+	// whole.
+	truncated := fmt.Sprintf("[Output truncated at %d bytes, %d bytes were left out.]", maxDismBytes, len(capabilities)-maxDismBytes)
+	if !strings.Contains(got, capabilities[:maxDismBytes]+"\r\n"+truncated) {
+		t.Errorf("expected the capabilities cut at %d bytes followed by %q", maxDismBytes, truncated)
+	}
+	if strings.Count(got, "[Output truncated") != 1 {
+		t.Errorf("expected only the capabilities to be truncated")
+	}
+	if !strings.HasSuffix(strings.TrimSpace(got), strings.TrimSpace(features)) {
+		t.Errorf("expected the features whole at the end of dism_features.txt, got %q", got[len(got)-200:])
+	}
+}
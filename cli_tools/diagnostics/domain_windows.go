@@ -0,0 +1,51 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// nltestPath is the domain trust and DC locator tool.
+var nltestPath = `C:\Windows\System32\nltest.exe`
+
+// domainDiagnostics checks the secure channel to the domain the instance is
+// joined to and the domain controller it finds, along with the cached
+// Kerberos tickets. It is skipped on instances that aren't domain joined.
+type domainDiagnostics struct {
+	outputFileName string
+}
+
+func (d domainDiagnostics) run(ctx context.Context) (string, error) {
+	systems, err := wmiQuery{class: "Win32_ComputerSystem", namespace: `root\CIMv2`}.objects(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(systems) == 0 || !strings.EqualFold(fmt.Sprint(systems[0].get("PartOfDomain")), "true") {
+		return "", skipError("the instance is not joined to a domain")
+	}
+	return group{d.outputFileName, domainChecks(fmt.Sprint(systems[0].get("Domain")))}.run(ctx)
+}
+
+// domainChecks are the sections of domainDiagnostics for domain.
+func domainChecks(domain string) []section {
+	return []section{
+		cmd{path: nltestPath, args: "/sc_query:" + domain, network: true},
+		cmd{path: nltestPath, args: "/dsgetdc:" + domain, network: true},
+		cmd{path: `C:\Windows\System32\klist.exe`},
+	}
+}
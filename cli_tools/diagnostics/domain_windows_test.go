@@ -0,0 +1,89 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDomainDiagnostics(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		system     wmiObject
+		noNetwork  bool
+		wantCalls  []string
+		wantInFile []string
+	}{
+		{
+			name:       "joined",
+			system:     wmiObject{{"Domain", "corp.example.com"}, {"PartOfDomain", true}},
+			wantCalls:  []string{nltestPath + " /sc_query:corp.example.com", nltestPath + " /dsgetdc:corp.example.com", `C:\Windows\System32\klist.exe`},
+			wantInFile: []string{"/sc_query:corp.example.com", "/dsgetdc:corp.example.com", "klist.exe"},
+		},
+		{
+			name:       "joined with -no-network",
+			system:     wmiObject{{"Domain", "corp.example.com"}, {"PartOfDomain", true}},
+			noNetwork:  true,
+			wantCalls:  []string{`C:\Windows\System32\klist.exe`},
+			wantInFile: []string{"Skipped: " + string(errNoNetwork), "klist.exe"},
+		},
+		{
+			name:   "workgroup",
+			system: wmiObject{{"Domain", "WORKGROUP"}, {"PartOfDomain", false}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			opts.noNetwork = tc.noNetwork
+			wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{"Win32_ComputerSystem": {tc.system}}}
+
+			path, err := domainDiagnostics{"domain.txt"}.run(context.Background())
+			if tc.wantCalls == nil {
+				if _, ok := err.(skipError); !ok {
+					t.Errorf("run() error = %v, want a skipError", err)
+				}
+				if len(fake.calls) != 0 {
+					t.Errorf("expected nothing to run, got calls %q", fake.calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.calls) != len(tc.wantCalls) {
+				t.Errorf("got calls %q, want %q", fake.calls, tc.wantCalls)
+			}
+			for _, c := range tc.wantCalls {
+				if fake.callCount(c) != 1 {
+					t.Errorf("expected %q to run once, got calls %q", c, fake.calls)
+				}
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(data)
+			for _, want := range tc.wantInFile {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected %q in domain.txt:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const memoryManagementKey = `SYSTEM\CurrentControlSet\Control\Session Manager\Memory Management`
+
+// dumpHeaderMB is the room a dump needs in the paging file on top of the
+// memory it holds.
+const dumpHeaderMB = 257
+
+// dumpTypes names the CrashDumpEnabled values.
+var dumpTypes = map[uint64]string{
+	0: "no dump",
+	1: "complete memory dump",
+	2: "kernel memory dump",
+	3: "small memory dump",
+	7: "automatic memory dump",
+}
+
+// dumpSettings are the CrashControl values that decide whether a bugcheck
+// leaves a dump behind.
+type dumpSettings struct {
+	// dumpType is CrashDumpEnabled, Windows defaults to an automatic
+	// memory dump when it isn't set.
+	dumpType uint64
+	// active is set by FilterPages on a complete dump, making it an
+	// active memory dump.
+	active bool
+	// dedicatedDumpFile is where the dump is written instead of the
+	// paging file when set.
+	dedicatedDumpFile string
+}
+
+// pagingFile is the paging file of the system drive, the only one a dump
+// can be written to.
+type pagingFile struct {
+	path string
+	// sizeMB is the current size of the paging file, 0 when there is no
+	// paging file on the system drive.
+	sizeMB int64
+	// systemManaged paging files are sized by Windows to fit the dump.
+	systemManaged bool
+}
+
+func (s dumpSettings) typeName() string {
+	if s.dumpType == 1 && s.active {
+		return "active memory dump"
+	}
+	if name, ok := dumpTypes[s.dumpType]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown dump type %d", s.dumpType)
+}
+
+// requiredMB is the least paging file the dump type needs on a machine with
+// ramMB of memory. The size of a kernel dump depends on the memory the
+// kernel uses, a third of the memory is the usual rule of thumb.
+func (s dumpSettings) requiredMB(ramMB int64) int64 {
+	switch s.dumpType {
+	case 1:
+		return ramMB + dumpHeaderMB
+	case 2, 7:
+		return ramMB/3 + dumpHeaderMB
+	case 3:
+		return 2
+	}
+	return 0
+}
+
+// dumpVerdict tells whether a bugcheck would leave a dump with settings s,
+// the paging file p and ramMB of memory, and why.
+func dumpVerdict(s dumpSettings, p pagingFile, ramMB int64) (bool, string) {
+	if _, ok := dumpTypes[s.dumpType]; !ok {
+		return false, fmt.Sprintf("CrashDumpEnabled is %d, which is not a dump type Windows knows.", s.dumpType)
+	}
+	if s.dumpType == 0 {
+		return false, "Crash dumps are disabled (CrashDumpEnabled is 0), a bugcheck leaves no dump."
+	}
+	if s.dedicatedDumpFile != "" {
+		return true, fmt.Sprintf("The %s is written to the dedicated dump file %s, the paging file size doesn't matter.", s.typeName(), s.dedicatedDumpFile)
+	}
+	if p.path == "" {
+		return false, fmt.Sprintf("There is no paging file on the system drive, the %s has nowhere to be written.", s.typeName())
+	}
+	if p.systemManaged {
+		return true, fmt.Sprintf("The paging file %s is system managed, Windows sizes it to fit the %s.", p.path, s.typeName())
+	}
+	required := s.requiredMB(ramMB)
+	if p.sizeMB < required {
+		return false, fmt.Sprintf("The paging file %s of %d MB is too small for the %s, which needs at least %d MB with %d MB of memory. Enlarge it, make it system managed or set up a dedicated dump file.", p.path, p.sizeMB, s.typeName(), required, ramMB)
+	}
+	return true, fmt.Sprintf("The paging file %s of %d MB is large enough for the %s, which needs at least %d MB with %d MB of memory.", p.path, p.sizeMB, s.typeName(), required, ramMB)
+}
+
+// readDumpSettings reads the dump settings from the CrashControl key.
+func readDumpSettings() (dumpSettings, error) {
+	s := dumpSettings{dumpType: 7}
+	v, err := reg.value(crashControlKey, "CrashDumpEnabled")
+	switch {
+	case err == nil:
+		n, ok := v.(uint64)
+		if !ok {
+			return s, fmt.Errorf("unexpected CrashDumpEnabled %v", v)
+		}
+		s.dumpType = n
+	case err != registry.ErrNotExist:
+		return s, err
+	}
+	if v, err := reg.value(crashControlKey, "FilterPages"); err == nil {
+		s.active = v == uint64(1)
+	}
+	if v, err := reg.value(crashControlKey, "DedicatedDumpFile"); err == nil {
+		s.dedicatedDumpFile = formatRegistryValue(v)
+	}
+	return s, nil
+}
+
+// systemPagingFile finds the paging file of the system drive, going by the
+// PagingFiles setting and the paging files in use. An entry without sizes,
+// with sizes of 0 or for ?: is system managed.
+func systemPagingFile(ctx context.Context) (pagingFile, error) {
+	drive := os.Getenv("SystemDrive")
+	if drive == "" {
+		drive = "C:"
+	}
+	var p pagingFile
+	v, err := reg.value(memoryManagementKey, "PagingFiles")
+	if err != nil && err != registry.ErrNotExist {
+		return p, err
+	}
+	entries, _ := v.([]string)
+	for _, e := range entries {
+		fields := strings.Fields(e)
+		if len(fields) == 0 {
+			continue
+		}
+		path := fields[0]
+		if strings.HasPrefix(path, `?:`) {
+			path = drive + path[2:]
+		} else if !strings.HasPrefix(strings.ToUpper(path), strings.ToUpper(drive)+`\`) {
+			continue
+		}
+		p.path = path
+		p.systemManaged = len(fields) < 3 || (fields[1] == "0" && fields[2] == "0")
+	}
+	if p.path == "" {
+		return p, nil
+	}
+
+	usage, err := wmiQuery{class: "Win32_PageFileUsage", namespace: `root\CIMv2`}.objects(ctx)
+	if err != nil {
+		return p, err
+	}
+	for _, u := range usage {
+		if strings.EqualFold(fmt.Sprint(u.get("Name")), p.path) {
+			p.sizeMB = wmiInt(u, "AllocatedBaseSize")
+		}
+	}
+	return p, nil
+}
+
+// dumpConfig checks that the crash dump settings and the paging file would
+// let a bugcheck leave a dump behind, many crash investigations stall for
+// lack of one. The settings, the paging file and the verdict are written
+// out, and a bad verdict is raised in the summary.
+type dumpConfig struct {
+	outputFileName string
+}
+
+func (d dumpConfig) run(ctx context.Context) (outPath string, err error) {
+	outPath = filepath.Join(tmpFolder, d.outputFileName)
+	settings, err := readDumpSettings()
+	if err != nil {
+		return outPath, fmt.Errorf("error reading the crash dump settings: %v", err)
+	}
+	p, err := systemPagingFile(ctx)
+	if err != nil {
+		return outPath, fmt.Errorf("error reading the paging file settings: %v", err)
+	}
+	systems, err := wmiQuery{class: "Win32_ComputerSystem", namespace: `root\CIMv2`}.objects(ctx)
+	if err != nil {
+		return outPath, err
+	}
+	var ramMB int64
+	if len(systems) > 0 {
+		ramMB = wmiInt(systems[0], "TotalPhysicalMemory") >> 20
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Crash dump settings (HKLM\\%s):\r\n", crashControlKey)
+	if err := (regQuery{key: crashControlKey, values: []string{"CrashDumpEnabled", "FilterPages", "DumpFile", "DedicatedDumpFile", "AutoReboot", "Overwrite"}}).writeOutput(ctx, &b); err != nil {
+		return outPath, err
+	}
+	fmt.Fprintf(&b, "\r\nDump type: %s\r\n", settings.typeName())
+	fmt.Fprintf(&b, "Physical memory: %d MB\r\n", ramMB)
+	switch {
+	case p.path == "":
+		b.WriteString("Paging file on the system drive: none\r\n")
+	case p.systemManaged:
+		fmt.Fprintf(&b, "Paging file on the system drive: %s, %d MB, system managed\r\n", p.path, p.sizeMB)
+	default:
+		fmt.Fprintf(&b, "Paging file on the system drive: %s, %d MB\r\n", p.path, p.sizeMB)
+	}
+	ok, verdict := dumpVerdict(settings, p, ramMB)
+	fmt.Fprintf(&b, "\r\nVerdict: %s\r\n", verdict)
+	if !ok {
+		summary.warnf("A bugcheck would not leave a dump: %s See CrashDump/%s.", verdict, d.outputFileName)
+	}
+
+	f, err := createOutput(ctx, outPath)
+	if err != nil {
+		return outPath, err
+	}
+	defer func() {
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}()
+	_, err = io.WriteString(f, b.String())
+	return outPath, err
+}
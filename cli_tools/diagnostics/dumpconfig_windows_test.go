@@ -0,0 +1,125 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatherCrashDumpLogsDumpConfig(t *testing.T) {
+	const sixteenGB = "17179869184"
+	for _, tc := range []struct {
+		name         string
+		crashControl map[string]interface{}
+		pagingFiles  []string
+		allocatedMB  string
+		ok           bool
+		verdict      string
+	}{
+		{
+			name:         "complete dump, small paging file",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(1), "DumpFile": `%SystemRoot%\MEMORY.DMP`, "AutoReboot": uint64(1), "Overwrite": uint64(1)},
+			pagingFiles:  []string{`C:\pagefile.sys 4096 4096`},
+			allocatedMB:  "4096",
+			verdict:      `The paging file C:\pagefile.sys of 4096 MB is too small for the complete memory dump, which needs at least 16641 MB with 16384 MB of memory.`,
+		},
+		{
+			name:         "complete dump, large paging file",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(1)},
+			pagingFiles:  []string{`C:\pagefile.sys 20480 20480`},
+			allocatedMB:  "20480",
+			ok:           true,
+			verdict:      `The paging file C:\pagefile.sys of 20480 MB is large enough for the complete memory dump`,
+		},
+		{
+			name:         "active dump, small paging file",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(1), "FilterPages": uint64(1)},
+			pagingFiles:  []string{`C:\pagefile.sys 1024 1024`},
+			allocatedMB:  "1024",
+			verdict:      "too small for the active memory dump",
+		},
+		{
+			name:         "dumps disabled",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(0)},
+			pagingFiles:  []string{`?:\pagefile.sys`},
+			allocatedMB:  "2048",
+			verdict:      "Crash dumps are disabled (CrashDumpEnabled is 0)",
+		},
+		{
+			name:         "kernel dump, system managed paging file",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(2)},
+			pagingFiles:  []string{`C:\pagefile.sys 0 0`},
+			allocatedMB:  "2048",
+			ok:           true,
+			verdict:      `The paging file C:\pagefile.sys is system managed, Windows sizes it to fit the kernel memory dump.`,
+		},
+		{
+			name:         "automatic dump by default, paging files on all drives",
+			crashControl: map[string]interface{}{},
+			pagingFiles:  []string{`?:\pagefile.sys`},
+			allocatedMB:  "2048",
+			ok:           true,
+			verdict:      "system managed, Windows sizes it to fit the automatic memory dump.",
+		},
+		{
+			name:         "kernel dump, paging file on another drive",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(2)},
+			pagingFiles:  []string{`D:\pagefile.sys 8192 8192`},
+			verdict:      "There is no paging file on the system drive, the kernel memory dump has nowhere to be written.",
+		},
+		{
+			name:         "complete dump to a dedicated dump file",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(1), "DedicatedDumpFile": `D:\dedicateddumpfile.sys`},
+			verdict:      `written to the dedicated dump file D:\dedicateddumpfile.sys`,
+			ok:           true,
+		},
+		{
+			name:         "small dump, small paging file",
+			crashControl: map[string]interface{}{"CrashDumpEnabled": uint64(3)},
+			pagingFiles:  []string{`C:\pagefile.sys 16 16`},
+			allocatedMB:  "16",
+			ok:           true,
+			verdict:      "large enough for the small memory dump, which needs at least 2 MB",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			keys := map[string]map[string]interface{}{crashControlKey: tc.crashControl}
+			if tc.pagingFiles != nil {
+				keys[memoryManagementKey] = map[string]interface{}{"PagingFiles": tc.pagingFiles}
+			}
+			reg = &fakeRegistry{keys: keys}
+			objects := map[string][]wmiObject{"Win32_ComputerSystem": {{{"TotalPhysicalMemory", sixteenGB}}}}
+			if tc.allocatedMB != "" {
+				objects["Win32_PageFileUsage"] = []wmiObject{{{"Name", `C:\pagefile.sys`}, {"AllocatedBaseSize", tc.allocatedMB}}}
+			}
+			wmiSrc = &fakeWmiSource{objects: objects}
+
+			folder := runGatherer(t, gatherCrashDumpLogs)
+			got := readFolderFile(t, folder, "dump_config.txt")
+			if !strings.Contains(got, "Verdict: ") || !strings.Contains(got, tc.verdict) {
+				t.Errorf("expected the verdict %q in dump_config.txt:\n%s", tc.verdict, got)
+			}
+			if !strings.Contains(got, "Physical memory: 16384 MB") {
+				t.Errorf("expected the physical memory in dump_config.txt:\n%s", got)
+			}
+			if warned := strings.Contains(summary.String(), "A bugcheck would not leave a dump"); warned == tc.ok {
+				t.Errorf("warned = %v, want %v:\n%s", warned, !tc.ok, summary.String())
+			}
+		})
+	}
+}
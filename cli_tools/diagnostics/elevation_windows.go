@@ -0,0 +1,40 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// isElevated reports whether the process token is a member of the built in
+// Administrators group. With UAC the group is only enabled in the token of an
+// elevated process.
+func isElevated() (bool, error) {
+	var adminGroup *windows.SID
+	err := windows.AllocateAndInitializeSid(
+		&windows.SECURITY_NT_AUTHORITY,
+		2,
+		windows.SECURITY_BUILTIN_DOMAIN_RID,
+		windows.DOMAIN_ALIAS_RID_ADMINS,
+		0, 0, 0, 0, 0, 0,
+		&adminGroup)
+	if err != nil {
+		return false, err
+	}
+	defer windows.FreeSid(adminGroup)
+
+	var t windows.Token // A nil Token will use the current thread's primary token.
+	return t.IsMember(adminGroup)
+}
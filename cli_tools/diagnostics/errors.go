@@ -0,0 +1,105 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+const errorsFileName = "errors.json"
+
+// Kinds of errors in errors.json.
+const (
+	kindTimeout    = "timeout"
+	kindCancelled  = "cancelled"
+	kindExitStatus = "exit_status"
+	kindNotFound   = "not_found"
+	kindPermission = "permission"
+	kindOther      = "other"
+)
+
+// runError is the error of a runner, it keeps the command that failed along
+// with the error so the failure can be reported against it.
+type runError struct {
+	command string
+	err     error
+}
+
+func (e runError) Error() string {
+	return e.err.Error()
+}
+
+func (e runError) Unwrap() error {
+	return e.err
+}
+
+// errorKind sorts err into one of the kinds of errors.json, going through
+// the errors err wraps.
+func errorKind(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return kindTimeout
+	case errors.Is(err, context.Canceled):
+		return kindCancelled
+	case errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist):
+		return kindNotFound
+	case errors.Is(err, os.ErrPermission):
+		return kindPermission
+	case errors.As(err, &exitErr):
+		return kindExitStatus
+	}
+	return kindOther
+}
+
+// errorRecord is one entry of errors.json.
+type errorRecord struct {
+	Folder string `json:"folder"`
+	// Command is empty for errors that aren't from a runner, such as
+	// failing to walk a directory.
+	Command string `json:"command"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// errorRecords lists the errors of folders.
+func errorRecords(folders []logFolder) []errorRecord {
+	records := []errorRecord{}
+	for _, folder := range folders {
+		for _, err := range folder.errs {
+			r := errorRecord{Folder: folder.name, Kind: errorKind(err), Message: reproduciblePaths(err.Error())}
+			if e, ok := err.(runError); ok {
+				r.Command = reproduciblePaths(e.command)
+			}
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// writeErrorsJSON writes the errors of folders to path as a JSON array, for
+// tools that wrap this one.
+func writeErrorsJSON(path string, folders []logFolder) error {
+	data, err := json.MarshalIndent(errorRecords(folders), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
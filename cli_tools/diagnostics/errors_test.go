@@ -0,0 +1,89 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteErrorsJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	folders := []logFolder{
+		{name: "System", errs: []error{
+			runError{command: "systeminfo.exe", err: context.DeadlineExceeded},
+			runError{command: "msinfo32.exe /report msinfo32.txt", err: &exec.Error{Name: "msinfo32.exe", Err: exec.ErrNotFound}},
+		}},
+		{name: "Network"},
+		{name: "Kubernetes", errs: []error{
+			&os.PathError{Op: "lstat", Path: `C:\etc\kubernetes\logs`, Err: os.ErrNotExist},
+			errors.New("something else"),
+		}},
+	}
+	path := filepath.Join(dir, errorsFileName)
+	if err := writeErrorsJSON(path, folders); err != nil {
+		t.Fatalf("writeErrorsJSON() error = %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]string
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("errors.json is not an array of objects: %v\n%s", err, data)
+	}
+	want := []map[string]string{
+		{"folder": "System", "command": "systeminfo.exe", "kind": kindTimeout, "message": context.DeadlineExceeded.Error()},
+		{"folder": "System", "command": "msinfo32.exe /report msinfo32.txt", "kind": kindNotFound, "message": (&exec.Error{Name: "msinfo32.exe", Err: exec.ErrNotFound}).Error()},
+		{"folder": "Kubernetes", "command": "", "kind": kindNotFound, "message": `lstat C:\etc\kubernetes\logs: file does not exist`},
+		{"folder": "Kubernetes", "command": "", "kind": kindOther, "message": "something else"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors.json = %v, want %v", got, want)
+	}
+}
+
+func TestWriteErrorsJSONEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, errorsFileName)
+	if err := writeErrorsJSON(path, []logFolder{{name: "System"}}); err != nil {
+		t.Fatalf("writeErrorsJSON() error = %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[]" {
+		t.Errorf("errors.json = %s, want an empty array", data)
+	}
+}
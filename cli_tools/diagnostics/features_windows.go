@@ -0,0 +1,65 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const currentVersionKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion`
+
+var (
+	// serverFeatures lists the roles and features, Get-WindowsFeature only
+	// exists on Server SKUs.
+	serverFeatures = cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-WindowsFeature | Format-Table -AutoSize"`}
+	// clientFeatures lists the optional features on client SKUs, it needs
+	// privileges.
+	clientFeatures = cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-WindowsOptionalFeature -Online | Format-Table -AutoSize"`, admin: adminRequired}
+)
+
+// isServerSKU reports whether Windows is a Server SKU, including Server Core,
+// going by the InstallationType in the registry.
+func isServerSKU() (bool, error) {
+	v, err := reg.value(currentVersionKey, "InstallationType")
+	if err != nil {
+		return false, err
+	}
+	installationType, ok := v.(string)
+	if !ok {
+		return false, fmt.Errorf("unexpected InstallationType %v", v)
+	}
+	return strings.HasPrefix(installationType, "Server"), nil
+}
+
+// windowsFeatures lists the installed roles and features with the command
+// matching the SKU.
+type windowsFeatures struct {
+	outputFileName string
+}
+
+func (f windowsFeatures) run(ctx context.Context) (string, error) {
+	server, err := isServerSKU()
+	if err != nil {
+		return "", fmt.Errorf("error detecting the Windows SKU: %v", err)
+	}
+	command := clientFeatures
+	if server {
+		command = serverFeatures
+	}
+	command.outputFileName = f.outputFileName
+	return command.run(ctx)
+}
@@ -0,0 +1,72 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWindowsFeatures(t *testing.T) {
+	serverCall := `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe -NoProfile -NonInteractive -Command Get-WindowsFeature | Format-Table -AutoSize`
+	clientCall := `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe -NoProfile -NonInteractive -Command Get-WindowsOptionalFeature -Online | Format-Table -AutoSize`
+	tests := []struct {
+		installationType string
+		want             string
+		notWant          string
+	}{
+		{"Server", serverCall, clientCall},
+		{"Server Core", serverCall, clientCall},
+		{"Client", clientCall, serverCall},
+	}
+	for _, tt := range tests {
+		t.Run(tt.installationType, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+				currentVersionKey: {"InstallationType": tt.installationType},
+			}}
+
+			path, err := windowsFeatures{"features.txt"}.run(context.Background())
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if path != filepath.Join(tmpFolder, "features.txt") {
+				t.Errorf("run() path = %q, want features.txt", path)
+			}
+			if !stringArrayIncludesString(fake.calls, tt.want) {
+				t.Errorf("expected %q to run, calls: %v", tt.want, fake.calls)
+			}
+			if stringArrayIncludesString(fake.calls, tt.notWant) {
+				t.Errorf("expected %q not to run on %s", tt.notWant, tt.installationType)
+			}
+		})
+	}
+}
+
+func TestWindowsFeaturesUnknownSKU(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	_, err := windowsFeatures{"features.txt"}.run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "SKU") {
+		t.Errorf("expected an error detecting the SKU, got %v", err)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("expected no command to run, calls: %v", fake.calls)
+	}
+}
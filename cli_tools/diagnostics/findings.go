@@ -0,0 +1,295 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	findingsJSONFileName = "findings.json"
+	findingsTextFileName = "findings.txt"
+)
+
+// Severities of findings, most severe first.
+const (
+	severityCritical = "critical"
+	severityWarning  = "warning"
+	severityInfo     = "info"
+)
+
+var severityRank = map[string]int{severityCritical: 0, severityWarning: 1, severityInfo: 2}
+
+// Finding is a problem a rule found in the collected files, with what to do
+// about it.
+type Finding struct {
+	Rule        string `json:"rule"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation"`
+	// File is the file of the bundle the finding is based on.
+	File string `json:"file"`
+}
+
+// findingRule checks the collected files for one kind of problem.
+type findingRule struct {
+	name  string
+	check func(c collection) []Finding
+}
+
+// collection is what the rules read, the collected files by their path in
+// the bundle.
+type collection struct {
+	files map[string]string
+}
+
+func newCollection(folders []logFolder) collection {
+	c := collection{files: make(map[string]string)}
+	for _, folder := range folders {
+		for _, path := range folder.files {
+			c.files[archivePath(folder.name, path)] = path
+		}
+	}
+	return c
+}
+
+// read returns the contents of the file at name in the bundle, false when it
+// wasn't collected or can't be read.
+func (c collection) read(name string) (string, bool) {
+	path, ok := c.files[name]
+	if !ok {
+		return "", false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// runRules runs rules over c and returns their findings, most severe first.
+func runRules(rules []findingRule, c collection) []Finding {
+	findings := []Finding{}
+	for _, r := range rules {
+		for _, f := range r.check(c) {
+			f.Rule = r.name
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] < severityRank[findings[j].Severity]
+	})
+	return findings
+}
+
+// writeFindings writes findings to findings.json, for tools that wrap this
+// one, and findings.txt in dir, and returns their paths.
+func writeFindings(dir string, findings []Finding) ([]string, error) {
+	data, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	jsonPath := filepath.Join(dir, findingsJSONFileName)
+	if err := ioutil.WriteFile(jsonPath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Findings (%d):\r\n", len(findings))
+	for _, f := range findings {
+		fmt.Fprintf(&b, "\r\n[%s] %s: %s\r\n", f.Severity, f.Rule, f.Message)
+		fmt.Fprintf(&b, "  See: %s\r\n", f.File)
+		fmt.Fprintf(&b, "  Fix: %s\r\n", f.Remediation)
+	}
+	textPath := filepath.Join(dir, findingsTextFileName)
+	if err := ioutil.WriteFile(textPath, []byte(b.String()), 0644); err != nil {
+		return nil, err
+	}
+	return []string{jsonPath, textPath}, nil
+}
+
+// textRecords splits the "name: value" lines of s into records separated by
+// blank lines, the way WMI objects are written.
+func textRecords(s string) []map[string]string {
+	var records []map[string]string
+	record := make(map[string]string)
+	for _, line := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(record) > 0 {
+				records = append(records, record)
+				record = make(map[string]string)
+			}
+			continue
+		}
+		if parts := strings.SplitN(line, ": ", 2); len(parts) == 2 {
+			record[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	if len(record) > 0 {
+		records = append(records, record)
+	}
+	return records
+}
+
+// findingRules are the checks run over every bundle.
+var findingRules = []findingRule{
+	{"crash_dump_disabled", checkCrashDumpDisabled},
+	{"public_firewall_off", checkPublicFirewallOff},
+	{"disk_full", checkDiskFull},
+	{"clock_skew", checkClockSkew},
+}
+
+func checkCrashDumpDisabled(c collection) []Finding {
+	const file = "CrashDump/dump_config.txt"
+	s, ok := c.read(file)
+	if !ok || !strings.Contains(s, "\nDump type: no dump") {
+		return nil
+	}
+	return []Finding{{
+		Severity:    severityWarning,
+		Message:     "Crash dumps are disabled, a bugcheck leaves nothing to debug.",
+		Remediation: `Set CrashDumpEnabled to 7, an automatic memory dump, under HKLM\SYSTEM\CurrentControlSet\Control\CrashControl and restart.`,
+		File:        file,
+	}}
+}
+
+func checkPublicFirewallOff(c collection) []Finding {
+	const file = "Network/firewall_profiles.txt"
+	s, ok := c.read(file)
+	if !ok {
+		return nil
+	}
+	for _, r := range textRecords(s) {
+		// Enabled is a GpoBoolean, 0 is False.
+		if r["Name"] == "Public" && r["Enabled"] == "0" {
+			return []Finding{{
+				Severity:    severityWarning,
+				Message:     "The Windows Firewall is off for the Public profile.",
+				Remediation: "Turn it on with Set-NetFirewallProfile -Profile Public -Enabled True, after adding rules for the traffic the instance serves.",
+				File:        file,
+			}}
+		}
+	}
+	return nil
+}
+
+// diskFullWarning and diskFullCritical are the shares of a volume in use
+// that are reported.
+const (
+	diskFullWarning  = 0.90
+	diskFullCritical = 0.98
+)
+
+func checkDiskFull(c collection) []Finding {
+	const file = "Disk/volumes.txt"
+	s, ok := c.read(file)
+	if !ok {
+		return nil
+	}
+	var findings []Finding
+	for _, r := range textRecords(s) {
+		size, err := strconv.ParseFloat(r["Size"], 64)
+		if err != nil || size <= 0 {
+			continue
+		}
+		remaining, err := strconv.ParseFloat(r["SizeRemaining"], 64)
+		if err != nil {
+			continue
+		}
+		used := 1 - remaining/size
+		if used <= diskFullWarning {
+			continue
+		}
+		severity := severityWarning
+		if used >= diskFullCritical {
+			severity = severityCritical
+		}
+		findings = append(findings, Finding{
+			Severity:    severity,
+			Message:     fmt.Sprintf("Volume %s is %.0f%% full, %d MB of %d MB left.", volumeName(r), math.Floor(used*100), int64(remaining)>>20, int64(size)>>20),
+			Remediation: "Free space on it, Disk/space_usage.txt lists the largest directories of the system volume, or resize the disk and extend the volume.",
+			File:        file,
+		})
+	}
+	return findings
+}
+
+// volumeName names a MSFT_Volume record by its drive letter, which WMI
+// returns as a character code, or its label.
+func volumeName(r map[string]string) string {
+	if code, err := strconv.Atoi(r["DriveLetter"]); err == nil && code > 0 {
+		return string(rune(code)) + ":"
+	}
+	if l := r["DriveLetter"]; l != "" && l != "0" {
+		return l + ":"
+	}
+	if l := r["FileSystemLabel"]; l != "" {
+		return l
+	}
+	return r["Path"]
+}
+
+// clockSkewWarning is the offset from time.google.com that is reported,
+// clockSkewCritical the one over which Kerberos authentication fails.
+const (
+	clockSkewWarning  = 2 * time.Second
+	clockSkewCritical = 5 * time.Minute
+)
+
+// stripchartOffsetRe finds the offsets in the samples of w32tm /stripchart,
+// such as "12:00:01, d:+00.0312500s o:-01.2345678s".
+var stripchartOffsetRe = regexp.MustCompile(`o:([+-]?[0-9.]+)s`)
+
+func checkClockSkew(c collection) []Finding {
+	const file = "System/time_sync.txt"
+	s, ok := c.read(file)
+	if !ok {
+		return nil
+	}
+	var offsets []float64
+	for _, m := range stripchartOffsetRe.FindAllStringSubmatch(s, -1) {
+		if o, err := strconv.ParseFloat(m[1], 64); err == nil {
+			offsets = append(offsets, math.Abs(o))
+		}
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	// The median leaves out the samples thrown off by network jitter.
+	sort.Float64s(offsets)
+	skew := time.Duration(offsets[len(offsets)/2] * float64(time.Second))
+	if skew <= clockSkewWarning {
+		return nil
+	}
+	severity := severityWarning
+	if skew > clockSkewCritical {
+		severity = severityCritical
+	}
+	return []Finding{{
+		Severity:    severity,
+		Message:     fmt.Sprintf("The clock is %v off time.google.com.", skew.Round(time.Millisecond)),
+		Remediation: "Check the time source in the w32tm /query /status output of the file, on GCE it is metadata.google.internal, and resync with w32tm /resync.",
+		File:        file,
+	}}
+}
@@ -0,0 +1,171 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// crafted writes files, by their path in the bundle, and returns them as the
+// folders of a collection. The base names must differ.
+func crafted(t *testing.T, dir string, files map[string]string) []logFolder {
+	var folders []logFolder
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.Base(name))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		folders = append(folders, logFolder{name: filepath.Dir(name), files: []string{path}})
+	}
+	return folders
+}
+
+func TestFindingRules(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		check func(collection) []Finding
+		files map[string]string
+		want  []Finding
+	}{
+		{
+			"crash dumps disabled",
+			checkCrashDumpDisabled,
+			map[string]string{"CrashDump/dump_config.txt": "Crash dump settings:\r\nCrashDumpEnabled: 0\r\n\r\nDump type: no dump\r\n"},
+			[]Finding{{Severity: severityWarning, Message: "Crash dumps are disabled, a bugcheck leaves nothing to debug.", File: "CrashDump/dump_config.txt"}},
+		},
+		{
+			"crash dumps enabled",
+			checkCrashDumpDisabled,
+			map[string]string{"CrashDump/dump_config.txt": "Crash dump settings:\r\nCrashDumpEnabled: 7\r\n\r\nDump type: automatic memory dump\r\n"},
+			nil,
+		},
+		{
+			"public firewall off",
+			checkPublicFirewallOff,
+			map[string]string{"Network/firewall_profiles.txt": "Queried wmi objects [MSFT_NetFirewallProfile] from namespace root\\StandardCimv2\r\n\r\n\r\n\r\nName: Domain\r\nEnabled: 0\r\n\r\n\r\nName: Public\r\nEnabled: 0\r\n"},
+			[]Finding{{Severity: severityWarning, Message: "The Windows Firewall is off for the Public profile.", File: "Network/firewall_profiles.txt"}},
+		},
+		{
+			"public firewall on",
+			checkPublicFirewallOff,
+			map[string]string{"Network/firewall_profiles.txt": "\r\n\r\nName: Domain\r\nEnabled: 0\r\n\r\n\r\nName: Public\r\nEnabled: 1\r\n"},
+			nil,
+		},
+		{
+			"disks full",
+			checkDiskFull,
+			map[string]string{"Disk/volumes.txt": "\r\n\r\nDriveLetter: 67\r\nSize: 107374182400\r\nSizeRemaining: 1073741824\r\n" +
+				"\r\n\r\nDriveLetter: 68\r\nSize: 107374182400\r\nSizeRemaining: 8589934592\r\n" +
+				"\r\n\r\nDriveLetter: 69\r\nSize: 107374182400\r\nSizeRemaining: 53687091200\r\n" +
+				"\r\n\r\nDriveLetter: 0\r\nFileSystemLabel: System Reserved\r\nSize: 0\r\nSizeRemaining: 0\r\n"},
+			[]Finding{
+				{Severity: severityCritical, Message: "Volume C: is 99% full, 1024 MB of 102400 MB left.", File: "Disk/volumes.txt"},
+				{Severity: severityWarning, Message: "Volume D: is 92% full, 8192 MB of 102400 MB left.", File: "Disk/volumes.txt"},
+			},
+		},
+		{
+			"clock skew",
+			checkClockSkew,
+			map[string]string{"System/time_sync.txt": "Tracking time.google.com [216.239.35.0:123].\r\nCollecting 5 samples.\r\n" +
+				"12:00:01, d:+00.0312500s o:-03.2345678s  [*  |   ]\r\n" +
+				"12:00:03, d:+00.0312500s o:-03.2000000s  [*  |   ]\r\n" +
+				"12:00:05, d:+00.0312500s o:+40.0000000s  [   |  *]\r\n"},
+			[]Finding{{Severity: severityWarning, Message: "The clock is 3.235s off time.google.com.", File: "System/time_sync.txt"}},
+		},
+		{
+			"clock in sync",
+			checkClockSkew,
+			map[string]string{"System/time_sync.txt": "12:00:01, d:+00.0312500s o:-00.0045678s  [*]\r\n"},
+			nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "findings")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			got := tt.check(newCollection(crafted(t, dir, tt.files)))
+			for i := range got {
+				if got[i].Remediation == "" {
+					t.Errorf("finding %q has no remediation", got[i].Message)
+				}
+				got[i].Remediation = ""
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunRulesAndWriteFindings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "findings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rules := []findingRule{
+		{"warns", func(collection) []Finding {
+			return []Finding{{Severity: severityWarning, Message: "a warning", Remediation: "fix it", File: "System/a.txt"}}
+		}},
+		{"nothing", func(collection) []Finding { return nil }},
+		{"critical", func(collection) []Finding {
+			return []Finding{{Severity: severityCritical, Message: "a critical problem", Remediation: "fix it now", File: "Disk/b.txt"}}
+		}},
+	}
+
+	findings := runRules(rules, newCollection(nil))
+	if len(findings) != 2 || findings[0].Rule != "critical" || findings[1].Rule != "warns" {
+		t.Fatalf("runRules = %+v, want the critical finding first, then the warning", findings)
+	}
+	files, err := writeFindings(dir, findings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Finding
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, findings) {
+		t.Errorf("%s holds %s, %v, want %+v", findingsJSONFileName, data, err, findings)
+	}
+	text, err := ioutil.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Findings (2):", "[critical] critical: a critical problem", "  See: Disk/b.txt", "  Fix: fix it now"} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("expected %q in %s:\n%s", want, findingsTextFileName, text)
+		}
+	}
+
+	// No findings is an empty array, not null.
+	files, err = writeFindings(dir, runRules(nil, newCollection(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(files[0]); string(data) != "[]" {
+		t.Errorf("%s without findings = %s, want []", findingsJSONFileName, data)
+	}
+}
@@ -0,0 +1,136 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// followedLog captures what is appended to a log file, from the offset
+// recorded at the start of an iteration to the end of the file at the end
+// of it, rather than the whole file each time.
+type followedLog struct {
+	path   string
+	offset int64
+	// iteration counts the deltas captured, it numbers their files.
+	iteration int
+}
+
+// followLog starts following path from its current end. A file that doesn't
+// exist yet is followed from its start once it is created.
+func followLog(path string) (*followedLog, error) {
+	l := &followedLog{path: path}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.offset = info.Size()
+	return l, nil
+}
+
+// captureDelta copies the bytes appended since the last capture into dir
+// and starts the next iteration from the new end. It returns an empty path
+// when nothing was appended. A file shorter than the offset was truncated
+// or rotated, it is captured from its start.
+func (l *followedLog) captureDelta(dir string) (string, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	end := info.Size()
+	if end < l.offset {
+		summary.notef("%s was truncated or rotated during the collection, its delta %d is captured from the start of the new file", l.path, l.iteration+1)
+		l.offset = 0
+	}
+	if end == l.offset {
+		return "", nil
+	}
+	if _, err := f.Seek(l.offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	l.iteration++
+	outPath := filepath.Join(dir, fmt.Sprintf("%s.%d.delta", safeFileName(l.path), l.iteration))
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	// Only copy up to the end seen now, what is appended meanwhile is in
+	// the next delta.
+	n, err := io.Copy(out, io.LimitReader(f, end-l.offset))
+	if cErr := out.Close(); err == nil {
+		err = cErr
+	}
+	l.offset += n
+	return outPath, err
+}
+
+// followLogs follows paths while the collection runs, capturing a delta of
+// each every interval, or once at the end when interval is 0. The deltas go
+// into dir. It returns once ctx is done and the last deltas are captured.
+func followLogs(ctx context.Context, paths []string, dir string, interval time.Duration) logFolder {
+	folder := logFolder{name: "Follow"}
+	var logs []*followedLog
+	for _, path := range paths {
+		l, err := followLog(path)
+		if err != nil {
+			folder.errs = append(folder.errs, err)
+			continue
+		}
+		logs = append(logs, l)
+	}
+	capture := func() {
+		for _, l := range logs {
+			path, err := l.captureDelta(dir)
+			if err != nil {
+				folder.errs = append(folder.errs, fmt.Errorf("capturing the delta of %s: %v", l.path, err))
+			}
+			if path != "" {
+				folder.files = append(folder.files, path)
+			}
+		}
+	}
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			capture()
+		case <-ctx.Done():
+			capture()
+			return folder
+		}
+	}
+}
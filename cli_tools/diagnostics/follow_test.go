@@ -0,0 +1,157 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendToFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readDelta(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFollowedLogDeltas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldSummary := summary
+	summary = &runSummary{}
+	defer func() { summary = oldSummary }()
+
+	logPath := filepath.Join(dir, "app.log")
+	appendToFile(t, logPath, "before the collection\n")
+	l, err := followLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each iteration only gets what was appended during it.
+	appendToFile(t, logPath, "iteration 1\n")
+	first, err := l.captureDelta(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, logPath, "iteration 2, line 1\niteration 2, line 2\n")
+	second, err := l.captureDelta(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readDelta(t, first); got != "iteration 1\n" {
+		t.Errorf("first delta is %q, want only what was appended during the first iteration", got)
+	}
+	if got := readDelta(t, second); got != "iteration 2, line 1\niteration 2, line 2\n" {
+		t.Errorf("second delta is %q, want only what was appended during the second iteration", got)
+	}
+	if want := safeFileName(logPath) + ".2.delta"; filepath.Base(second) != want {
+		t.Errorf("second delta is named %s, want %s", filepath.Base(second), want)
+	}
+
+	// Nothing appended, nothing captured.
+	if path, err := l.captureDelta(dir); err != nil || path != "" {
+		t.Errorf("captureDelta of an unchanged file = %q, %v, want no delta", path, err)
+	}
+
+	// A rotated file is captured from its start.
+	if err := ioutil.WriteFile(logPath, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := l.captureDelta(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readDelta(t, rotated); got != "new\n" {
+		t.Errorf("delta after the rotation is %q, want the new file", got)
+	}
+	if _, _, notes := summary.lines(); len(notes) != 1 || !strings.Contains(notes[0], "was truncated or rotated") {
+		t.Errorf("expected the rotation noted in the summary, got %v", notes)
+	}
+}
+
+func TestFollowedLogCreatedLater(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "new.log")
+	l, err := followLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path, err := l.captureDelta(dir); err != nil || path != "" {
+		t.Errorf("captureDelta of a missing file = %q, %v, want no delta", path, err)
+	}
+	appendToFile(t, logPath, "created\n")
+	path, err := l.captureDelta(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readDelta(t, path); got != "created\n" {
+		t.Errorf("delta of a file created during the collection is %q, want all of it", got)
+	}
+}
+
+func TestFollowLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "app.log")
+	appendToFile(t, logPath, "before\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan logFolder)
+	go func() { done <- followLogs(ctx, []string{logPath}, dir, 0) }()
+	time.Sleep(50 * time.Millisecond)
+	appendToFile(t, logPath, "during\n")
+	cancel()
+	folder := <-done
+
+	if folder.name != "Follow" || len(folder.files) != 1 || len(folder.errs) != 0 {
+		t.Fatalf("followLogs = %+v, want a single delta in Follow", folder)
+	}
+	if got := readDelta(t, folder.files[0]); got != "during\n" {
+		t.Errorf("delta is %q, want what was appended during the collection", got)
+	}
+}
@@ -0,0 +1,31 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+const (
+	fontsKey    = `SOFTWARE\Microsoft\Windows NT\CurrentVersion\Fonts`
+	codePageKey = `SYSTEM\CurrentControlSet\Control\Nls\CodePage`
+	languageKey = `SYSTEM\CurrentControlSet\Control\Nls\Language`
+)
+
+// fontsLocale lists the installed fonts, the system code pages and the
+// languages, for applications that render text wrong or fail to start for
+// lack of a font or code page.
+var fontsLocale = group{"fonts_locale.txt", []section{
+	regQuery{key: fontsKey},
+	// The ANSI, OEM and Mac code pages follow the system locale.
+	regQuery{key: codePageKey, values: []string{"ACP", "OEMCP", "MACCP"}},
+	regQuery{key: languageKey, values: []string{"Default", "InstallLanguage"}},
+}}
@@ -0,0 +1,49 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatherSystemLogsFontsLocale(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		fontsKey: {
+			"Arial (TrueType)": "arial.ttf",
+			"MS Gothic & MS UI Gothic & MS PGothic (TrueType)": "msgothic.ttc",
+		},
+		codePageKey: {"ACP": "1252", "OEMCP": "437", "MACCP": "10000"},
+		languageKey: {"Default": "0409", "InstallLanguage": "0409"},
+	}}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "fonts_locale.txt")
+	for _, want := range []string{
+		`==== Read registry values from HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion\Fonts ====`,
+		"Arial (TrueType): arial.ttf",
+		"MS Gothic & MS UI Gothic & MS PGothic (TrueType): msgothic.ttc",
+		"ACP: 1252",
+		"OEMCP: 437",
+		"MACCP: 10000",
+		"InstallLanguage: 0409",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in fonts_locale.txt:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The formats of -output-format.
+const (
+	outputText = "text"
+	outputCSV  = "csv"
+	outputJSON = "json"
+)
+
+// formatMap holds the -output-format choices, keyed by the output file name
+// of the collector.
+type formatMap map[string]string
+
+func (m *formatMap) String() string {
+	var pairs []string
+	for name, f := range *m {
+		pairs = append(pairs, name+"="+f)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *formatMap) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not name=format, e.g. vms.txt=json", value)
+	}
+	format := strings.ToLower(value[i+1:])
+	switch format {
+	case outputText, outputCSV, outputJSON:
+	default:
+		return fmt.Errorf("format of %s must be %s, %s or %s, got %q", value[:i], outputText, outputCSV, outputJSON, value[i+1:])
+	}
+	if *m == nil {
+		*m = make(formatMap)
+	}
+	(*m)[value[:i]] = format
+	return nil
+}
+
+// formattedFileName is the name of the output file outputFileName in
+// format, its extension follows the format.
+func formattedFileName(outputFileName, format string) string {
+	if format == outputText {
+		return outputFileName
+	}
+	return strings.TrimSuffix(outputFileName, filepath.Ext(outputFileName)) + "." + format
+}
+
+// appliedFormats records the names of -output-format that matched a
+// collector able to write the format, see unmatchedFormats.
+var appliedFormats = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// outputFormat returns the -output-format of the collector writing
+// outputFileName, text when none was given.
+func outputFormat(outputFileName string) string {
+	if f, ok := opts.outputFormats[outputFileName]; ok {
+		return f
+	}
+	return outputText
+}
+
+// formatApplied records that the -output-format of outputFileName was used.
+func formatApplied(outputFileName string) {
+	appliedFormats.Lock()
+	appliedFormats.names[outputFileName] = true
+	appliedFormats.Unlock()
+}
+
+// unmatchedFormats returns the names given to -output-format that no
+// collector that ran had, or whose collector can't write the format.
+func unmatchedFormats() []string {
+	appliedFormats.Lock()
+	defer appliedFormats.Unlock()
+	var names []string
+	for name := range opts.outputFormats {
+		if !appliedFormats.names[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,47 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import "testing"
+
+func TestFormatMapSet(t *testing.T) {
+	var m formatMap
+	for _, v := range []string{"vms.txt=json", "cluster_nodes.txt=CSV", "vm_switches.txt=text"} {
+		if err := m.Set(v); err != nil {
+			t.Errorf("Set(%q) error = %v", v, err)
+		}
+	}
+	if got, want := m.String(), "cluster_nodes.txt=csv,vm_switches.txt=text,vms.txt=json"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, v := range []string{"vms.txt", "=json", "vms.txt=xml"} {
+		if err := m.Set(v); err == nil {
+			t.Errorf("Set(%q) should fail", v)
+		}
+	}
+}
+
+func TestFormattedFileName(t *testing.T) {
+	for _, tt := range []struct{ name, format, want string }{
+		{"vms.txt", outputText, "vms.txt"},
+		{"vms.txt", outputCSV, "vms.csv"},
+		{"vms.txt", outputJSON, "vms.json"},
+		{"cluster_nodes", outputJSON, "cluster_nodes.json"},
+	} {
+		if got := formattedFileName(tt.name, tt.format); got != tt.want {
+			t.Errorf("formattedFileName(%q, %q) = %q, want %q", tt.name, tt.format, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// formatStageRe matches a PowerShell -Command ending in a Format-List or
+// Format-Table stage, which only makes text. It captures the command up to
+// the pipeline, the pipeline before the stage and the properties the stage
+// shows.
+var formatStageRe = regexp.MustCompile(`^(.*-Command ")(.+?)\s*\|\s*Format-(?:List|Table)\b([^|"]*)"$`)
+
+// withOutputFormat returns command writing its objects as format rather
+// than as text, into an output file with the extension of the format. Only
+// the PowerShell commands ending in a Format-List or Format-Table stage can,
+// the stage is replaced with Export-Csv or ConvertTo-Json. The command
+// writes the file itself, so no command line header gets in the data.
+func withOutputFormat(command cmd, format string) (cmd, bool) {
+	if command.path != powershell {
+		return command, false
+	}
+	m := formatStageRe.FindStringSubmatch(command.args)
+	if m == nil {
+		return command, false
+	}
+	if format == outputText {
+		return command, true
+	}
+
+	pipeline := m[2]
+	// The properties the Format stage picked are kept, the other
+	// arguments only lay out the text.
+	var props []string
+	for _, f := range strings.Fields(strings.Replace(m[3], ",", " ", -1)) {
+		if f != "*" && !strings.HasPrefix(f, "-") {
+			props = append(props, f)
+		}
+	}
+	if len(props) > 0 {
+		pipeline += " | Select-Object " + strings.Join(props, ", ")
+	}
+	name := formattedFileName(command.outputFileName, format)
+	switch format {
+	case outputCSV:
+		pipeline += " | Export-Csv -NoTypeInformation -Encoding UTF8 -Path " + psQuote(name)
+	case outputJSON:
+		pipeline += " | ConvertTo-Json -Depth 3 | Set-Content -Encoding UTF8 -Path " + psQuote(name)
+	default:
+		return command, false
+	}
+	command.args = m[1] + pipeline + `"`
+	command.outputFileName = name
+	command.cmdProducesFile = true
+	// The inspections read text.
+	command.inspect = nil
+	return command, true
+}
+
+// formatted returns command with the -output-format given for it applied,
+// or unchanged when there is none or it can't write the format.
+func (command cmd) formatted() cmd {
+	if _, ok := opts.outputFormats[command.outputFileName]; !ok {
+		return command
+	}
+	c, ok := withOutputFormat(command, outputFormat(command.outputFileName))
+	if !ok {
+		return command
+	}
+	formatApplied(command.outputFileName)
+	return c
+}
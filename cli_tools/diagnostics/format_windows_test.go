@@ -0,0 +1,91 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithOutputFormat(t *testing.T) {
+	vms := cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-VM | Format-List *"`, outputFileName: "vms.txt", admin: adminRequired, inspect: func(string) {}}
+	events := cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-WinEvent -LogName System -MaxEvents 10 | Format-Table TimeCreated, Message -AutoSize"`, outputFileName: "events.txt"}
+
+	for _, tt := range []struct {
+		command  cmd
+		format   string
+		wantArgs string
+		wantName string
+	}{
+		{vms, outputText, vms.args, "vms.txt"},
+		{vms, outputCSV, `-NoProfile -NonInteractive -Command "Get-VM | Export-Csv -NoTypeInformation -Encoding UTF8 -Path 'vms.csv'"`, "vms.csv"},
+		{vms, outputJSON, `-NoProfile -NonInteractive -Command "Get-VM | ConvertTo-Json -Depth 3 | Set-Content -Encoding UTF8 -Path 'vms.json'"`, "vms.json"},
+		// The properties picked for the text are kept.
+		{events, outputJSON, `-NoProfile -NonInteractive -Command "Get-WinEvent -LogName System -MaxEvents 10 | Select-Object TimeCreated, Message | ConvertTo-Json -Depth 3 | Set-Content -Encoding UTF8 -Path 'events.json'"`, "events.json"},
+	} {
+		got, ok := withOutputFormat(tt.command, tt.format)
+		if !ok {
+			t.Errorf("%s as %s: not supported", tt.command.outputFileName, tt.format)
+			continue
+		}
+		if got.args != tt.wantArgs || got.outputFileName != tt.wantName {
+			t.Errorf("%s as %s = %s into %s, want %s into %s", tt.command.outputFileName, tt.format, got.args, got.outputFileName, tt.wantArgs, tt.wantName)
+		}
+		if tt.format != outputText && (!got.cmdProducesFile || got.inspect != nil || got.admin != tt.command.admin) {
+			t.Errorf("%s as %s should write its own file, without the text inspection, keeping its privileges", tt.command.outputFileName, tt.format)
+		}
+	}
+
+	for _, c := range []cmd{
+		{path: `C:\Windows\System32\ipconfig.exe`, args: "/all", outputFileName: "ipconfig.txt"},
+		{path: powershell, args: `-NoProfile -NonInteractive -ExecutionPolicy Bypass -File "C:\plugins\check.ps1"`, outputFileName: "check.txt"},
+		{path: powershell, args: `-NoProfile -NonInteractive -Command "$log = Get-ClusterLog; Move-Item $log.FullName 'cluster.log' -Force"`, outputFileName: "cluster.log"},
+	} {
+		if got, ok := withOutputFormat(c, outputJSON); ok || !reflect.DeepEqual(got.args, c.args) {
+			t.Errorf("%s can't write json, got %s, %v", c.outputFileName, got.args, ok)
+		}
+	}
+}
+
+func TestRunOutputFormat(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.writeFiles = true
+	appliedFormats.names = make(map[string]bool)
+	opts.outputFormats = formatMap{"vms.txt": outputJSON, "ipconfig.txt": outputCSV, "missing.txt": outputJSON}
+
+	path, err := cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-VM | Format-List *"`, outputFileName: "vms.txt"}.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(tmpFolder, "vms.json"); path != want {
+		t.Errorf("run() path = %s, want %s", path, want)
+	}
+	if len(fake.calls) != 1 || !strings.Contains(fake.calls[0], "ConvertTo-Json") || !strings.Contains(fake.calls[0], "'"+filepath.Join(tmpFolder, "vms.json")+"'") {
+		t.Errorf("expected the JSON conversion into the temporary folder, got %v", fake.calls)
+	}
+
+	// ipconfig isn't a PowerShell collector, it stays text.
+	path, err = cmd{path: `C:\Windows\System32\ipconfig.exe`, args: "/all", outputFileName: "ipconfig.txt"}.run(context.Background())
+	if err != nil || filepath.Base(path) != "ipconfig.txt" {
+		t.Errorf("run() = %s, %v, want ipconfig.txt as text", path, err)
+	}
+	if got, want := unmatchedFormats(), []string{"ipconfig.txt", "missing.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unmatchedFormats() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gceAgentEventsXPath selects the events written by the guest agent and the
+// metadata script runner, which log each script run and its output.
+const gceAgentEventsXPath = "*[System[Provider[@Name='GCEMetadataScripts' or @Name='GCEGuestAgent' or @Name='GCEWindowsAgent']]]"
+
+// metadataScriptPrefixes are the metadata keys of the scripts the guest
+// environment runs on Windows.
+var metadataScriptPrefixes = []string{"windows-startup-script-", "windows-shutdown-script-", "sysprep-specialize-script-"}
+
+// gceAgentFiles are the OS Config agent logs and the guest agent config,
+// collected whole. Either can be missing when the agent isn't installed.
+var gceAgentFiles = []string{
+	`C:\ProgramData\Google\osconfig_agent`,
+	`C:\Program Files\Google\Compute Engine\instance_configs.cfg`,
+}
+
+// metadata reads from the GCE metadata server, tests point it at a fake one.
+var metadata = metadataClient{
+	baseURL: "http://metadata.google.internal/computeMetadata/v1/",
+	client:  &http.Client{},
+}
+
+// metadataTimeout bounds a request to the metadata server when the collector
+// making it has no shorter deadline.
+const metadataTimeout = 10 * time.Second
+
+type metadataClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// get returns the metadata at path, relative to the v1 root. The request is
+// abandoned when ctx is done.
+func (c metadataClient) get(ctx context.Context, path string) ([]byte, error) {
+	if opts.noNetwork {
+		return nil, errNoNetwork
+	}
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, metadataStatusError{path: path, status: resp.Status, code: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// metadataStatusError is a request the metadata server answered with a status
+// other than 200, such as 404 for a key that isn't set.
+type metadataStatusError struct {
+	path   string
+	status string
+	code   int
+}
+
+func (e metadataStatusError) Error() string {
+	return fmt.Sprintf("metadata server returned %q for %s", e.status, e.path)
+}
+
+// attributes returns the custom metadata of the instance or project, level
+// being "instance" or "project".
+func (c metadataClient) attributes(ctx context.Context, level string) (map[string]string, error) {
+	data, err := c.get(ctx, level+"/attributes/?recursive=true")
+	if err != nil {
+		return nil, err
+	}
+	attributes := make(map[string]string)
+	return attributes, json.Unmarshal(data, &attributes)
+}
+
+// metadataScripts writes the startup, shutdown and specialize scripts set in
+// the instance and project metadata.
+type metadataScripts struct {
+	outputFileName string
+}
+
+func (m metadataScripts) run(ctx context.Context) (string, error) {
+	outPath := filepath.Join(tmpFolder, m.outputFileName)
+	if opts.noNetwork {
+		return outPath, errNoNetwork
+	}
+	outFile, err := createOutput(ctx, outPath)
+	if err != nil {
+		return outPath, err
+	}
+	defer outFile.Close()
+
+	found := 0
+	for _, level := range []string{"instance", "project"} {
+		attributes, err := metadata.attributes(ctx, level)
+		if err != nil {
+			return outPath, err
+		}
+		var keys []string
+		for key := range attributes {
+			for _, prefix := range metadataScriptPrefixes {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(outFile, "==== %s/attributes/%s ====\r\n%s\r\n\r\n", level, key, attributes[key])
+			found++
+		}
+	}
+	if found == 0 {
+		_, err = io.WriteString(outFile, "No startup, shutdown or specialize scripts are set in metadata.\r\n")
+	}
+	return outPath, err
+}
+
+// startupScriptRunners are the collectors of the GCE/startup_scripts folder.
+func startupScriptRunners() []runner {
+	return []runner{
+		metadataScripts{"metadata_scripts.txt"},
+		cmd{path: `C:\Windows\System32\wevtutil.exe`, args: eventQueryArgs("Application", gceAgentEventsXPath, "/rd:true /c:200"), outputFileName: "agent_events.txt"},
+	}
+}
+
+// gatherStartupScriptLogs collects the metadata scripts and the agent's
+// record of running them, startup script failures are one of the most common
+// problems on GCE.
+func gatherStartupScriptLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	logs <- logFolder{name: "GCE/startup_scripts", files: resultPaths(runAll(ctx, startupScriptRunners(), errs))}
+}
+
+// gatherGCEAgentLogs collects the config and logs of the GCE agents and the
+// state of the OS Config agent. Agents that aren't installed are noted in the
+// summary, not reported as errors.
+func gatherGCEAgentLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	noteIgnoresSince("The GCE agent logs")
+	filePaths, ers := collectFilePaths(gceAgentFiles)
+	for _, err := range ers {
+		if os.IsNotExist(err) {
+			summary.notef("Not collected, it does not exist: %v", err)
+			continue
+		}
+		errs <- err
+	}
+	files := resultPaths(runAll(ctx, osConfigRunners(), errs))
+	logs <- logFolder{name: "GCE", files: append(filePaths, files...)}
+}
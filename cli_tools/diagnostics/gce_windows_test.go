@@ -0,0 +1,179 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withFakeMetadata points the metadata client at a server answering with the
+// given paths and bodies, other paths return 404.
+func withFakeMetadata(t *testing.T, responses map[string]string) func() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			t.Errorf("request to %s is missing the Metadata-Flavor header", r.URL)
+		}
+		body, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	old := metadata
+	metadata = metadataClient{baseURL: server.URL + "/computeMetadata/v1/", client: server.Client()}
+	return func() {
+		metadata = old
+		server.Close()
+	}
+}
+
+func TestGatherStartupScriptLogs(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withFakeMetadata(t, map[string]string{
+		"/computeMetadata/v1/instance/attributes/?recursive=true": `{"windows-startup-script-ps1": "Write-Host hello", "enable-oslogin": "true"}`,
+		"/computeMetadata/v1/project/attributes/?recursive=true":  `{"windows-shutdown-script-cmd": "echo bye"}`,
+	})()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherStartupScriptLogs(context.Background(), logs, errs)
+	folder := <-logs
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", <-errs)
+	}
+
+	want := filepath.Join(tmpFolder, "metadata_scripts.txt")
+	if folder.name != "GCE/startup_scripts" || !stringArrayIncludesString(folder.files, want) {
+		t.Fatalf("expected %s in GCE/startup_scripts folder, got %v", want, folder)
+	}
+	data, err := ioutil.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, s := range []string{
+		"==== instance/attributes/windows-startup-script-ps1 ====\r\nWrite-Host hello",
+		"==== project/attributes/windows-shutdown-script-cmd ====\r\necho bye",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("expected %q in %s:\n%s", s, want, got)
+		}
+	}
+	if strings.Contains(got, "enable-oslogin") {
+		t.Errorf("only scripts should be collected:\n%s", got)
+	}
+	if fake.callCount(`C:\Windows\System32\wevtutil.exe qe Application /q:`+gceAgentEventsXPath+` /rd:true /c:200 /f:text`) != 1 {
+		t.Errorf("expected the agent events to be exported, calls: %v", fake.calls)
+	}
+}
+
+func TestGatherStartupScriptLogsNoNetwork(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withFakeMetadata(t, nil)()
+	opts.noNetwork = true
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherStartupScriptLogs(context.Background(), logs, errs)
+	folder := <-logs
+	if stringArrayIncludesString(folder.files, filepath.Join(tmpFolder, "metadata_scripts.txt")) {
+		t.Error("metadata should not be read with -no-network")
+	}
+}
+
+func TestMetadataGetCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	c := metadataClient{baseURL: server.URL + "/computeMetadata/v1/", client: server.Client()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.get(ctx, "instance/hostname"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("get() error = %v, want the deadline of the context", err)
+	}
+	if d := time.Since(start); d >= metadataTimeout {
+		t.Errorf("get() took %v, want it abandoned at the deadline of the context", d)
+	}
+}
+
+func TestGatherGCEAgentLogs(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "gce_agent_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	osConfig := filepath.Join(dir, "osconfig_agent")
+	if err := os.MkdirAll(filepath.Join(osConfig, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{
+		filepath.Join(osConfig, "logs", "osconfig_agent.log"),
+		filepath.Join(dir, "instance_configs.cfg"),
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(f, []byte("content of "+f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(dir, "not_installed")
+	old, oldAgent := gceAgentFiles, osConfigAgentPath
+	gceAgentFiles = []string{osConfig, files[1], missing}
+	osConfigAgentPath = missing
+	defer func() { gceAgentFiles, osConfigAgentPath = old, oldAgent }()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherGCEAgentLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	if folder.name != "GCE" {
+		t.Errorf("folder name = %q, want GCE", folder.name)
+	}
+	sort.Strings(folder.files)
+	want := append([]string(nil), files...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(folder.files, want) {
+		t.Errorf("collected files = %v, want %v", folder.files, want)
+	}
+	if len(errs) != 0 {
+		t.Errorf("a missing path should not be an error, got %v", <-errs)
+	}
+	if s := summary.String(); !strings.Contains(s, "not_installed") {
+		t.Errorf("expected a note about the missing path in the summary:\n%s", s)
+	}
+}
@@ -0,0 +1,63 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// maxWheaEvents bounds the WHEA events collected, a failing part can log
+// many a minute.
+const maxWheaEvents = 200
+
+// hardwareErrors collects the hardware errors the WHEA logger recorded and
+// the state of Driver Verifier, which is behind many driver bugchecks when
+// it was left on.
+func hardwareErrors() group {
+	filter := "LogName='System'; ProviderName='Microsoft-Windows-WHEA-Logger'"
+	if !opts.since.IsZero() {
+		filter += fmt.Sprintf("; StartTime=[datetime]'%s'", opts.since.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	return group{"hardware_errors.txt", []section{
+		cmd{
+			path:    powershell,
+			args:    fmt.Sprintf(`-NoProfile -NonInteractive -Command "Get-WinEvent -FilterHashtable @{%s} -MaxEvents %d -ErrorAction SilentlyContinue | Format-List TimeCreated, Id, LevelDisplayName, Message"`, filter, maxWheaEvents),
+			inspect: checkWheaEvents,
+		},
+		cmd{path: `C:\Windows\System32\verifier.exe`, args: "/query", admin: adminRequired},
+	}}
+}
+
+// checkWheaEvents raises the WHEA events in the summary, by level. Errors are
+// uncorrected or fatal, warnings are errors the hardware corrected, a part
+// that keeps logging them is failing.
+func checkWheaEvents(output string) {
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "LevelDisplayName" {
+			counts[strings.TrimSpace(parts[1])]++
+		}
+	}
+	if n := counts["Critical"] + counts["Error"]; n > 0 {
+		summary.errorf("%d uncorrected hardware errors were logged by WHEA, see System/hardware_errors.txt", n)
+	}
+	if n := counts["Warning"]; n > 0 {
+		summary.warnf("%d corrected hardware errors were logged by WHEA, see System/hardware_errors.txt", n)
+	}
+}
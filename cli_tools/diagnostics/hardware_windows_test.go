@@ -0,0 +1,78 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleWheaEvents = `
+
+TimeCreated      : 6/1/2019 8:00:01 AM
+Id               : 19
+LevelDisplayName : Warning
+Message          : A corrected hardware error has occurred.
+
+TimeCreated      : 6/1/2019 8:05:01 AM
+Id               : 19
+LevelDisplayName : Warning
+Message          : A corrected hardware error has occurred.
+
+TimeCreated      : 6/1/2019 9:00:00 AM
+Id               : 18
+LevelDisplayName : Error
+Message          : A fatal hardware error has occurred.
+`
+
+// commandCall is how the fake executor records the call of c.
+func commandCall(c cmd) string {
+	return c.path + " " + strings.Join(splitArgs(c.args), " ")
+}
+
+func TestGatherSystemLogsHardwareErrors(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	whea := commandCall(hardwareErrors().sections[0].(cmd))
+	fake.outputs = map[string]string{whea: sampleWheaEvents}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "hardware_errors.txt")
+	for _, want := range []string{"ProviderName='Microsoft-Windows-WHEA-Logger'", "A fatal hardware error has occurred.", "verifier.exe /query"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in hardware_errors.txt:\n%s", want, got)
+		}
+	}
+	errors, warnings, _ := summary.lines()
+	if !stringArrayIncludesString(errors, "1 uncorrected hardware errors were logged by WHEA, see System/hardware_errors.txt") {
+		t.Errorf("expected the fatal WHEA error in the summary errors, got %v", errors)
+	}
+	if !stringArrayIncludesString(warnings, "2 corrected hardware errors were logged by WHEA, see System/hardware_errors.txt") {
+		t.Errorf("expected the corrected WHEA errors in the summary warnings, got %v", warnings)
+	}
+}
+
+func TestHardwareErrorsSince(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	if args := hardwareErrors().sections[0].(cmd).args; strings.Contains(args, "StartTime") {
+		t.Errorf("expected no StartTime without -since, got %s", args)
+	}
+	opts.since = time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	if args := hardwareErrors().sections[0].(cmd).args; !strings.Contains(args, "StartTime=[datetime]'2019-06-01T00:00:00Z'") {
+		t.Errorf("expected the -since StartTime in %s", args)
+	}
+}
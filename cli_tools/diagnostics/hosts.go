@@ -0,0 +1,253 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	hostsIndexFileName = "hosts_index.txt"
+	// hostsStateFileName records which hosts of -hosts were collected from,
+	// so a run that was interrupted or had hosts failing resumes with the
+	// others.
+	hostsStateFileName = "hosts_state.json"
+)
+
+// hostTransport collects a bundle from a remote host.
+type hostTransport interface {
+	// collect runs the collection on host and copies the bundle into dir,
+	// returning its path there.
+	collect(ctx context.Context, host, dir string) (string, error)
+}
+
+// hostResult is the outcome of the collection from one host of -hosts.
+type hostResult struct {
+	host string
+	// bundle is the path of the bundle copied from the host, empty when
+	// the collection failed.
+	bundle   string
+	err      error
+	duration time.Duration
+}
+
+// hostRecord is the state of a host in hosts_state.json.
+type hostRecord struct {
+	Status string `json:"status"`
+	// Bundle is relative to the folder of the bundles.
+	Bundle   string        `json:"bundle,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// hostsState tracks the collection from the hosts of -hosts in a file,
+// which is saved as each host is done so it survives an interrupted run.
+type hostsState struct {
+	path string
+
+	mu    sync.Mutex
+	hosts map[string]hostRecord
+}
+
+// loadHostsState reads the state saved in path by an earlier run, the state
+// is empty when there is none.
+func loadHostsState(path string) (*hostsState, error) {
+	s := &hostsState{path: path, hosts: make(map[string]hostRecord)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.hosts); err != nil {
+		return nil, fmt.Errorf("%s is not a valid hosts state: %v", path, err)
+	}
+	return s, nil
+}
+
+// collected returns the bundle under dir collected from host by an earlier
+// run, if it is still there.
+func (s *hostsState) collected(host, dir string) (hostRecord, string, bool) {
+	s.mu.Lock()
+	r, ok := s.hosts[strings.ToLower(host)]
+	s.mu.Unlock()
+	if !ok || r.Status != "ok" {
+		return r, "", false
+	}
+	bundle := filepath.Join(dir, filepath.FromSlash(r.Bundle))
+	if _, err := os.Stat(bundle); err != nil {
+		return r, "", false
+	}
+	return r, bundle, true
+}
+
+// record saves the outcome of the collection from a host.
+func (s *hostsState) record(r hostResult, dir string) error {
+	rec := hostRecord{Status: "ok", Duration: r.duration}
+	if r.err != nil {
+		rec.Status, rec.Error = "error", r.err.Error()
+	} else if bundle, err := filepath.Rel(dir, r.bundle); err == nil {
+		rec.Bundle = filepath.ToSlash(bundle)
+	} else {
+		rec.Bundle = r.bundle
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts[strings.ToLower(r.host)] = rec
+	data, err := json.MarshalIndent(s.hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The state is replaced in one go so an interruption can't leave it
+	// half written.
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// readHostsFile reads the hosts listed in path, one per line. Blank lines
+// and lines starting with # are skipped, as are hosts listed twice.
+func readHostsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []string
+	seen := make(map[string]bool)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		host := strings.TrimSpace(s.Text())
+		if host == "" || strings.HasPrefix(host, "#") || seen[strings.ToLower(host)] {
+			continue
+		}
+		seen[strings.ToLower(host)] = true
+		hosts = append(hosts, host)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("%s lists no hosts", path)
+	}
+	return hosts, nil
+}
+
+// hostDirName is the name of the folder the bundle of host goes in, the
+// colons of an IPv6 address can't be in a folder name.
+func hostDirName(host string) string {
+	return safeFileName(host)
+}
+
+// safeFileName replaces the characters of s that can't be in a Windows file
+// name with underscores.
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// collectHosts collects from each of hosts through t, at most limit at a
+// time, into a folder per host under dir. A host that fails doesn't stop
+// the others, its error is in its result. The results are in the order of
+// hosts. The hosts state records each host as it is done, and the hosts it
+// has a bundle for are not collected from again.
+func collectHosts(ctx context.Context, t hostTransport, hosts []string, dir string, limit int, state *hostsState) []hostResult {
+	results := make([]hostResult, len(hosts))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		if rec, bundle, ok := state.collected(host, dir); ok {
+			log.Printf("Skipping %s, it was collected from by an earlier run", host)
+			results[i] = hostResult{host: host, bundle: bundle, duration: rec.Duration}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			r := hostResult{host: host}
+			hostDir := filepath.Join(dir, hostDirName(host))
+			if r.err = os.MkdirAll(hostDir, 0755); r.err == nil {
+				r.bundle, r.err = t.collect(ctx, host, hostDir)
+			}
+			r.duration = time.Since(start)
+			if r.err != nil {
+				r.bundle = ""
+				log.Printf("Error collecting from %s: %v", host, r.err)
+			} else {
+				log.Printf("Collected from %s in %v", host, r.duration.Round(time.Second))
+			}
+			if err := state.record(r, dir); err != nil {
+				log.Printf("Error saving the state of %s: %v", host, err)
+			}
+			results[i] = r
+		}(i, host)
+	}
+	wg.Wait()
+	return results
+}
+
+// failedHosts counts the results that have an error.
+func failedHosts(results []hostResult) int {
+	n := 0
+	for _, r := range results {
+		if r.err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// writeHostsIndex writes the index of the bundles collected under dir to
+// path, a line per host giving its status and either its bundle, relative
+// to dir, or the error it failed with.
+func writeHostsIndex(path, dir string, results []hostResult) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Bundles collected by diagnostics %s from %d hosts, %d failed.\r\n", buildInfo(), len(results), failedHosts(results))
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(&b, "%s\terror\t%s\r\n", r.host, strings.Replace(r.err.Error(), "\n", " ", -1))
+			continue
+		}
+		bundle, err := filepath.Rel(dir, r.bundle)
+		if err != nil {
+			bundle = r.bundle
+		}
+		fmt.Fprintf(&b, "%s\tok\t%s\t%v\r\n", r.host, filepath.ToSlash(bundle), r.duration.Round(time.Second))
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
@@ -0,0 +1,225 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport collects a bundle from a host by writing a file, or fails
+// with the error set for the host. It records the most hosts it was
+// collecting from at once.
+type fakeTransport struct {
+	errs map[string]error
+
+	mu        sync.Mutex
+	running   int
+	peak      int
+	collected []string
+}
+
+func (f *fakeTransport) collect(ctx context.Context, host, dir string) (string, error) {
+	f.mu.Lock()
+	f.collected = append(f.collected, host)
+	f.running++
+	if f.running > f.peak {
+		f.peak = f.running
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := f.errs[host]; err != nil {
+		return "", err
+	}
+	bundle := filepath.Join(dir, "logs.zip")
+	return bundle, ioutil.WriteFile(bundle, []byte("bundle of "+host), 0644)
+}
+
+func TestReadHostsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hosts.txt")
+	if err := ioutil.WriteFile(path, []byte("# web tier\r\nweb-1\r\n  web-2  \r\n\r\nWEB-1\r\nfe80::1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := readHostsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(hosts, ","), "web-1,web-2,fe80::1"; got != want {
+		t.Errorf("readHostsFile = %s, want %s", got, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("# nothing yet\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readHostsFile(path); err == nil {
+		t.Error("expected an error for a file listing no hosts")
+	}
+}
+
+func TestCollectHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hosts := []string{"web-1", "web-2", "db-1", "fe80::1", "web-3", "web-4"}
+	transport := &fakeTransport{errs: map[string]error{"db-1": errors.New("Connecting to remote server db-1 failed: Access is denied")}}
+	state, err := loadHostsState(filepath.Join(dir, hostsStateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := collectHosts(context.Background(), transport, hosts, dir, 2, state)
+
+	if transport.peak > 2 {
+		t.Errorf("collected from %d hosts at once, the limit is 2", transport.peak)
+	}
+	if len(results) != len(hosts) {
+		t.Fatalf("got %d results for %d hosts", len(results), len(hosts))
+	}
+	for i, r := range results {
+		if r.host != hosts[i] {
+			t.Errorf("result %d is for %s, want %s", i, r.host, hosts[i])
+		}
+		if r.host == "db-1" {
+			if r.err == nil || r.bundle != "" {
+				t.Errorf("db-1: expected an error and no bundle, got %q, %v", r.bundle, r.err)
+			}
+			continue
+		}
+		if r.err != nil {
+			t.Errorf("%s: %v", r.host, r.err)
+			continue
+		}
+		// Each host has its own folder, named so Windows accepts it.
+		if want := filepath.Join(dir, hostDirName(r.host), "logs.zip"); r.bundle != want {
+			t.Errorf("%s: bundle = %s, want %s", r.host, r.bundle, want)
+		}
+		if data, err := ioutil.ReadFile(r.bundle); err != nil || string(data) != "bundle of "+r.host {
+			t.Errorf("%s: bundle holds %q, %v", r.host, data, err)
+		}
+	}
+	if got := hostDirName("fe80::1"); got != "fe80__1" {
+		t.Errorf(`hostDirName("fe80::1") = %s, want fe80__1`, got)
+	}
+
+	indexPath := filepath.Join(dir, hostsIndexFileName)
+	if err := writeHostsIndex(indexPath, dir, results); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n")
+	if want := "from 6 hosts, 1 failed."; !strings.HasSuffix(lines[0], want) {
+		t.Errorf("index header = %q, want it to end with %q", lines[0], want)
+	}
+	wantPrefixes := []string{
+		"web-1\tok\tweb-1/logs.zip\t",
+		"web-2\tok\tweb-2/logs.zip\t",
+		"db-1\terror\tConnecting to remote server db-1 failed: Access is denied",
+		"fe80::1\tok\tfe80__1/logs.zip\t",
+		"web-3\tok\tweb-3/logs.zip\t",
+		"web-4\tok\tweb-4/logs.zip\t",
+	}
+	if len(lines) != len(wantPrefixes)+1 {
+		t.Fatalf("index =\n%s\nwant a header and a line per host", data)
+	}
+	for i, want := range wantPrefixes {
+		if !strings.HasPrefix(lines[i+1], want) {
+			t.Errorf("index line %d = %q, want it to start with %q", i+1, lines[i+1], want)
+		}
+	}
+}
+
+func TestCollectHostsResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, hostsStateFileName)
+	hosts := []string{"web-1", "web-2", "db-1", "web-3", "web-4"}
+
+	// The first run is interrupted after the first three hosts, and db-1
+	// failed.
+	state, err := loadHostsState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &fakeTransport{errs: map[string]error{"db-1": errors.New("Connecting to remote server db-1 failed: Access is denied")}}
+	collectHosts(context.Background(), first, hosts[:3], dir, 2, state)
+
+	// web-2's bundle went missing since.
+	if err := os.Remove(filepath.Join(dir, "web-2", "logs.zip")); err != nil {
+		t.Fatal(err)
+	}
+	state, err = loadHostsState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := &fakeTransport{}
+	results := collectHosts(context.Background(), second, hosts, dir, 2, state)
+
+	sort.Strings(second.collected)
+	if got, want := strings.Join(second.collected, ","), "db-1,web-2,web-3,web-4"; got != want {
+		t.Errorf("resumed run collected from %s, want %s", got, want)
+	}
+	if failed := failedHosts(results); failed != 0 {
+		t.Errorf("resumed run has %d failed hosts, want none", failed)
+	}
+	for i, r := range results {
+		if want := filepath.Join(dir, hostDirName(hosts[i]), "logs.zip"); r.host != hosts[i] || r.bundle != want {
+			t.Errorf("result %d = %s %s, want %s %s", i, r.host, r.bundle, hosts[i], want)
+		}
+	}
+
+	// Every host is recorded as done now.
+	state, err = loadHostsState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range hosts {
+		if _, _, ok := state.collected(host, dir); !ok {
+			t.Errorf("%s is not recorded as collected", host)
+		}
+	}
+	third := &fakeTransport{}
+	collectHosts(context.Background(), third, hosts, dir, 2, state)
+	if len(third.collected) != 0 {
+		t.Errorf("expected no host collected from again, got %v", third.collected)
+	}
+}
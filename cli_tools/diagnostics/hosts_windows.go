@@ -0,0 +1,89 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// remoteDiagnosticsPath is where the google-compute-engine-diagnostics
+// package installs the tool, -hosts runs it from there on each host.
+var remoteDiagnosticsPath = `C:\Program Files\Google\Compute Engine\diagnostics\diagnostics.exe`
+
+// remoteTransport collects from the hosts of -hosts.
+var remoteTransport hostTransport = psRemoting{}
+
+// psRemoting collects from a host over PowerShell remoting (WinRM): it runs
+// the tool installed on the host in a temporary folder there, then copies
+// the bundle back and removes the folder. The host must have the
+// diagnostics package installed and remoting enabled, and the current user
+// must be allowed to open a session on it.
+type psRemoting struct{}
+
+func (psRemoting) collect(ctx context.Context, host, dir string) (string, error) {
+	bundle := filepath.Join(dir, archiveFileName(formatZip))
+	var out bytes.Buffer
+	if err := exe.execute(ctx, powershell, []string{"-NoProfile", "-NonInteractive", "-EncodedCommand", encodePowerShell(remoteCollectScript(host, dir))}, &out); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return bundle, nil
+}
+
+// remoteCollectScript is the PowerShell script collecting from host into
+// dir. The tool exits with an error when some collectors failed, the
+// bundle it still produces is copied all the same, it is only missing when
+// the collection failed outright.
+func remoteCollectScript(host, dir string) string {
+	return strings.Join([]string{
+		`$ErrorActionPreference = 'Stop'`,
+		`$s = New-PSSession -ComputerName ` + psQuote(host),
+		`try {`,
+		`  $remote = Invoke-Command -Session $s -ScriptBlock {`,
+		`    $d = New-Item -ItemType Directory -Path (Join-Path $env:TEMP ('diagnostics_' + [guid]::NewGuid()))`,
+		`    Start-Process -FilePath ` + psQuote(remoteDiagnosticsPath) + ` -WorkingDirectory $d -Wait -NoNewWindow | Out-Null`,
+		`    Join-Path $d ` + psQuote(archiveFileName(formatZip)),
+		`  }`,
+		`  Copy-Item -FromSession $s -Path $remote -Destination ` + psQuote(dir),
+		`  Invoke-Command -Session $s -ScriptBlock { Remove-Item -Recurse -Force (Split-Path $using:remote) }`,
+		`} finally {`,
+		`  Remove-PSSession $s`,
+		`}`,
+	}, "\r\n")
+}
+
+// psQuote quotes s as a PowerShell string literal.
+func psQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// encodePowerShell encodes script for -EncodedCommand, which spares
+// quoting it on the command line.
+func encodePowerShell(script string) string {
+	var b bytes.Buffer
+	for _, u := range utf16.Encode([]rune(script)) {
+		b.WriteByte(byte(u))
+		b.WriteByte(byte(u >> 8))
+	}
+	return base64.StdEncoding.EncodeToString(b.Bytes())
+}
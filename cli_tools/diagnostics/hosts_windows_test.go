@@ -0,0 +1,76 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// decodePowerShell reverses encodePowerShell.
+func decodePowerShell(t *testing.T, encoded string) string {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	return string(utf16.Decode(u))
+}
+
+func TestPSRemotingCollect(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	dir := `C:\bundles\o'brien-1`
+	bundle, err := psRemoting{}.collect(context.Background(), "o'brien-1", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "logs.zip"); bundle != want {
+		t.Errorf("bundle = %s, want %s", bundle, want)
+	}
+	if len(fake.calls) != 1 {
+		t.Fatalf("expected one powershell call, got %v", fake.calls)
+	}
+	fields := strings.Fields(fake.calls[0])
+	if fields[0] != powershell || fields[len(fields)-2] != "-EncodedCommand" {
+		t.Fatalf("unexpected call %s", fake.calls[0])
+	}
+	script := decodePowerShell(t, fields[len(fields)-1])
+	for _, want := range []string{
+		`New-PSSession -ComputerName 'o''brien-1'`,
+		`Start-Process -FilePath '` + remoteDiagnosticsPath + `'`,
+		`Copy-Item -FromSession $s -Path $remote -Destination 'C:\bundles\o''brien-1'`,
+		`Remove-PSSession $s`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script is missing %q:\n%s", want, script)
+		}
+	}
+
+	fake.errs = map[string]error{fake.calls[0]: errors.New("exit status 1")}
+	fake.outputs = map[string]string{fake.calls[0]: "New-PSSession : Connecting to remote server o'brien-1 failed\r\n"}
+	if _, err := (psRemoting{}).collect(context.Background(), "o'brien-1", dir); err == nil || !strings.Contains(err.Error(), "Connecting to remote server o'brien-1 failed") {
+		t.Errorf("expected the error to hold the PowerShell output, got %v", err)
+	}
+}
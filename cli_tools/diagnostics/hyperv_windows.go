@@ -0,0 +1,40 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+)
+
+// hyperVServicePath is the Hyper-V Virtual Machine Management service, it is
+// only there when the Hyper-V role is installed.
+var hyperVServicePath = `C:\Windows\System32\vmms.exe`
+
+// hyperVRunners are the collectors of the HyperV folder.
+func hyperVRunners() []runner {
+	return []runner{
+		installed{hyperVServicePath, cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-VM | Format-List *"`, outputFileName: "vms.txt", admin: adminRequired}},
+		installed{hyperVServicePath, cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-VMSwitch | Format-List *"`, outputFileName: "vm_switches.txt", admin: adminRequired}},
+		installed{hyperVServicePath, cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-VMNetworkAdapter -All | Format-List *"`, outputFileName: "vm_network_adapters.txt", admin: adminRequired}},
+		// The host itself is a Msvm_ComputerSystem too, alongside the VMs.
+		installed{hyperVServicePath, wmiQuery{class: "Msvm_ComputerSystem", namespace: `root\virtualization\v2`, outputFileName: "vm_state.txt"}},
+	}
+}
+
+// gatherHyperVLogs collects the VMs, switches and network adapters of Hyper-V
+// on instances using nested virtualization.
+func gatherHyperVLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	logs <- logFolder{name: "HyperV", files: resultPaths(runAll(ctx, hyperVRunners(), errs))}
+}
@@ -0,0 +1,83 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withHyperV(t *testing.T, present bool) func() {
+	old := hyperVServicePath
+	hyperVServicePath = filepath.Join(tmpFolder, "vmms.exe")
+	if present {
+		if err := ioutil.WriteFile(hyperVServicePath, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() { hyperVServicePath = old }
+}
+
+func TestGatherHyperVLogs(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withHyperV(t, true)()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"Msvm_ComputerSystem": {{{"ElementName", "nested-vm"}, {"EnabledState", "2"}}},
+	}}
+
+	folder := runGatherer(t, gatherHyperVLogs)
+	if folder.name != "HyperV" {
+		t.Errorf("folder name = %q, want HyperV", folder.name)
+	}
+	for _, c := range []string{"Get-VM |", "Get-VMSwitch", "Get-VMNetworkAdapter -All"} {
+		found := false
+		for _, call := range fake.calls {
+			found = found || strings.Contains(call, c)
+		}
+		if !found {
+			t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+		}
+	}
+	for _, name := range []string{"vms.txt", "vm_switches.txt", "vm_network_adapters.txt"} {
+		readFolderFile(t, folder, name)
+	}
+	if got := readFolderFile(t, folder, "vm_state.txt"); !strings.Contains(got, "ElementName: nested-vm") {
+		t.Errorf("expected the VM state in vm_state.txt:\n%s", got)
+	}
+}
+
+func TestGatherHyperVLogsNotInstalled(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withHyperV(t, false)()
+	wmi := &fakeWmiSource{}
+	wmiSrc = wmi
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherHyperVLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	if len(fake.calls) != 0 || wmi.queries != 0 {
+		t.Errorf("expected nothing to run without Hyper-V, calls: %v, %d WMI queries", fake.calls, wmi.queries)
+	}
+	if len(errs) != 0 || len(folder.files) != 0 {
+		t.Errorf("expected an empty folder and no errors, got files %v, %d errors", folder.files, len(errs))
+	}
+}
@@ -0,0 +1,75 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// The IIS tools, configuration and logs, they are only there when the Web
+// Server role is installed.
+var (
+	appcmdPath  = `C:\Windows\System32\inetsrv\appcmd.exe`
+	iisConfig   = `C:\Windows\System32\inetsrv\config\applicationHost.config`
+	iisLogsRoot = `C:\inetpub\logs\LogFiles`
+)
+
+// iisMaxFiles and iisMaxBytes cap the IIS logs collected, busy sites keep
+// months of them. The newest logs are kept.
+var (
+	iisMaxFiles       = 50
+	iisMaxBytes int64 = 500 << 20
+)
+
+// iisPasswordRe matches the password attributes of applicationHost.config,
+// such as those of the app pool identities and virtual directories.
+var iisPasswordRe = regexp.MustCompile(`(?i)(password\s*=\s*")[^"]*(")`)
+
+// iisConfigCopy copies applicationHost.config with the passwords removed.
+type iisConfigCopy struct {
+	outputFileName string
+}
+
+func (c iisConfigCopy) run(ctx context.Context) (string, error) {
+	outPath := filepath.Join(tmpFolder, c.outputFileName)
+	data, err := ioutil.ReadFile(iisConfig)
+	if err != nil {
+		return outPath, err
+	}
+	return outPath, ioutil.WriteFile(outPath, iisPasswordRe.ReplaceAll(data, []byte("${1}<removed>${2}")), 0644)
+}
+
+// iisRunners are the collectors of the IIS folder, on top of the logs.
+func iisRunners() []runner {
+	return []runner{
+		installed{appcmdPath, cmd{path: appcmdPath, args: "list sites", outputFileName: "sites.txt"}},
+		installed{appcmdPath, cmd{path: appcmdPath, args: "list apppools", outputFileName: "apppools.txt"}},
+		installed{appcmdPath, iisConfigCopy{"applicationHost.config"}},
+	}
+}
+
+// gatherIISLogs collects the sites, app pools, configuration and recent logs
+// of IIS, on instances serving web sites.
+func gatherIISLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	files := resultPaths(runAll(ctx, iisRunners(), errs))
+	if _, err := os.Stat(appcmdPath); err == nil {
+		files = append(files, cappedFiles("IIS log", []string{iisLogsRoot}, iisMaxFiles, iisMaxBytes, errs)...)
+	}
+	logs <- logFolder{name: "IIS", files: files}
+}
@@ -0,0 +1,134 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withIIS points the IIS paths into tmpFolder, with appcmd there only if
+// present.
+func withIIS(t *testing.T, present bool) func() {
+	oldAppcmd, oldConfig, oldLogs, oldFiles, oldBytes := appcmdPath, iisConfig, iisLogsRoot, iisMaxFiles, iisMaxBytes
+	root := filepath.Join(tmpFolder, "inetsrv")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	appcmdPath = filepath.Join(root, "appcmd.exe")
+	iisConfig = filepath.Join(root, "applicationHost.config")
+	iisLogsRoot = filepath.Join(tmpFolder, "inetpub", "logs", "LogFiles")
+	if present {
+		if err := ioutil.WriteFile(appcmdPath, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		appcmdPath, iisConfig, iisLogsRoot, iisMaxFiles, iisMaxBytes = oldAppcmd, oldConfig, oldLogs, oldFiles, oldBytes
+	}
+}
+
+func TestGatherIISLogs(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withIIS(t, true)()
+	iisMaxFiles = 2
+	fake.outputs = map[string]string{
+		appcmdPath + " list sites":    `SITE "Default Web Site" (id:1,bindings:http/*:80:,state:Started)`,
+		appcmdPath + " list apppools": `APPPOOL "DefaultAppPool" (MgdVersion:v4.0,MgdMode:Integrated,state:Started)`,
+	}
+	config := `<applicationPools>
+    <add name="DefaultAppPool" />
+    <add name="Orders"><processModel identityType="SpecificUser" userName="CORP\svc-orders" password="[enc:IISCngProvider:c2VjcmV0:enc]" /></add>
+</applicationPools>
+<virtualDirectory path="/" physicalPath="\\share\site" userName="CORP\svc-share" Password = "plaintext" />`
+	if err := ioutil.WriteFile(iisConfig, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var logFiles []string
+	for i, name := range []string{"u_ex190603.log", "u_ex190602.log", "u_ex190601.log"} {
+		p := filepath.Join(iisLogsRoot, "W3SVC1", name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("2019-06-01 00:00:00 10.0.0.2 GET / - 80 - 10.0.0.3 - 200 0 0 15\r\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-time.Duration(i) * 24 * time.Hour)
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		logFiles = append(logFiles, p)
+	}
+
+	folder := runGatherer(t, gatherIISLogs)
+	if folder.name != "IIS" {
+		t.Errorf("folder name = %q, want IIS", folder.name)
+	}
+	if got := readFolderFile(t, folder, "sites.txt"); !strings.Contains(got, "Default Web Site") {
+		t.Errorf("expected the sites in sites.txt:\n%s", got)
+	}
+	if got := readFolderFile(t, folder, "apppools.txt"); !strings.Contains(got, "DefaultAppPool") {
+		t.Errorf("expected the app pools in apppools.txt:\n%s", got)
+	}
+	got := readFolderFile(t, folder, "applicationHost.config")
+	if strings.Contains(got, "c2VjcmV0") || strings.Contains(got, "plaintext") {
+		t.Errorf("applicationHost.config still has passwords:\n%s", got)
+	}
+	for _, want := range []string{`userName="CORP\svc-orders" password="<removed>"`, `Password = "<removed>"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in applicationHost.config:\n%s", want, got)
+		}
+	}
+
+	var gotLogs []string
+	for _, f := range folder.files {
+		if strings.HasPrefix(f, iisLogsRoot) {
+			gotLogs = append(gotLogs, f)
+		}
+	}
+	sort.Strings(gotLogs)
+	if want := []string{logFiles[1], logFiles[0]}; strings.Join(gotLogs, ",") != strings.Join(want, ",") {
+		t.Errorf("IIS logs = %v, want the 2 newest %v", gotLogs, want)
+	}
+	if s := summary.String(); !strings.Contains(s, "1 older IIS log files were not collected") {
+		t.Errorf("expected the dropped log in the summary:\n%s", s)
+	}
+}
+
+func TestGatherIISLogsNotInstalled(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withIIS(t, false)()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherIISLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	if len(fake.calls) != 0 {
+		t.Errorf("expected nothing to run without IIS, calls: %v", fake.calls)
+	}
+	if len(errs) != 0 || len(folder.files) != 0 {
+		t.Errorf("expected no errors or files without IIS, got %d errors and files %v", len(errs), folder.files)
+	}
+}
@@ -0,0 +1,370 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSystem is a machine for gatherLogs to collect from end to end: a fake
+// executor, WMI source, registry and metadata server, and a folder standing
+// in for the file system, with every optional program installed. Tests add
+// to it with file and registry, or through exe, before calling gatherLogs.
+type fakeSystem struct {
+	exe *fakeExecutor
+	reg *fakeRegistry
+	// root holds the files collected whole, and the programs checked for.
+	root string
+	// files are the files written with file, the ones gatherLogs is
+	// expected to collect as is.
+	files []string
+}
+
+// withFakeSystem sets up a fakeSystem and points every path the gatherers
+// read at it, until the returned func is called.
+func withFakeSystem(t *testing.T) (*fakeSystem, func()) {
+	fake, cleanup := withFakeExecutor(t)
+	cleanupMetadata := withFakeMetadata(t, map[string]string{
+		"/computeMetadata/v1/instance/attributes/?recursive=true": `{"windows-startup-script-ps1": "Write-Host hello"}`,
+		"/computeMetadata/v1/project/attributes/?recursive=true":  `{}`,
+	})
+	root, err := ioutil.TempDir("", "diagnostics_system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.writeFiles = true
+	systemVolume = root
+	s := &fakeSystem{exe: fake, root: root, reg: &fakeRegistry{keys: map[string]map[string]interface{}{
+		currentVersionKey: {"InstallationType": "Server", "ProductName": "Windows Server 2019 Datacenter",
+			"CurrentMajorVersionNumber": uint64(10), "CurrentMinorVersionNumber": uint64(0), "CurrentBuild": "17763", "UBR": uint64(1234)},
+	}}}
+	reg = s.reg
+
+	oldPaths := []string{eventLogsRoot, k8sLogsRoot, crashDump, containerdConfig, crictlPath, ctrPath, wslPath,
+		clusterServicePath, hyperVServicePath, appcmdPath, iisConfig, iisLogsRoot, bootTraceStateFile, fltmcPath, bootLog, osConfigAgentPath}
+	// gatherLogs sets elevated from the privileges the test runs with.
+	oldWer, oldGCE, oldPanther, oldElevated := werRoots, gceAgentFiles, pantherRoots, elevated
+	eventLogsRoot = s.path(`Windows\System32\winevt\Logs`)
+	k8sLogsRoot = s.path(`etc\kubernetes\logs`)
+	crashDump = s.path(`Windows\MEMORY.dmp`)
+	containerdConfig = s.path(`Program Files\containerd\config.toml`)
+	crictlPath = s.path(`etc\kubernetes\node\bin\crictl.exe`)
+	ctrPath = s.path(`Program Files\containerd\ctr.exe`)
+	wslPath = s.path(`Windows\System32\wsl.exe`)
+	clusterServicePath = s.path(`Windows\Cluster\clussvc.exe`)
+	hyperVServicePath = s.path(`Windows\System32\vmms.exe`)
+	appcmdPath = s.path(`Windows\System32\inetsrv\appcmd.exe`)
+	iisConfig = s.path(`Windows\System32\inetsrv\config\applicationHost.config`)
+	iisLogsRoot = s.path(`inetpub\logs\LogFiles`)
+	bootTraceStateFile = s.path(`ProgramData\Google\diagnostics\boottrace.json`)
+	fltmcPath = s.path(`Windows\System32\fltMC.exe`)
+	bootLog = s.path(`Windows\ntbtlog.txt`)
+	// The OS Config agent isn't installed, its inventory would be read from
+	// the metadata server.
+	osConfigAgentPath = s.path(`Program Files\Google\OSConfig\google_osconfig_agent.exe`)
+	werRoots = []string{s.path(`ProgramData\Microsoft\Windows\WER\ReportArchive`), s.path(`ProgramData\Microsoft\Windows\WER\LocalDumps`)}
+	pantherRoots = []string{s.path(`Windows\Panther`), s.path(`Windows\System32\Sysprep\Panther`)}
+	gceAgentFiles = []string{s.path(`ProgramData\Google\osconfig_agent`), s.path(`Program Files\Google\Compute Engine\instance_configs.cfg`)}
+
+	// The programs are only checked for, never run.
+	for _, p := range []string{crictlPath, ctrPath, wslPath, clusterServicePath, hyperVServicePath, appcmdPath, fltmcPath} {
+		s.write(t, p, "fake program")
+	}
+	s.write(t, iisConfig, `<configuration><system.applicationHost /></configuration>`)
+	// Files collected as they are.
+	s.file(t, filepath.Join(eventLogsRoot, "System.evtx"), "evtx")
+	s.file(t, filepath.Join(eventLogsRoot, "Application.evtx"), "evtx")
+	s.file(t, filepath.Join(k8sLogsRoot, "kubelet.log"), "kubelet started")
+	s.file(t, crashDump, "PAGEDU64")
+	s.file(t, bootLog, "Loaded driver \\SystemRoot\\system32\\ntoskrnl.exe")
+	s.file(t, containerdConfig, "version = 2")
+	s.file(t, filepath.Join(werRoots[0], "AppCrash_app.exe_1", "Report.wer"), "Version=1")
+	s.file(t, filepath.Join(werRoots[1], "app.exe.1234.dmp"), "MDMP")
+	s.file(t, filepath.Join(iisLogsRoot, "W3SVC1", "u_ex190601.log"), "#Software: Microsoft Internet Information Services 10.0")
+	s.file(t, filepath.Join(gceAgentFiles[0], "osconfig_agent.log"), "osconfig started")
+	s.file(t, filepath.Join(pantherRoots[0], "setupact.log"), "Info [Setup] Setup completed")
+	s.file(t, filepath.Join(pantherRoots[1], "setuperr.log"), "")
+	s.file(t, gceAgentFiles[1], "[accountManager]\r\ndisable = false")
+
+	return s, func() {
+		for i, p := range []*string{&eventLogsRoot, &k8sLogsRoot, &crashDump, &containerdConfig, &crictlPath, &ctrPath, &wslPath,
+			&clusterServicePath, &hyperVServicePath, &appcmdPath, &iisConfig, &iisLogsRoot, &bootTraceStateFile, &fltmcPath, &bootLog, &osConfigAgentPath} {
+			*p = oldPaths[i]
+		}
+		werRoots, gceAgentFiles, pantherRoots, elevated = oldWer, oldGCE, oldPanther, oldElevated
+		os.RemoveAll(root)
+		cleanupMetadata()
+		cleanup()
+	}
+}
+
+// path returns the path under the fake system of a Windows path relative to
+// C:\.
+func (s *fakeSystem) path(windowsPath string) string {
+	return filepath.Join(append([]string{s.root}, strings.Split(windowsPath, `\`)...)...)
+}
+
+// write creates the file at path with content.
+func (s *fakeSystem) write(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// file creates the file at path with content, and expects it to be
+// collected.
+func (s *fakeSystem) file(t *testing.T, path, content string) {
+	s.write(t, path, content)
+	s.files = append(s.files, path)
+}
+
+// manifestEntries parses the manifest written by gatherLogs into the files
+// listed under each folder, failing the test if it isn't complete.
+func manifestEntries(t *testing.T) map[string][]string {
+	data, err := ioutil.ReadFile(filepath.Join(tmpFolder, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := string(data)
+	if !strings.HasSuffix(manifest, manifestComplete+"\r\n") {
+		t.Fatalf("manifest is not complete:\n%s", manifest)
+	}
+	entries := make(map[string][]string)
+	folder := ""
+	for _, line := range strings.Split(strings.TrimSuffix(manifest, "\r\n"), "\r\n") {
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			folder = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			entries[folder] = []string{}
+		case strings.HasPrefix(line, "error\t"):
+		default:
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 {
+				t.Errorf("unexpected manifest line %q", line)
+				continue
+			}
+			entries[folder] = append(entries[folder], fields[1])
+		}
+	}
+	return entries
+}
+
+func TestGatherLogsEndToEnd(t *testing.T) {
+	system, cleanup := withFakeSystem(t)
+	defer cleanup()
+
+	folders := gatherLogs()
+
+	// Every gatherer produced its folder, without errors, and the manifest
+	// comes last at the root.
+	want := []string{"Cluster", "CrashDump", "Disk", "Event", "GCE", "GCE/startup_scripts", "HyperV", "IIS", "Kubernetes", "Network", "Program", "Setup", "System"}
+	if len(want) != len(gatherers()) {
+		t.Fatalf("expected %d folders, there are %d gatherers: update the test along with gatherers()", len(want), len(gatherers()))
+	}
+	var got []string
+	byName := make(map[string]logFolder)
+	for _, f := range folders {
+		if f.name == "" {
+			continue
+		}
+		got = append(got, f.name)
+		byName[f.name] = f
+		for _, err := range f.errs {
+			t.Errorf("%s: %v", f.name, err)
+		}
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("folders = %v, want %v", got, want)
+	}
+	if last := folders[len(folders)-1]; last.name != "" || len(last.files) != 1 || filepath.Base(last.files[0]) != manifestFileName {
+		t.Errorf("expected the manifest at the root last, got %v", last)
+	}
+
+	// The manifest lists exactly the files of each folder, and they all
+	// exist.
+	entries := manifestEntries(t)
+	for name, f := range byName {
+		listed, ok := entries[name]
+		if !ok {
+			t.Errorf("folder %s is missing from the manifest", name)
+			continue
+		}
+		if strings.Join(listed, ",") != strings.Join(f.files, ",") {
+			t.Errorf("manifest lists %v for %s, gatherLogs returned %v", listed, name, f.files)
+		}
+		for _, p := range f.files {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("%s file %s: %v", name, p, err)
+			}
+		}
+	}
+	if len(entries) != len(byName) {
+		t.Errorf("manifest has %d folders, gatherLogs returned %d", len(entries), len(byName))
+	}
+
+	// The files on the fake system were collected as they are.
+	collected := make(map[string]bool)
+	for _, f := range folders {
+		for _, p := range f.files {
+			collected[p] = true
+		}
+	}
+	for _, p := range system.files {
+		if !collected[p] {
+			t.Errorf("%s was not collected", p)
+		}
+	}
+	if len(system.exe.calls) == 0 {
+		t.Error("no commands ran")
+	}
+}
+
+// blockingExecutor fails the commands whose path contains fail and blocks
+// every other command until its context is done.
+type blockingExecutor struct {
+	fail string
+}
+
+func (b blockingExecutor) execute(ctx context.Context, path string, args []string, out io.Writer) error {
+	if strings.Contains(path, b.fail) {
+		return errors.New("exit status 1")
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestGatherLogsFailFast(t *testing.T) {
+	_, cleanup := withFakeSystem(t)
+	defer cleanup()
+	opts.failFast = true
+	// Every command but systeminfo runs until it is cancelled, so the
+	// collection only ends if the systeminfo error cancels it.
+	exe = blockingExecutor{fail: "systeminfo.exe"}
+
+	done := make(chan []logFolder, 1)
+	go func() {
+		folders := gatherLogs()
+		done <- folders
+	}()
+	var folders []logFolder
+	select {
+	case folders = <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("the collection wasn't cancelled after the first error")
+	}
+
+	if !strings.Contains(summary.String(), "The collection was cancelled on the first error, -fail-fast is set: exit status 1") {
+		t.Errorf("expected the cancellation in the summary:\n%s", summary.String())
+	}
+	notRun := 0
+	for _, f := range folders {
+		for _, e := range f.errs {
+			if strings.Contains(e.Error(), "were not run: context canceled") {
+				notRun++
+			}
+		}
+	}
+	if notRun == 0 {
+		t.Errorf("expected collectors left unrun by the cancellation, folders: %v", folders)
+	}
+}
+
+func TestGatherLogsStream(t *testing.T) {
+	system, cleanup := withFakeSystem(t)
+	defer cleanup()
+	archive := filepath.Join(tmpFolder, archiveFileName(formatZip))
+	var err error
+	if stream, err = createStreamArchive(archive, flate.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { stream = nil }()
+
+	folders := gatherLogs()
+	for _, f := range folders {
+		for _, err := range f.errs {
+			t.Errorf("%s: %v", f.name, err)
+		}
+	}
+	if err := stream.finish(folders); err != nil {
+		t.Fatal(err)
+	}
+
+	// The outputs of the collectors went straight into the bundle.
+	streamed := []string{"System/systeminfo.txt", "System/lsa.txt", "System/users.txt", "Network/connections.csv", "CrashDump/dump_config.txt"}
+	for _, name := range streamed {
+		if _, err := os.Stat(filepath.Join(tmpFolder, filepath.Base(name))); !os.IsNotExist(err) {
+			t.Errorf("%s was written to the temporary folder: %v", name, err)
+		}
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	contents := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		contents[f.Name] = string(data)
+	}
+	for _, name := range streamed {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("%s is missing from the bundle", name)
+		}
+	}
+	if got := contents["System/systeminfo.txt"]; !strings.HasPrefix(got, "# Command: ") {
+		t.Errorf("System/systeminfo.txt = %q, want the command output", got)
+	}
+	// The files collected whole are added at the end.
+	for _, p := range system.files {
+		found := false
+		for _, f := range folders {
+			if stringArrayIncludesString(f.files, p) {
+				_, ok := contents[archivePath(f.name, p)]
+				found = found || ok
+			}
+		}
+		if !found {
+			t.Errorf("%s is missing from the bundle", p)
+		}
+	}
+	if _, ok := contents[manifestFileName]; !ok {
+		t.Errorf("the manifest is missing from the bundle")
+	}
+}
@@ -0,0 +1,146 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ioLatencyCounters are the performance counters sampled by ioLatency, for
+// each physical disk and their total.
+var ioLatencyCounters = []string{`\PhysicalDisk(*)\Avg. Disk sec/Read`, `\PhysicalDisk(*)\Avg. Disk sec/Write`}
+
+// ioLatency samples the read and write latency of the disks with typeperf
+// into a CSV file, and notes the average and maximum of each in the summary.
+// It is a light alternative to a trace for slow disk complaints.
+type ioLatency struct {
+	outputFileName string
+}
+
+// command is the typeperf command taking the samples set with the
+// -io-latency flags.
+func (l ioLatency) command() cmd {
+	return typeperfCommand(ioLatencyCounters, opts.ioLatencyInterval, opts.ioLatencySamples, l.outputFileName)
+}
+
+// typeperfCommand is the typeperf command taking samples of counters every
+// interval, rounded down to whole seconds, into the CSV file outputFileName.
+func typeperfCommand(counters []string, interval time.Duration, samples int, outputFileName string) cmd {
+	args := make([]string, 0, len(counters))
+	for _, c := range counters {
+		args = append(args, `"`+c+`"`)
+	}
+	seconds := int(interval / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return cmd{
+		path:            `C:\Windows\System32\typeperf.exe`,
+		args:            fmt.Sprintf("%s -si %d -sc %d -f CSV -o %s -y", strings.Join(args, " "), seconds, samples, outputFileName),
+		outputFileName:  outputFileName,
+		cmdProducesFile: true,
+	}
+}
+
+func (l ioLatency) run(ctx context.Context) (string, error) {
+	if opts.ioLatencySamples <= 0 {
+		return "", skipError("disk latency sampling is off, -io-latency-samples is 0")
+	}
+	path, err := l.command().run(ctx)
+	if err != nil {
+		return path, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	defer f.Close()
+	stats, err := summarizeCounters(f)
+	if err != nil {
+		return path, fmt.Errorf("reading %s: %v", l.outputFileName, err)
+	}
+	for _, s := range stats {
+		summary.notef("%s: average %.1f ms, max %.1f ms over %d samples", s.counter, s.avg*1000, s.max*1000, s.samples)
+	}
+	return path, nil
+}
+
+// counterStats sums up the samples of a performance counter, latencies are
+// in seconds.
+type counterStats struct {
+	counter       string
+	samples       int
+	avg, min, max float64
+}
+
+// summarizeCounters computes the average, minimum and maximum of each
+// counter of a typeperf CSV file. The first column is the time of the sample, the first
+// row names the counters. Empty samples, which typeperf writes when a
+// counter has no value yet, are left out.
+func summarizeCounters(r io.Reader) ([]counterStats, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no header row")
+	}
+	var stats []counterStats
+	for col := 1; col < len(rows[0]); col++ {
+		s := counterStats{counter: counterName(rows[0][col])}
+		var sum float64
+		for _, row := range rows[1:] {
+			if col >= len(row) {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(row[col]), 64)
+			if err != nil {
+				continue
+			}
+			sum += v
+			s.samples++
+			if s.samples == 1 || v < s.min {
+				s.min = v
+			}
+			if v > s.max {
+				s.max = v
+			}
+		}
+		if s.samples == 0 {
+			continue
+		}
+		s.avg = sum / float64(s.samples)
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// counterName drops the computer name typeperf puts at the start of the
+// counter paths, \\HOST\PhysicalDisk(0 C:)\... becomes PhysicalDisk(0 C:)\....
+func counterName(path string) string {
+	if strings.HasPrefix(path, `\\`) {
+		if i := strings.Index(path[2:], `\`); i >= 0 {
+			return path[i+3:]
+		}
+	}
+	return strings.TrimPrefix(path, `\`)
+}
@@ -0,0 +1,91 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleLatencyCSV = `"(PDH-CSV 4.0)","\\WIN-1\PhysicalDisk(0 C:)\Avg. Disk sec/Read","\\WIN-1\PhysicalDisk(_Total)\Avg. Disk sec/Read","\\WIN-1\PhysicalDisk(0 C:)\Avg. Disk sec/Write"
+"06/01/2019 08:00:01.000"," "," "," "
+"06/01/2019 08:00:02.000","0.002000","0.002000","0.010000"
+"06/01/2019 08:00:03.000","0.004000","0.004000","0.030000"
+"06/01/2019 08:00:04.000","0.000000","0.000000","0.020000"
+`
+
+func TestSummarizeCounters(t *testing.T) {
+	stats, err := summarizeCounters(strings.NewReader(sampleLatencyCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []counterStats{
+		{counter: `PhysicalDisk(0 C:)\Avg. Disk sec/Read`, samples: 3, avg: 0.002, min: 0, max: 0.004},
+		{counter: `PhysicalDisk(_Total)\Avg. Disk sec/Read`, samples: 3, avg: 0.002, min: 0, max: 0.004},
+		{counter: `PhysicalDisk(0 C:)\Avg. Disk sec/Write`, samples: 3, avg: 0.02, min: 0.01, max: 0.03},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("summarizeCounters() = %+v, want %+v", stats, want)
+	}
+	for i, s := range stats {
+		w := want[i]
+		if s.counter != w.counter || s.samples != w.samples || math.Abs(s.avg-w.avg) > 1e-9 || math.Abs(s.min-w.min) > 1e-9 || math.Abs(s.max-w.max) > 1e-9 {
+			t.Errorf("stats[%d] = %+v, want %+v", i, s, w)
+		}
+	}
+
+	if _, err := summarizeCounters(strings.NewReader("")); err == nil {
+		t.Error("summarizeCounters() of an empty file succeeded, want an error")
+	}
+}
+
+func TestIOLatency(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.writeFiles = true
+	opts.ioLatencySamples = 3
+	opts.ioLatencyInterval = 2 * time.Second
+	outPath := filepath.Join(tmpFolder, "io_latency.csv")
+	call := `C:\Windows\System32\typeperf.exe \PhysicalDisk(*)\Avg. Disk sec/Read \PhysicalDisk(*)\Avg. Disk sec/Write -si 2 -sc 3 -f CSV -o ` + outPath + ` -y`
+	fake.outputs = map[string]string{call: sampleLatencyCSV}
+
+	path, err := ioLatency{"io_latency.csv"}.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != outPath || fake.callCount(call) != 1 {
+		t.Errorf("expected %q to write %s, got %s and calls %v", call, outPath, path, fake.calls)
+	}
+	s := summary.String()
+	for _, want := range []string{
+		`PhysicalDisk(_Total)\Avg. Disk sec/Read: average 2.0 ms, max 4.0 ms over 3 samples`,
+		`PhysicalDisk(0 C:)\Avg. Disk sec/Write: average 20.0 ms, max 30.0 ms over 3 samples`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in the summary:\n%s", want, s)
+		}
+	}
+
+	opts.ioLatencySamples = 0
+	if _, err := (ioLatency{"io_latency.csv"}).run(context.Background()); err == nil {
+		t.Error("expected sampling to be skipped with -io-latency-samples 0")
+	} else if _, ok := err.(skipError); !ok {
+		t.Errorf("run() error = %v, want a skipError", err)
+	}
+}
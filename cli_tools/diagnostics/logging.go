@@ -0,0 +1,98 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logOutput receives the JSON log records with -json-logs.
+var logOutput io.Writer = os.Stderr
+
+// logMu keeps JSON records from interleaving.
+var logMu sync.Mutex
+
+// logRecord is an event of the tool's own operation, logged as a line of
+// text or, with -json-logs, as a JSON object.
+type logRecord struct {
+	Level    string        `json:"level"`
+	Msg      string        `json:"msg"`
+	Folder   string        `json:"folder,omitempty"`
+	Command  string        `json:"command,omitempty"`
+	Duration time.Duration `json:"-"`
+	Err      error         `json:"-"`
+}
+
+func (r logRecord) MarshalJSON() ([]byte, error) {
+	type plain logRecord
+	out := struct {
+		plain
+		Duration string `json:"duration,omitempty"`
+		Error    string `json:"error,omitempty"`
+	}{plain: plain(r)}
+	if r.Duration > 0 {
+		out.Duration = r.Duration.String()
+	}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// logEvent logs r, only its message is logged as text.
+func logEvent(r logRecord) {
+	if !opts.jsonLogs {
+		log.Print(r.Msg)
+		return
+	}
+	writeLogRecord(r)
+}
+
+func writeLogRecord(r logRecord) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		data, _ = json.Marshal(logRecord{Level: "error", Msg: "error encoding log record: " + err.Error()})
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	logOutput.Write(append(data, '\n'))
+}
+
+// jsonLogWriter turns the lines of the standard logger into JSON records, so
+// that with -json-logs everything the tool logs is JSON.
+type jsonLogWriter struct{}
+
+func (jsonLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		level := "info"
+		if strings.HasPrefix(line, "Error") {
+			level = "error"
+		}
+		writeLogRecord(logRecord{Level: level, Msg: line})
+	}
+	return len(p), nil
+}
+
+// useJSONLogs sends the standard logger through jsonLogWriter.
+func useJSONLogs() {
+	log.SetFlags(0)
+	log.SetOutput(jsonLogWriter{})
+}
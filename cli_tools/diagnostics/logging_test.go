@@ -0,0 +1,85 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLogs(t *testing.T) {
+	var buf bytes.Buffer
+	oldOutput, oldOpts, oldFlags := logOutput, opts, log.Flags()
+	logOutput = &buf
+	opts.jsonLogs = true
+	useJSONLogs()
+	defer func() {
+		logOutput, opts = oldOutput, oldOpts
+		log.SetFlags(oldFlags)
+		log.SetOutput(os.Stderr)
+	}()
+
+	logEvent(logRecord{Level: "error", Msg: "Error: exit status 1 while running route", Command: `route.exe print`, Duration: 1500 * time.Millisecond, Err: errors.New("exit status 1")})
+	logEvent(logRecord{Level: "info", Msg: "Gathered System in 2s", Folder: "System", Duration: 2 * time.Second})
+	log.Printf("Error creating file %s: %v", "C:\\temp\\x.txt", "access denied")
+	log.Print("Collecting into C:\\temp\n")
+
+	want := []map[string]string{
+		{"level": "error", "msg": "Error: exit status 1 while running route", "command": "route.exe print", "duration": "1.5s", "error": "exit status 1"},
+		{"level": "info", "msg": "Gathered System in 2s", "folder": "System", "duration": "2s"},
+		{"level": "error", "msg": "Error creating file C:\\temp\\x.txt: access denied"},
+		{"level": "info", "msg": "Collecting into C:\\temp"},
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d log lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		var got map[string]string
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Errorf("line %d is not a JSON object: %v\n%s", i, err, line)
+			continue
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("line %d = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestTextLogs(t *testing.T) {
+	var buf bytes.Buffer
+	oldOutput, oldOpts, oldFlags := logOutput, opts, log.Flags()
+	log.SetFlags(0)
+	log.SetOutput(&buf)
+	logOutput = &buf
+	opts.jsonLogs = false
+	defer func() {
+		logOutput, opts = oldOutput, oldOpts
+		log.SetFlags(oldFlags)
+		log.SetOutput(os.Stderr)
+	}()
+
+	logEvent(logRecord{Level: "info", Msg: "Gathered System in 2s", Folder: "System", Duration: 2 * time.Second})
+	if got := buf.String(); got != "Gathered System in 2s\n" {
+		t.Errorf("text log = %q, want just the message", got)
+	}
+}
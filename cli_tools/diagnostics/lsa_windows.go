@@ -0,0 +1,58 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+const lsaKey = `SYSTEM\CurrentControlSet\Control\Lsa`
+
+// lsaValues and msv1Values are the LSA settings collected, which packages
+// are loaded and how NTLM and anonymous access are restricted. The LSA keys
+// also hold the pieces of the boot key and other secrets, so only values on
+// these lists are ever read: never change the queries below to read every
+// value of a key.
+var (
+	lsaValues = []string{
+		"Authentication Packages",
+		"Security Packages",
+		"Notification Packages",
+		"LmCompatibilityLevel",
+		"NoLMHash",
+		"LimitBlankPasswordUse",
+		"RestrictAnonymous",
+		"RestrictAnonymousSAM",
+		"EveryoneIncludesAnonymous",
+		"ForceGuest",
+		"DisableDomainCreds",
+		"DisableRestrictedAdmin",
+		"RunAsPPL",
+		"LsaCfgFlags",
+		"crashonauditfail",
+		"SCENoApplyLegacyAuditPolicy",
+	}
+	msv1Values = []string{
+		"NtlmMinClientSec",
+		"NtlmMinServerSec",
+		"RestrictSendingNTLMTraffic",
+		"RestrictReceivingNTLMTraffic",
+		"AuditReceivingNTLMTraffic",
+		"allowlocalsystemnullsessionfallback",
+	}
+)
+
+// lsa reports the LSA configuration, logon and authentication failures are
+// sometimes down to the packages loaded or the NTLM restrictions.
+var lsa = group{"lsa.txt", []section{
+	regQuery{key: lsaKey, values: lsaValues},
+	regQuery{key: lsaKey + `\MSV1_0`, values: msv1Values},
+}}
@@ -0,0 +1,73 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatherSystemLogsLsa(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake := &fakeRegistry{keys: map[string]map[string]interface{}{
+		lsaKey: {
+			"Authentication Packages": []string{"msv1_0"},
+			"Security Packages":       []string{"kerberos", "msv1_0", "schannel", "wdigest", "tspkg", "pku2u"},
+			"LmCompatibilityLevel":    uint64(5),
+			"RunAsPPL":                uint64(1),
+			// Not on the allowlist, must never be read.
+			"SecretEncryptionKey": []byte{0x01, 0x02},
+		},
+		lsaKey + `\MSV1_0`: {
+			"NtlmMinClientSec": uint64(0x20080000),
+			"Auth1":            "secret",
+		},
+		lsaKey + `\JD`: {"Class": "secret"},
+	}}
+	reg = fake
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "lsa.txt")
+	for _, want := range []string{
+		`Read registry values from HKLM\SYSTEM\CurrentControlSet\Control\Lsa`,
+		"Authentication Packages: msv1_0",
+		"Security Packages: kerberos; msv1_0; schannel; wdigest; tspkg; pku2u",
+		"LmCompatibilityLevel: 5",
+		"RunAsPPL: 1",
+		"NoLMHash: (not set)",
+		"NtlmMinClientSec: 537395200",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in lsa.txt:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "secret") || strings.Contains(got, "0102") {
+		t.Errorf("lsa.txt contains a disallowed value:\n%s", got)
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range lsaValues {
+		allowed[lsaKey+`\`+name] = true
+	}
+	for _, name := range msv1Values {
+		allowed[lsaKey+`\MSV1_0\`+name] = true
+	}
+	for _, read := range fake.read {
+		if strings.HasPrefix(strings.ToLower(read), strings.ToLower(lsaKey)) && !allowed[read] {
+			t.Errorf("read %s, which is not on the LSA allowlist", read)
+		}
+	}
+}
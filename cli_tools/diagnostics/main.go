@@ -15,34 +15,194 @@
 package main
 
 import (
-	"archive/zip"
+	"compress/flate"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
 	tmpFolder   = ""
 	errNonFatal = errors.New("method succeeded with errors")
+	opts        options
 )
 
+// options holds the flag controlled settings that the gatherers consult.
+type options struct {
+	trace bool
+	// traceOnly runs the wpr trace and nothing else, it is set by the
+	// trace subcommand.
+	traceOnly bool
+	// listCollectors lists the collectors rather than running them, it is
+	// set by the list-collectors subcommand.
+	listCollectors bool
+	// traceDuration is how long the wpr trace runs for.
+	traceDuration time.Duration
+	// bootTrace registers a wpr boot trace, or collects it if one was
+	// registered by a previous run.
+	bootTrace bool
+	// noNetwork skips collectors that make outbound network calls.
+	noNetwork bool
+	// lowImpact lowers the process priority, runs one gatherer at a time
+	// and pauses between collectors.
+	lowImpact bool
+	// fileHeaders adds the hostname, time and tool version after the
+	// command line that starts the files captured from command output.
+	fileHeaders bool
+	// maxFolderDuration bounds the time spent gathering each folder, the
+	// collectors still running when it is up are cancelled. 0 means no
+	// limit.
+	maxFolderDuration time.Duration
+	// policy overrides the default RunPolicy of every runner, unset
+	// fields leave the defaults in place.
+	policy RunPolicy
+	// timeoutGrace is how long a program whose timeout fired is given to
+	// stop after being asked to, before it is killed.
+	timeoutGrace time.Duration
+	// collectorTimeouts overrides the timeout of single collectors, named
+	// after their output file.
+	collectorTimeouts timeoutMap
+	// outputFormats asks the collectors that can for their output as CSV
+	// or JSON rather than text, named after their output file.
+	outputFormats formatMap
+	// ioLatencySamples is the number of disk latency samples taken, 0
+	// turns the sampling off, and ioLatencyInterval the time between them.
+	ioLatencySamples  int
+	ioLatencyInterval time.Duration
+	// memorySamples is the number of memory samples taken, 0 turns the
+	// sampling off, and memoryInterval the time between them.
+	memorySamples  int
+	memoryInterval time.Duration
+	// pktmonDuration is how long the pktmon packet capture runs for, 0
+	// turns it off.
+	pktmonDuration time.Duration
+	// dumpProcess is the PID or name of a process to take a full dump of.
+	dumpProcess string
+	// previous is the bundle given to -attach-previous, the static
+	// artifacts are carried forward from it. nil when it isn't set.
+	previous *previousBundle
+	// pluginDir holds user supplied .ps1 and .cmd scripts, each is run as
+	// a collector of the Plugins folder.
+	pluginDir string
+	// eventChannels are event log channels to export as text on top of
+	// the raw event logs.
+	eventChannels stringList
+	// eventIDs limits the -event-channel exports to the events with these
+	// IDs, all events are exported when it is empty.
+	eventIDs eventIDList
+	// excludeGlobs are patterns of files to leave out of the collected
+	// directories, matched against the base name and the full path.
+	excludeGlobs stringList
+	// failFast cancels the collection on the first collector error, by
+	// default the other collectors carry on.
+	failFast bool
+	// timeoutsAsWarnings records the collectors that timed out as warnings
+	// rather than errors, they are left out of errors.json, -fail-fast and
+	// the exit code.
+	timeoutsAsWarnings bool
+	// resolveNames are names to resolve into Network/name_resolution.txt.
+	resolveNames stringList
+	// resolveTimeout bounds the resolution of each of resolveNames.
+	resolveTimeout time.Duration
+	// registryExports are registry keys to export with reg export into
+	// System/registry.
+	registryExports stringList
+	// maxRegistryExportBytes is the largest registry export kept, a larger
+	// one is dropped with an error.
+	maxRegistryExportBytes int64
+	// followLogs are log files of which only what is appended during the
+	// collection is collected, into the Follow folder.
+	followLogs stringList
+	// followInterval splits the -follow-log deltas into one per interval,
+	// 0 captures a single delta at the end of the collection.
+	followInterval time.Duration
+	// readOnly skips the collectors that change the state of the system,
+	// such as traces.
+	readOnly bool
+	// obfuscatePaths replaces user names in the paths recorded in the
+	// manifest, the collected files are unchanged.
+	obfuscatePaths bool
+	// reproducible makes identical collected files give byte identical
+	// bundles: the archive entries are sorted, their times fixed and the
+	// temporary folder left out of the manifest.
+	reproducible bool
+	// since is the lower bound on the time of what the time aware
+	// collectors gather, such as events. Zero means no bound.
+	since time.Time
+	// uploadRateLimit caps the upload to the signed URL in bytes per
+	// second, 0 means no limit.
+	uploadRateLimit int64
+	// keepTemp keeps the temporary folder the logs are collected into.
+	keepTemp bool
+	// jsonLogs logs the tool's own operation as JSON lines.
+	jsonLogs bool
+}
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// eventIDList is a flag of event IDs that can be given several times.
+type eventIDList []int
+
+func (l *eventIDList) String() string {
+	ids := make([]string, len(*l))
+	for i, id := range *l {
+		ids[i] = strconv.Itoa(id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func (l *eventIDList) Set(value string) error {
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 || id > 65535 {
+		return fmt.Errorf("%q is not an event ID, expected a number from 0 to 65535", value)
+	}
+	*l = append(*l, id)
+	return nil
+}
+
+// runner collects one output file. It stops early, returning an error, when
+// ctx is done.
 type runner interface {
-	run() (string, error)
+	run(ctx context.Context) (string, error)
 }
 
+// logFolder is a folder of the bundle and the files that go in it. Files of a
+// folder with an empty name go at the root of the bundle.
 type logFolder struct {
 	name  string
 	files []string
+	// errs are the errors met while gathering the folder.
+	errs []error
+	// timeouts are the collectors of the folder that timed out, when
+	// -timeouts-as-warnings keeps them out of errs.
+	timeouts []error
 }
 
-func zipFiles(logs []logFolder, outputPath string) (err error) {
+// archiveFiles writes the files of logs into an archive of the given format
+// and compression level at outputPath.
+func archiveFiles(logs []logFolder, outputPath, format string, level int) (err error) {
 	newFile, err := os.Create(outputPath)
 	if err != nil {
 		return err
@@ -54,56 +214,117 @@ func zipFiles(logs []logFolder, outputPath string) (err error) {
 		}
 	}()
 
-	writer := zip.NewWriter(newFile)
-	defer writer.Close()
+	writer, err := newArchiveWriter(newFile, format, level)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cErr := writer.close(); cErr != nil && (err == nil || err == errNonFatal) {
+			err = cErr
+		}
+	}()
+
+	return writeEntries(writer, archiveEntries(logs))
+}
+
+// writeEntries adds the files of entries to writer. The files that can't be
+// read or written are logged and skipped, returning errNonFatal.
+func writeEntries(writer archiveWriter, entries []archiveEntry) (err error) {
+	for _, e := range entries {
+		file, info, aErr := openForArchive(e.path)
+		if aErr != nil {
+			log.Printf("Error opening file %s for archiving with error %v\n", e.path, aErr)
+			err = errNonFatal
+			continue
+		}
+
+		modTime := info.ModTime()
+		if opts.reproducible {
+			modTime = reproducibleModTime
+		}
+		if aErr = writer.add(e.name, info.Size(), modTime, file); aErr != nil {
+			log.Printf("Error saving file %s to archive with error %v\n", e.path, aErr)
+			err = errNonFatal
+		}
+		if cErr := file.Close(); cErr != nil {
+			err = errNonFatal
+		}
+	}
+	return err
+}
 
-	err = nil
+// archiveEntry is a file to archive and its path within the bundle.
+type archiveEntry struct {
+	name string
+	path string
+}
+
+// archiveEntries lists the files of logs in the order they are archived, the
+// order of the folders unless -reproducible sorts them by name.
+func archiveEntries(logs []logFolder) []archiveEntry {
+	var entries []archiveEntry
 	for _, folder := range logs {
 		for _, path := range folder.files {
-			file, zErr := os.Open(path)
-			if zErr != nil {
-				log.Printf("Error opening file %s for zipping with error %v\n", path, err)
-				err = errNonFatal
-				continue
-			}
-			defer func() {
-				if cErr := file.Close(); cErr != nil {
-					err = errNonFatal
-				}
-			}()
-
-			p := fmt.Sprintf("%s/%s", folder.name, filepath.Base(path))
-			zf, zErr := writer.Create(p)
-			if zErr != nil {
-				log.Printf("Error saving file %s to zip with error %v\n", path, err)
-				err = errNonFatal
-				continue
-			}
-
-			if _, zErr = io.Copy(zf, file); zErr != nil {
-				log.Printf("Error saving contents of file %s with error %v\n", path, err)
-				err = errNonFatal
-			}
+			entries = append(entries, archiveEntry{name: archivePath(folder.name, path), path: path})
 		}
 	}
-	return err
+	if opts.reproducible {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+	return entries
+}
+
+// archivePath is the path within the bundle of the file at path, collected
+// into the given folder.
+func archivePath(folder, path string) string {
+	p := filepath.Base(path)
+	if folder != "" {
+		p = fmt.Sprintf("%s/%s", folder, p)
+	}
+	return p
+}
+
+// uploadTimeout bounds the requests to the signed URL, and the upload of the
+// bundle on top of the time -upload-rate-limit makes it take.
+var uploadTimeout = 10 * time.Second
+
+// uploadDuration returns how long the upload of size bytes may take. A rate
+// limited upload gets the time the limit makes it take on top of
+// uploadTimeout, as slow as the limit is.
+func uploadDuration(size int64) time.Duration {
+	d := uploadTimeout
+	if opts.uploadRateLimit > 0 {
+		d += time.Duration(float64(size) / float64(opts.uploadRateLimit) * float64(time.Second))
+	}
+	return d
 }
 
 func uploadToSignedURL(uploadPath string, signedURL string) error {
+	// The client has no overall timeout, the connection and the response
+	// are bounded by the transport and the whole upload by the deadline of
+	// its request, which follows its size.
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: uploadTimeout}).DialContext,
+			TLSHandshakeTimeout:   uploadTimeout,
+			ResponseHeaderTimeout: uploadTimeout,
+		},
 	}
 
 	// The signed Url gives us the actual url to upload to
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
 	req, err := http.NewRequest("POST", signedURL, nil)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("x-goog-resumable", "start")
-	resp, err := client.Do(req)
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
+	resp.Body.Close()
 	uploadURL := resp.Header.Get("Location")
 
 	// Upload the file
@@ -111,32 +332,143 @@ func uploadToSignedURL(uploadPath string, signedURL string) error {
 	if err != nil {
 		return err
 	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	var body io.Reader = f
+	if opts.uploadRateLimit > 0 {
+		body = newThrottledReader(f, opts.uploadRateLimit)
+	}
 	bodyReader, bodyWriter := io.Pipe()
 	go func() {
 		defer bodyWriter.Close()
 		defer f.Close()
-		io.Copy(bodyWriter, f)
+		io.Copy(bodyWriter, body)
 	}()
 
+	ctx, cancel = context.WithTimeout(context.Background(), uploadDuration(fi.Size()))
+	defer cancel()
 	req, err = http.NewRequest("PUT", uploadURL, bodyReader)
 	if err != nil {
 		return err
 	}
-	_, err = client.Do(req)
-	return err
+	resp, err = client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
 }
 
-func moveZipFile(path string) (string, error) {
+func moveArchive(path string) (string, error) {
 	currDir, err := os.Getwd()
 	if err != nil {
 		return "", err
 	}
 
-	knownZipPath := filepath.Join(currDir, filepath.Base(path))
-	return knownZipPath, os.Rename(path, knownZipPath)
+	knownPath := filepath.Join(currDir, filepath.Base(path))
+	return knownPath, os.Rename(path, knownPath)
+}
+
+const (
+	// traceCommand is the subcommand that only takes a wpr trace.
+	traceCommand = "trace"
+	// listCollectorsCommand is the subcommand that lists the collectors
+	// and exits.
+	listCollectorsCommand = "list-collectors"
+)
+
+// parseCommand handles the subcommand at the start of args, if any, and
+// returns the flags that follow it.
+func parseCommand(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	switch args[0] {
+	case traceCommand:
+		opts.traceOnly = true
+		return args[1:]
+	case listCollectorsCommand:
+		opts.listCollectors = true
+		return args[1:]
+	}
+	return args
+}
+
+// cleanupTemp removes the temporary folder dir once the bundle is packaged
+// and delivered. It is kept when packaging failed, as it may hold the only
+// copy of the logs, and with -keep-temp.
+func cleanupTemp(dir string, packaged bool) error {
+	if !packaged {
+		log.Printf("Keeping the collected files in %s as packaging failed.", dir)
+		return nil
+	}
+	if opts.keepTemp {
+		log.Printf("Keeping the collected files in %s, -keep-temp is set.", dir)
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// bundleDelivery is how the bundle is archived and where it goes.
+type bundleDelivery struct {
+	format string
+	level  int
+	// maxBytes is -max-total-bundle-bytes, 0 for no limit.
+	maxBytes int64
+	// signedURL is the URL the bundle is uploaded to, when it's empty the
+	// bundle is moved to the current directory.
+	signedURL string
+}
+
+// packageBundle archives logs into archive and delivers it as d says, then
+// removes the temporary folder, which is kept when anything failed. nonFatal
+// is set when some files couldn't be archived.
+func packageBundle(logs []logFolder, archive string, d bundleDelivery) (nonFatal bool, err error) {
+	defer func() {
+		if cErr := cleanupTemp(tmpFolder, err == nil); cErr != nil {
+			log.Printf("Error removing %s: %v", tmpFolder, cErr)
+		}
+	}()
+
+	if stream != nil {
+		err = stream.finish(logs)
+	} else {
+		err = archiveFiles(logs, archive, d.format, d.level)
+	}
+	if err == errNonFatal {
+		nonFatal = true
+	} else if err != nil {
+		return false, fmt.Errorf("archiving files: %v", err)
+	}
+	if d.maxBytes > 0 {
+		if info, err := os.Stat(archive); err == nil && info.Size() > d.maxBytes {
+			return nonFatal, fmt.Errorf("the bundle is %d bytes, over -max-total-bundle-bytes %d, even with everything that could be dropped left out. It can be found at %s", info.Size(), d.maxBytes, archive)
+		}
+	}
+
+	if d.signedURL != "" {
+		if err := uploadToSignedURL(archive, d.signedURL); err != nil {
+			return nonFatal, fmt.Errorf("uploading to signed url: %v. Logs can be found at %s", err, archive)
+		}
+		log.Print("Logs uploaded to the supplied url successfully.")
+		return nonFatal, nil
+	}
+	knownPath, err := moveArchive(archive)
+	if err != nil {
+		return nonFatal, fmt.Errorf("moving logs to well known directory: %v. They can be found instead at: %s", err, archive)
+	}
+	log.Printf("Logs can be found at %s", knownPath)
+	return nonFatal, nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == versionCommand {
+		fmt.Println(buildInfo())
+		return
+	}
+
 	var err error
 	tmpFolder, err = ioutil.TempDir("", "diagnostics")
 	if err != nil {
@@ -144,38 +476,304 @@ func main() {
 	}
 
 	signedURL := flag.String("signedUrl", "", "The Signed Url to upload the zipped logs to.")
-	traceFlag := flag.Bool("trace", false, "Take a 10 minute trace of the system using wpr.")
-	flag.Parse()
+	archiveFormat := flag.String("archive-format", formatZip, "Format of the bundle, zip or tar.gz.")
+	compressLevel := flag.Int("compress-level", flate.DefaultCompression, "Compression level of the bundle from 0 (store, useful when the network link already compresses) to 9 (smallest). -1 uses the default level.")
+	flag.BoolVar(&opts.trace, "trace", false, "Take a trace of the system using wpr, as long as -duration, 10 minutes by default.")
+	flag.DurationVar(&opts.traceDuration, "duration", 10*time.Minute, "Length of the wpr trace taken with -trace or the trace subcommand.")
+	flag.BoolVar(&opts.bootTrace, "boot-trace", false, "Trace the next boot using wpr. Run once to register the trace, reboot, then run again to collect it.")
+	flag.BoolVar(&opts.noNetwork, "no-network", false, "Skip collectors that make outbound network calls (ping, tracert, nslookup).")
+	flag.BoolVar(&opts.lowImpact, "low-impact", false, "Run at below normal priority, one collector at a time with pauses in between, to limit the load on a busy machine.")
+	flag.BoolVar(&opts.timeoutsAsWarnings, "timeouts-as-warnings", false, "Record the collectors that time out as warnings in the summary rather than as errors, so they don't fail the run or show up in errors.json.")
+	flag.BoolVar(&opts.failFast, "fail-fast", false, "Cancel the whole collection as soon as a collector fails, for validation runs. By default the other collectors carry on and the failures are listed in the summary.")
+	flag.BoolVar(&opts.readOnly, "read-only", false, "Only run collectors that don't change the state of the system, skipping traces and disk analysis.")
+	flag.BoolVar(&opts.fileHeaders, "file-headers", false, "Add a header giving the hostname, time and tool version to each file captured from command output, after the command line.")
+	flag.DurationVar(&opts.maxFolderDuration, "max-duration-per-folder", 0, "Time budget for each folder (System, Network, ...), collectors still running when it is up are cancelled and the folder is marked partial. 0 means no limit.")
+	flag.DurationVar(&opts.policy.Timeout, "timeout", 0, "Timeout for a single attempt of each collector. Defaults to 10m for commands and 5m for WMI queries.")
+	flag.IntVar(&opts.policy.MaxAttempts, "max-attempts", 0, "Number of times to try each collector. Defaults to 1 for commands and 3 for WMI queries.")
+	flag.DurationVar(&opts.timeoutGrace, "timeout-grace", 10*time.Second, "Time a command whose timeout fired is given to stop after CTRL_BREAK, or wpr -cancel for wpr, before it is killed. 0 kills it right away.")
+	flag.Var(&opts.outputFormats, "output-format", "Format of the output of a single collector, as the name of its output file and text, csv or json, e.g. vms.txt=json. Only the PowerShell collectors can write csv and json, the extension of the file follows the format. A name no such collector has is refused, see list-collectors. Can be given several times.")
+	flag.Var(&opts.collectorTimeouts, "collector-timeout", "Timeout of a single collector, as the name of its output file and a duration, e.g. tracert_gstatic.txt=20m. Overrides -timeout. A name no collector has is refused, see list-collectors. Can be given several times.")
+	flag.DurationVar(&opts.policy.Backoff, "backoff", 0, "Wait before retrying a failed collector, doubled on each retry. Defaults to 1s.")
+	streamOutputs := flag.Bool("stream", false, "Write the output of the collectors straight into the bundle rather than into temporary files first, for machines short of disk space. The collectors take turns writing, so the collection is slower. Only for zip bundles, and not with -anonymize, -max-total-bundle-bytes or -reproducible.")
+	htmlReport := flag.Bool("html-report", false, "Add a report.html to the bundle, linking to each collected file and showing the summary and basic system facts.")
+	flag.IntVar(&opts.ioLatencySamples, "io-latency-samples", 30, "Number of disk read and write latency samples to take into Disk/io_latency.csv. 0 turns the sampling off.")
+	flag.DurationVar(&opts.ioLatencyInterval, "io-latency-interval", time.Second, "Time between disk latency samples, in whole seconds.")
+	flag.DurationVar(&opts.pktmonDuration, "pktmon-duration", 0, "Length of a pktmon packet capture of all interfaces to take into Network/pktmon.etl. Needs administrator privileges and Windows 10 2004 or later. 0 turns the capture off.")
+	flag.IntVar(&opts.memorySamples, "memory-samples", 30, "Number of commit charge, pool and paging samples to take into System/memory_trend.csv. 0 turns the sampling off.")
+	flag.DurationVar(&opts.memoryInterval, "memory-interval", time.Second, "Time between memory samples, in whole seconds.")
+	flag.StringVar(&opts.dumpProcess, "dump-process", "", "PID or name of a hung process to take a full memory dump of into CrashDump. Needs administrator privileges and Sysinternals ProcDump.")
+	attachPrevious := flag.String("attach-previous", "", "Previous bundle of this machine, a .zip or .tar.gz. Static artifacts such as the hardware inventory are carried forward from it, noted as unchanged in the manifest, when it is a bundle of this machine and the machine has not restarted since.")
+	listJSON := flag.Bool("json", false, "With list-collectors, print the collectors as JSON rather than as a table.")
+	hostsFile := flag.String("hosts", "", "File listing hosts to collect from instead of this machine, one per line. Each host is collected from over PowerShell remoting with the tool installed there, its bundle goes in a folder named after it and hosts_index.txt lists the outcome for every host. When some hosts fail or the run is interrupted, running again in the same folder collects from the remaining hosts only.")
+	hostConcurrency := flag.Int("host-concurrency", 4, "Number of hosts of -hosts collected from at the same time.")
+	flag.StringVar(&opts.pluginDir, "plugin-dir", "", "Folder of .ps1 and .cmd scripts to run as extra collectors, the output of each is captured into Plugins/<script>.txt. A script exiting with an error is recorded as a failed collector.")
+	flag.Var(&opts.eventChannels, "event-channel", "Event log channel to export as text into the Event folder, e.g. Microsoft-Windows-Hyper-V-Compute/Admin. Can be given several times.")
+	flag.Var(&opts.eventIDs, "event-id", "Only export the events with this ID from the -event-channel channels, combined with -since. Can be given several times.")
+	flag.Var(&opts.resolveNames, "resolve-name", "Name to resolve with the resolver of the machine into Network/name_resolution.txt, with the addresses it resolves to and how long it took, e.g. db.corp.example.com. Skipped with -no-network. Can be given several times.")
+	flag.DurationVar(&opts.resolveTimeout, "resolve-timeout", 5*time.Second, "Timeout of the resolution of each -resolve-name name.")
+	flag.Var(&opts.registryExports, "export-registry", `Registry key to export with reg export into System/registry, e.g. HKLM\SYSTEM\CurrentControlSet\Services\Tcpip. A root or a whole hive such as HKLM\SOFTWARE is refused. Can be given several times.`)
+	flag.Int64Var(&opts.maxRegistryExportBytes, "export-registry-max-bytes", 32<<20, "Largest -export-registry export to keep, a larger one is dropped and reported as an error.")
+	flag.Var(&opts.followLogs, "follow-log", "Log file of which only the bytes appended while the collection runs are collected into the Follow folder, rather than the whole file. Can be given several times.")
+	flag.DurationVar(&opts.followInterval, "follow-interval", 0, "Capture the -follow-log deltas every interval, each into its own numbered file, e.g. 30s. 0 captures a single delta at the end of the collection.")
+	flag.Var(&opts.excludeGlobs, "exclude-glob", "Pattern of files to leave out of the collected directories, e.g. *.pfx, matched against the base name and the full path. Can be given several times.")
+	anonymize := flag.Bool("anonymize", false, "Replace the hostname, user names and IP addresses with tokens in the file names, manifest, headers and contents of the bundle, for sharing it publicly. Implies -obfuscate-paths. Text files in UTF-8 or UTF-16 are redacted, binary files such as event logs, traces and dumps are left out and listed in the summary.")
+	flag.BoolVar(&opts.reproducible, "reproducible", false, "Make the bundle byte for byte reproducible, for diffing bundles: sort the archive entries, give them a fixed modification time and leave the temporary folder out of the manifest. The tokens of -obfuscate-paths and -anonymize are then the same in every run, and easier to reverse.")
+	flag.BoolVar(&opts.obfuscatePaths, "obfuscate-paths", false, `Replace user names in the paths recorded in the manifest (C:\Users\<name>) with a token, the same for a user throughout the bundle but different in every run unless -reproducible is set.`)
+	since := flag.String("since", "", "Only collect events and records from this time on, as an RFC3339 time (2019-06-01T00:00:00Z) or a duration before now (24h). Collectors that can't filter by time note that they ignored it.")
+	maxBundleBytes := flag.Int64("max-total-bundle-bytes", 0, "Hard limit on the size of the bundle. Files are dropped, crash dumps first, then event logs, then traces, until it fits, and the dropped files are listed in the summary. 0 means no limit.")
+	flag.Int64Var(&opts.uploadRateLimit, "upload-rate-limit", 0, "Limit the upload to the signed URL to this many bytes per second, to spare the egress of a busy instance. 0 means no limit.")
+	flag.BoolVar(&opts.keepTemp, "keep-temp", false, "Keep the temporary folder the logs are collected into, for debugging.")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile of the diagnostics tool itself to this file.")
+	memProfile := flag.String("memprofile", "", "Write a heap profile of the diagnostics tool itself to this file, taken at the end of the run.")
+	flag.BoolVar(&opts.jsonLogs, "json-logs", false, "Log the tool's own operation as JSON lines with level, msg, folder, command, duration and error fields.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [%s|%s] [flags]\n       %s %s\n\n", filepath.Base(os.Args[0]), traceCommand, listCollectorsCommand, filepath.Base(os.Args[0]), versionCommand)
+		fmt.Fprintf(flag.CommandLine.Output(), "With %s, only a wpr trace of -duration is taken and packaged, the other collectors are skipped. With %s, the collectors that the flags given would run are listed with their folder, whether they make network calls or change the system, the privileges they need and their timeout, nothing is collected. With %s, the version, commit and build date of the tool are printed.\n\n", traceCommand, listCollectorsCommand, versionCommand)
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(parseCommand(os.Args[1:]))
+	if opts.jsonLogs {
+		useJSONLogs()
+	}
+	if *anonymize {
+		opts.obfuscatePaths = true
+	}
+	if *archiveFormat != formatZip && *archiveFormat != formatTarGz {
+		log.Fatalf("Invalid -archive-format %q, expected %s or %s", *archiveFormat, formatZip, formatTarGz)
+	}
+	if *compressLevel < flate.DefaultCompression || *compressLevel > flate.BestCompression {
+		log.Fatalf("Invalid -compress-level %d, expected 0-9", *compressLevel)
+	}
+	if *streamOutputs && (*archiveFormat != formatZip || *anonymize || *maxBundleBytes > 0 || opts.reproducible) {
+		log.Fatalf("Invalid -stream, it needs -archive-format %s and can't be used with -anonymize, -max-total-bundle-bytes or -reproducible, which rework the files before archiving", formatZip)
+	}
+	if opts.traceDuration <= 0 {
+		log.Fatalf("Invalid -duration %v, expected a positive duration", opts.traceDuration)
+	}
+	if opts.ioLatencySamples < 0 || opts.ioLatencyInterval < time.Second {
+		log.Fatalf("Invalid disk latency sampling, expected -io-latency-samples of 0 or more and -io-latency-interval of 1s or more")
+	}
+	if opts.memorySamples < 0 || opts.memoryInterval < time.Second {
+		log.Fatalf("Invalid memory sampling, expected -memory-samples of 0 or more and -memory-interval of 1s or more")
+	}
+	if opts.pktmonDuration < 0 {
+		log.Fatalf("Invalid -pktmon-duration %v, expected 0 or a positive duration", opts.pktmonDuration)
+	}
+	if *attachPrevious != "" {
+		if opts.previous, err = readPreviousBundle(*attachPrevious); err != nil {
+			log.Fatalf("Invalid -attach-previous %q: %v", *attachPrevious, err)
+		}
+	}
+	var hosts []string
+	if *hostsFile != "" {
+		if hosts, err = readHostsFile(*hostsFile); err != nil {
+			log.Fatalf("Invalid -hosts %q: %v", *hostsFile, err)
+		}
+	}
+	if *hostConcurrency < 1 {
+		log.Fatalf("Invalid -host-concurrency %d, expected 1 or more", *hostConcurrency)
+	}
+	if opts.pluginDir != "" {
+		if info, err := os.Stat(opts.pluginDir); err != nil || !info.IsDir() {
+			log.Fatalf("Invalid -plugin-dir %q, expected a folder", opts.pluginDir)
+		}
+	}
+	keys, err := parseRegistryExports(opts.registryExports)
+	if err != nil {
+		log.Fatalf("Invalid -export-registry: %v", err)
+	}
+	opts.registryExports = keys
+	if opts.timeoutGrace < 0 {
+		log.Fatalf("Invalid -timeout-grace %v, expected 0 or a positive duration", opts.timeoutGrace)
+	}
+	if opts.resolveTimeout <= 0 {
+		log.Fatalf("Invalid -resolve-timeout %v, expected a positive duration", opts.resolveTimeout)
+	}
+	if opts.followInterval < 0 {
+		log.Fatalf("Invalid -follow-interval %v, expected 0 or a positive duration", opts.followInterval)
+	}
+	if opts.maxRegistryExportBytes <= 0 {
+		log.Fatalf("Invalid -export-registry-max-bytes %d, expected a positive size", opts.maxRegistryExportBytes)
+	}
+	if strings.ContainsAny(opts.dumpProcess, `"*?`) {
+		log.Fatalf("Invalid -dump-process %q, expected a PID or a process name", opts.dumpProcess)
+	}
+	if *maxBundleBytes < 0 {
+		log.Fatalf("Invalid -max-total-bundle-bytes %d, expected 0 or more bytes", *maxBundleBytes)
+	}
+	if opts.uploadRateLimit < 0 {
+		log.Fatalf("Invalid -upload-rate-limit %d, expected 0 or more bytes per second", opts.uploadRateLimit)
+	}
+	if *since != "" {
+		if opts.since, err = parseSince(*since, time.Now()); err != nil {
+			log.Fatalf("Invalid -since: %v", err)
+		}
+	}
+	for _, pattern := range opts.excludeGlobs {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			log.Fatalf("Invalid -exclude-glob %q: %v", pattern, err)
+		}
+	}
+	if err := checkCollectorNames(); err != nil {
+		log.Fatalf("Invalid %v", err)
+	}
 
-	nonFatalErrorsPresent := false
-	paths, err := gatherLogs(*traceFlag)
+	if opts.listCollectors {
+		os.RemoveAll(tmpFolder)
+		if err := listCollectors(os.Stdout, *listJSON); err != nil {
+			log.Fatalf("Error listing the collectors: %v", err)
+		}
+		return
+	}
+
+	if len(hosts) > 0 {
+		// Nothing is collected from this machine, each host makes its own
+		// bundle.
+		os.RemoveAll(tmpFolder)
+		dir, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Error getting the current directory: %v", err)
+		}
+		statePath := filepath.Join(dir, hostsStateFileName)
+		state, err := loadHostsState(statePath)
+		if err != nil {
+			log.Fatalf("Error reading %s, remove it to collect from every host again: %v", statePath, err)
+		}
+		results := collectHosts(context.Background(), remoteTransport, hosts, dir, *hostConcurrency, state)
+		indexPath := filepath.Join(dir, hostsIndexFileName)
+		if err := writeHostsIndex(indexPath, dir, results); err != nil {
+			log.Fatalf("Error writing %s: %v", indexPath, err)
+		}
+		log.Printf("Bundles of the hosts are indexed in %s", indexPath)
+		if failed := failedHosts(results); failed > 0 {
+			log.Fatalf("Collecting failed on %d of %d hosts, the others were still collected. Run again in %s to collect from the failed hosts only.", failed, len(hosts), dir)
+		}
+		// Every host is done, the next run starts over.
+		if err := os.Remove(statePath); err != nil {
+			log.Printf("Error removing %s: %v", statePath, err)
+		}
+		return
+	}
+
+	archive := filepath.Join(tmpFolder, archiveFileName(*archiveFormat))
+	if *streamOutputs {
+		if stream, err = createStreamArchive(archive, *compressLevel); err != nil {
+			log.Fatalf("Error creating the bundle to stream into: %v", err)
+		}
+	}
+
+	prof, err := startProfiling(*cpuProfile, *memProfile)
 	if err != nil {
-		nonFatalErrorsPresent = true
+		log.Fatalf("Error starting the profile: %v", err)
 	}
 
-	zipFile := filepath.Join(tmpFolder, "logs.zip")
-	err = zipFiles(paths, zipFile)
-	if err == errNonFatal {
+	// The progress goes to stdout and the log to stderr, on a console both
+	// show up together, so the log clears the bar before each line.
+	progress = newProgressReporter(os.Stdout, isTerminal(os.Stdout))
+	if opts.jsonLogs {
+		logOutput = progress.logWriter(logOutput)
+	} else {
+		log.SetOutput(progress.logWriter(os.Stderr))
+	}
+
+	nonFatalErrorsPresent := false
+	paths := gatherLogs()
+	// A failed collector fails the run, with -timeouts-as-warnings one that
+	// timed out doesn't.
+	if len(errorRecords(paths)) > 0 {
+		nonFatalErrorsPresent = true
+	}
+	for _, name := range unmatchedFormats() {
+		log.Printf("Error: -output-format %s matches no PowerShell collector that ran", name)
+		summary.errorf("-output-format %s matches no PowerShell collector that ran, it names the output file of a collector such as vms.txt", name)
 		nonFatalErrorsPresent = true
-	} else if err != nil {
-		log.Fatalf("Error zipping files: %v", err)
+	}
+	for _, name := range unmatchedTimeouts() {
+		log.Printf("Error: -collector-timeout %s matches no collector that ran", name)
+		summary.errorf("-collector-timeout %s matches no collector that ran, it names the output file of a collector such as systeminfo.txt", name)
+		nonFatalErrorsPresent = true
+	}
+	// The checks read the collected files, which -stream only writes into
+	// the bundle.
+	if stream != nil {
+		summary.notef("The health checks were skipped, -stream doesn't keep the collected files on disk for them to read")
+	} else {
+		findings := runRules(findingRules, newCollection(paths))
+		if len(findings) > 0 {
+			summary.warnf("The health checks found %d problems, see %s for what to do about them", len(findings), findingsTextFileName)
+		}
+		if files, err := writeFindings(tmpFolder, findings); err != nil {
+			log.Printf("Error writing the findings: %v", err)
+			nonFatalErrorsPresent = true
+		} else {
+			paths = append(paths, logFolder{name: "", files: files})
+		}
+	}
+	if *maxBundleBytes > 0 {
+		var dropped []droppedFile
+		paths, dropped = fitBundle(paths, *maxBundleBytes)
+		for _, d := range dropped {
+			summary.warnf("Dropped %s from %s (%d bytes) to stay under -max-total-bundle-bytes", d.path, d.folder, d.size)
+		}
 	}
 
-	if *signedURL != "" {
-		if err = uploadToSignedURL(zipFile, *signedURL); err != nil {
-			log.Fatalf("Error uploading to signed url: %v. Logs can be found at %s", err, zipFile)
+	if *anonymize {
+		var left []string
+		paths, left = leaveOutBinaries(paths)
+		for _, p := range left {
+			summary.warnf("Left %s out of the bundle, -anonymize can't remove identifying data from binary files", p)
 		}
-		log.Print("Logs uploaded to the supplied url successfully.")
+	}
+
+	summaryPath := filepath.Join(tmpFolder, summaryFileName)
+	if err := summary.write(summaryPath); err != nil {
+		log.Printf("Error writing summary: %v", err)
+		nonFatalErrorsPresent = true
+	} else {
+		paths = append(paths, logFolder{name: "", files: []string{summaryPath}})
+	}
+	errorsPath := filepath.Join(tmpFolder, errorsFileName)
+	if err := writeErrorsJSON(errorsPath, paths); err != nil {
+		log.Printf("Error writing %s: %v", errorsFileName, err)
+		nonFatalErrorsPresent = true
 	} else {
-		knownZipPath, err := moveZipFile(zipFile)
+		paths = append(paths, logFolder{name: "", files: []string{errorsPath}})
+	}
+	if *htmlReport {
+		reportPath := filepath.Join(tmpFolder, reportFileName)
+		if err := writeReport(reportPath, paths, summary); err != nil {
+			log.Printf("Error writing the HTML report: %v", err)
+			nonFatalErrorsPresent = true
+		} else {
+			paths = append(paths, logFolder{name: "", files: []string{reportPath}})
+		}
+	}
+
+	if *anonymize {
+		hostname, _ := os.Hostname()
+		paths, err = anonymizeFolders(paths, newRedactionDictionary(hostname, localUsers()), filepath.Join(tmpFolder, "anonymized"))
 		if err != nil {
-			log.Fatalf("Error moving logs to well known directory. They can be found instead at: %s", zipFile)
+			prof.fatalf("Error anonymizing the bundle, not packaging it: %v", err)
 		}
-		log.Printf("Logs can be found at %s", knownZipPath)
 	}
-	os.RemoveAll(tmpFolder)
+
+	nonFatal, err := packageBundle(paths, archive, bundleDelivery{
+		format:    *archiveFormat,
+		level:     *compressLevel,
+		maxBytes:  *maxBundleBytes,
+		signedURL: *signedURL,
+	})
+	if err != nil {
+		prof.fatalf("Error packaging the logs: %v", err)
+	}
+	if nonFatal {
+		nonFatalErrorsPresent = true
+	}
+	if err := prof.stop(); err != nil {
+		log.Printf("Error writing the profile: %v", err)
+	}
 
 	if nonFatalErrorsPresent {
-		log.Fatal("Errors occured while collecting and zipping some logs.\nUnaffected logs were still packaged and available.")
+		log.Fatal("Errors occured while collecting and archiving some logs.\nUnaffected logs were still packaged and available.")
 	}
 }
@@ -0,0 +1,248 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCleanupTemp(t *testing.T) {
+	tests := []struct {
+		name     string
+		packaged bool
+		keepTemp bool
+		removed  bool
+	}{
+		{"Packaged", true, false, true},
+		{"Packaging failed", false, false, false},
+		{"Keep temp", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cleanup_test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(dir, "systeminfo.txt"), []byte("content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			oldOpts := opts
+			defer func() { opts = oldOpts }()
+			opts.keepTemp = tt.keepTemp
+
+			if err := cleanupTemp(dir, tt.packaged); err != nil {
+				t.Fatalf("cleanupTemp() error = %v", err)
+			}
+			_, err = os.Stat(dir)
+			if removed := os.IsNotExist(err); removed != tt.removed {
+				t.Errorf("temp folder removed = %v, want %v", removed, tt.removed)
+			}
+		})
+	}
+}
+
+func TestPackageBundleCleanup(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       bundleDelivery
+		wantErr bool
+	}{
+		{name: "Moved", d: bundleDelivery{format: formatZip}},
+		{name: "Over the size limit", d: bundleDelivery{format: formatZip, maxBytes: 1}, wantErr: true},
+		{name: "Upload failed", d: bundleDelivery{format: formatZip, signedURL: "http://127.0.0.1:0/signed"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "package_test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			oldTmp, oldWd := tmpFolder, ""
+			if oldWd, err = os.Getwd(); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				tmpFolder = oldTmp
+				os.Chdir(oldWd)
+			}()
+			// The bundle is moved to the current directory.
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			tmpFolder = filepath.Join(dir, "tmp")
+			if err := os.Mkdir(tmpFolder, 0755); err != nil {
+				t.Fatal(err)
+			}
+			systeminfo := filepath.Join(tmpFolder, "systeminfo.txt")
+			if err := ioutil.WriteFile(systeminfo, []byte("content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = packageBundle([]logFolder{{name: "System", files: []string{systeminfo}}}, filepath.Join(tmpFolder, archiveFileName(formatZip)), tt.d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("packageBundle() error = %v, want error %v", err, tt.wantErr)
+			}
+			_, statErr := os.Stat(tmpFolder)
+			if removed := os.IsNotExist(statErr); removed == tt.wantErr {
+				t.Errorf("temp folder removed = %v, want %v", removed, !tt.wantErr)
+			}
+			if !tt.wantErr {
+				if _, err := os.Stat(filepath.Join(dir, archiveFileName(formatZip))); err != nil {
+					t.Errorf("expected the bundle in the current directory: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	oldOpts := opts
+	defer func() { opts = oldOpts }()
+
+	tests := []struct {
+		args      []string
+		want      []string
+		traceOnly bool
+	}{
+		{nil, nil, false},
+		{[]string{"-trace", "-duration", "2m"}, []string{"-trace", "-duration", "2m"}, false},
+		{[]string{"trace", "-duration", "2m"}, []string{"-duration", "2m"}, true},
+		{[]string{"trace"}, []string{}, true},
+		{[]string{"list-collectors", "-json"}, []string{"-json"}, false},
+	}
+	for _, tt := range tests {
+		opts.traceOnly, opts.listCollectors = false, false
+		got := parseCommand(tt.args)
+		if !reflect.DeepEqual(got, tt.want) || opts.traceOnly != tt.traceOnly {
+			t.Errorf("parseCommand(%q) = %q, traceOnly %v, want %q, %v", tt.args, got, opts.traceOnly, tt.want, tt.traceOnly)
+		}
+		if listing := len(tt.args) > 0 && tt.args[0] == listCollectorsCommand; opts.listCollectors != listing {
+			t.Errorf("parseCommand(%q) listCollectors = %v, want %v", tt.args, opts.listCollectors, listing)
+		}
+	}
+}
+
+func TestEventIDListSet(t *testing.T) {
+	var l eventIDList
+	for _, v := range []string{"41", "6008", "0"} {
+		if err := l.Set(v); err != nil {
+			t.Fatalf("Set(%q) error = %v", v, err)
+		}
+	}
+	if !reflect.DeepEqual(l, eventIDList{41, 6008, 0}) || l.String() != "41,6008,0" {
+		t.Errorf("eventIDList = %v, want [41 6008 0]", l)
+	}
+	for _, bad := range []string{"", "kernel-power", "-1", "65536"} {
+		if err := l.Set(bad); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestReproducibleBundle(t *testing.T) {
+	oldOpts, oldTmp, oldSummary, oldKey, oldClock := opts, tmpFolder, summary, tokenKey, collectionClock
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		opts, tmpFolder, summary, tokenKey, collectionClock = oldOpts, oldTmp, oldSummary, oldKey, oldClock
+		os.Chdir(oldWd)
+	}()
+	opts.reproducible, opts.obfuscatePaths = true, true
+
+	// bundle runs what main does after gathering, from a temporary folder of
+	// its own and at its own time, and returns the bytes of the bundle.
+	bundle := func(run int, modTime time.Time) []byte {
+		dir, err := ioutil.TempDir("", "reproducible_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		tmpFolder = filepath.Join(dir, fmt.Sprintf("diagnostics%d", run))
+		if err := os.Mkdir(tmpFolder, 0755); err != nil {
+			t.Fatal(err)
+		}
+		summary, tokenKey = &runSummary{}, newTokenKey()
+		collectionClock = func() time.Time { return modTime }
+
+		systeminfo := filepath.Join(tmpFolder, "systeminfo.txt")
+		if err := ioutil.WriteFile(systeminfo, []byte("Host Name: WIN-DB1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(systeminfo, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		msinfo := filepath.Join(tmpFolder, "msinfo32.txt")
+		commandLines.record(systeminfo, `C:\Windows\System32\systeminfo.exe`)
+		summary.warnf("Dropped %s from System to stay under -max-total-bundle-bytes", msinfo)
+		paths := []logFolder{{
+			name:  "System",
+			files: []string{systeminfo},
+			errs:  []error{runError{`C:\Windows\System32\msinfo32.exe /report ` + msinfo, fmt.Errorf(`open C:\Users\jdoe\ntuser.dat: access denied`)}},
+		}}
+
+		m, err := createManifest(filepath.Join(tmpFolder, manifestFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.add(paths[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.close(); err != nil {
+			t.Fatal(err)
+		}
+		root := logFolder{files: []string{filepath.Join(tmpFolder, manifestFileName)}}
+		for name, write := range map[string]func(string) error{
+			summaryFileName: summary.write,
+			errorsFileName:  func(p string) error { return writeErrorsJSON(p, paths) },
+			reportFileName:  func(p string) error { return writeReport(p, paths, summary) },
+		} {
+			p := filepath.Join(tmpFolder, name)
+			if err := write(p); err != nil {
+				t.Fatal(err)
+			}
+			root.files = append(root.files, p)
+		}
+		paths = append(paths, root)
+
+		if _, err := packageBundle(paths, filepath.Join(tmpFolder, archiveFileName(formatZip)), bundleDelivery{format: formatZip}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, archiveFileName(formatZip)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := bundle(1, time.Now())
+	second := bundle(2, time.Now().Add(-time.Hour))
+	if !bytes.Equal(first, second) {
+		t.Errorf("two -reproducible bundles of the same files differ")
+	}
+}
@@ -15,23 +15,75 @@
 package main
 
 import (
-	"errors"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-const (
+// The folders and files collected whole, tests point them elsewhere.
+var (
 	eventLogsRoot = `C:\Windows\System32\winevt\Logs`
 	k8sLogsRoot   = `C:\etc\kubernetes\logs`
 	// TODO: user can change the dump path, so better fetch the path from Registry:
 	// https://support.microsoft.com/en-us/help/254649/overview-of-memory-dump-file-options-for-windows
 	// But it's not likely people will do that.
 	crashDump = `C:\Windows\MEMORY.dmp`
+	// bootLog lists the drivers loaded and not loaded during the last
+	// boot, Windows only writes it when boot logging is on.
+	bootLog = `C:\Windows\ntbtlog.txt`
+)
+
+const (
+	// bootEventsXPath selects the System log events around boot and
+	// shutdown: kernel start/stop, unexpected power loss, user and
+	// process initiated shutdowns and the event log service start/stop.
+	bootEventsXPath = "*[System[(EventID=12 or EventID=13 or EventID=41 or EventID=1074 or EventID=1076 or EventID=6005 or EventID=6006 or EventID=6008)]]"
+	powershell      = `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`
+)
+
+var (
+	// minOutputSizes is the smallest size an output file is expected to
+	// have when the command producing it worked, keyed by file name.
+	// Outputs not listed only need to be non empty.
+	minOutputSizes = map[string]int64{
+		"systeminfo.txt": 1024,
+		"msinfo32.txt":   16 * 1024,
+		"bcdedit.txt":    256,
+		"drivers.txt":    1024,
+		"pnputil.txt":    1024,
+		"ipconfig.txt":   256,
+		"route.txt":      256,
+		"netstat.txt":    256,
+		"trace.etl":      64 * 1024,
+	}
+
+	errNoNetwork   skipError = "makes outbound network calls and -no-network is set"
+	errNotElevated skipError = "requires administrator privileges"
+	errReadOnly    skipError = "changes the state of the system and -read-only is set"
+
+	// wslPath is the Windows Subsystem for Linux, it is only there when
+	// WSL is installed.
+	wslPath = `C:\Windows\System32\wsl.exe`
+	// fltmcPath manages the file system minifilters, it is missing from
+	// some minimal installs.
+	fltmcPath = `C:\Windows\System32\fltMC.exe`
+	// elevated is whether the tool runs with administrator privileges,
+	// it is set at the start of gatherLogs.
+	elevated = true
+	// exe runs the external commands and wmiSrc runs the WMI queries, tests
+	// replace them with fakes.
+	exe    executor  = osExecutor{}
+	wmiSrc wmiSource = newCachedWmiSource(connectWmi)
 )
 
 type cmd struct {
@@ -41,139 +93,731 @@ type cmd struct {
 	// True when the command produces its own file and doesn't need one
 	// created from stdout.
 	cmdProducesFile bool
+	// True when the command makes outbound network calls, these are
+	// skipped when running with -no-network.
+	network bool
+	// True when the command changes the state of the system, such as
+	// starting a trace, these are skipped when running with -read-only.
+	mutates bool
+	// admin says how the command copes without administrator privileges.
+	admin adminNeed
+	// unelevatedArgs replace args when running without administrator
+	// privileges and admin is adminLimited.
+	unelevatedArgs string
+	// inspect, when set, is given the output of a successful run to look
+	// for problems worth raising in the summary.
+	inspect func(output string)
+	policy  RunPolicy
+}
+
+// adminNeed describes how much a runner depends on administrator privileges.
+type adminNeed int
+
+const (
+	// adminNone runners work the same with or without privileges.
+	adminNone adminNeed = iota
+	// adminLimited runners still work without privileges but their output
+	// is incomplete.
+	adminLimited
+	// adminRequired runners can't work at all without privileges and are
+	// skipped.
+	adminRequired
+)
+
+// skipError is returned by runners that chose not to run, it says why and
+// isn't treated as a failure.
+type skipError string
+
+func (e skipError) Error() string {
+	return string(e)
+}
+
+// resolvedArgs returns the args to run the command with, given the current
+// privileges. Commands that need privileges they don't have return a
+// skipError.
+func (command cmd) resolvedArgs() (string, error) {
+	if command.network && opts.noNetwork {
+		return "", errNoNetwork
+	}
+	if command.mutates && opts.readOnly {
+		return "", errReadOnly
+	}
+	if elevated {
+		return command.args, nil
+	}
+	switch command.admin {
+	case adminRequired:
+		return "", errNotElevated
+	case adminLimited:
+		summary.warnf("%s ran without administrator privileges, its output may be incomplete", command.title())
+		if command.unelevatedArgs != "" {
+			return command.unelevatedArgs, nil
+		}
+	}
+	return command.args, nil
+}
+
+// executor runs an external program. When out is non nil the program's
+// stdout and stderr are written to it. The program is stopped if ctx is
+// done before it exits, see stopGracefully.
+type executor interface {
+	execute(ctx context.Context, path string, args []string, out io.Writer) error
+}
+
+type osExecutor struct{}
+
+func (osExecutor) execute(ctx context.Context, path string, args []string, out io.Writer) error {
+	c := exec.Command(path, args...)
+	if out != nil {
+		c.Stdout = out
+		c.Stderr = out
+	}
+	c.SysProcAttr = processGroupAttr()
+	if err := c.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		stopGracefully(osProcess{path: path, process: c.Process}, done, opts.timeoutGrace)
+		return ctx.Err()
+	}
+}
+
+// stoppable is a running program that can be asked to stop or be killed.
+type stoppable interface {
+	interrupt() error
+	kill() error
+}
+
+// stopGracefully stops a program whose context is done, usually because its
+// timeout fired. Killing some programs outright leaves the system in a bad
+// state, a wpr killed mid trace keeps the kernel logger running, so p is
+// first asked to stop and given grace to exit, then killed. done receives
+// the exit of the program.
+func stopGracefully(p stoppable, done <-chan error, grace time.Duration) {
+	if grace > 0 {
+		if err := p.interrupt(); err != nil {
+			log.Printf("Error asking %v to stop, killing it: %v", p, err)
+		} else {
+			select {
+			case <-done:
+				return
+			case <-time.After(grace):
+				log.Printf("%v did not stop within the -timeout-grace of %v, killing it", p, grace)
+			}
+		}
+	}
+	if err := p.kill(); err != nil {
+		log.Printf("Error killing %v: %v", p, err)
+	}
+	<-done
+}
+
+// wmiSource fetches the objects of a WMI class. A non empty where clause
+// limits the objects returned.
+type wmiSource interface {
+	query(class, namespace, where string) ([]wmiObject, error)
+}
+
+// wmiConnection is an open connection to a WMI namespace.
+type wmiConnection interface {
+	query(class, where string) ([]wmiObject, error)
+}
+
+// cachedWmiSource keeps one connection per namespace for the whole run, as
+// connecting costs more than most queries. A connection a query fails on is
+// dropped and the query retried once on a new one.
+type cachedWmiSource struct {
+	connect func(namespace string) (wmiConnection, error)
+
+	mu    sync.Mutex
+	conns map[string]wmiConnection
+}
+
+func newCachedWmiSource(connect func(namespace string) (wmiConnection, error)) *cachedWmiSource {
+	return &cachedWmiSource{connect: connect, conns: make(map[string]wmiConnection)}
+}
+
+// connection returns the cached connection to namespace, connecting if there
+// is none.
+func (s *cachedWmiSource) connection(namespace string) (wmiConnection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.conns[namespace]; ok {
+		return c, nil
+	}
+	c, err := s.connect(namespace)
+	if err != nil {
+		return nil, err
+	}
+	s.conns[namespace] = c
+	return c, nil
+}
+
+// drop forgets c if it is still the cached connection to namespace. It is not
+// released, other queries may still be running on it.
+func (s *cachedWmiSource) drop(namespace string, c wmiConnection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns[namespace] == c {
+		delete(s.conns, namespace)
+	}
+}
+
+func (s *cachedWmiSource) query(class, namespace, where string) ([]wmiObject, error) {
+	c, err := s.connection(namespace)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := c.query(class, where)
+	if err == nil {
+		return objects, nil
+	}
+	s.drop(namespace, c)
+	if c, err = s.connection(namespace); err != nil {
+		return nil, err
+	}
+	return c.query(class, where)
 }
 
 type wmiQuery struct {
 	class          string
 	namespace      string
 	outputFileName string
+	// where is an optional WQL condition, e.g. "LocalAccount = True".
+	where  string
+	policy RunPolicy
 }
 
-func (command cmd) run() (outPath string, err error) {
+func (command cmd) run(ctx context.Context) (outPath string, err error) {
+	// -collector-timeout names the collector by its text output file, which
+	// -output-format may rename.
+	name := command.outputFileName
+	command = command.formatted()
 	outPath = filepath.Join(tmpFolder, command.outputFileName)
-
-	c := exec.Command(command.path)
-	argString := command.args
+	argString, err := command.resolvedArgs()
+	if err != nil {
+		return outPath, err
+	}
+	policy := resolvePolicy(runPolicy(ctx, name, command.policy), cmdDefaultPolicy)
 
 	if command.cmdProducesFile {
 		// Replace any output file args with that path in a temp folder
 		relPath := command.outputFileName
-		argString = strings.Replace(argString, relPath, outPath, -1)
-	} else {
-		// If the command doesn't produce a file, we need to construct
-		// one from Stdout and Stderr
-		outFile, err := os.Create(outPath)
-		if err != nil {
-			log.Printf("Error creating file %s: %v", outPath, err)
-			return outPath, err
+		args := splitArgs(strings.Replace(argString, relPath, outPath, -1))
+		commandLines.record(outPath, commandLine(command.path, args))
+		err = policy.attempt(ctx, func(ctx context.Context) error {
+			return exe.execute(ctx, command.path, args, nil)
+		})
+		return outPath, err
+	}
+
+	// If the command doesn't produce a file, we need to construct
+	// one from Stdout and Stderr
+	outFile, err := createOutput(ctx, outPath)
+	if err != nil {
+		log.Printf("Error creating file %s: %v", outPath, err)
+		return outPath, err
+	}
+	defer func() {
+		if cErr := outFile.Close(); err == nil {
+			err = cErr
 		}
-		defer func() {
-			if cErr := outFile.Close(); err != nil {
-				err = cErr
+	}()
+
+	args := splitArgs(argString)
+	line := commandLine(command.path, args)
+	commandLines.record(outPath, line)
+	var output bytes.Buffer
+	attempts := 0
+	err = policy.attempt(ctx, func(ctx context.Context) error {
+		attempts++
+		// Only keep the output of the last attempt, a streamed output
+		// can't be rewound so it keeps them all.
+		if f, ok := outFile.(*os.File); ok {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
 			}
-		}()
-		c.Stdout = outFile
-		c.Stderr = outFile
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+		} else if attempts > 1 {
+			if _, err := fmt.Fprintf(outFile, "\r\n# Attempt %d\r\n", attempts); err != nil {
+				return err
+			}
+		}
+		output.Reset()
+		if _, err := fmt.Fprintf(outFile, "# Command: %s\r\n", line); err != nil {
+			return err
+		}
+		if opts.fileHeaders {
+			if err := writeFileHeader(outFile); err != nil {
+				return err
+			}
+		}
+		return exe.execute(ctx, command.path, args, command.captureOutput(outFile, &output))
+	})
+	if err == nil && command.inspect != nil {
+		command.inspect(output.String())
 	}
+	return outPath, err
+}
 
-	if command.args != "" {
-		c.Args = append(c.Args, strings.Split(argString, " ")...)
+// captureOutput returns the writer to give the command, copying the output
+// into buf as well when the command has an inspect function.
+func (command cmd) captureOutput(w io.Writer, buf *bytes.Buffer) io.Writer {
+	if command.inspect == nil {
+		return w
 	}
-	err = c.Run()
-	return
+	return io.MultiWriter(w, buf)
 }
 
-func (query wmiQuery) run() (string, error) {
-	outPath := filepath.Join(tmpFolder, query.outputFileName)
-	outFile, err := os.Create(outPath)
+// commandLine formats a command the way it would be typed, quoting arguments
+// that contain spaces.
+func commandLine(path string, args []string) string {
+	parts := []string{path}
+	for _, a := range args {
+		if strings.Contains(a, " ") {
+			a = `"` + a + `"`
+		}
+		parts = append(parts, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// writeFileHeader writes the collection metadata that follows the command
+// line at the start of output files when running with -file-headers.
+func writeFileHeader(w io.Writer) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	_, err = fmt.Fprintf(w, "# Hostname: %s\r\n# Collected: %s\r\n# Tool version: %s\r\n#\r\n",
+		hostname, collectionTime(), buildInfo())
+	return err
+}
+
+// splitArgs splits an argument string on spaces, keeping double quoted
+// sections (such as XPath queries) together as a single argument.
+func splitArgs(argString string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range argString {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ' ' && !inQuotes:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// section is something that can write its output into a file shared with
+// other sections, see group.
+type section interface {
+	// title describes the section, it heads its output in the shared file.
+	title() string
+	// writeOutput runs the section and writes its output to w.
+	writeOutput(ctx context.Context, w io.Writer) error
+}
+
+func (command cmd) title() string {
+	return strings.TrimSpace(command.path + " " + command.args)
+}
+
+// writeOutput runs the command with its stdout and stderr going to w. The
+// outputFileName and cmdProducesFile fields are ignored.
+func (command cmd) writeOutput(ctx context.Context, w io.Writer) error {
+	argString, err := command.resolvedArgs()
+	if err != nil {
+		return err
+	}
+	policy := resolvePolicy(runPolicy(ctx, command.outputFileName, command.policy), cmdDefaultPolicy)
+	var output bytes.Buffer
+	err = policy.attempt(ctx, func(ctx context.Context) error {
+		output.Reset()
+		return exe.execute(ctx, command.path, splitArgs(argString), command.captureOutput(w, &output))
+	})
+	if err == nil && command.inspect != nil {
+		command.inspect(output.String())
+	}
+	return err
+}
+
+// group runs several sections in order, writing all of their output into a
+// single file with a heading before each section.
+type group struct {
+	outputFileName string
+	sections       []section
+}
+
+func (g group) run(ctx context.Context) (outPath string, err error) {
+	outPath = filepath.Join(tmpFolder, g.outputFileName)
+	outFile, err := createOutput(ctx, outPath)
 	if err != nil {
 		return outPath, err
 	}
-	defer outFile.Close()
+	defer func() {
+		if cErr := outFile.Close(); err == nil {
+			err = cErr
+		}
+	}()
 
-	// WMI is somewhat flaky, so we should retry a few times on failures
-	var data string
-	for i := 0; i < 3; i++ {
-		data, err = printWmiObjects(query.class, query.namespace)
-		if err == nil {
-			break
+	// A -collector-timeout of the group bounds each of its sections.
+	if d, ok := opts.collectorTimeouts[g.outputFileName]; ok {
+		timeoutApplied(g.outputFileName)
+		ctx = withGroupTimeout(ctx, d)
+	}
+
+	// Only fail the group if none of the sections succeeded, the output
+	// of the ones that did is still useful.
+	failed := 0
+	var lastErr error
+	for _, s := range g.sections {
+		fmt.Fprintf(outFile, "==== %s ====\r\n", s.title())
+		sErr := s.writeOutput(ctx, outFile)
+		if reason, ok := sErr.(skipError); ok {
+			fmt.Fprintf(outFile, "Skipped: %s.\r\n\r\n", reason)
+			continue
+		}
+		switch {
+		case sErr != nil:
+			fmt.Fprintf(outFile, "\r\nError: %v\r\n", sErr)
+			failed++
+			lastErr = sErr
+		}
+		fmt.Fprint(outFile, "\r\n")
+	}
+	if failed > 0 && failed == len(g.sections) {
+		return outPath, lastErr
+	}
+	return outPath, nil
+}
+
+func (query wmiQuery) title() string {
+	return fmt.Sprintf("Queried wmi objects [%s] from namespace %s", query.class, query.namespace)
+}
+
+// objects runs the query, retrying and timing out according to its policy.
+func (query wmiQuery) objects(ctx context.Context) ([]wmiObject, error) {
+	var objects []wmiObject
+	policy := resolvePolicy(runPolicy(ctx, query.outputFileName, query.policy), wmiDefaultPolicy)
+	err := policy.attempt(ctx, func(ctx context.Context) error {
+		// WMI calls can't be interrupted, so stop waiting on the query
+		// once the timeout is hit and leave it to finish in the background.
+		type result struct {
+			objects []wmiObject
+			err     error
+		}
+		done := make(chan result, 1)
+		go func() {
+			o, err := wmiSrc.query(query.class, query.namespace, query.where)
+			done <- result{o, err}
+		}()
+		select {
+		case r := <-done:
+			objects = r.objects
+			return r.err
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	})
+	return objects, err
+}
+
+// fetch runs the query and formats the objects it returns.
+func (query wmiQuery) fetch(ctx context.Context) (string, error) {
+	objects, err := query.objects(ctx)
+	if err != nil {
+		return "", err
+	}
+	return formatWmiObjects(objects), nil
+}
+
+func (query wmiQuery) writeOutput(ctx context.Context, w io.Writer) error {
+	data, err := query.fetch(ctx)
+	if err != nil {
+		return err
 	}
+	_, err = io.WriteString(w, data)
+	return err
+}
+
+func (query wmiQuery) run(ctx context.Context) (string, error) {
+	outPath := filepath.Join(tmpFolder, query.outputFileName)
+	data, err := query.fetch(ctx)
+	if err != nil {
+		return outPath, err
+	}
+
+	outFile, err := createOutput(ctx, outPath)
 	if err != nil {
 		return outPath, err
 	}
+	defer outFile.Close()
 
-	header := fmt.Sprintf("Queried wmi objects [%s] from namespace %s\n\n", query.class, query.namespace)
-	if _, err = outFile.WriteString(header); err != nil {
+	if _, err = io.WriteString(outFile, query.title()+"\n\n"); err != nil {
 		return outPath, err
 	}
 
-	_, err = outFile.WriteString(data)
+	_, err = io.WriteString(outFile, data)
 	return outPath, err
 }
 
-func runAll(commands []runner, errCh chan error) []string {
-	paths := make([]string, 0, len(commands))
+// RunResult is the outcome of one runner of runAll.
+type RunResult struct {
+	Runner runner
+	// Path is the output file, set when the runner succeeded.
+	Path string
+	// Err is why the runner failed or wasn't run, nil on success and when
+	// skipped.
+	Err error
+	// Skipped is set when the runner chose not to run, see skipError.
+	Skipped bool
+}
+
+// runAll runs commands in order and returns one result per command, in the
+// same order. Errors are also sent to errCh.
+func runAll(ctx context.Context, commands []runner, errCh chan error) []RunResult {
+	results := make([]RunResult, 0, len(commands))
+	progress.add(len(commands))
 
-	for _, command := range commands {
-		path, err := command.run()
+	for i, command := range commands {
+		if err := ctx.Err(); err != nil {
+			errCh <- fmt.Errorf("%d collectors were not run: %w", len(commands)-i, err)
+			for _, notRun := range commands[i:] {
+				results = append(results, RunResult{Runner: notRun, Err: fmt.Errorf("not run: %w", err)})
+				progress.collected()
+			}
+			break
+		}
+		if opts.lowImpact && i > 0 {
+			time.Sleep(lowImpactPause)
+		}
+		start := time.Now()
+		path, err := command.run(ctx)
+		progress.collected()
+		record := logRecord{Command: describeRunner(command), Duration: time.Since(start)}
+		if reason, ok := err.(skipError); ok {
+			record.Level, record.Msg = "info", fmt.Sprintf("Skipping %v: %s", command, reason)
+			logEvent(record)
+			results = append(results, RunResult{Runner: command, Skipped: true})
+			continue
+		}
 		if err != nil {
-			log.Printf("Error: %s while running %v", err, command)
+			record.Level, record.Msg, record.Err = "error", fmt.Sprintf("Error: %s while running %v", err, command), err
+			logEvent(record)
+			err = runError{command: record.Command, err: err}
 			errCh <- err
+			results = append(results, RunResult{Runner: command, Err: err})
 		} else {
-			paths = append(paths, path)
+			record.Level, record.Msg = "info", fmt.Sprintf("Collected %s in %v", record.Command, record.Duration.Round(time.Millisecond))
+			logEvent(record)
+			results = append(results, RunResult{Runner: command, Path: path})
 		}
 	}
 
+	return results
+}
+
+// describeRunner names the runner for error reports.
+func describeRunner(r runner) string {
+	switch r := r.(type) {
+	case cmd:
+		return commandLine(r.path, splitArgs(r.args))
+	case section:
+		return r.title()
+	case group:
+		return "collectors of " + r.outputFileName
+	case installed:
+		return describeRunner(r.runner)
+	case carriedForward:
+		return describeRunner(r.runner)
+	case registryExport:
+		return describeRunner(r.export)
+	}
+	return fmt.Sprint(r)
+}
+
+// resultPaths returns the output files of the successful results.
+func resultPaths(results []RunResult) []string {
+	paths := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.Err == nil && !r.Skipped {
+			paths = append(paths, r.Path)
+		}
+	}
 	return paths
 }
 
-func gatherSystemLogs(logs chan logFolder, errs chan error) {
-	var commands = []runner{
-		cmd{`C:\Windows\System32\systeminfo.exe`, "", "systeminfo.txt", false},
-		cmd{`C:\Windows\System32\bcdedit.exe`, "", "bcdedit.txt", false},
-		cmd{`C:\Windows\System32\sc.exe`, "query type=driver", "drivers.txt", false},
-		cmd{`C:\Windows\System32\pnputil.exe`, "/e", "pnputil.txt", false},
-		cmd{`C:\Windows\System32\msinfo32.exe`, "/report msinfo32.txt", "msinfo32.txt", true},
-		wmiQuery{"Win32_UserAccount", `root\CIMv2`, "users.txt"},
+// systemRunners are the collectors of the System folder.
+func systemRunners() []runner {
+	return []runner{
+		cmd{path: `C:\Windows\System32\systeminfo.exe`, outputFileName: "systeminfo.txt"},
+		osVersion{"os_version.txt"},
+		cmd{path: `C:\Windows\System32\bcdedit.exe`, outputFileName: "bcdedit.txt", admin: adminRequired},
+		cmd{path: `C:\Windows\System32\sc.exe`, args: "query type=driver", outputFileName: "drivers.txt"},
+		cmd{path: `C:\Windows\System32\driverquery.exe`, args: "/v /fo csv", outputFileName: "loaded_drivers.csv"},
+		// The minifilters are kept out of loaded_drivers.csv so it stays
+		// a valid CSV.
+		installed{fltmcPath, cmd{path: fltmcPath, args: "filters", outputFileName: "filter_drivers.txt", admin: adminRequired}},
+		cmd{path: `C:\Windows\System32\pnputil.exe`, args: "/e", outputFileName: "pnputil.txt"},
+		carriedForward{"System/msinfo32.txt", cmd{path: `C:\Windows\System32\msinfo32.exe`, args: "/report msinfo32.txt", outputFileName: "msinfo32.txt", cmdProducesFile: true}},
+		wmiQuery{class: "Win32_UserAccount", namespace: `root\CIMv2`, outputFileName: "users.txt"},
+		group{"time_sync.txt", []section{
+			cmd{path: `C:\Windows\System32\w32tm.exe`, args: "/query /status"},
+			cmd{path: `C:\Windows\System32\w32tm.exe`, args: "/query /configuration"},
+			cmd{path: `C:\Windows\System32\w32tm.exe`, args: "/stripchart /computer:time.google.com /samples:5", network: true},
+		}},
+		group{"groups.txt", []section{
+			wmiQuery{class: "Win32_Group", namespace: `root\CIMv2`, where: "LocalAccount = True"},
+			wmiQuery{class: "Win32_GroupUser", namespace: `root\CIMv2`},
+		}},
+		windowsFeatures{"features.txt"},
+		dismFeatures,
+		componentHealth,
+		domainDiagnostics{"domain.txt"},
+		lsa,
+		// The effective audit policy, for security investigations.
+		cmd{path: `C:\Windows\System32\auditpol.exe`, args: "/get /category:*", outputFileName: "audit_policy.txt", admin: adminRequired},
+		rdpRedirectionSettings,
+		// Virtualization-based security and Credential Guard, which some
+		// drivers are incompatible with and which cost some performance.
+		wmiQuery{class: "Win32_DeviceGuard", namespace: `root\Microsoft\Windows\DeviceGuard`, outputFileName: "device_guard.txt"},
+		fontsLocale,
+		cpu,
+		memoryTrend{"memory_trend.csv"},
+		hardwareErrors(),
+		installed{wslPath, group{"wsl.txt", []section{
+			cmd{path: wslPath, args: "--list --verbose"},
+			cmd{path: wslPath, args: "--status"},
+		}}},
+		group{"power.txt", []section{
+			cmd{path: `C:\Windows\System32\powercfg.exe`, args: "/list"},
+			cmd{path: `C:\Windows\System32\powercfg.exe`, args: "/getactivescheme"},
+			cmd{path: `C:\Windows\System32\powercfg.exe`, args: "/a"},
+		}},
 	}
+}
 
-	logs <- logFolder{"System", runAll(commands, errs)}
+func gatherSystemLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	files := resultPaths(runAll(ctx, systemRunners(), errs))
+	bootLogPaths, ers := collectFilePaths([]string{bootLog})
+	for _, err := range ers {
+		if os.IsNotExist(err) {
+			summary.notef("%s was not collected, boot logging is not enabled. Turn it on with bcdedit /set {current} bootlog Yes and restart to get it.", bootLog)
+			continue
+		}
+		errs <- err
+	}
+	logs <- logFolder{name: "System", files: append(files, bootLogPaths...)}
 }
 
-func gatherDiskLogs(logs chan logFolder, errs chan error) {
-	var commands = []runner{
-		wmiQuery{"MSFT_Disk", `root\Microsoft\Windows\Storage`, "disks.txt"},
-		wmiQuery{"MSFT_Volume", `root\Microsoft\Windows\Storage`, "volumes.txt"},
-		wmiQuery{"MSFT_Partition", `root\Microsoft\Windows\Storage`, "partitions.txt"},
+// diskRunners are the collectors of the Disk folder.
+func diskRunners() []runner {
+	return []runner{
+		wmiQuery{class: "MSFT_Disk", namespace: `root\Microsoft\Windows\Storage`, outputFileName: "disks.txt"},
+		wmiQuery{class: "MSFT_Volume", namespace: `root\Microsoft\Windows\Storage`, outputFileName: "volumes.txt"},
+		wmiQuery{class: "MSFT_Partition", namespace: `root\Microsoft\Windows\Storage`, outputFileName: "partitions.txt"},
+		group{"vss.txt", []section{
+			cmd{path: `C:\Windows\System32\vssadmin.exe`, args: "list writers", admin: adminRequired, inspect: checkVssWriters},
+			cmd{path: `C:\Windows\System32\vssadmin.exe`, args: "list shadows", admin: adminRequired},
+		}},
+		group{"volume_health.txt", []section{
+			cmd{path: `C:\Windows\System32\fsutil.exe`, args: "volume diskfree C:", admin: adminRequired},
+			// /A only analyzes the volume, never add an optimization flag
+			// here, collecting logs must not defragment the disk.
+			cmd{path: `C:\Windows\System32\defrag.exe`, args: "C: /A", admin: adminRequired, mutates: true},
+		}},
+		diskEvents(),
+		spaceUsage{"space_usage.txt"},
+		componentStore,
+		bitlocker,
+		ioLatency{"io_latency.csv"},
 	}
+}
 
-	logs <- logFolder{"Disk", runAll(commands, errs)}
+func gatherDiskLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	logs <- logFolder{name: "Disk", files: resultPaths(runAll(ctx, diskRunners(), errs))}
 }
 
-func gatherNetworkLogs(logs chan logFolder, errs chan error) {
-	var commands = []runner{
-		cmd{`C:\Windows\System32\nslookup.exe`, "8.8.8.8", "nslookup_dns.txt", false},
-		cmd{`C:\Windows\System32\tracert.exe`, "www.gstatic.com", "tracert_gstatic.txt", false},
-		cmd{`C:\Windows\System32\ping.exe`, "-n 10 8.8.8.8", "ping_dns.txt", false},
-		cmd{`C:\Windows\System32\ping.exe`, "-n 10 www.gstatic.com", "ping_gstatic.txt", false},
-		cmd{`C:\Windows\System32\ipconfig.exe`, "/all", "ipconfig.txt", false},
-		cmd{`C:\Windows\System32\route.exe`, "print", "route.txt", false},
-		cmd{`C:\Windows\System32\netstat.exe`, "-anb", "netstat.txt", false},
-		wmiQuery{"MSFT_NetFirewallRule", `root\StandardCimv2`, "firewall.txt"},
+// networkRunners are the collectors of the Network folder.
+func networkRunners() []runner {
+	commands := []runner{
+		cmd{path: `C:\Windows\System32\nslookup.exe`, args: "8.8.8.8", outputFileName: "nslookup_dns.txt", network: true},
+		cmd{path: `C:\Windows\System32\tracert.exe`, args: "www.gstatic.com", outputFileName: "tracert_gstatic.txt", network: true},
+		cmd{path: `C:\Windows\System32\ping.exe`, args: "-n 10 8.8.8.8", outputFileName: "ping_dns.txt", network: true},
+		cmd{path: `C:\Windows\System32\ping.exe`, args: "-n 10 www.gstatic.com", outputFileName: "ping_gstatic.txt", network: true},
+		cmd{path: `C:\Windows\System32\ipconfig.exe`, args: "/all", outputFileName: "ipconfig.txt"},
+		cmd{path: `C:\Windows\System32\route.exe`, args: "print", outputFileName: "route.txt"},
+		resolvedRoutes,
+		tcpConnections{"connections.csv"},
+		cmd{path: `C:\Windows\System32\arp.exe`, args: "-a", outputFileName: "arp.txt"},
+		group{"mtu.txt", []section{
+			cmd{path: `C:\Windows\System32\netsh.exe`, args: "interface ipv4 show subinterfaces"},
+			pmtuSweep{"8.8.8.8"},
+		}},
+		wmiQuery{class: "MSFT_NetNeighbor", namespace: `root\StandardCimv2`, outputFileName: "neighbors.txt"},
+		// Offloads, RSS and jumbo frames settings of each adapter.
+		wmiQuery{class: "MSFT_NetAdapterAdvancedPropertySettingData", namespace: `root\StandardCimv2`, outputFileName: "adapter_advanced.txt"},
+		// Showing the owning executables (-b) needs privileges, fall back to
+		// the owning process IDs (-o) without them.
+		cmd{path: `C:\Windows\System32\netstat.exe`, args: "-anb", outputFileName: "netstat.txt", admin: adminLimited, unelevatedArgs: "-ano"},
+		wmiQuery{class: "MSFT_NetFirewallRule", namespace: `root\StandardCimv2`, outputFileName: "firewall.txt"},
+		wmiQuery{class: "MSFT_NetFirewallProfile", namespace: `root\StandardCimv2`, outputFileName: "firewall_profiles.txt"},
+		// The network category (Domain, Private or Public) of each
+		// connection decides which firewall profile applies, and depends on
+		// whether the machine is domain joined (PartOfDomain, Domain).
+		group{"network_location.txt", []section{
+			wmiQuery{class: "MSFT_NetConnectionProfile", namespace: `root\StandardCimv2`},
+			wmiQuery{class: "Win32_ComputerSystem", namespace: `root\CIMv2`},
+		}},
+		proxy,
+		schannel,
+		smb,
+		installed{pktmonPath, pktmonCapture{"pktmon.etl"}},
 	}
+	if len(opts.resolveNames) > 0 {
+		commands = append(commands, nameResolutions(opts.resolveNames))
+	}
+	return commands
+}
 
-	logs <- logFolder{"Network", runAll(commands, errs)}
+func gatherNetworkLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	logs <- logFolder{name: "Network", files: resultPaths(runAll(ctx, networkRunners(), errs))}
 }
 
-func gatherProgramLogs(logs chan logFolder, errs chan error) {
-	var commands = []runner{
-		wmiQuery{"Win32_Process", `root\Cimv2`, "processes.txt"},
-		wmiQuery{"Win32_Service", `root\Cimv2`, "services.txt"},
-		wmiQuery{"MSFT_ScheduledTask", `root\Microsoft\Windows\TaskScheduler`, "scheduled_tasks.txt"},
+// programRunners are the collectors of the Program folder.
+func programRunners() []runner {
+	return []runner{
+		wmiQuery{class: "Win32_Process", namespace: `root\Cimv2`, outputFileName: "processes.txt"},
+		wmiQuery{class: "Win32_Service", namespace: `root\Cimv2`, outputFileName: "services.txt"},
+		wmiQuery{class: "MSFT_ScheduledTask", namespace: `root\Microsoft\Windows\TaskScheduler`, outputFileName: "scheduled_tasks.txt"},
+		group{"printers.txt", []section{
+			cmd{path: `C:\Windows\System32\sc.exe`, args: "queryex spooler"},
+			cmd{path: `C:\Windows\System32\sc.exe`, args: "qc spooler"},
+			wmiQuery{class: "Win32_Printer", namespace: `root\Cimv2`},
+			wmiQuery{class: "Win32_PrinterDriver", namespace: `root\Cimv2`},
+		}},
 	}
+}
 
-	logs <- logFolder{"Program", runAll(commands, errs)}
+func gatherProgramLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	logs <- logFolder{name: "Program", files: resultPaths(runAll(ctx, programRunners(), errs))}
 }
 
 // collectFilePaths recursively collect all the file paths under given list of roots,
@@ -192,9 +836,14 @@ func collectFilePaths(roots []string) ([]string, []error) {
 			if e != nil {
 				return e
 			}
-			if !info.IsDir() {
-				filePaths = append(filePaths, path)
+			if info.IsDir() {
+				return nil
+			}
+			if pattern, ok := excluded(path); ok {
+				summary.notef("Excluded %s, it matches -exclude-glob %q", path, pattern)
+				return nil
 			}
+			filePaths = append(filePaths, path)
 			return nil
 		})
 		if err != nil {
@@ -204,83 +853,410 @@ func collectFilePaths(roots []string) ([]string, []error) {
 	return filePaths, errs
 }
 
+// excluded returns the first -exclude-glob pattern matching the base name or
+// the full path of path. Paths are case insensitive on Windows, so is the
+// match.
+func excluded(path string) (string, bool) {
+	path = strings.ToLower(path)
+	for _, pattern := range opts.excludeGlobs {
+		p := strings.ToLower(pattern)
+		if ok, _ := filepath.Match(p, filepath.Base(path)); ok {
+			return pattern, true
+		}
+		if ok, _ := filepath.Match(p, path); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// eventRunners are the collectors of the Event folder, the events exported
+// as text.
+func eventRunners() []runner {
+	commands := []runner{
+		group{"setup_readable.txt", []section{
+			cmd{path: `C:\Windows\System32\wevtutil.exe`, args: eventQueryArgs("Setup", "", "")},
+			cmd{path: `C:\Windows\System32\wevtutil.exe`, args: eventQueryArgs("System", bootEventsXPath, "")},
+		}},
+	}
+	for _, name := range opts.eventChannels {
+		commands = append(commands, eventChannel(name))
+	}
+	return commands
+}
+
 // gatherEventLogs put all the event log file paths in logFolder channel
-// and errors in error channel.
-func gatherEventLogs(logs chan logFolder, errs chan error) {
+// and errors in error channel. The raw .evtx files can't be read off box, so
+// the setup and boot critical events are also exported as text.
+func gatherEventLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	filePaths := resultPaths(runAll(ctx, eventRunners(), errs))
+
 	roots := []string{eventLogsRoot}
-	filePaths, ers := collectFilePaths(roots)
+	noteIgnoresSince("The raw .evtx event logs")
+	eventPaths, ers := collectFilePaths(roots)
 	for _, err := range ers {
 		errs <- err
 	}
-	logs <- logFolder{"Event", filePaths}
+	logs <- logFolder{name: "Event", files: append(filePaths, eventPaths...)}
+}
+
+// eventQueryArgs returns the wevtutil args to export the events of channel
+// matching xpath, or all of them if it is empty, as text. extra args go
+// before the format. The events are limited by -since.
+func eventQueryArgs(channel, xpath, extra string) string {
+	args := "qe " + channel
+	if xpath = sinceXPath(xpath); xpath != "" {
+		args += fmt.Sprintf(" /q:%q", xpath)
+	}
+	if extra != "" {
+		args += " " + extra
+	}
+	return args + " /f:text"
+}
+
+// eventIDXPath returns the event log XPath query selecting the events with
+// one of ids, or "" to select every event when there are none.
+func eventIDXPath(ids []int) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	conds := make([]string, len(ids))
+	for i, id := range ids {
+		conds[i] = fmt.Sprintf("EventID=%d", id)
+	}
+	return "*[System[" + strings.Join(conds, " or ") + "]]"
+}
+
+// eventChannel exports the event log channel of that name as text, for the
+// channels asked for with -event-channel, limited to the -event-id events.
+type eventChannel string
+
+var channelFileNameReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileName is the name of the output file, with the characters that can't
+// or shouldn't be in a file name replaced.
+func (c eventChannel) fileName() string {
+	return channelFileNameReplacer.ReplaceAllString(string(c), "_") + ".txt"
+}
+
+func (c eventChannel) run(ctx context.Context) (string, error) {
+	if strings.TrimSpace(string(c)) == "" || strings.ContainsAny(string(c), `"*?`) {
+		return "", fmt.Errorf("event channel %q: invalid channel name", string(c))
+	}
+	command := cmd{path: `C:\Windows\System32\wevtutil.exe`, args: eventQueryArgs(`"`+string(c)+`"`, eventIDXPath(opts.eventIDs), ""), outputFileName: c.fileName()}
+	path, err := command.run(ctx)
+	if err != nil {
+		return path, fmt.Errorf("event channel %q: %v", string(c), err)
+	}
+	return path, nil
 }
 
 // gatherKubernetesLogs put all the kubernetes log file paths in logFolder channel
 // and errors in error channel.
-func gatherKubernetesLogs(logs chan logFolder, errs chan error) {
+func gatherKubernetesLogs(ctx context.Context, logs chan logFolder, errs chan error) {
 	roots := []string{k8sLogsRoot, crashDump}
+	if _, err := os.Stat(containerdConfig); err == nil {
+		roots = append(roots, containerdConfig)
+	}
+	noteIgnoresSince("The Kubernetes logs")
 	filePaths, ers := collectFilePaths(roots)
 	for _, err := range ers {
 		errs <- err
 	}
-	logs <- logFolder{"Kubernetes", filePaths}
+	filePaths = append(filePaths, resultPaths(runAll(ctx, containerRuntimeRunners(), errs))...)
+	logs <- logFolder{name: "Kubernetes", files: filePaths}
 }
 
-func gatherTraceLogs(logs chan logFolder, errs chan error) {
-	traceStart := cmd{`C:\Windows\System32\wpr.exe`, "-start CPU -start DiskIO -start FileIO -start Network", "trace.etl", true}
-	traceStop := cmd{`C:\Windows\System32\wpr.exe`, "-stop trace.etl", "trace.etl", true}
+// traceStart and traceStop start the wpr trace of -trace and stop it into
+// trace.etl.
+var (
+	traceStart = cmd{path: `C:\Windows\System32\wpr.exe`, args: "-start CPU -start DiskIO -start FileIO -start Network", outputFileName: "trace.etl", cmdProducesFile: true, mutates: true}
+	traceStop  = cmd{path: `C:\Windows\System32\wpr.exe`, args: "-stop trace.etl", outputFileName: "trace.etl", cmdProducesFile: true, mutates: true}
+)
 
-	if _, err := traceStart.run(); err != nil {
+func gatherTraceLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	if _, err := traceStart.run(ctx); err != nil {
 		errs <- err
 	}
 
-	time.Sleep(10 * time.Minute)
-	paths := runAll([]runner{
+	select {
+	case <-time.After(opts.traceDuration):
+	case <-ctx.Done():
+	}
+	// Always stop the trace, even when the folder ran out of time, so wpr
+	// isn't left tracing.
+	paths := resultPaths(runAll(context.Background(), []runner{
 		traceStop,
-	}, errs)
-	logs <- logFolder{"Trace", paths}
+	}, errs))
+	logs <- logFolder{name: "Trace", files: paths}
+}
+
+// startGatherers starts each gatherer in its own goroutine, in the order of
+// runFuncs, holding back all but limit of them at a time when limit is above
+// 0. Each gatherer gets its own context, derived from ctx and bounded by
+// -max-duration-per-folder.
+// The errors of a gatherer are sent to errs and also kept on its folder.
+func startGatherers(ctx context.Context, runFuncs []gatherFunc, logs chan logFolder, errs chan error, limit int) {
+	if limit <= 0 {
+		for _, run := range runFuncs {
+			go gatherFolder(ctx, run, logs, errs)
+		}
+		return
+	}
+	sem := make(chan struct{}, limit)
+	go func() {
+		for _, run := range runFuncs {
+			// Taking the slot before starting the gatherer, rather than in
+			// it, keeps the gatherers starting in order.
+			sem <- struct{}{}
+			go func(run gatherFunc) {
+				defer func() { <-sem }()
+				gatherFolder(ctx, run, logs, errs)
+			}(run)
+		}
+	}()
+}
+
+// gatherFolder runs a single gatherer for startGatherers, until ctx is done.
+func gatherFolder(ctx context.Context, run gatherFunc, logs chan logFolder, errs chan error) {
+	start := time.Now()
+	cancel := func() {}
+	if opts.maxFolderDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.maxFolderDuration)
+	}
+	defer cancel()
+
+	// Keep a copy of the errors of the folder while passing them on to errs.
+	folderLogs := make(chan logFolder, 1)
+	folderErrs := make(chan error)
+	var collected []error
+	done := make(chan struct{})
+	var timeouts []error
+	go func() {
+		for err := range folderErrs {
+			if opts.timeoutsAsWarnings && errorKind(err) == kindTimeout {
+				timeouts = append(timeouts, err)
+				continue
+			}
+			collected = append(collected, err)
+			errs <- err
+		}
+		close(done)
+	}()
+	run(ctx, folderLogs, folderErrs)
+	folder := <-folderLogs
+	close(folderErrs)
+	<-done
+	folder.errs, folder.timeouts = collected, timeouts
+	logEvent(logRecord{
+		Level:    "info",
+		Msg:      fmt.Sprintf("Gathered %s in %v", folder.name, time.Since(start).Round(time.Millisecond)),
+		Folder:   folder.name,
+		Duration: time.Since(start),
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		summary.warnf("%s is partial, it went over its %v budget and the collectors still running were cancelled", folder.name, opts.maxFolderDuration)
+	}
+	logs <- folder
+}
+
+// gatherFunc gathers the logs of one folder, sending the folder to logs and
+// any errors to errs. It sends a folder even when ctx is done, with whatever
+// was collected by then.
+type gatherFunc func(ctx context.Context, logs chan logFolder, errs chan error)
+
+// Gatherer priorities, lower ones start first. Under a concurrency limit or
+// a tight timeout, the essentials are collected before the expensive folders.
+const (
+	priorityEssential = iota
+	priorityNormal
+	priorityExpensive
+)
+
+// prioritizedGatherer is a gatherer and the priority it starts with.
+type prioritizedGatherer struct {
+	run      gatherFunc
+	priority int
+	// folder is the folder the gatherer collects, streamed outputs need it
+	// before the gatherer is done.
+	folder string
+}
+
+// byPriority returns the gatherers in priority order, equal priorities keep
+// their order.
+func byPriority(gs []prioritizedGatherer) []gatherFunc {
+	sort.SliceStable(gs, func(i, j int) bool { return gs[i].priority < gs[j].priority })
+	runFuncs := make([]gatherFunc, 0, len(gs))
+	for _, g := range gs {
+		run := g.run
+		if stream != nil {
+			run = streamedGatherer(g.folder, g.run)
+		}
+		runFuncs = append(runFuncs, run)
+	}
+	return runFuncs
+}
+
+// streamedGatherer runs the gatherer of folder with the folder in its
+// context, for its outputs to be streamed into the right folder of the
+// bundle.
+func streamedGatherer(folder string, run gatherFunc) gatherFunc {
+	return func(ctx context.Context, logs chan logFolder, errs chan error) {
+		run(inFolder(ctx, folder), logs, errs)
+	}
+}
+
+// gatherers returns the gatherers to run given the options and privileges,
+// in the order they start.
+func gatherers() []gatherFunc {
+	gs := []prioritizedGatherer{
+		{gatherSystemLogs, priorityEssential, "System"},
+		{gatherEventLogs, priorityEssential, "Event"},
+		{gatherNetworkLogs, priorityEssential, "Network"},
+		{gatherDiskLogs, priorityNormal, "Disk"},
+		{gatherProgramLogs, priorityNormal, "Program"},
+		{gatherKubernetesLogs, priorityNormal, "Kubernetes"},
+		{gatherStartupScriptLogs, priorityNormal, "GCE/startup_scripts"},
+		{gatherGCEAgentLogs, priorityNormal, "GCE"},
+		{gatherClusterLogs, priorityNormal, "Cluster"},
+		{gatherHyperVLogs, priorityNormal, "HyperV"},
+		{gatherIISLogs, priorityNormal, "IIS"},
+		{gatherSetupLogs, priorityNormal, "Setup"},
+		{gatherCrashDumpLogs, priorityExpensive, "CrashDump"},
+	}
+	if opts.pluginDir != "" {
+		gs = append(gs, prioritizedGatherer{gatherPluginLogs, priorityNormal, "Plugins"})
+	}
+	if len(opts.registryExports) > 0 {
+		gs = append(gs, prioritizedGatherer{gatherRegistryExports, priorityNormal, "System/registry"})
+	}
+	// The trace subcommand skips everything but the trace.
+	if opts.traceOnly {
+		gs = nil
+	}
+	// Tracing can't work at all without administrator privileges, and
+	// starting a trace changes the state of the system.
+	if opts.trace || opts.traceOnly {
+		switch {
+		case opts.readOnly:
+			summary.warnf("Skipped the wpr trace: %s", errReadOnly)
+		case elevated:
+			gs = append(gs, prioritizedGatherer{gatherTraceLogs, priorityExpensive, "Trace"})
+		default:
+			summary.warnf("Skipped the wpr trace: %s", errNotElevated)
+		}
+	}
+	if opts.bootTrace {
+		switch {
+		case opts.readOnly:
+			summary.warnf("Skipped the wpr boot trace: %s", errReadOnly)
+		case elevated:
+			gs = append(gs, prioritizedGatherer{gatherBootTraceLogs, priorityExpensive, "Trace"})
+		default:
+			summary.warnf("Skipped the wpr boot trace: %s", errNotElevated)
+		}
+	}
+	return byPriority(gs)
 }
 
-func gatherLogs(trace bool) ([]logFolder, error) {
-	runFuncs := []func(logs chan logFolder, errs chan error){
-		gatherSystemLogs,
-		gatherDiskLogs,
-		gatherNetworkLogs,
-		gatherProgramLogs,
-		gatherEventLogs,
-		gatherKubernetesLogs,
+// gatherLogs runs the gatherers and returns the folders they collected. The
+// errors of the collectors are kept with their folder, see errorRecords.
+func gatherLogs() []logFolder {
+	var err error
+	if elevated, err = isElevated(); err != nil {
+		log.Printf("Error checking for administrator privileges, assuming there are none: %v", err)
 	}
-	if trace {
-		runFuncs = append(runFuncs, gatherTraceLogs)
+	if !elevated {
+		log.Print("Not running as Administrator, some collectors will be skipped or limited.")
+		summary.warnf("Not running as Administrator, some collectors were skipped or limited")
 	}
+	runFuncs := gatherers()
 
 	folderCount := len(runFuncs)
 	folders := make([]logFolder, 0, folderCount)
-	errStrings := make([]string, 0)
 	ch := make(chan logFolder, folderCount)
 	errs := make(chan error)
 
-	for _, run := range runFuncs {
-		go run(ch, errs)
+	if opts.lowImpact {
+		if err := lowerPriority(); err != nil {
+			log.Printf("Error lowering process priority: %v", err)
+		}
+	}
+	manifestPath := filepath.Join(tmpFolder, manifestFileName)
+	m, err := createManifest(manifestPath)
+	if err != nil {
+		log.Printf("Error creating the manifest: %v", err)
+	} else {
+		log.Printf("Collecting into %s, see %s for what was collected so far.", tmpFolder, manifestFileName)
+		if build := osBuild(); build != "" {
+			if err := m.comment("Windows build " + build); err != nil {
+				log.Printf("Error adding the Windows build to the manifest: %v", err)
+			}
+		}
+	}
+	// With -fail-fast the first error cancels the collectors still running
+	// and the ones yet to start, the folders keep what was collected by then.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The -follow-log files are followed until the gatherers are done, so
+	// their deltas cover the whole collection.
+	var followed chan logFolder
+	followCtx, stopFollowing := context.WithCancel(context.Background())
+	defer stopFollowing()
+	if len(opts.followLogs) > 0 {
+		followed = make(chan logFolder, 1)
+		go func() {
+			followed <- followLogs(followCtx, opts.followLogs, tmpFolder, opts.followInterval)
+		}()
 	}
+	startGatherers(ctx, runFuncs, ch, errs, concurrency())
 
-	for {
+	for len(folders) < folderCount {
 		select {
 		case folder := <-ch:
 			folders = append(folders, folder)
+			if m != nil {
+				if err := m.add(folder); err != nil {
+					log.Printf("Error adding %s to the manifest: %v", folder.name, err)
+				}
+			}
 		case err := <-errs:
-			errStrings = append(errStrings, err.Error())
+			if opts.failFast && ctx.Err() == nil {
+				log.Printf("Cancelling the collection, -fail-fast is set and a collector failed: %v", err)
+				summary.errorf("The collection was cancelled on the first error, -fail-fast is set: %v", err)
+				cancel()
+			}
 		}
-
-		if len(folders) == folderCount {
-			break
+	}
+	progress.finish()
+	if followed != nil {
+		stopFollowing()
+		folder := <-followed
+		folders = append(folders, folder)
+		if m != nil {
+			if err := m.add(folder); err != nil {
+				log.Printf("Error adding %s to the manifest: %v", folder.name, err)
+			}
+		}
+	}
+	if m != nil {
+		if err := m.close(); err != nil {
+			log.Printf("Error closing the manifest: %v", err)
+		} else {
+			folders = append(folders, logFolder{name: "", files: []string{manifestPath}})
 		}
 	}
-	// TODO: errors are swallowed if error count <= gathterxxxLogs func count.
-	// Not sure this behavior is intented or not. Will check that if we can modify it like:
-	// if len(errStrings) > 0
-	if len(errs) > 0 {
-		return folders, errors.New(strings.Join(errStrings, "\n"))
+	for _, folder := range folders {
+		for _, err := range folder.errs {
+			summary.errorf("%s: %v", folder.name, err)
+		}
+		for _, err := range folder.timeouts {
+			summary.warnf("%s: %v, a timeout is not an error with -timeouts-as-warnings", folder.name, err)
+		}
 	}
-	return folders, nil
+	for _, w := range validateOutputs(folders, minOutputSizes) {
+		summary.warnf("%s", w)
+	}
+
+	return folders
 }
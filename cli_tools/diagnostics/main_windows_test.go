@@ -16,11 +16,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -96,7 +107,7 @@ func TestGatherEventLogs(t *testing.T) {
 	errCh := make(chan error)
 
 	t.Run("Gathers Expected SystemLog File", func(t *testing.T) {
-		go gatherEventLogs(logFolderCh, errCh)
+		go gatherEventLogs(context.Background(), logFolderCh, errCh)
 		select {
 		case l := <-logFolderCh:
 			if !stringArrayIncludesString(l.files, systemLogPath) {
@@ -107,3 +118,1384 @@ func TestGatherEventLogs(t *testing.T) {
 		}
 	})
 }
+
+// fakeExecutor records the commands it is asked to run and writes a line of
+// output for each, or the output given in outputs. Commands listed in errs
+// fail with the given error.
+type fakeExecutor struct {
+	mu      sync.Mutex
+	calls   []string
+	errs    map[string]error
+	outputs map[string]string
+	// hang makes every command block until its context is done.
+	hang bool
+	// writeFiles makes the commands that write their own output file, which
+	// get no output writer, create the file named in their args.
+	writeFiles bool
+}
+
+// outputFileRe finds the output file a command writes itself, its path is in
+// tmpFolder.
+func outputFileRe() *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(tmpFolder) + `[^'" ]*`)
+}
+
+func (f *fakeExecutor) execute(ctx context.Context, path string, args []string, out io.Writer) error {
+	call := strings.TrimSpace(path + " " + strings.Join(args, " "))
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	err := f.errs[call]
+	output, ok := f.outputs[call]
+	f.mu.Unlock()
+	if f.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if !ok {
+		output = fmt.Sprintf("output of %s\n", path)
+	}
+	if out != nil {
+		io.WriteString(out, output)
+	}
+	if out == nil && f.writeFiles {
+		for _, a := range args {
+			if path := outputFileRe().FindString(a); path != "" {
+				if err := ioutil.WriteFile(path, []byte(output), 0644); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return err
+}
+
+func (f *fakeExecutor) callCount(call string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeWmiSource returns canned objects per class, failing the first failures
+// queries and optionally taking delay to answer. Classes without canned
+// objects return a single object with a Name.
+type fakeWmiSource struct {
+	mu       sync.Mutex
+	queries  int
+	failures int
+	delay    time.Duration
+	objects  map[string][]wmiObject
+	// wheres records the condition of the last query of each class.
+	wheres map[string]string
+}
+
+func (f *fakeWmiSource) query(class, namespace, where string) ([]wmiObject, error) {
+	f.mu.Lock()
+	f.queries++
+	if f.wheres == nil {
+		f.wheres = make(map[string]string)
+	}
+	f.wheres[class] = where
+	fail := f.queries <= f.failures
+	f.mu.Unlock()
+	time.Sleep(f.delay)
+	if fail {
+		return nil, errors.New("wmi query failed")
+	}
+	if objects, ok := f.objects[class]; ok {
+		return objects, nil
+	}
+	return []wmiObject{{{"Name", "fake " + class}}}, nil
+}
+
+// withFakeExecutor swaps in a fake executor, a fake WMI source, an empty fake
+// registry, a host lookup that finds nothing, a fresh summary and a temporary
+// output folder for the duration of a test.
+func withFakeExecutor(t *testing.T) (*fakeExecutor, func()) {
+	dir, err := ioutil.TempDir("", "diagnostics_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeExecutor{}
+	oldExe, oldWmi, oldReg, oldTmp, oldOpts, oldSummary, oldLookup, oldVolume := exe, wmiSrc, reg, tmpFolder, opts, summary, lookupHost, systemVolume
+	exe, wmiSrc, reg, tmpFolder, summary = fake, &fakeWmiSource{}, &fakeRegistry{}, dir, &runSummary{}
+	// Walking the real system volume would take minutes.
+	systemVolume = dir
+	lookupHost = func(host string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return fake, func() {
+		exe, wmiSrc, reg, tmpFolder, opts, summary, lookupHost, systemVolume = oldExe, oldWmi, oldReg, oldTmp, oldOpts, oldSummary, oldLookup, oldVolume
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNoNetworkSkipsExternalCommands(t *testing.T) {
+	tests := []struct {
+		name      string
+		noNetwork bool
+		want      []string
+		notWant   []string
+	}{
+		{"Network allowed", false, []string{`C:\Windows\System32\ping.exe -n 10 8.8.8.8`, `C:\Windows\System32\ipconfig.exe /all`}, nil},
+		{"No network", true, []string{`C:\Windows\System32\ipconfig.exe /all`, `C:\Windows\System32\route.exe print`}, []string{
+			`C:\Windows\System32\nslookup.exe 8.8.8.8`,
+			`C:\Windows\System32\tracert.exe www.gstatic.com`,
+			`C:\Windows\System32\ping.exe -n 10 8.8.8.8`,
+			`C:\Windows\System32\ping.exe -n 10 www.gstatic.com`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			opts.noNetwork = tt.noNetwork
+
+			logs := make(chan logFolder, 1)
+			errs := make(chan error, 10)
+			gatherNetworkLogs(context.Background(), logs, errs)
+			<-logs
+
+			for _, c := range tt.want {
+				if !stringArrayIncludesString(fake.calls, c) {
+					t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+				}
+			}
+			for _, c := range tt.notWant {
+				if stringArrayIncludesString(fake.calls, c) {
+					t.Errorf("expected %q to be skipped with -no-network", c)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"-n 10 8.8.8.8", []string{"-n", "10", "8.8.8.8"}},
+		{`qe System /q:"*[System[(EventID=41 or EventID=6008)]]" /f:text`, []string{"qe", "System", "/q:*[System[(EventID=41 or EventID=6008)]]", "/f:text"}},
+	}
+	for _, tt := range tests {
+		if got := splitArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGatherEventLogsExportsSetupEvents(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherEventLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	want := filepath.Join(tmpFolder, "setup_readable.txt")
+	if !stringArrayIncludesString(folder.files, want) {
+		t.Fatalf("expected %s in Event folder, got %v", want, folder.files)
+	}
+	wantCalls := []string{
+		`C:\Windows\System32\wevtutil.exe qe Setup /f:text`,
+		`C:\Windows\System32\wevtutil.exe qe System /q:` + bootEventsXPath + ` /f:text`,
+	}
+	for _, c := range wantCalls {
+		if !stringArrayIncludesString(fake.calls, c) {
+			t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+		}
+	}
+	data, err := ioutil.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), `output of C:\Windows\System32\wevtutil.exe`) != 2 {
+		t.Errorf("expected output of both queries in %s, got:\n%s", want, data)
+	}
+}
+
+func TestRunPolicyAttempts(t *testing.T) {
+	fast := RunPolicy{Timeout: time.Second, MaxAttempts: 3, Backoff: time.Millisecond}
+
+	t.Run("cmd retries failures", func(t *testing.T) {
+		fake, cleanup := withFakeExecutor(t)
+		defer cleanup()
+		call := `C:\Windows\System32\pnputil.exe /e`
+		fake.errs = map[string]error{call: errors.New("exit status 1")}
+
+		c := cmd{path: `C:\Windows\System32\pnputil.exe`, args: "/e", outputFileName: "pnputil.txt", policy: fast}
+		if _, err := c.run(context.Background()); err == nil {
+			t.Error("expected an error from the failing command")
+		}
+		if got := fake.callCount(call); got != 3 {
+			t.Errorf("expected 3 attempts, got %d", got)
+		}
+	})
+
+	t.Run("cmd stops after success", func(t *testing.T) {
+		fake, cleanup := withFakeExecutor(t)
+		defer cleanup()
+
+		c := cmd{path: `C:\Windows\System32\pnputil.exe`, args: "/e", outputFileName: "pnputil.txt", policy: fast}
+		if _, err := c.run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := fake.callCount(`C:\Windows\System32\pnputil.exe /e`); got != 1 {
+			t.Errorf("expected 1 attempt, got %d", got)
+		}
+	})
+
+	t.Run("wmi retries failures", func(t *testing.T) {
+		_, cleanup := withFakeExecutor(t)
+		defer cleanup()
+		fake := &fakeWmiSource{failures: 2}
+		wmiSrc = fake
+
+		q := wmiQuery{class: "Win32_Service", namespace: `root\Cimv2`, outputFileName: "services.txt", policy: fast}
+		if _, err := q.run(context.Background()); err != nil {
+			t.Fatalf("expected the third attempt to succeed, got %v", err)
+		}
+		if fake.queries != 3 {
+			t.Errorf("expected 3 attempts, got %d", fake.queries)
+		}
+	})
+
+	t.Run("flags apply when the runner sets nothing", func(t *testing.T) {
+		_, cleanup := withFakeExecutor(t)
+		defer cleanup()
+		fake := &fakeWmiSource{failures: 10}
+		wmiSrc = fake
+		opts.policy = RunPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+
+		q := wmiQuery{class: "Win32_Service", namespace: `root\Cimv2`, outputFileName: "services.txt"}
+		if _, err := q.run(context.Background()); err == nil {
+			t.Error("expected an error from the failing query")
+		}
+		if fake.queries != 2 {
+			t.Errorf("expected 2 attempts, got %d", fake.queries)
+		}
+	})
+}
+
+func TestRunPolicyTimeout(t *testing.T) {
+	policy := RunPolicy{Timeout: 50 * time.Millisecond, MaxAttempts: 2, Backoff: time.Millisecond}
+
+	t.Run("cmd", func(t *testing.T) {
+		fake, cleanup := withFakeExecutor(t)
+		defer cleanup()
+		fake.hang = true
+
+		c := cmd{path: `C:\Windows\System32\tracert.exe`, args: "www.gstatic.com", outputFileName: "tracert.txt", policy: policy}
+		start := time.Now()
+		_, err := c.run(context.Background())
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("timeout not respected, run took %v", elapsed)
+		}
+		if got := fake.callCount(`C:\Windows\System32\tracert.exe www.gstatic.com`); got != 2 {
+			t.Errorf("expected 2 attempts, got %d", got)
+		}
+	})
+
+	t.Run("wmi", func(t *testing.T) {
+		_, cleanup := withFakeExecutor(t)
+		defer cleanup()
+		fake := &fakeWmiSource{delay: 2 * time.Second}
+		wmiSrc = fake
+
+		q := wmiQuery{class: "Win32_Process", namespace: `root\Cimv2`, outputFileName: "processes.txt", policy: policy}
+		start := time.Now()
+		_, err := q.run(context.Background())
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("timeout not respected, run took %v", elapsed)
+		}
+	})
+}
+
+func TestGatherSystemLogsTimeSync(t *testing.T) {
+	stripchart := `C:\Windows\System32\w32tm.exe /stripchart /computer:time.google.com /samples:5`
+	for _, noNetwork := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noNetwork=%t", noNetwork), func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			opts.noNetwork = noNetwork
+
+			logs := make(chan logFolder, 1)
+			errs := make(chan error, 10)
+			gatherSystemLogs(context.Background(), logs, errs)
+			folder := <-logs
+
+			want := filepath.Join(tmpFolder, "time_sync.txt")
+			if !stringArrayIncludesString(folder.files, want) {
+				t.Fatalf("expected %s in System folder, got %v", want, folder.files)
+			}
+			for _, c := range []string{`C:\Windows\System32\w32tm.exe /query /status`, `C:\Windows\System32\w32tm.exe /query /configuration`} {
+				if fake.callCount(c) != 1 {
+					t.Errorf("expected %q to run once, calls: %v", c, fake.calls)
+				}
+			}
+			if ran := fake.callCount(stripchart) == 1; ran == noNetwork {
+				t.Errorf("stripchart ran = %t with noNetwork = %t", ran, noNetwork)
+			}
+		})
+	}
+}
+
+func TestGatherNetworkLogsFirewallProfiles(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherNetworkLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	want := filepath.Join(tmpFolder, "firewall_profiles.txt")
+	if !stringArrayIncludesString(folder.files, want) {
+		t.Fatalf("expected %s in Network folder, got %v", want, folder.files)
+	}
+	data, err := ioutil.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `Queried wmi objects [MSFT_NetFirewallProfile] from namespace root\StandardCimv2`) {
+		t.Errorf("unexpected contents of %s:\n%s", want, data)
+	}
+}
+
+func TestGatherSystemLogsGroups(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherSystemLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	want := filepath.Join(tmpFolder, "groups.txt")
+	if !stringArrayIncludesString(folder.files, want) {
+		t.Fatalf("expected %s in System folder, got %v", want, folder.files)
+	}
+	data, err := ioutil.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range []string{
+		`Queried wmi objects [Win32_Group] from namespace root\CIMv2`,
+		`Queried wmi objects [Win32_GroupUser] from namespace root\CIMv2`,
+	} {
+		if !strings.Contains(string(data), header) {
+			t.Errorf("expected header %q in %s:\n%s", header, want, data)
+		}
+	}
+}
+
+func TestUnelevatedGating(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer func() { elevated = true }()
+	elevated = false
+	opts.trace = true
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		currentVersionKey: {"InstallationType": "Client"},
+	}}
+
+	for _, g := range gatherers() {
+		if reflect.ValueOf(g).Pointer() == reflect.ValueOf(gatherTraceLogs).Pointer() {
+			t.Error("trace gatherer should be skipped when not elevated")
+		}
+	}
+
+	logs := make(chan logFolder, 2)
+	errs := make(chan error, 10)
+	gatherSystemLogs(context.Background(), logs, errs)
+	gatherNetworkLogs(context.Background(), logs, errs)
+	<-logs
+	<-logs
+
+	if fake.callCount(`C:\Windows\System32\bcdedit.exe`) != 0 {
+		t.Error("bcdedit requires privileges and should be skipped")
+	}
+	if fake.callCount(clientFeatures.path+" "+strings.Join(splitArgs(clientFeatures.args), " ")) != 0 {
+		t.Error("Get-WindowsOptionalFeature requires privileges and should be skipped")
+	}
+	if fake.callCount(`C:\Windows\System32\netstat.exe -ano`) != 1 || fake.callCount(`C:\Windows\System32\netstat.exe -anb`) != 0 {
+		t.Errorf("netstat should fall back to -ano, calls: %v", fake.calls)
+	}
+	if len(errs) != 0 {
+		t.Errorf("skipped collectors should not report errors, got %v", <-errs)
+	}
+	if !strings.Contains(summary.String(), `netstat.exe -anb ran without administrator privileges`) {
+		t.Errorf("expected the limited netstat to be called out in the summary:\n%s", summary)
+	}
+}
+
+func TestMaxFolderDuration(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	// Every command hangs, the Disk folder only runs WMI queries so it is
+	// unaffected.
+	fake.hang = true
+	opts.maxFolderDuration = 100 * time.Millisecond
+	gatherDiskWmi := func(ctx context.Context, logs chan logFolder, errs chan error) {
+		logs <- logFolder{name: "Disk", files: resultPaths(runAll(ctx, []runner{
+			wmiQuery{class: "MSFT_Disk", namespace: `root\Microsoft\Windows\Storage`, outputFileName: "disks.txt"},
+			wmiQuery{class: "MSFT_Volume", namespace: `root\Microsoft\Windows\Storage`, outputFileName: "volumes.txt"},
+			wmiQuery{class: "MSFT_Partition", namespace: `root\Microsoft\Windows\Storage`, outputFileName: "partitions.txt"},
+		}, errs))}
+	}
+
+	logs := make(chan logFolder, 2)
+	errs := make(chan error, 20)
+	start := time.Now()
+	startGatherers(context.Background(), []gatherFunc{gatherNetworkLogs, gatherDiskWmi}, logs, errs, 0)
+	folders := make(map[string]logFolder)
+	for i := 0; i < 2; i++ {
+		f := <-logs
+		folders[f.name] = f
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("folder budget not respected, gathering took %v", elapsed)
+	}
+	if len(fake.calls) != 1 {
+		t.Errorf("expected the Network runners after the slow one to be cancelled, calls: %v", fake.calls)
+	}
+	if got := len(folders["Disk"].files); got != 3 {
+		t.Errorf("expected the Disk folder to be complete, got %d files", got)
+	}
+	s := summary.String()
+	if !strings.Contains(s, "Network is partial") || strings.Contains(s, "Disk is partial") {
+		t.Errorf("expected only Network to be marked partial:\n%s", s)
+	}
+}
+
+// runGatherer runs g to completion and returns the folder it produced.
+func runGatherer(t *testing.T, g gatherFunc) logFolder {
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 100)
+	g(context.Background(), logs, errs)
+	return <-logs
+}
+
+// readFolderFile fails the test if name isn't one of the folder's files and
+// returns its contents otherwise.
+func readFolderFile(t *testing.T, folder logFolder, name string) string {
+	t.Helper()
+	path := filepath.Join(tmpFolder, name)
+	if !stringArrayIncludesString(folder.files, path) {
+		t.Fatalf("expected %s in %s folder, got %v", name, folder.name, folder.files)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGatherNetworkLogsNeighbors(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	if got := readFolderFile(t, folder, "arp.txt"); got != "# Command: C:\\Windows\\System32\\arp.exe -a\r\noutput of C:\\Windows\\System32\\arp.exe\n" {
+		t.Errorf("unexpected arp.txt contents: %q", got)
+	}
+	if fake.callCount(`C:\Windows\System32\arp.exe -a`) != 1 {
+		t.Errorf("expected arp -a to run, calls: %v", fake.calls)
+	}
+	if got := readFolderFile(t, folder, "neighbors.txt"); !strings.HasPrefix(got, `Queried wmi objects [MSFT_NetNeighbor] from namespace root\StandardCimv2`) {
+		t.Errorf("unexpected neighbors.txt contents:\n%s", got)
+	}
+}
+
+func TestFileHeaders(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.fileHeaders = true
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cmd{path: `C:\Windows\System32\wevtutil.exe`, args: `qe System /q:"*[System[(EventID=41 or EventID=6008)]]"`, outputFileName: "out.txt"}
+	if _, err := c.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(tmpFolder, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\r\n")
+	if len(lines) < 6 {
+		t.Fatalf("expected a header followed by output, got:\n%s", data)
+	}
+	for i, prefix := range []string{
+		`# Command: C:\Windows\System32\wevtutil.exe qe System "/q:*[System[(EventID=41 or EventID=6008)]]"`,
+		"# Hostname: " + hostname,
+		"# Collected: ",
+		"# Tool version: " + buildInfo().String(),
+		"#",
+		`output of C:\Windows\System32\wevtutil.exe`,
+	} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], prefix)
+		}
+	}
+
+	// Files written by the command itself are left alone.
+	p := cmd{path: `C:\Windows\System32\msinfo32.exe`, args: "/report msinfo32.txt", outputFileName: "msinfo32.txt", cmdProducesFile: true}
+	if _, err := p.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpFolder, "msinfo32.txt")); !os.IsNotExist(err) {
+		t.Errorf("no header file should be created for commands producing their own file, got %v", err)
+	}
+}
+
+func TestGatherDiskLogsVolumeHealth(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	folder := runGatherer(t, gatherDiskLogs)
+	got := readFolderFile(t, folder, "volume_health.txt")
+	for _, c := range []string{`C:\Windows\System32\fsutil.exe volume diskfree C:`, `C:\Windows\System32\defrag.exe C: /A`} {
+		if !stringArrayIncludesString(fake.calls, c) {
+			t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+		}
+		if !strings.Contains(got, c) {
+			t.Errorf("expected a %q section in volume_health.txt:\n%s", c, got)
+		}
+	}
+
+	// Anything but analysis would modify the volume.
+	for _, c := range fake.calls {
+		if !strings.HasPrefix(c, `C:\Windows\System32\defrag.exe`) {
+			continue
+		}
+		for _, arg := range strings.Fields(c)[1:] {
+			switch strings.ToUpper(arg) {
+			case "C:", "/A", "/U", "/V":
+			default:
+				t.Errorf("defrag run with %q, only analysis flags are allowed", arg)
+			}
+		}
+	}
+}
+
+func TestStartGatherersFolderErrors(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.errs = map[string]error{`C:\Windows\System32\ipconfig.exe /all`: errors.New("exit status 1")}
+	failing := func(ctx context.Context, logs chan logFolder, errs chan error) {
+		errs <- errors.New("first")
+		errs <- errors.New("second")
+		logs <- logFolder{name: "Failing", files: nil}
+	}
+
+	logs := make(chan logFolder, 3)
+	errs := make(chan error, 20)
+	startGatherers(context.Background(), []gatherFunc{gatherNetworkLogs, gatherDiskLogs, failing}, logs, errs, 0)
+	got := make(map[string][]string)
+	for i := 0; i < 3; i++ {
+		f := <-logs
+		for _, err := range f.errs {
+			got[f.name] = append(got[f.name], err.Error())
+		}
+	}
+
+	want := map[string][]string{
+		"Network": {"exit status 1"},
+		"Failing": {"first", "second"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("folder errors = %v, want %v", got, want)
+	}
+	if len(errs) != 3 {
+		t.Errorf("expected the 3 errors to be passed on to errs, got %d", len(errs))
+	}
+}
+
+func TestGatherSystemLogsPower(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "power.txt")
+	for _, c := range []string{
+		`C:\Windows\System32\powercfg.exe /list`,
+		`C:\Windows\System32\powercfg.exe /getactivescheme`,
+		`C:\Windows\System32\powercfg.exe /a`,
+	} {
+		if !stringArrayIncludesString(fake.calls, c) {
+			t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+		}
+		if !strings.Contains(got, c) {
+			t.Errorf("expected a %q section in power.txt:\n%s", c, got)
+		}
+	}
+}
+
+func TestGatherEventLogsChannels(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.eventChannels = stringList{"Microsoft-Windows-Hyper-V-Compute/Admin", "Application", "No Such Channel", `Bad"Name`}
+	fake.errs = map[string]error{
+		`C:\Windows\System32\wevtutil.exe qe No Such Channel /f:text`: errors.New("exit status 15007"),
+	}
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherEventLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	for _, name := range []string{"Microsoft-Windows-Hyper-V-Compute_Admin.txt", "Application.txt"} {
+		if !stringArrayIncludesString(folder.files, filepath.Join(tmpFolder, name)) {
+			t.Errorf("expected %s in the Event folder, got %v", name, folder.files)
+		}
+	}
+	if !stringArrayIncludesString(fake.calls, `C:\Windows\System32\wevtutil.exe qe Microsoft-Windows-Hyper-V-Compute/Admin /f:text`) {
+		t.Errorf("expected the Hyper-V channel to be exported, calls: %v", fake.calls)
+	}
+
+	var got []string
+	for len(errs) > 0 {
+		got = append(got, (<-errs).Error())
+	}
+	want := []string{
+		`event channel "No Such Channel": exit status 15007`,
+		`event channel "Bad\"Name": invalid channel name`,
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			found = found || strings.HasPrefix(g, w)
+		}
+		if !found {
+			t.Errorf("expected error %q, got %q", w, got)
+		}
+	}
+}
+
+func TestGatherEventLogsChannelsEventIDs(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.eventChannels = stringList{"System"}
+	opts.eventIDs = eventIDList{41, 6008}
+	opts.since = time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	runGatherer(t, gatherEventLogs)
+	want := `C:\Windows\System32\wevtutil.exe qe System /q:*[System[(EventID=41 or EventID=6008) and TimeCreated[@SystemTime>='2019-06-01T00:00:00.000Z']]] /f:text`
+	if !stringArrayIncludesString(fake.calls, want) {
+		t.Errorf("expected the System channel to be exported with the ID and time filter, calls: %v", fake.calls)
+	}
+	// The ID filter is only for the -event-channel exports.
+	if !stringArrayIncludesString(fake.calls, `C:\Windows\System32\wevtutil.exe qe Setup /q:*[System[TimeCreated[@SystemTime>='2019-06-01T00:00:00.000Z']]] /f:text`) {
+		t.Errorf("expected the Setup events without the ID filter, calls: %v", fake.calls)
+	}
+
+	if got := eventIDXPath(eventIDList{4625}); got != "*[System[EventID=4625]]" {
+		t.Errorf("eventIDXPath([4625]) = %s", got)
+	}
+	if got := eventIDXPath(nil); got != "" {
+		t.Errorf("eventIDXPath(nil) = %q, want no filter", got)
+	}
+}
+
+func TestGatherNetworkLogsLocation(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"MSFT_NetConnectionProfile": {{{"InterfaceAlias", "Ethernet"}, {"NetworkCategory", "1"}}},
+		"Win32_ComputerSystem":      {{{"Domain", "corp.example.com"}, {"PartOfDomain", "true"}}},
+	}}
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "network_location.txt")
+	for _, want := range []string{
+		"Queried wmi objects [MSFT_NetConnectionProfile] from namespace root\\StandardCimv2",
+		"NetworkCategory: 1",
+		"Queried wmi objects [Win32_ComputerSystem] from namespace root\\CIMv2",
+		"PartOfDomain: true",
+		"Domain: corp.example.com",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in network_location.txt:\n%s", want, got)
+		}
+	}
+}
+
+func TestRunAllResults(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.noNetwork = true
+	fake.errs = map[string]error{`C:\Windows\System32\route.exe print`: errors.New("exit status 1")}
+
+	commands := []runner{
+		cmd{path: `C:\Windows\System32\ipconfig.exe`, args: "/all", outputFileName: "ipconfig.txt"},
+		cmd{path: `C:\Windows\System32\ping.exe`, args: "-n 10 8.8.8.8", outputFileName: "ping_dns.txt", network: true},
+		cmd{path: `C:\Windows\System32\route.exe`, args: "print", outputFileName: "route.txt"},
+		wmiQuery{class: "MSFT_Disk", namespace: `root\Microsoft\Windows\Storage`, outputFileName: "disks.txt"},
+	}
+	errs := make(chan error, 10)
+	results := runAll(context.Background(), commands, errs)
+
+	if len(results) != len(commands) {
+		t.Fatalf("got %d results for %d runners", len(results), len(commands))
+	}
+	for i, r := range results {
+		if !reflect.DeepEqual(r.Runner, commands[i]) {
+			t.Errorf("result %d is for %v, want %v", i, r.Runner, commands[i])
+		}
+	}
+	if r := results[0]; r.Err != nil || r.Skipped || r.Path != filepath.Join(tmpFolder, "ipconfig.txt") {
+		t.Errorf("expected ipconfig to succeed, got %+v", r)
+	}
+	if r := results[1]; !r.Skipped || r.Err != nil || r.Path != "" {
+		t.Errorf("expected ping to be skipped, got %+v", r)
+	}
+	if r := results[2]; r.Err == nil || r.Err.Error() != "exit status 1" {
+		t.Errorf("expected route to fail, got %+v", r)
+	}
+	if r := results[3]; r.Err != nil || r.Path != filepath.Join(tmpFolder, "disks.txt") {
+		t.Errorf("expected the WMI query to succeed, got %+v", r)
+	}
+	want := []string{filepath.Join(tmpFolder, "ipconfig.txt"), filepath.Join(tmpFolder, "disks.txt")}
+	if got := resultPaths(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("resultPaths() = %v, want %v", got, want)
+	}
+}
+
+func TestRunAllResultsNotRun(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	commands := []runner{
+		cmd{path: `C:\Windows\System32\ipconfig.exe`, args: "/all", outputFileName: "ipconfig.txt"},
+		cmd{path: `C:\Windows\System32\route.exe`, args: "print", outputFileName: "route.txt"},
+	}
+	errs := make(chan error, 10)
+	results := runAll(ctx, commands, errs)
+
+	if len(results) != len(commands) {
+		t.Fatalf("got %d results for %d runners", len(results), len(commands))
+	}
+	for i, r := range results {
+		if r.Err == nil {
+			t.Errorf("expected result %d to report it wasn't run, got %+v", i, r)
+		}
+	}
+}
+
+func TestGatherNetworkLogsAdapterAdvanced(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"MSFT_NetAdapterAdvancedPropertySettingData": {
+			{{"Name", "Ethernet"}, {"DisplayName", "Jumbo Packet"}, {"DisplayValue", "Disabled"}},
+			{{"Name", "Ethernet"}, {"DisplayName", "Large Send Offload V2 (IPv4)"}, {"DisplayValue", "Enabled"}},
+		},
+	}}
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "adapter_advanced.txt")
+	header := "Queried wmi objects [MSFT_NetAdapterAdvancedPropertySettingData] from namespace root\\StandardCimv2"
+	if !strings.HasPrefix(got, header) {
+		t.Errorf("expected adapter_advanced.txt to start with %q:\n%s", header, got)
+	}
+	for _, want := range []string{"DisplayName: Jumbo Packet", "DisplayName: Large Send Offload V2 (IPv4)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in adapter_advanced.txt:\n%s", want, got)
+		}
+	}
+}
+
+func TestCollectFilePathsExcludeGlob(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	root := filepath.Join(tmpFolder, "collect")
+	files := []string{
+		filepath.Join(root, "kubelet.log"),
+		filepath.Join(root, "server.KEY"),
+		filepath.Join(root, "certs", "client.pfx"),
+		filepath.Join(root, "archive", "old.log"),
+		filepath.Join(root, "archive", "readme.txt"),
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts.excludeGlobs = stringList{"*.key", "*.pfx", filepath.Join(root, "archive", "*.log")}
+
+	got, errs := collectFilePaths([]string{root})
+	if len(errs) != 0 {
+		t.Fatalf("collectFilePaths() errors = %v", errs)
+	}
+	want := []string{files[4], files[0]}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectFilePaths() = %v, want %v", got, want)
+	}
+	s := summary.String()
+	for _, f := range files[1:4] {
+		if !strings.Contains(s, "Excluded "+f) {
+			t.Errorf("expected %s to be recorded as excluded:\n%s", f, s)
+		}
+	}
+}
+
+func TestGatherProgramLogsPrinters(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	folder := runGatherer(t, gatherProgramLogs)
+	got := readFolderFile(t, folder, "printers.txt")
+	for _, c := range []string{`C:\Windows\System32\sc.exe queryex spooler`, `C:\Windows\System32\sc.exe qc spooler`} {
+		if !stringArrayIncludesString(fake.calls, c) {
+			t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+		}
+	}
+	for _, want := range []string{
+		"Queried wmi objects [Win32_Printer] from namespace root\\Cimv2",
+		"Queried wmi objects [Win32_PrinterDriver] from namespace root\\Cimv2",
+		"Name: fake Win32_Printer",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in printers.txt:\n%s", want, got)
+		}
+	}
+}
+
+func TestRunAllErrorRecords(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.errs = map[string]error{`C:\Windows\System32\route.exe print`: errors.New("exit status 1")}
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 20)
+	startGatherers(context.Background(), []gatherFunc{gatherNetworkLogs}, logs, errs, 0)
+	folder := <-logs
+
+	want := []errorRecord{{Folder: "Network", Command: `C:\Windows\System32\route.exe print`, Kind: kindOther, Message: "exit status 1"}}
+	if got := errorRecords([]logFolder{folder}); !reflect.DeepEqual(got, want) {
+		t.Errorf("errorRecords() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.readOnly = true
+	opts.trace = true
+	opts.bootTrace = true
+
+	for _, g := range gatherers() {
+		p := reflect.ValueOf(g).Pointer()
+		if p == reflect.ValueOf(gatherTraceLogs).Pointer() || p == reflect.ValueOf(gatherBootTraceLogs).Pointer() {
+			t.Error("trace gatherers should be excluded with -read-only")
+		}
+	}
+	if s := summary.String(); !strings.Contains(s, "Skipped the wpr trace: "+string(errReadOnly)) {
+		t.Errorf("expected the skipped trace in the summary:\n%s", s)
+	}
+
+	folder := runGatherer(t, gatherDiskLogs)
+	if fake.callCount(`C:\Windows\System32\defrag.exe C: /A`) != 0 {
+		t.Errorf("defrag should be skipped with -read-only, calls: %v", fake.calls)
+	}
+	if got := readFolderFile(t, folder, "volume_health.txt"); !strings.Contains(got, "Skipped: "+string(errReadOnly)) {
+		t.Errorf("expected the skipped defrag in volume_health.txt:\n%s", got)
+	}
+	if fake.callCount(`C:\Windows\System32\fsutil.exe volume diskfree C:`) != 1 {
+		t.Errorf("read-only collectors should still run, calls: %v", fake.calls)
+	}
+}
+
+func TestSinceAppliedToTimeAwareCollectors(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withFakeMetadata(t, nil)()
+	wmi := &fakeWmiSource{}
+	wmiSrc = wmi
+	opts.since = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	opts.eventChannels = stringList{"Microsoft-Windows-Hyper-V-Compute/Admin"}
+	timeCond := "TimeCreated[@SystemTime>='2019-06-01T12:00:00.000Z']"
+
+	runGatherer(t, gatherEventLogs)
+	runGatherer(t, gatherStartupScriptLogs)
+	runGatherer(t, gatherCrashDumpLogs)
+	runGatherer(t, gatherKubernetesLogs)
+
+	for _, want := range []string{
+		`C:\Windows\System32\wevtutil.exe qe Setup /q:*[System[` + timeCond + `]] /f:text`,
+		`C:\Windows\System32\wevtutil.exe qe System /q:*[System[(` + strings.TrimSuffix(strings.TrimPrefix(bootEventsXPath, "*[System["), "]]") + `) and ` + timeCond + `]] /f:text`,
+		`C:\Windows\System32\wevtutil.exe qe Microsoft-Windows-Hyper-V-Compute/Admin /q:*[System[` + timeCond + `]] /f:text`,
+	} {
+		if !stringArrayIncludesString(fake.calls, want) {
+			t.Errorf("expected %q to run, calls: %v", want, fake.calls)
+		}
+	}
+	agentEvents := false
+	for _, c := range fake.calls {
+		agentEvents = agentEvents || strings.Contains(c, "qe Application") && strings.Contains(c, timeCond)
+	}
+	if !agentEvents {
+		t.Errorf("expected the agent events to be limited by -since, calls: %v", fake.calls)
+	}
+	if got, want := wmi.wheres["Win32_ReliabilityRecords"], "TimeGenerated >= '20190601120000.000000-000'"; !strings.Contains(got, want) {
+		t.Errorf("reliability records where = %q, want it to contain %q", got, want)
+	}
+
+	s := summary.String()
+	for _, want := range []string{"The raw .evtx event logs can't be filtered by time", "The Kubernetes logs can't be filtered by time"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in the summary:\n%s", want, s)
+		}
+	}
+}
+
+func TestGatherSystemLogsWsl(t *testing.T) {
+	for _, installed := range []bool{true, false} {
+		t.Run(fmt.Sprintf("installed=%v", installed), func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			oldWsl := wslPath
+			defer func() { wslPath = oldWsl }()
+			wslPath = filepath.Join(tmpFolder, "wsl.exe")
+			if installed {
+				if err := ioutil.WriteFile(wslPath, []byte("fake"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			logs := make(chan logFolder, 1)
+			errs := make(chan error, 10)
+			gatherSystemLogs(context.Background(), logs, errs)
+			folder := <-logs
+
+			wslFile := filepath.Join(tmpFolder, "wsl.txt")
+			if got := stringArrayIncludesString(folder.files, wslFile); got != installed {
+				t.Errorf("wsl.txt collected = %v, want %v", got, installed)
+			}
+			for _, c := range []string{wslPath + " --list --verbose", wslPath + " --status"} {
+				if got := fake.callCount(c) == 1; got != installed {
+					t.Errorf("%q ran = %v, want %v", c, got, installed)
+				}
+			}
+			for len(errs) > 0 {
+				if err := <-errs; strings.Contains(err.Error(), "wsl") {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordedCommandLine(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer func() { elevated = true }()
+	elevated = false
+
+	tests := []struct {
+		name    string
+		command cmd
+	}{
+		{"args in order", cmd{path: `C:\Windows\System32\netsh.exe`, args: "interface ipv4 show subinterfaces level=verbose", outputFileName: "subinterfaces.txt"}},
+		{"unelevated args", cmd{path: `C:\Windows\System32\netstat.exe`, args: "-anob", unelevatedArgs: "-ano", outputFileName: "netstat.txt", admin: adminLimited}},
+		{"produces file", cmd{path: `C:\Windows\System32\msinfo32.exe`, args: "/report msinfo32.txt", outputFileName: "msinfo32.txt", cmdProducesFile: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.calls = nil
+			outPath, err := tt.command.run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.calls) != 1 {
+				t.Fatalf("expected a single call, got %v", fake.calls)
+			}
+			executed := fake.calls[0]
+			if got := commandLines.get(outPath); got != executed {
+				t.Errorf("recorded command line = %q, executed %q", got, executed)
+			}
+			if tt.command.cmdProducesFile {
+				return
+			}
+			data, err := ioutil.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first := strings.SplitN(string(data), "\r\n", 2)[0]; first != "# Command: "+executed {
+				t.Errorf("first line = %q, want the executed command %q", first, executed)
+			}
+		})
+	}
+}
+
+func TestTraceOnly(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.traceOnly = true
+	opts.traceDuration = 10 * time.Millisecond
+
+	runFuncs := gatherers()
+	if len(runFuncs) != 1 || reflect.ValueOf(runFuncs[0]).Pointer() != reflect.ValueOf(gatherTraceLogs).Pointer() {
+		t.Fatalf("expected only the trace gatherer to run, got %d gatherers", len(runFuncs))
+	}
+
+	logs := make(chan logFolder, len(runFuncs))
+	errs := make(chan error, 10)
+	start := time.Now()
+	startGatherers(context.Background(), runFuncs, logs, errs, 0)
+	folder := <-logs
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the trace took %v, want about -duration", elapsed)
+	}
+	if folder.name != "Trace" {
+		t.Errorf("folder name = %q, want Trace", folder.name)
+	}
+	want := []string{
+		`C:\Windows\System32\wpr.exe -start CPU -start DiskIO -start FileIO -start Network`,
+		`C:\Windows\System32\wpr.exe -stop ` + filepath.Join(tmpFolder, "trace.etl"),
+	}
+	if !reflect.DeepEqual(fake.calls, want) {
+		t.Errorf("calls = %v, want only the wpr start and stop %v", fake.calls, want)
+	}
+}
+
+func TestTraceOnlyNotElevated(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer func() { elevated = true }()
+	elevated = false
+	opts.traceOnly = true
+
+	if runFuncs := gatherers(); len(runFuncs) != 0 {
+		t.Errorf("expected nothing to run, got %d gatherers", len(runFuncs))
+	}
+	if s := summary.String(); !strings.Contains(s, "Skipped the wpr trace") {
+		t.Errorf("expected the skipped trace in the summary:\n%s", s)
+	}
+}
+
+func TestCollectorTimeout(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.hang = true
+	opts.policy.Timeout = 300 * time.Millisecond
+	opts.collectorTimeouts = timeoutMap{"tracert_gstatic.txt": 10 * time.Millisecond}
+
+	run := func(c runner) time.Duration {
+		start := time.Now()
+		if _, err := c.run(context.Background()); err != context.DeadlineExceeded {
+			t.Errorf("run() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		return time.Since(start)
+	}
+	if d := run(cmd{path: `C:\Windows\System32\tracert.exe`, args: "www.gstatic.com", outputFileName: "tracert_gstatic.txt"}); d >= 300*time.Millisecond {
+		t.Errorf("tracert ran for %v, want its 10ms -collector-timeout", d)
+	}
+	if d := run(cmd{path: `C:\Windows\System32\systeminfo.exe`, outputFileName: "systeminfo.txt"}); d < 300*time.Millisecond {
+		t.Errorf("systeminfo ran for %v, want the 300ms -timeout", d)
+	}
+}
+
+func TestTimeoutsAsWarnings(t *testing.T) {
+	for _, asWarnings := range []bool{false, true} {
+		fake, cleanup := withFakeExecutor(t)
+		fake.hang = true
+		opts.timeoutsAsWarnings = asWarnings
+		gather := func(ctx context.Context, logs chan logFolder, errs chan error) {
+			logs <- logFolder{name: "Network", files: resultPaths(runAll(ctx, []runner{
+				cmd{path: `C:\Windows\System32\tracert.exe`, args: "www.gstatic.com", outputFileName: "tracert.txt", policy: RunPolicy{Timeout: 10 * time.Millisecond, MaxAttempts: 1}},
+			}, errs))}
+		}
+
+		logs := make(chan logFolder, 1)
+		errs := make(chan error, 10)
+		startGatherers(context.Background(), []gatherFunc{gather}, logs, errs, 0)
+		folder := <-logs
+		close(errs)
+		var forwarded []error
+		for err := range errs {
+			forwarded = append(forwarded, err)
+		}
+		records := errorRecords([]logFolder{folder})
+
+		if asWarnings {
+			if len(forwarded) != 0 || len(records) != 0 {
+				t.Errorf("with -timeouts-as-warnings: forwarded %v, errors.json %v, want the timeout left out", forwarded, records)
+			}
+			if len(folder.timeouts) != 1 || errorKind(folder.timeouts[0]) != kindTimeout {
+				t.Errorf("with -timeouts-as-warnings: timeouts = %v, want the tracert timeout", folder.timeouts)
+			}
+		} else {
+			if len(forwarded) != 1 || len(folder.timeouts) != 0 {
+				t.Errorf("without -timeouts-as-warnings: forwarded %v, timeouts %v, want the timeout forwarded", forwarded, folder.timeouts)
+			}
+			if len(records) != 1 || records[0].Kind != kindTimeout {
+				t.Errorf("without -timeouts-as-warnings: errors.json = %v, want a timeout", records)
+			}
+		}
+		cleanup()
+	}
+}
+
+func TestRunAllNotRunKind(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	errs := make(chan error, 10)
+	results := runAll(ctx, []runner{
+		cmd{path: `C:\Windows\System32\ipconfig.exe`, args: "/all", outputFileName: "ipconfig.txt"},
+		cmd{path: `C:\Windows\System32\route.exe`, args: "print", outputFileName: "route.txt"},
+	}, errs)
+	close(errs)
+
+	if len(fake.calls) != 0 {
+		t.Errorf("ran %v after the deadline", fake.calls)
+	}
+	for _, r := range results {
+		if got := errorKind(r.Err); got != kindTimeout {
+			t.Errorf("%v: kind of %v = %s, want %s", r.Runner, r.Err, got, kindTimeout)
+		}
+	}
+	for err := range errs {
+		if got := errorKind(err); got != kindTimeout {
+			t.Errorf("kind of %v = %s, want %s", err, got, kindTimeout)
+		}
+	}
+	// The kinds hold through runError and other wrapping too.
+	for err, want := range map[error]string{
+		runError{"tracert.exe", fmt.Errorf("attempt 2: %w", context.DeadlineExceeded)}:         kindTimeout,
+		runError{"wpr.exe", &exec.Error{Name: "wpr.exe", Err: exec.ErrNotFound}}:               kindNotFound,
+		fmt.Errorf("reading: %w", &os.PathError{Op: "open", Path: "a", Err: os.ErrPermission}): kindPermission,
+		errors.New("RPC server unavailable"):                                                   kindOther,
+	} {
+		if got := errorKind(err); got != want {
+			t.Errorf("errorKind(%v) = %s, want %s", err, got, want)
+		}
+	}
+}
+
+type fakeWmiConnection struct {
+	namespace string
+	queries   int
+	fail      bool
+}
+
+func (c *fakeWmiConnection) query(class, where string) ([]wmiObject, error) {
+	c.queries++
+	if c.fail {
+		return nil, errors.New("RPC server unavailable")
+	}
+	return []wmiObject{{{"Name", c.namespace + " " + class}}}, nil
+}
+
+func TestCachedWmiSource(t *testing.T) {
+	var conns []*fakeWmiConnection
+	src := newCachedWmiSource(func(namespace string) (wmiConnection, error) {
+		c := &fakeWmiConnection{namespace: namespace}
+		conns = append(conns, c)
+		return c, nil
+	})
+
+	for _, class := range []string{"Win32_OperatingSystem", "Win32_Service", "Win32_Process"} {
+		objects, err := src.query(class, `root\cimv2`, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := objects[0].get("Name"); got != `root\cimv2 `+class {
+			t.Errorf("expected %s from root\\cimv2, got %v", class, got)
+		}
+	}
+	if len(conns) != 1 || conns[0].queries != 3 {
+		t.Fatalf("expected a single connection for the 3 queries to root\\cimv2, got %d", len(conns))
+	}
+
+	if _, err := src.query("MSFT_Disk", `root\Microsoft\Windows\Storage`, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 2 {
+		t.Errorf("expected a connection per namespace, got %d", len(conns))
+	}
+
+	// A query failing on a connection reconnects and is retried once.
+	conns[0].fail = true
+	if _, err := src.query("Win32_Service", `root\cimv2`, ""); err != nil {
+		t.Errorf("expected the query to succeed on a new connection, got %v", err)
+	}
+	if len(conns) != 3 || conns[2].namespace != `root\cimv2` || conns[2].queries != 1 {
+		t.Fatalf("expected a new connection to root\\cimv2, got %d connections", len(conns))
+	}
+	if _, err := src.query("Win32_Process", `root\cimv2`, ""); err != nil || len(conns) != 3 || conns[2].queries != 2 {
+		t.Errorf("expected the new connection to be reused, got %d connections, err %v", len(conns), err)
+	}
+
+	conns[2].fail = true
+	src.connect = func(namespace string) (wmiConnection, error) {
+		return nil, errors.New("access denied")
+	}
+	if _, err := src.query("Win32_Process", `root\cimv2`, ""); err == nil || err.Error() != "access denied" {
+		t.Errorf("expected the reconnect error, got %v", err)
+	}
+}
+
+func TestGatherSystemLogsLoadedDrivers(t *testing.T) {
+	for _, installed := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fltmc installed=%v", installed), func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			oldFltmc := fltmcPath
+			defer func() { fltmcPath = oldFltmc }()
+			fltmcPath = filepath.Join(tmpFolder, "fltMC.exe")
+			if installed {
+				if err := ioutil.WriteFile(fltmcPath, []byte("fake"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			folder := runGatherer(t, gatherSystemLogs)
+
+			if fake.callCount(`C:\Windows\System32\driverquery.exe /v /fo csv`) != 1 {
+				t.Errorf("expected driverquery to run once, got calls %v", fake.calls)
+			}
+			if !stringArrayIncludesString(folder.files, filepath.Join(tmpFolder, "loaded_drivers.csv")) {
+				t.Errorf("expected loaded_drivers.csv in %v", folder.files)
+			}
+			if got := fake.callCount(fltmcPath+" filters") == 1; got != installed {
+				t.Errorf("fltmc filters ran = %v, want %v", got, installed)
+			}
+			if got := stringArrayIncludesString(folder.files, filepath.Join(tmpFolder, "filter_drivers.txt")); got != installed {
+				t.Errorf("filter_drivers.txt collected = %v, want %v", got, installed)
+			}
+		})
+	}
+}
+
+func TestGatherSystemLogsBootLog(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("boot logging enabled=%v", enabled), func(t *testing.T) {
+			_, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			oldBootLog := bootLog
+			defer func() { bootLog = oldBootLog }()
+			bootLog = filepath.Join(tmpFolder, "Windows", "ntbtlog.txt")
+			if enabled {
+				if err := os.MkdirAll(filepath.Dir(bootLog), 0755); err != nil {
+					t.Fatal(err)
+				}
+				content := "Microsoft (R) Windows (R) Version 10.0 (Build 17763)\r\n 6 1 2020 10:12:03.500\r\nLoaded driver \\SystemRoot\\system32\\ntoskrnl.exe\r\nDid not load driver \\SystemRoot\\System32\\drivers\\vga.sys\r\n"
+				if err := ioutil.WriteFile(bootLog, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			folder := runGatherer(t, gatherSystemLogs)
+
+			if got := stringArrayIncludesString(folder.files, bootLog); got != enabled {
+				t.Errorf("ntbtlog.txt collected = %v, want %v: %v", got, enabled, folder.files)
+			}
+			if noted := strings.Contains(summary.String(), "boot logging is not enabled"); noted == enabled {
+				t.Errorf("boot logging note = %v, want %v:\n%s", noted, !enabled, summary.String())
+			}
+		})
+	}
+}
+
+func TestGatherSystemLogsDeviceGuard(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"Win32_DeviceGuard": {{
+			{"VirtualizationBasedSecurityStatus", int32(2)},
+			{"SecurityServicesConfigured", []int32{1, 2}},
+			{"SecurityServicesRunning", []int32{1}},
+			{"CodeIntegrityPolicyEnforcementStatus", nil},
+		}},
+	}}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "device_guard.txt")
+	wantHeader := "Queried wmi objects [Win32_DeviceGuard] from namespace root\\Microsoft\\Windows\\DeviceGuard\n\n"
+	if !strings.HasPrefix(got, wantHeader) {
+		t.Errorf("device_guard.txt should start with %q, got:\n%s", wantHeader, got)
+	}
+	for _, want := range []string{
+		"VirtualizationBasedSecurityStatus: 2\r\n",
+		"SecurityServicesConfigured: [1 2]\r\n",
+		"SecurityServicesRunning: [1]\r\n",
+		"CodeIntegrityPolicyEnforcementStatus: \r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in device_guard.txt:\n%s", want, got)
+		}
+	}
+}
+
+func TestGatherSystemLogsAuditPolicy(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	call := `C:\Windows\System32\auditpol.exe /get /category:*`
+	fake.outputs = map[string]string{call: "System audit policy\r\nCategory/Subcategory      Setting\r\nLogon/Logoff\r\n  Logon                   Success and Failure\r\n"}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	if !stringArrayIncludesString(fake.calls, call) {
+		t.Errorf("expected %s to run, got %v", call, fake.calls)
+	}
+	got := readFolderFile(t, folder, "audit_policy.txt")
+	if !strings.Contains(got, "Logon                   Success and Failure") {
+		t.Errorf("expected the audit policy in audit_policy.txt:\n%s", got)
+	}
+}
+
+func TestGroupCollectorTimeout(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.hang = true
+	opts.collectorTimeouts = timeoutMap{"time_sync.txt": 10 * time.Millisecond}
+	appliedTimeouts.names = make(map[string]bool)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := group{"time_sync.txt", []section{
+			cmd{path: `C:\Windows\System32\w32tm.exe`, args: "/query /status"},
+			cmd{path: `C:\Windows\System32\w32tm.exe`, args: "/query /peers"},
+		}}.run(context.Background())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if errorKind(err) != kindTimeout {
+			t.Errorf("group error = %v, want its sections timed out", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the -collector-timeout of the group was not applied to its sections")
+	}
+	if got := unmatchedTimeouts(); len(got) != 0 {
+		t.Errorf("unmatchedTimeouts() = %v, want the group timeout applied", got)
+	}
+}
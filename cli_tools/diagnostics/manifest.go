@@ -0,0 +1,264 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	manifestFileName = "manifest.txt"
+	// manifestComplete ends the manifest of a run that gathered every
+	// folder, a manifest without it is from a run that was cut short.
+	manifestComplete = "# Complete"
+	// manifestHostPrefix starts the line of the manifest naming the machine
+	// the bundle was collected on.
+	manifestHostPrefix = "# Host: "
+)
+
+// userSegmentRe matches the user name in paths under the users folder.
+var userSegmentRe = regexp.MustCompile(`(?i)(\\Users\\)([^\\]+)`)
+
+// sharedProfiles are the folders under the users folder that don't belong
+// to a user, they are left as they are.
+var sharedProfiles = map[string]bool{"public": true, "default": true, "default user": true, "all users": true}
+
+// reproducibleTemp stands for the temporary folder in the manifest of a
+// -reproducible bundle, its name changes with every run.
+const reproducibleTemp = "<temp>"
+
+// reproduciblePaths returns s, which may contain paths, with the temporary
+// folder replaced with reproducibleTemp under -reproducible.
+func reproduciblePaths(s string) string {
+	if opts.reproducible && tmpFolder != "" {
+		s = strings.Replace(s, tmpFolder, reproducibleTemp, -1)
+	}
+	return s
+}
+
+// recordedPath returns s, which contains a path, as it should be recorded in
+// the manifest. With -reproducible the temporary folder is replaced with
+// reproducibleTemp, and with -obfuscate-paths user names are replaced with a
+// token that is the same for the same user.
+func recordedPath(s string) string {
+	s = reproduciblePaths(s)
+	if !opts.obfuscatePaths {
+		return s
+	}
+	return userSegmentRe.ReplaceAllStringFunc(s, func(m string) string {
+		parts := userSegmentRe.FindStringSubmatch(m)
+		if sharedProfiles[strings.ToLower(parts[2])] {
+			return m
+		}
+		return parts[1] + userToken(parts[2])
+	})
+}
+
+// userToken is a stable stand in for a user name, user names are case
+// insensitive on Windows.
+func userToken(name string) string {
+	return token("user", []byte(strings.ToLower(name)))
+}
+
+// tokenKey keys the tokens that stand in for user names, host names and IP
+// addresses. It is random for each run and never goes into the bundle, so a
+// token can't be reversed by hashing likely names. Tokens are therefore only
+// stable within a bundle, the same name gets a different token in every run
+// unless -reproducible makes them use reproducibleTokenKey.
+var tokenKey = newTokenKey()
+
+// reproducibleTokenKey is the token key of -reproducible bundles, fixed so
+// that the tokens are the same in every run. Being public, it only keeps
+// the names from being read at a glance.
+var reproducibleTokenKey = func() []byte {
+	sum := sha256.Sum256([]byte("compute-image-tools diagnostics reproducible tokens"))
+	return sum[:]
+}()
+
+func newTokenKey() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Error generating the token key: %v", err)
+	}
+	return key
+}
+
+// token returns prefix and a keyed hash of value, the same value gets the
+// same token for the whole run, and in every run with -reproducible.
+func token(prefix string, value []byte) string {
+	key := tokenKey
+	if opts.reproducible {
+		key = reproducibleTokenKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(value)
+	return fmt.Sprintf("%s-%x", prefix, mac.Sum(nil)[:4])
+}
+
+// commandLines records the exact command line that produced each output
+// file, the manifest lists it next to the file so it can be run again by
+// hand.
+var commandLines = &commandLineLog{lines: make(map[string]string)}
+
+type commandLineLog struct {
+	mu    sync.Mutex
+	lines map[string]string
+}
+
+func (c *commandLineLog) record(path, commandLine string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines[path] = commandLine
+}
+
+// get returns the command line that produced path, or "" when it wasn't
+// produced by a command.
+func (c *commandLineLog) get(path string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lines[path]
+}
+
+// carriedForwards records the files carried forward from the -attach-previous
+// bundle, the manifest notes where each came from as the file itself is a
+// byte for byte copy.
+var carriedForwards = &carriedForwardLog{records: make(map[string]carriedRecord)}
+
+// carriedRecord is where a carried forward file came from and when it was
+// first collected.
+type carriedRecord struct {
+	bundle string
+	since  time.Time
+}
+
+// carriedNotePrefix and carriedNoteSince frame the note of a carried
+// forward file in the manifest, readPreviousBundle reads the date back.
+const (
+	carriedNotePrefix = "carried forward from "
+	carriedNoteSince  = ", unchanged since "
+)
+
+func (r carriedRecord) String() string {
+	return carriedNotePrefix + r.bundle + carriedNoteSince + r.since.Format(time.RFC3339)
+}
+
+type carriedForwardLog struct {
+	mu      sync.Mutex
+	records map[string]carriedRecord
+}
+
+func (c *carriedForwardLog) record(path string, r carriedRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records[path] = r
+}
+
+// get returns where the file at path was carried forward from, ok is false
+// when it was collected.
+func (c *carriedForwardLog) get(path string) (r carriedRecord, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok = c.records[path]
+	return r, ok
+}
+
+// manifest indexes the collected files as the folders complete. Each folder
+// is flushed to disk as soon as it is added, so a run that crashes or is
+// killed midway still leaves an index of what it collected in tmpFolder.
+type manifest struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// createManifest creates the manifest at path.
+func createManifest(path string) (*manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	if _, err := fmt.Fprintf(f, "# Files collected by diagnostics %s, one folder at a time.\r\n%s%s\r\n", buildInfo(), manifestHostPrefix, hostname); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &manifest{f: f}, nil
+}
+
+// add writes the files and errors of folder and flushes them to disk. Each
+// file is listed with its path in the archive, its original path and, when
+// a command produced it, the command line or, when it was carried forward,
+// where from.
+func (m *manifest) add(folder logFolder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	name := folder.name
+	if name == "" {
+		name = "(root)"
+	}
+	fmt.Fprintf(&b, "[%s]\r\n", name)
+	for _, path := range folder.files {
+		fmt.Fprintf(&b, "%s\t%s", archivePath(folder.name, path), recordedPath(path))
+		if line := commandLines.get(path); line != "" {
+			fmt.Fprintf(&b, "\t%s", recordedPath(line))
+		}
+		if r, ok := carriedForwards.get(path); ok {
+			fmt.Fprintf(&b, "\t%s", recordedPath(r.String()))
+		}
+		b.WriteString("\r\n")
+	}
+	for _, err := range folder.errs {
+		fmt.Fprintf(&b, "error\t%s\r\n", recordedPath(err.Error()))
+	}
+	if _, err := m.f.WriteString(b.String()); err != nil {
+		return err
+	}
+	return m.f.Sync()
+}
+
+// comment writes text as a comment line, such as what the files were
+// collected from.
+func (m *manifest) comment(text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := fmt.Fprintf(m.f, "# %s\r\n", text); err != nil {
+		return err
+	}
+	return m.f.Sync()
+}
+
+// close marks the manifest complete and closes it.
+func (m *manifest) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.f.WriteString(manifestComplete + "\r\n"); err != nil {
+		m.f.Close()
+		return err
+	}
+	return m.f.Close()
+}
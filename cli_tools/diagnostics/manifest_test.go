@@ -0,0 +1,218 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, manifestFileName)
+	m, err := createManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := filepath.Join(dir, "systeminfo.txt")
+	commandLines.record(system, `C:\Windows\System32\systeminfo.exe`)
+	msinfo := filepath.Join(dir, "msinfo32.txt")
+	carriedForwards.record(msinfo, carriedRecord{bundle: `C:\previous.zip`, since: time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)})
+	if err := m.add(logFolder{name: "System", files: []string{system, msinfo}, errs: []error{errors.New("bcdedit failed")}}); err != nil {
+		t.Fatal(err)
+	}
+	// The run is killed here: the manifest is never closed, what was added
+	// must already be on disk.
+	defer m.f.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{"[System]", "System/systeminfo.txt\t" + system + "\tC:\\Windows\\System32\\systeminfo.exe\r\n", "System/msinfo32.txt\t" + msinfo + "\tcarried forward from C:\\previous.zip, unchanged since 2019-06-01T08:00:00Z\r\n", "error\tbcdedit failed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in the partial manifest:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, manifestComplete) {
+		t.Errorf("a partial manifest should not be marked complete:\n%s", got)
+	}
+}
+
+func TestManifestComplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, manifestFileName)
+	m, err := createManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []logFolder{
+		{name: "System", files: []string{filepath.Join(dir, "systeminfo.txt")}},
+		{name: "Network", files: []string{filepath.Join(dir, "ipconfig.txt")}},
+	} {
+		if err := m.add(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.Contains(got, "Network/ipconfig.txt") || !strings.HasSuffix(got, manifestComplete+"\r\n") {
+		t.Errorf("expected every folder and the complete marker in the manifest:\n%s", got)
+	}
+}
+
+func TestUserTokenKeyed(t *testing.T) {
+	oldKey, oldOpts := tokenKey, opts
+	defer func() { tokenKey, opts = oldKey, oldOpts }()
+
+	// An unkeyed hash of the name could be reversed by hashing likely names.
+	sum := sha256.Sum256([]byte("jdoe"))
+	if got := userToken("jdoe"); got == fmt.Sprintf("user-%x", sum[:4]) {
+		t.Errorf("userToken(jdoe) = %q, the unkeyed hash of the name", got)
+	}
+	// Each run has its own key, so the tokens are only stable within a
+	// bundle.
+	first := userToken("jdoe")
+	tokenKey = newTokenKey()
+	if got := userToken("jdoe"); got == first {
+		t.Errorf("userToken(jdoe) = %q in the next run too, want it to change", got)
+	}
+	// With -reproducible every run gives the same tokens.
+	opts.reproducible = true
+	first = userToken("jdoe")
+	tokenKey = newTokenKey()
+	if got := userToken("jdoe"); got != first {
+		t.Errorf("userToken(jdoe) = %q in the next -reproducible run, want %q", got, first)
+	}
+	if first == fmt.Sprintf("user-%x", sum[:4]) {
+		t.Errorf("userToken(jdoe) = %q with -reproducible, the unkeyed hash of the name", first)
+	}
+}
+
+func TestRecordedPathObfuscation(t *testing.T) {
+	oldOpts := opts
+	defer func() { opts = oldOpts }()
+	opts.obfuscatePaths = true
+
+	jdoe := recordedPath(`C:\Users\jdoe\AppData\Local\Temp\setup.log`)
+	if strings.Contains(jdoe, "jdoe") {
+		t.Errorf("user name left in %q", jdoe)
+	}
+	if want := `C:\Users\` + userToken("jdoe") + `\AppData\Local\Temp\setup.log`; jdoe != want {
+		t.Errorf("recordedPath() = %q, want %q", jdoe, want)
+	}
+	// The same user gets the same token, whatever the case, and other users
+	// get another one.
+	if got := recordedPath(`C:\users\JDoe\Desktop\notes.txt`); got != `C:\users\`+userToken("jdoe")+`\Desktop\notes.txt` {
+		t.Errorf("recordedPath() = %q, want the token of jdoe", got)
+	}
+	if userToken("jdoe") == userToken("asmith") {
+		t.Errorf("different users got the same token %q", userToken("jdoe"))
+	}
+	for _, p := range []string{`C:\Users\Public\Documents\a.txt`, `C:\Windows\Logs\CBS\CBS.log`} {
+		if got := recordedPath(p); got != p {
+			t.Errorf("recordedPath(%q) = %q, want it unchanged", p, got)
+		}
+	}
+
+	opts.obfuscatePaths = false
+	if p := `C:\Users\jdoe\a.txt`; recordedPath(p) != p {
+		t.Errorf("paths should be unchanged without -obfuscate-paths")
+	}
+}
+
+func TestManifestObfuscatesPaths(t *testing.T) {
+	oldOpts := opts
+	defer func() { opts = oldOpts }()
+	opts.obfuscatePaths = true
+	dir, err := ioutil.TempDir("", "manifest_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := createManifest(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.add(logFolder{
+		name:  "Event",
+		files: []string{`C:\Users\jdoe\AppData\Local\app.log`},
+		errs:  []error{errors.New(`open C:\Users\jdoe\ntuser.dat: access denied`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"\t" + `C:\Users\` + userToken("jdoe") + `\AppData\Local\app.log`,
+		"error\t" + `open C:\Users\` + userToken("jdoe") + `\ntuser.dat: access denied`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in the manifest:\n%s", want, got)
+		}
+	}
+}
+
+func TestRecordedPathReproducible(t *testing.T) {
+	oldOpts, oldTmp := opts, tmpFolder
+	defer func() { opts, tmpFolder = oldOpts, oldTmp }()
+	tmpFolder = `C:\Users\jdoe\AppData\Local\Temp\diagnostics123456`
+
+	p := tmpFolder + `\ipconfig.txt`
+	if got := recordedPath(p); got != p {
+		t.Errorf("recordedPath(%q) = %q, want it unchanged without -reproducible", p, got)
+	}
+	opts.reproducible = true
+	if got, want := recordedPath(p), reproducibleTemp+`\ipconfig.txt`; got != want {
+		t.Errorf("recordedPath(%q) = %q, want %q", p, got, want)
+	}
+	line := `C:\Windows\System32\msinfo32.exe /report ` + tmpFolder + `\msinfo32.txt`
+	if got, want := recordedPath(line), `C:\Windows\System32\msinfo32.exe /report `+reproducibleTemp+`\msinfo32.txt`; got != want {
+		t.Errorf("recordedPath(%q) = %q, want %q", line, got, want)
+	}
+}
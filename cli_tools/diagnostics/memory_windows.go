@@ -0,0 +1,66 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// memoryTrendCounters are the performance counters sampled by memoryTrend.
+var memoryTrendCounters = []string{
+	`\Memory\Committed Bytes`,
+	`\Memory\% Committed Bytes In Use`,
+	`\Memory\Pool Paged Bytes`,
+	`\Memory\Pool Nonpaged Bytes`,
+	`\Memory\Pages/sec`,
+}
+
+// highCommitPercent is the share of the commit limit that, when every sample
+// is over it, flags the system as short of memory.
+const highCommitPercent = 90
+
+// memoryTrend samples the commit charge, the kernel pools and the paging
+// rate with typeperf into a CSV file, showing how memory use moves rather
+// than a single snapshot. Sustained high commit is flagged in the summary.
+type memoryTrend struct {
+	outputFileName string
+}
+
+func (m memoryTrend) run(ctx context.Context) (string, error) {
+	if opts.memorySamples <= 0 {
+		return "", skipError("memory sampling is off, -memory-samples is 0")
+	}
+	path, err := typeperfCommand(memoryTrendCounters, opts.memoryInterval, opts.memorySamples, m.outputFileName).run(ctx)
+	if err != nil {
+		return path, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	defer f.Close()
+	stats, err := summarizeCounters(f)
+	if err != nil {
+		return path, fmt.Errorf("reading %s: %v", m.outputFileName, err)
+	}
+	for _, s := range stats {
+		if s.counter == `Memory\% Committed Bytes In Use` && s.min >= highCommitPercent {
+			summary.warnf("The commit charge stayed at %.0f%% to %.0f%% of the commit limit over %d samples, the system is short of memory", s.min, s.max, s.samples)
+		}
+	}
+	return path, nil
+}
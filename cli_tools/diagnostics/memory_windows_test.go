@@ -0,0 +1,80 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleMemoryCSV = `"(PDH-CSV 4.0)","\\WIN-1\Memory\Committed Bytes","\\WIN-1\Memory\% Committed Bytes In Use","\\WIN-1\Memory\Pool Paged Bytes","\\WIN-1\Memory\Pool Nonpaged Bytes","\\WIN-1\Memory\Pages/sec"
+"06/01/2019 08:00:01.000","15032385536","%s","402653184","201326592","0.000000"
+"06/01/2019 08:00:02.000","15569256448","93.500000","402653184","201326592","1200.000000"
+"06/01/2019 08:00:03.000","15837691904","97.100000","402653184","201326592","3400.000000"
+`
+
+func TestMemoryTrend(t *testing.T) {
+	for _, tc := range []struct {
+		firstCommit string
+		warn        bool
+	}{
+		{"91.200000", true},
+		// A single sample under the bar is not sustained high commit.
+		{"60.000000", false},
+	} {
+		t.Run(tc.firstCommit, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			fake.writeFiles = true
+			opts.memorySamples = 3
+			opts.memoryInterval = time.Second
+			outPath := filepath.Join(tmpFolder, "memory_trend.csv")
+			call := `C:\Windows\System32\typeperf.exe \Memory\Committed Bytes \Memory\% Committed Bytes In Use \Memory\Pool Paged Bytes \Memory\Pool Nonpaged Bytes \Memory\Pages/sec -si 1 -sc 3 -f CSV -o ` + outPath + ` -y`
+			fake.outputs = map[string]string{call: strings.Replace(sampleMemoryCSV, "%s", tc.firstCommit, 1)}
+
+			path, err := memoryTrend{"memory_trend.csv"}.run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != outPath || fake.callCount(call) != 1 {
+				t.Errorf("expected %q to write %s, got %s and calls %v", call, outPath, path, fake.calls)
+			}
+			s := summary.String()
+			if warned := strings.Contains(s, "short of memory"); warned != tc.warn {
+				t.Errorf("high commit flagged = %v, want %v:\n%s", warned, tc.warn, s)
+			}
+			if tc.warn && !strings.Contains(s, "stayed at 91% to 97% of the commit limit over 3 samples") {
+				t.Errorf("expected the commit range in the summary:\n%s", s)
+			}
+		})
+	}
+}
+
+func TestMemoryTrendOff(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.memorySamples = 0
+	if _, err := (memoryTrend{"memory_trend.csv"}).run(context.Background()); err == nil {
+		t.Error("expected sampling to be skipped with -memory-samples 0")
+	} else if _, ok := err.(skipError); !ok {
+		t.Errorf("run() error = %v, want a skipError", err)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("expected typeperf not to run, got calls %v", fake.calls)
+	}
+}
@@ -0,0 +1,107 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// icmpOverhead is the size of the IPv4 and ICMP headers, ping -l sets
+	// the payload size so the packet is that much bigger.
+	icmpOverhead = 28
+	// The sweep looks for the path MTU between the IPv4 minimum of 576 and
+	// the 8896 of jumbo frames on GCE.
+	minProbePayload = 576 - icmpOverhead
+	maxProbePayload = 8896 - icmpOverhead
+)
+
+// pmtuSweep finds the path MTU to target by pinging it with fragmentation
+// disabled, with a binary search over the payload size.
+type pmtuSweep struct {
+	target string
+}
+
+func (p pmtuSweep) title() string {
+	return "Path MTU discovery to " + p.target
+}
+
+// probe pings target once with fragmentation disabled and a payload of size
+// bytes, it reports whether a reply came back.
+func (p pmtuSweep) probe(ctx context.Context, size int) (bool, error) {
+	var out bytes.Buffer
+	err := exe.execute(ctx, `C:\Windows\System32\ping.exe`, []string{"-f", "-l", strconv.Itoa(size), "-n", "1", "-w", "1000", p.target}, &out)
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	// ping exits with an error both when the packet is too big and when
+	// there is no reply, a reply is what counts.
+	return err == nil && strings.Contains(out.String(), "TTL="), nil
+}
+
+// sweepPayload returns the largest size in [lo, hi] for which probe
+// succeeds, assuming sizes below a working one work too. It returns 0 if
+// even lo fails.
+func sweepPayload(lo, hi int, probe func(size int) (bool, error)) (int, error) {
+	ok, err := probe(lo)
+	if err != nil || !ok {
+		return 0, err
+	}
+	// lo always works, find the largest working size up to hi.
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		ok, err := probe(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo, nil
+}
+
+func (p pmtuSweep) writeOutput(ctx context.Context, w io.Writer) error {
+	if opts.noNetwork {
+		return errNoNetwork
+	}
+	payload, err := sweepPayload(minProbePayload, maxProbePayload, func(size int) (bool, error) {
+		ok, err := p.probe(ctx, size)
+		switch {
+		case err != nil:
+		case ok:
+			fmt.Fprintf(w, "Payload %d bytes: reply\r\n", size)
+		default:
+			fmt.Fprintf(w, "Payload %d bytes: no reply\r\n", size)
+		}
+		return ok, err
+	})
+	if err != nil {
+		return err
+	}
+	if payload == 0 {
+		_, err = fmt.Fprintf(w, "\r\nNo reply from %s even at %d bytes, the path MTU could not be found.\r\n", p.target, minProbePayload+icmpOverhead)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\r\nPath MTU to %s: %d bytes (largest unfragmented payload %d + %d bytes of headers).\r\n", p.target, payload+icmpOverhead, payload, icmpOverhead)
+	return err
+}
@@ -0,0 +1,121 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakePing replies to pings with a payload up to max bytes, it fails the
+// bigger ones the way ping does with -f.
+type fakePing struct {
+	fakeExecutor
+	max int
+}
+
+func (f *fakePing) execute(ctx context.Context, path string, args []string, out io.Writer) error {
+	if !strings.HasSuffix(path, "ping.exe") {
+		return f.fakeExecutor.execute(ctx, path, args, out)
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, path+" "+strings.Join(args, " "))
+	f.mu.Unlock()
+	size, err := strconv.Atoi(args[2])
+	if err != nil {
+		return err
+	}
+	if size > f.max {
+		fmt.Fprint(out, "Packet needs to be fragmented but DF set.\r\n")
+		return errors.New("exit status 1")
+	}
+	fmt.Fprintf(out, "Reply from 8.8.8.8: bytes=%d time=1ms TTL=117\r\n", size)
+	return nil
+}
+
+func TestSweepPayload(t *testing.T) {
+	tests := []struct {
+		max  int
+		want int
+	}{
+		{1432, 1432},
+		{1472, 1472},
+		{8868, 8868},
+		{100000, maxProbePayload},
+		{minProbePayload, minProbePayload},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		probes := 0
+		got, err := sweepPayload(minProbePayload, maxProbePayload, func(size int) (bool, error) {
+			probes++
+			return size <= tt.max, nil
+		})
+		if err != nil {
+			t.Errorf("max %d: sweepPayload() error = %v", tt.max, err)
+		}
+		if got != tt.want {
+			t.Errorf("max %d: sweepPayload() = %d, want %d", tt.max, got, tt.want)
+		}
+		if probes > 15 {
+			t.Errorf("max %d: %d probes, expected a binary search", tt.max, probes)
+		}
+	}
+}
+
+func TestGatherNetworkLogsMTU(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake := &fakePing{max: 1432}
+	exe = fake
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "mtu.txt")
+	for _, want := range []string{
+		`C:\Windows\System32\netsh.exe interface ipv4 show subinterfaces`,
+		"Path MTU to 8.8.8.8: 1460 bytes",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in mtu.txt:\n%s", want, got)
+		}
+	}
+	if fake.callCount(`C:\Windows\System32\ping.exe -f -l 1432 -n 1 -w 1000 8.8.8.8`) != 1 {
+		t.Errorf("expected the working size to be probed, calls: %v", fake.calls)
+	}
+}
+
+func TestGatherNetworkLogsMTUNoNetwork(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake := &fakePing{max: 1432}
+	exe = fake
+	opts.noNetwork = true
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "mtu.txt")
+	if !strings.Contains(got, "Skipped: "+string(errNoNetwork)) {
+		t.Errorf("expected the probe to be skipped in mtu.txt:\n%s", got)
+	}
+	for _, c := range fake.calls {
+		if strings.Contains(c, "-f -l") {
+			t.Errorf("unexpected probe with -no-network: %s", c)
+		}
+	}
+}
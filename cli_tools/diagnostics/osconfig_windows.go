@@ -0,0 +1,133 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+)
+
+// osConfigAgentPath is the OS Config agent, its inventory and guest policies
+// are only looked for when it is installed.
+var osConfigAgentPath = `C:\Program Files\Google\OSConfig\google_osconfig_agent.exe`
+
+// osConfigInventoryKeys are the guest attributes the OS Config agent reports
+// the inventory of the instance under, in the guestInventory namespace.
+var osConfigInventoryKeys = []string{
+	"Hostname",
+	"LongName",
+	"ShortName",
+	"Version",
+	"Architecture",
+	"KernelVersion",
+	"KernelRelease",
+	"OSConfigAgentVersion",
+	"LastUpdated",
+	"InstalledPackages",
+	"PackageUpdates",
+}
+
+// osConfigPackageKeys hold the package lists as gzipped JSON, base64
+// encoded.
+var osConfigPackageKeys = map[string]bool{"InstalledPackages": true, "PackageUpdates": true}
+
+// osConfigGuestPolicyEvents are the OS Config agent events about the guest
+// policies it looked up and applied.
+const osConfigGuestPolicyEvents = `-NoProfile -NonInteractive -Command "Get-WinEvent -FilterHashtable @{LogName='Application'; ProviderName='OSConfigAgent'} -MaxEvents 2000 -ErrorAction SilentlyContinue | Where-Object { $_.Message -match 'guest ?polic' } | Select-Object -First 200 | Format-List TimeCreated, LevelDisplayName, Message"`
+
+// osConfigInventory writes the inventory the OS Config agent last reported
+// in the guest attributes, with the package lists decoded.
+type osConfigInventory struct {
+	outputFileName string
+}
+
+func (o osConfigInventory) run(ctx context.Context) (string, error) {
+	outPath := filepath.Join(tmpFolder, o.outputFileName)
+	if opts.noNetwork {
+		return outPath, errNoNetwork
+	}
+	outFile, err := createOutput(ctx, outPath)
+	if err != nil {
+		return outPath, err
+	}
+	defer outFile.Close()
+
+	reported := 0
+	for _, key := range osConfigInventoryKeys {
+		data, err := metadata.get(ctx, "instance/guest-attributes/guestInventory/"+key)
+		if e, ok := err.(metadataStatusError); ok && e.code == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return outPath, err
+		}
+		reported++
+		if !osConfigPackageKeys[key] {
+			fmt.Fprintf(outFile, "%s: %s\r\n", key, data)
+			continue
+		}
+		packages, err := decodeOSConfigPackages(data)
+		if err != nil {
+			fmt.Fprintf(outFile, "%s: error decoding the packages: %v\r\n%s\r\n", key, err, data)
+			continue
+		}
+		fmt.Fprintf(outFile, "%s:\r\n%s\r\n", key, packages)
+	}
+	if reported == 0 {
+		_, err = io.WriteString(outFile, "The OS Config agent has not reported an inventory, it is only reported when enable-osconfig and enable-guest-attributes are set in metadata.\r\n")
+	}
+	return outPath, err
+}
+
+// decodeOSConfigPackages turns a base64 gzipped package list into indented
+// JSON.
+func decodeOSConfigPackages(data []byte) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, raw, "", "  "); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+// osConfigRunners collect the OS Config inventory and the guest policies the
+// agent applied, which explain patch and configuration drift. They are
+// skipped when the agent isn't installed.
+func osConfigRunners() []runner {
+	return []runner{
+		installed{osConfigAgentPath, osConfigInventory{"osconfig_inventory.txt"}},
+		installed{osConfigAgentPath, cmd{path: powershell, args: osConfigGuestPolicyEvents, outputFileName: "osconfig_guest_policies.txt"}},
+	}
+}
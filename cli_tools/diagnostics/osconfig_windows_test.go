@@ -0,0 +1,114 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// osConfigPackages encodes a package list the way the OS Config agent
+// reports it.
+func osConfigPackages(t *testing.T, list string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(list)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// withOSConfigAgent installs a fake OS Config agent and collects no GCE agent
+// files, for the gatherer to only run the OS Config collectors.
+func withOSConfigAgent(t *testing.T, installed bool) func() {
+	oldPath, oldFiles := osConfigAgentPath, gceAgentFiles
+	osConfigAgentPath = filepath.Join(tmpFolder, "google_osconfig_agent.exe")
+	gceAgentFiles = nil
+	if installed {
+		if err := ioutil.WriteFile(osConfigAgentPath, []byte("fake program"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		osConfigAgentPath, gceAgentFiles = oldPath, oldFiles
+	}
+}
+
+func TestGatherGCEAgentLogsOSConfig(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withOSConfigAgent(t, true)()
+	defer withFakeMetadata(t, map[string]string{
+		"/computeMetadata/v1/instance/guest-attributes/guestInventory/ShortName":            "windows",
+		"/computeMetadata/v1/instance/guest-attributes/guestInventory/Version":              "10.0.17763",
+		"/computeMetadata/v1/instance/guest-attributes/guestInventory/OSConfigAgentVersion": "20200220.00.0+win@1",
+		"/computeMetadata/v1/instance/guest-attributes/guestInventory/InstalledPackages": osConfigPackages(t,
+			`{"QFE":[{"Caption":"http://support.microsoft.com/?kbid=4534273","HotFixID":"KB4534273"}]}`),
+		"/computeMetadata/v1/instance/guest-attributes/guestInventory/PackageUpdates": "not base64",
+	})()
+	policies := powershell + " " + strings.Join(splitArgs(osConfigGuestPolicyEvents), " ")
+	fake.outputs = map[string]string{policies: "TimeCreated      : 6/1/2019 8:00:01 AM\r\nLevelDisplayName : Information\r\nMessage          : Applying guest policy projects/p/guestPolicies/chrome\r\n"}
+
+	folder := runGatherer(t, gatherGCEAgentLogs)
+	got := readFolderFile(t, folder, "osconfig_inventory.txt")
+	for _, want := range []string{
+		"ShortName: windows",
+		"Version: 10.0.17763",
+		"OSConfigAgentVersion: 20200220.00.0+win@1",
+		`"HotFixID": "KB4534273"`,
+		"PackageUpdates: error decoding the packages",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in osconfig_inventory.txt:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Hostname") {
+		t.Errorf("expected the keys not reported left out of osconfig_inventory.txt:\n%s", got)
+	}
+	if got := readFolderFile(t, folder, "osconfig_guest_policies.txt"); !strings.Contains(got, "Applying guest policy projects/p/guestPolicies/chrome") {
+		t.Errorf("expected the guest policy events in osconfig_guest_policies.txt:\n%s", got)
+	}
+}
+
+func TestGatherGCEAgentLogsOSConfigNoInventory(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withOSConfigAgent(t, true)()
+	defer withFakeMetadata(t, nil)()
+
+	folder := runGatherer(t, gatherGCEAgentLogs)
+	if got := readFolderFile(t, folder, "osconfig_inventory.txt"); !strings.Contains(got, "The OS Config agent has not reported an inventory") {
+		t.Errorf("expected the missing inventory explained in osconfig_inventory.txt:\n%s", got)
+	}
+}
+
+func TestGatherGCEAgentLogsOSConfigNotInstalled(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withOSConfigAgent(t, false)()
+
+	folder := runGatherer(t, gatherGCEAgentLogs)
+	if len(folder.files) != 0 || len(fake.calls) != 0 {
+		t.Errorf("expected the OS Config collectors skipped without the agent, got files %v and calls %v", folder.files, fake.calls)
+	}
+}
@@ -0,0 +1,104 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// osVersionValues are the values of currentVersionKey that identify the
+// installation. DisplayVersion replaced ReleaseId in 20H2, either can be
+// missing.
+var osVersionValues = []string{
+	"ProductName",
+	"EditionID",
+	"InstallationType",
+	"DisplayVersion",
+	"ReleaseId",
+	"CurrentMajorVersionNumber",
+	"CurrentMinorVersionNumber",
+	"CurrentVersion",
+	"CurrentBuild",
+	"UBR",
+	"BuildLabEx",
+	"InstallDate",
+}
+
+// osBuild returns the full build of Windows, such as 10.0.17763.1234, or ""
+// when it can't be read. Windows 8.1 and older only have CurrentVersion for
+// the major and minor version.
+func osBuild() string {
+	build, err := reg.value(currentVersionKey, "CurrentBuild")
+	if err != nil {
+		return ""
+	}
+	version := fmt.Sprint(build)
+	major, errMajor := reg.value(currentVersionKey, "CurrentMajorVersionNumber")
+	minor, errMinor := reg.value(currentVersionKey, "CurrentMinorVersionNumber")
+	if errMajor == nil && errMinor == nil {
+		version = fmt.Sprintf("%v.%v.%s", major, minor, version)
+	} else if v, err := reg.value(currentVersionKey, "CurrentVersion"); err == nil {
+		version = fmt.Sprintf("%v.%s", v, version)
+	}
+	if ubr, err := reg.value(currentVersionKey, "UBR"); err == nil {
+		version = fmt.Sprintf("%s.%v", version, ubr)
+	}
+	return version
+}
+
+// osVersion writes the edition and the exact build of Windows as name: value
+// lines, systeminfo has them but mixed with everything else.
+type osVersion struct {
+	outputFileName string
+}
+
+func (o osVersion) run(ctx context.Context) (string, error) {
+	outPath := filepath.Join(tmpFolder, o.outputFileName)
+	var b strings.Builder
+	if build := osBuild(); build != "" {
+		fmt.Fprintf(&b, "Build: %s\r\n", build)
+	}
+	for _, name := range osVersionValues {
+		v, err := reg.value(currentVersionKey, name)
+		if err == registry.ErrNotExist {
+			continue
+		}
+		if err != nil {
+			return outPath, err
+		}
+		value := formatRegistryValue(v)
+		// InstallDate is in seconds since 1970, of the last feature
+		// update rather than the first installation.
+		if seconds, ok := v.(uint64); ok && name == "InstallDate" {
+			value = fmt.Sprintf("%s (%d)", time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339), seconds)
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+
+	outFile, err := createOutput(ctx, outPath)
+	if err != nil {
+		return outPath, err
+	}
+	defer outFile.Close()
+	_, err = io.WriteString(outFile, b.String())
+	return outPath, err
+}
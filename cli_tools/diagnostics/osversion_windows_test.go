@@ -0,0 +1,92 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGatherSystemLogsOSVersion(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		currentVersionKey: {
+			"ProductName":               "Windows Server 2022 Datacenter",
+			"EditionID":                 "ServerDatacenter",
+			"InstallationType":          "Server",
+			"DisplayVersion":            "21H2",
+			"CurrentMajorVersionNumber": uint64(10),
+			"CurrentMinorVersionNumber": uint64(0),
+			"CurrentVersion":            "6.3",
+			"CurrentBuild":              "20348",
+			"UBR":                       uint64(1547),
+			"InstallDate":               uint64(1559376000),
+		},
+	}}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "os_version.txt")
+	want := "Build: 10.0.20348.1547\r\n" +
+		"ProductName: Windows Server 2022 Datacenter\r\n" +
+		"EditionID: ServerDatacenter\r\n" +
+		"InstallationType: Server\r\n" +
+		"DisplayVersion: 21H2\r\n" +
+		"CurrentMajorVersionNumber: 10\r\n" +
+		"CurrentMinorVersionNumber: 0\r\n" +
+		"CurrentVersion: 6.3\r\n" +
+		"CurrentBuild: 20348\r\n" +
+		"UBR: 1547\r\n" +
+		"InstallDate: 2019-06-01T08:00:00Z (1559376000)\r\n"
+	if got != want {
+		t.Errorf("os_version.txt is:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOSBuild(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	for _, tt := range []struct {
+		name   string
+		values map[string]interface{}
+		want   string
+	}{
+		{"Windows 10", map[string]interface{}{"CurrentMajorVersionNumber": uint64(10), "CurrentMinorVersionNumber": uint64(0), "CurrentVersion": "6.3", "CurrentBuild": "17763", "UBR": uint64(1234)}, "10.0.17763.1234"},
+		{"Windows 8.1", map[string]interface{}{"CurrentVersion": "6.3", "CurrentBuild": "9600", "UBR": uint64(19913)}, "6.3.9600.19913"},
+		{"no UBR", map[string]interface{}{"CurrentVersion": "6.1", "CurrentBuild": "7601"}, "6.1.7601"},
+		{"unreadable", nil, ""},
+	} {
+		reg = &fakeRegistry{keys: map[string]map[string]interface{}{currentVersionKey: tt.values}}
+		if got := osBuild(); got != tt.want {
+			t.Errorf("%s: osBuild() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGatherLogsManifestBuild(t *testing.T) {
+	_, cleanup := withFakeSystem(t)
+	defer cleanup()
+
+	gatherLogs()
+	data, err := ioutil.ReadFile(filepath.Join(tmpFolder, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\r\n# Windows build 10.0.17763.1234\r\n") {
+		t.Errorf("expected the Windows build in the manifest:\n%s", data)
+	}
+}
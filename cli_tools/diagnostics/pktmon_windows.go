@@ -0,0 +1,60 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// pktmonPath is the packet monitor built into Windows 10 2004 and Windows
+// Server 2022 and later.
+var pktmonPath = `C:\Windows\System32\PktMon.exe`
+
+// pktmonCapture captures the packets of all the interfaces with pktmon for
+// -pktmon-duration. pktmon keeps the first 128 bytes of each packet, enough
+// for the headers.
+type pktmonCapture struct {
+	outputFileName string
+}
+
+func (p pktmonCapture) run(ctx context.Context) (string, error) {
+	if opts.pktmonDuration <= 0 {
+		return "", skipError("packet capture is off, -pktmon-duration is 0")
+	}
+	if opts.noNetwork {
+		return "", skipError("captures network traffic and -no-network is set")
+	}
+	start := cmd{
+		path:            pktmonPath,
+		args:            "start --capture --file-name " + p.outputFileName,
+		outputFileName:  p.outputFileName,
+		cmdProducesFile: true,
+		mutates:         true,
+		admin:           adminRequired,
+	}
+	path, err := start.run(ctx)
+	if err != nil {
+		return path, err
+	}
+
+	select {
+	case <-time.After(opts.pktmonDuration):
+	case <-ctx.Done():
+	}
+	// Always stop the capture, even when the folder ran out of time, so
+	// pktmon isn't left capturing.
+	return path, exe.execute(context.Background(), pktmonPath, []string{"stop"}, nil)
+}
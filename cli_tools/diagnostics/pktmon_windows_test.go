@@ -0,0 +1,87 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPktmonCapture(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.pktmonDuration = time.Second
+	outPath := filepath.Join(tmpFolder, "pktmon.etl")
+
+	start := time.Now()
+	path, err := pktmonCapture{"pktmon.etl"}.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the capture to run for 1s, it stopped after %v", elapsed)
+	}
+	want := []string{pktmonPath + " start --capture --file-name " + outPath, pktmonPath + " stop"}
+	if path != outPath || len(fake.calls) != 2 || fake.calls[0] != want[0] || fake.calls[1] != want[1] {
+		t.Errorf("expected calls %q writing %s, got %q and %s", want, outPath, fake.calls, path)
+	}
+}
+
+func TestPktmonCaptureStopsOnTimeout(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.pktmonDuration = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := (pktmonCapture{"pktmon.etl"}).run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fake.callCount(pktmonPath+" stop") != 1 {
+		t.Errorf("expected the capture to be stopped when the folder runs out of time, got calls %q", fake.calls)
+	}
+}
+
+func TestPktmonCaptureSkipped(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		duration  time.Duration
+		noNetwork bool
+		readOnly  bool
+		elevated  bool
+	}{
+		{name: "off", duration: 0, elevated: true},
+		{name: "no network", duration: time.Second, noNetwork: true, elevated: true},
+		{name: "read only", duration: time.Second, readOnly: true, elevated: true},
+		{name: "not elevated", duration: time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			defer func() { elevated = true }()
+			opts.pktmonDuration, opts.noNetwork, opts.readOnly, elevated = tc.duration, tc.noNetwork, tc.readOnly, tc.elevated
+
+			_, err := pktmonCapture{"pktmon.etl"}.run(context.Background())
+			if _, ok := err.(skipError); !ok {
+				t.Errorf("run() error = %v, want a skipError", err)
+			}
+			if len(fake.calls) != 0 {
+				t.Errorf("expected pktmon not to run, got calls %q", fake.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pluginCommand returns the collector running the script at path from
+// -plugin-dir, PowerShell scripts and batch files are run, other files are
+// not plugins.
+func pluginCommand(path string) (cmd, bool) {
+	name := filepath.Base(path)
+	outputFileName := strings.TrimSuffix(name, filepath.Ext(name)) + ".txt"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ps1":
+		return cmd{path: powershell, args: `-NoProfile -NonInteractive -ExecutionPolicy Bypass -File "` + path + `"`, outputFileName: outputFileName}, true
+	case ".cmd":
+		return cmd{path: `C:\Windows\System32\cmd.exe`, args: `/c "` + path + `"`, outputFileName: outputFileName}, true
+	}
+	return cmd{}, false
+}
+
+// pluginRunners returns the collectors of the scripts in dir, in name order.
+func pluginRunners(dir string) ([]runner, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	var runners []runner
+	taken := make(map[string]bool)
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		c, ok := pluginCommand(filepath.Join(dir, info.Name()))
+		if !ok {
+			continue
+		}
+		// check.cmd and check.ps1 would both write check.txt, the later
+		// one keeps its extension in the name of its output.
+		if taken[strings.ToLower(c.outputFileName)] {
+			c.outputFileName = info.Name() + ".txt"
+		}
+		taken[strings.ToLower(c.outputFileName)] = true
+		runners = append(runners, c)
+	}
+	return runners, nil
+}
+
+// gatherPluginLogs runs the scripts of -plugin-dir, capturing the output of
+// each into its own file. A script exiting with an error is recorded as a
+// failed collector, like the built in ones.
+func gatherPluginLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	runners, err := pluginRunners(opts.pluginDir)
+	if err != nil {
+		errs <- err
+	}
+	logs <- logFolder{name: "Plugins", files: resultPaths(runAll(ctx, runners, errs))}
+}
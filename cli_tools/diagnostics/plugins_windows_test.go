@@ -0,0 +1,109 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGatherPluginLogs(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.pluginDir = filepath.Join(tmpFolder, "plugins dir")
+	if err := os.MkdirAll(filepath.Join(opts.pluginDir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"check.ps1":    "Get-Service w32time",
+		"failing.CMD":  "exit /b 1",
+		"README.txt":   "not a plugin",
+		"lib/util.ps1": "in a subfolder, not run",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(opts.pluginDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ps1 := powershell + ` -NoProfile -NonInteractive -ExecutionPolicy Bypass -File ` + filepath.Join(opts.pluginDir, "check.ps1")
+	batch := `C:\Windows\System32\cmd.exe /c ` + filepath.Join(opts.pluginDir, "failing.CMD")
+	fake.outputs = map[string]string{ps1: "Running  w32time  Windows Time"}
+	fake.errs = map[string]error{batch: errors.New("exit status 1")}
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherPluginLogs(context.Background(), logs, errs)
+	folder := <-logs
+
+	if folder.name != "Plugins" {
+		t.Errorf("folder name = %q, want Plugins", folder.name)
+	}
+	if len(fake.calls) != 2 || fake.calls[0] != ps1 || fake.calls[1] != batch {
+		t.Errorf("expected the two scripts to run in name order, got calls %q", fake.calls)
+	}
+	if got := readFolderFile(t, folder, "check.txt"); !strings.Contains(got, "Windows Time") {
+		t.Errorf("expected the script output in check.txt:\n%s", got)
+	}
+	if stringArrayIncludesString(folder.files, filepath.Join(tmpFolder, "failing.txt")) {
+		t.Errorf("the failing script output should not be collected, got %v", folder.files)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected the failing script to be recorded as an error, got %d errors", len(errs))
+	}
+	if err, ok := (<-errs).(runError); !ok || !strings.Contains(err.command, "failing.CMD") || err.Error() != "exit status 1" {
+		t.Errorf("error = %#v, want the exit status of the failing script", err)
+	}
+}
+
+func TestPluginRunnersOutputNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"check.cmd", "check.ps1", "disk.PS1", "notes.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runners, err := pluginRunners(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range runners {
+		got = append(got, r.(cmd).outputFileName)
+	}
+	// check.ps1 keeps its extension as check.cmd already writes check.txt.
+	if want := []string{"check.txt", "check.ps1.txt", "disk.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output files = %q, want %q", got, want)
+	}
+}
+
+func TestGatherersPluginDir(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	n := len(gatherers())
+	opts.pluginDir = tmpFolder
+	if got := len(gatherers()); got != n+1 {
+		t.Errorf("expected -plugin-dir to add a gatherer, got %d gatherers, want %d", got, n+1)
+	}
+}
@@ -0,0 +1,188 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunPolicy controls how long a runner may take and how often it is retried.
+// Zero fields are unset and fall back to the next policy in line, see
+// withDefaults.
+type RunPolicy struct {
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+	// MaxAttempts is the total number of tries, including the first one.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, it doubles for each
+	// attempt after that.
+	Backoff time.Duration
+}
+
+var (
+	// cmdDefaultPolicy is used by commands for anything not set on the
+	// command itself or with flags.
+	cmdDefaultPolicy = RunPolicy{Timeout: 10 * time.Minute, MaxAttempts: 1, Backoff: time.Second}
+	// wmiDefaultPolicy is used by WMI queries for anything not set on the
+	// query itself or with flags. WMI is somewhat flaky, so queries are
+	// retried a few times by default.
+	wmiDefaultPolicy = RunPolicy{Timeout: 5 * time.Minute, MaxAttempts: 3, Backoff: time.Second}
+)
+
+// withDefaults fills the unset fields of p from def.
+func (p RunPolicy) withDefaults(def RunPolicy) RunPolicy {
+	if p.Timeout == 0 {
+		p.Timeout = def.Timeout
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.Backoff == 0 {
+		p.Backoff = def.Backoff
+	}
+	return p
+}
+
+// resolvePolicy returns the policy a runner should use: the runner's own
+// settings first, then the flag settings, then the default for its kind.
+func resolvePolicy(own, kindDefault RunPolicy) RunPolicy {
+	return own.withDefaults(opts.policy).withDefaults(kindDefault)
+}
+
+// timeoutMap holds the -collector-timeout overrides, keyed by the output file
+// name of the collector.
+type timeoutMap map[string]time.Duration
+
+func (m *timeoutMap) String() string {
+	var pairs []string
+	for name, d := range *m {
+		pairs = append(pairs, name+"="+d.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *timeoutMap) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not name=duration, e.g. tracert_gstatic.txt=20m", value)
+	}
+	d, err := time.ParseDuration(value[i+1:])
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("timeout of %s must be positive, got %v", value[:i], d)
+	}
+	if *m == nil {
+		*m = make(timeoutMap)
+	}
+	(*m)[value[:i]] = d
+	return nil
+}
+
+// appliedTimeouts records the names of -collector-timeout that matched a
+// collector, see unmatchedTimeouts.
+var appliedTimeouts = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// collectorPolicy returns own with the -collector-timeout of the collector
+// writing outputFileName, if any, applied. It takes precedence over every
+// other setting. It only looks the timeout up, see runPolicy for the
+// collectors actually run.
+func collectorPolicy(outputFileName string, own RunPolicy) RunPolicy {
+	if d, ok := opts.collectorTimeouts[outputFileName]; ok {
+		own.Timeout = d
+	}
+	return own
+}
+
+type groupTimeoutKey struct{}
+
+// withGroupTimeout returns ctx for the sections of a group given timeout d
+// with -collector-timeout.
+func withGroupTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, groupTimeoutKey{}, d)
+}
+
+// runPolicy is collectorPolicy for a collector that is about to run with
+// ctx, it records the -collector-timeout as applied. A section of a group
+// given a -collector-timeout gets the timeout of the group, unless it has
+// its own.
+func runPolicy(ctx context.Context, outputFileName string, own RunPolicy) RunPolicy {
+	if _, ok := opts.collectorTimeouts[outputFileName]; ok {
+		timeoutApplied(outputFileName)
+		return collectorPolicy(outputFileName, own)
+	}
+	if d, ok := ctx.Value(groupTimeoutKey{}).(time.Duration); ok {
+		own.Timeout = d
+	}
+	return own
+}
+
+// timeoutApplied records that the -collector-timeout of outputFileName was
+// used.
+func timeoutApplied(outputFileName string) {
+	appliedTimeouts.Lock()
+	appliedTimeouts.names[outputFileName] = true
+	appliedTimeouts.Unlock()
+}
+
+// unmatchedTimeouts returns the names given to -collector-timeout that no
+// collector that ran had, most likely misspelled.
+func unmatchedTimeouts() []string {
+	appliedTimeouts.Lock()
+	defer appliedTimeouts.Unlock()
+	var names []string
+	for name := range opts.collectorTimeouts {
+		if !appliedTimeouts.names[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// attempt calls f until it succeeds, the attempts run out or ctx is done.
+// Each call gets its own context bounded by the policy's Timeout, and the
+// calls are spaced out by the policy's Backoff.
+func (p RunPolicy) attempt(ctx context.Context, f func(ctx context.Context) error) error {
+	var err error
+	wait := p.Backoff
+	for i := 0; i < p.MaxAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return err
+			}
+			wait *= 2
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+		err = f(attemptCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
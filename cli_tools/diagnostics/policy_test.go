@@ -0,0 +1,75 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMapSet(t *testing.T) {
+	var m timeoutMap
+	for _, v := range []string{"tracert_gstatic.txt=20m", "systeminfo.txt=30s", "systeminfo.txt=45s"} {
+		if err := m.Set(v); err != nil {
+			t.Fatalf("Set(%q) error = %v", v, err)
+		}
+	}
+	want := timeoutMap{"tracert_gstatic.txt": 20 * time.Minute, "systeminfo.txt": 45 * time.Second}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("timeoutMap = %v, want %v", m, want)
+	}
+	if got := m.String(); got != "systeminfo.txt=45s,tracert_gstatic.txt=20m0s" {
+		t.Errorf("String() = %q", got)
+	}
+	for _, bad := range []string{"tracert_gstatic.txt", "=20m", "tracert_gstatic.txt=soon", "tracert_gstatic.txt=-1m", "tracert_gstatic.txt=0s"} {
+		if err := m.Set(bad); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestCollectorPolicy(t *testing.T) {
+	oldOpts := opts
+	defer func() { opts = oldOpts }()
+	opts.collectorTimeouts = timeoutMap{"tracert_gstatic.txt": 20 * time.Minute, "typo.txt": time.Minute}
+	opts.policy = RunPolicy{Timeout: 2 * time.Minute}
+	def := RunPolicy{Timeout: 10 * time.Minute, MaxAttempts: 1, Backoff: time.Second}
+
+	appliedTimeouts.names = make(map[string]bool)
+
+	own := RunPolicy{Timeout: 5 * time.Minute, MaxAttempts: 2}
+	if got := resolvePolicy(collectorPolicy("tracert_gstatic.txt", own), def); got.Timeout != 20*time.Minute || got.MaxAttempts != 2 {
+		t.Errorf("named collector policy = %+v, want the 20m override and its own attempts", got)
+	}
+	// Looking the timeout up, as list-collectors does, doesn't apply it.
+	if got := unmatchedTimeouts(); !reflect.DeepEqual(got, []string{"tracert_gstatic.txt", "typo.txt"}) {
+		t.Errorf("unmatchedTimeouts() = %v before any collector ran, want both", got)
+	}
+	if got := resolvePolicy(runPolicy(context.Background(), "tracert_gstatic.txt", own), def); got.Timeout != 20*time.Minute {
+		t.Errorf("running collector timeout = %v, want the 20m override", got.Timeout)
+	}
+	// A section of a group given a -collector-timeout gets it.
+	if got := resolvePolicy(runPolicy(withGroupTimeout(context.Background(), 3*time.Minute), "", RunPolicy{}), def); got.Timeout != 3*time.Minute {
+		t.Errorf("section timeout = %v, want the 3m of its group", got.Timeout)
+	}
+	if got := resolvePolicy(collectorPolicy("systeminfo.txt", RunPolicy{}), def); got.Timeout != 2*time.Minute {
+		t.Errorf("other collector timeout = %v, want the -timeout of 2m", got.Timeout)
+	}
+	if got := unmatchedTimeouts(); !reflect.DeepEqual(got, []string{"typo.txt"}) {
+		t.Errorf("unmatchedTimeouts() = %v, want [typo.txt]", got)
+	}
+}
@@ -0,0 +1,149 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// staticArtifacts are the files of a bundle that can't change while the
+// machine keeps running, -attach-previous carries them forward from the
+// previous bundle rather than collecting them again.
+var staticArtifacts = map[string]bool{
+	// The hardware inventory, msinfo32 takes minutes to write it.
+	"System/msinfo32.txt": true,
+}
+
+// previousArtifact is a static artifact of the previous bundle and the time
+// it was collected.
+type previousArtifact struct {
+	modTime time.Time
+	data    []byte
+}
+
+// previousBundle holds the static artifacts of the bundle given to
+// -attach-previous.
+type previousBundle struct {
+	path string
+	// host is the machine the bundle was collected on, from its manifest,
+	// empty when the manifest doesn't say.
+	host      string
+	artifacts map[string]previousArtifact
+}
+
+// readPreviousBundle reads the static artifacts of the zip or tar.gz bundle
+// at path.
+func readPreviousBundle(path string) (*previousBundle, error) {
+	b := &previousBundle{path: path, artifacts: make(map[string]previousArtifact)}
+	var manifestData []byte
+	keep := func(name string, modTime time.Time, r io.Reader) error {
+		if name != manifestFileName && !staticArtifacts[name] {
+			return nil
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if name == manifestFileName {
+			manifestData = data
+			return nil
+		}
+		b.artifacts[name] = previousArtifact{modTime: modTime, data: data}
+		return nil
+	}
+
+	switch {
+	case strings.HasSuffix(path, "."+formatZip):
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = keep(f.Name, f.Modified, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case strings.HasSuffix(path, "."+formatTarGz):
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(gr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := keep(h.Name, h.ModTime, tr); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown bundle format, expected a .%s or .%s file", formatZip, formatTarGz)
+	}
+	b.readManifest(string(manifestData))
+	return b, nil
+}
+
+// readManifest takes the host the bundle was collected on from its
+// manifest, and the date the artifacts it carried forward itself were first
+// collected, their files only have the date they were carried forward.
+func (b *previousBundle) readManifest(manifest string) {
+	for _, line := range strings.Split(manifest, "\r\n") {
+		if strings.HasPrefix(line, manifestHostPrefix) {
+			b.host = strings.TrimPrefix(line, manifestHostPrefix)
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 || !strings.HasPrefix(fields[2], carriedNotePrefix) {
+			continue
+		}
+		a, ok := b.artifacts[fields[0]]
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(fields[2], carriedNoteSince)
+		if i < 0 {
+			continue
+		}
+		if since, err := time.Parse(time.RFC3339, fields[2][i+len(carriedNoteSince):]); err == nil {
+			a.modTime = since
+			b.artifacts[fields[0]] = a
+		}
+	}
+}
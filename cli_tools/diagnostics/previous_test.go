@@ -0,0 +1,97 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"compress/flate"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePreviousBundle writes a bundle of format in dir, collected on host,
+// holding a static artifact collected at collected, and another file. When
+// firstCollected isn't zero, the manifest notes the artifact as carried
+// forward, unchanged since firstCollected.
+func writePreviousBundle(t *testing.T, dir, format, host string, collected, firstCollected time.Time) string {
+	t.Helper()
+	msinfo := filepath.Join(dir, "msinfo32.txt")
+	systeminfo := filepath.Join(dir, "systeminfo.txt")
+	for _, p := range []string{msinfo, systeminfo} {
+		if err := ioutil.WriteFile(p, []byte("contents of "+filepath.Base(p)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, collected, collected); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := "# Files collected by diagnostics\r\n" + manifestHostPrefix + host + "\r\n[System]\r\nSystem/msinfo32.txt\t" + msinfo
+	if !firstCollected.IsZero() {
+		manifest += "\t" + carriedRecord{bundle: `C:\older.zip`, since: firstCollected}.String()
+	}
+	manifestPath := filepath.Join(dir, manifestFileName)
+	if err := ioutil.WriteFile(manifestPath, []byte(manifest+"\r\n"+manifestComplete+"\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, archiveFileName(format))
+	folders := []logFolder{{name: "System", files: []string{msinfo, systeminfo}}, {files: []string{manifestPath}}}
+	if err := archiveFiles(folders, out, format, flate.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestReadPreviousBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "previous_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	collected := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	for _, format := range []string{formatZip, formatTarGz} {
+		b, err := readPreviousBundle(writePreviousBundle(t, dir, format, "WIN-DB1", collected, time.Time{}))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if b.host != "WIN-DB1" {
+			t.Errorf("%s: host = %q, want WIN-DB1", format, b.host)
+		}
+		a, ok := b.artifacts["System/msinfo32.txt"]
+		if !ok || string(a.data) != "contents of msinfo32.txt" || !a.modTime.Equal(collected) {
+			t.Errorf("%s: msinfo32.txt = %q collected %v, want it collected %v", format, a.data, a.modTime, collected)
+		}
+		if _, ok := b.artifacts["System/systeminfo.txt"]; ok {
+			t.Errorf("%s: only the static artifacts should be kept", format)
+		}
+	}
+
+	// An artifact carried forward again keeps the date it was first
+	// collected on.
+	first := collected.AddDate(0, -1, 0)
+	b, err := readPreviousBundle(writePreviousBundle(t, dir, formatZip, "WIN-DB1", collected, first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := b.artifacts["System/msinfo32.txt"]; !a.modTime.Equal(first) {
+		t.Errorf("carried forward msinfo32.txt collected %v, want it first collected %v", a.modTime, first)
+	}
+
+	if _, err := readPreviousBundle(filepath.Join(dir, "logs.rar")); err == nil {
+		t.Error("expected an error for an unknown bundle format")
+	}
+}
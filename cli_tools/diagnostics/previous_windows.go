@@ -0,0 +1,89 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseWmiDate parses a CIM datetime, yyyymmddHHMMSS.mmmmmmsUUU where sUUU
+// is the offset from UTC in minutes.
+func parseWmiDate(v interface{}) (time.Time, error) {
+	s := fmt.Sprint(v)
+	if len(s) != 25 {
+		return time.Time{}, fmt.Errorf("%q is not a CIM datetime", s)
+	}
+	offset, err := strconv.Atoi(s[21:])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a CIM datetime", s)
+	}
+	return time.ParseInLocation("20060102150405.000000", s[:21], time.FixedZone("", offset*60))
+}
+
+// lastBootTime returns the time the machine last started.
+func lastBootTime(ctx context.Context) (time.Time, error) {
+	systems, err := wmiQuery{class: "Win32_OperatingSystem", namespace: `root\CIMv2`}.objects(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(systems) == 0 {
+		return time.Time{}, fmt.Errorf("no Win32_OperatingSystem object")
+	}
+	return parseWmiDate(systems[0].get("LastBootUpTime"))
+}
+
+// carriedForward takes the static artifact at archivePath from the
+// -attach-previous bundle when that bundle is from this machine and the
+// machine hasn't restarted since it was collected, and runs runner to
+// collect it otherwise. The artifact is copied as it is, the manifest notes
+// it was carried forward.
+type carriedForward struct {
+	archivePath string
+	runner
+}
+
+func (c carriedForward) run(ctx context.Context) (string, error) {
+	if opts.previous == nil {
+		return c.runner.run(ctx)
+	}
+	a, ok := opts.previous.artifacts[c.archivePath]
+	if !ok {
+		return c.runner.run(ctx)
+	}
+	if hostname, err := os.Hostname(); err != nil || !strings.EqualFold(opts.previous.host, hostname) {
+		summary.notef("%s was collected again, %s is not a bundle of this machine", c.archivePath, opts.previous.path)
+		return c.runner.run(ctx)
+	}
+	boot, err := lastBootTime(ctx)
+	if err != nil || !a.modTime.After(boot) {
+		return c.runner.run(ctx)
+	}
+
+	since := a.modTime.Format(time.RFC3339)
+	path := filepath.Join(tmpFolder, filepath.Base(c.archivePath))
+	if err := ioutil.WriteFile(path, a.data, 0644); err != nil {
+		return path, err
+	}
+	carriedForwards.record(path, carriedRecord{bundle: opts.previous.path, since: a.modTime})
+	summary.notef("%s is unchanged since %s, it was carried forward from the previous bundle", c.archivePath, since)
+	return path, nil
+}
@@ -0,0 +1,101 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWmiDate(t *testing.T) {
+	got, err := parseWmiDate("20190601100000.500000+120")
+	if want := time.Date(2019, 6, 1, 8, 0, 0, 500000000, time.UTC); err != nil || !got.Equal(want) {
+		t.Errorf("parseWmiDate() = %v, %v, want %v", got, err, want)
+	}
+	for _, s := range []interface{}{nil, "2019-06-01", "20190601100000.500000+1x0"} {
+		if _, err := parseWmiDate(s); err == nil {
+			t.Errorf("parseWmiDate(%v) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestCarriedForward(t *testing.T) {
+	collected := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	msinfo := `C:\Windows\System32\msinfo32.exe /report `
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name           string
+		boot           string
+		previous       bool
+		host           string
+		firstCollected time.Time
+		carried        bool
+		since          string
+	}{
+		{name: "no restart since", boot: "20190531080000.000000+000", previous: true, host: hostname, carried: true, since: "2019-06-01T08:00:00Z"},
+		{name: "carried forward again", boot: "20190430080000.000000+000", previous: true, host: hostname, firstCollected: time.Date(2019, 5, 1, 8, 0, 0, 0, time.UTC), carried: true, since: "2019-05-01T08:00:00Z"},
+		{name: "restarted since", boot: "20190601090000.000000+000", previous: true, host: hostname},
+		{name: "another machine", boot: "20190531080000.000000+000", previous: true, host: "OTHER-" + hostname},
+		{name: "no previous bundle", boot: "20190531080000.000000+000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+				"Win32_OperatingSystem": {{{"LastBootUpTime", tc.boot}}},
+			}}
+			if tc.previous {
+				dir, err := ioutil.TempDir("", "previous_test")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dir)
+				if opts.previous, err = readPreviousBundle(writePreviousBundle(t, dir, formatZip, tc.host, collected, tc.firstCollected)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			folder := runGatherer(t, gatherSystemLogs)
+			ran := false
+			for _, c := range fake.calls {
+				ran = ran || strings.HasPrefix(c, msinfo)
+			}
+			if ran == tc.carried {
+				t.Errorf("msinfo32 ran = %v, want %v", ran, !tc.carried)
+			}
+			if !tc.carried {
+				return
+			}
+			got := readFolderFile(t, folder, "msinfo32.txt")
+			if got != "contents of msinfo32.txt" {
+				t.Errorf("expected the previous msinfo32.txt as it is, got:\n%s", got)
+			}
+			r, ok := carriedForwards.get(filepath.Join(tmpFolder, "msinfo32.txt"))
+			if note := r.String(); !ok || !strings.HasPrefix(note, carriedNotePrefix) || !strings.HasSuffix(note, carriedNoteSince+tc.since) {
+				t.Errorf("expected the carry forward noted for the manifest, got %q", note)
+			}
+			if s := summary.String(); !strings.Contains(s, "System/msinfo32.txt is unchanged since "+tc.since) {
+				t.Errorf("expected the carried forward artifact in the summary:\n%s", s)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// lowImpactPause is the wait between runners in -low-impact mode, giving the
+// workload on the machine room to breathe.
+var lowImpactPause = 2 * time.Second
+
+// lowerPriority moves the process, and the commands it starts, to below
+// normal priority so collection yields to the workload on the machine.
+func lowerPriority() error {
+	return windows.SetPriorityClass(windows.CurrentProcess(), windows.BELOW_NORMAL_PRIORITY_CLASS)
+}
+
+// concurrency is the number of gatherers allowed to run at once, 0 means no
+// limit.
+func concurrency() int {
+	if opts.lowImpact {
+		return 1
+	}
+	return 0
+}
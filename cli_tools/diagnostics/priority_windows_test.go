@@ -0,0 +1,124 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLowImpactConcurrency(t *testing.T) {
+	for _, tt := range []struct {
+		lowImpact bool
+		wantMax   int
+	}{
+		{false, 4},
+		{true, 1},
+	} {
+		oldOpts := opts
+		opts.lowImpact = tt.lowImpact
+
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+		gatherer := func(ctx context.Context, logs chan logFolder, errs chan error) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			logs <- logFolder{}
+		}
+		runFuncs := []gatherFunc{gatherer, gatherer, gatherer, gatherer}
+
+		logs := make(chan logFolder, len(runFuncs))
+		startGatherers(context.Background(), runFuncs, logs, make(chan error), concurrency())
+		for range runFuncs {
+			<-logs
+		}
+		opts = oldOpts
+
+		if maxRunning != tt.wantMax {
+			t.Errorf("lowImpact = %t: %d gatherers ran at once, want %d", tt.lowImpact, maxRunning, tt.wantMax)
+		}
+	}
+}
+
+func TestStartGatherersInOrder(t *testing.T) {
+	for _, limit := range []int{1, 2} {
+		var mu sync.Mutex
+		var started []int
+		gatherer := func(i int) gatherFunc {
+			return func(ctx context.Context, logs chan logFolder, errs chan error) {
+				mu.Lock()
+				started = append(started, i)
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				logs <- logFolder{}
+			}
+		}
+		var runFuncs []gatherFunc
+		for i := 0; i < 6; i++ {
+			runFuncs = append(runFuncs, gatherer(i))
+		}
+
+		logs := make(chan logFolder, len(runFuncs))
+		startGatherers(context.Background(), runFuncs, logs, make(chan error), limit)
+		for range runFuncs {
+			<-logs
+		}
+
+		// With a limit of 2, a pair can start in either order, but never
+		// before the pairs ahead of it.
+		for i, g := range started {
+			if g/limit != i/limit {
+				t.Errorf("limit %d: gatherers started in order %v, want the order of runFuncs", limit, started)
+				break
+			}
+		}
+	}
+}
+
+func TestGatherersPriority(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	opts.trace = true
+
+	name := func(g gatherFunc) string {
+		return runtime.FuncForPC(reflect.ValueOf(g).Pointer()).Name()
+	}
+	var got []string
+	for _, g := range gatherers() {
+		got = append(got, name(g))
+	}
+	for i, g := range []gatherFunc{gatherSystemLogs, gatherEventLogs, gatherNetworkLogs} {
+		if got[i] != name(g) {
+			t.Errorf("gatherer %d is %s, want the essential %s first", i, got[i], name(g))
+		}
+	}
+	for i, g := range []gatherFunc{gatherCrashDumpLogs, gatherTraceLogs} {
+		if j := len(got) - 2 + i; got[j] != name(g) {
+			t.Errorf("gatherer %d is %s, want the expensive %s last", j, got[j], name(g))
+		}
+	}
+}
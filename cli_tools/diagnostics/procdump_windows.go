@@ -0,0 +1,79 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procdumpPath is Sysinternals ProcDump, Windows has no tool of its own to
+// take a full dump of a running process.
+var procdumpPath = `C:\Program Files\Sysinternals\procdump.exe`
+
+// processDump takes a full user-mode dump of a running process, given by PID
+// or name, with -dump-process. It is for processes that hang rather than
+// crash, so there is no dump to collect otherwise.
+type processDump struct {
+	target string
+}
+
+// fileName is the name of the dump, with the characters that can't or
+// shouldn't be in a file name replaced.
+func (d processDump) fileName() string {
+	return "process_" + channelFileNameReplacer.ReplaceAllString(d.target, "_") + ".dmp"
+}
+
+// isLsass reports whether target is the LSA process, a PID is looked up.
+func (d processDump) isLsass(ctx context.Context) (bool, error) {
+	name := d.target
+	if pid, err := strconv.ParseUint(d.target, 10, 32); err == nil {
+		processes, err := wmiQuery{class: "Win32_Process", namespace: `root\CIMv2`, where: fmt.Sprintf("ProcessId = %d", pid)}.objects(ctx)
+		if err != nil {
+			return false, err
+		}
+		if len(processes) == 0 {
+			return false, fmt.Errorf("no process with PID %d", pid)
+		}
+		name = fmt.Sprint(processes[0].get("Name"))
+	}
+	name = strings.ToLower(name)
+	return name == "lsass" || name == "lsass.exe", nil
+}
+
+func (d processDump) run(ctx context.Context) (string, error) {
+	if _, err := os.Stat(procdumpPath); err != nil {
+		summary.warnf("No dump of %s was taken, -dump-process needs ProcDump at %s", d.target, procdumpPath)
+		return "", skipError(fmt.Sprintf("%s is not installed", procdumpPath))
+	}
+	// The memory of the LSA process holds credentials, it is never dumped.
+	lsass, err := d.isLsass(ctx)
+	if err != nil {
+		return "", fmt.Errorf("-dump-process %s: %v", d.target, err)
+	}
+	if lsass {
+		return "", fmt.Errorf("-dump-process %s: refusing to dump the LSA process, its memory holds credentials", d.target)
+	}
+	return cmd{
+		path:            procdumpPath,
+		args:            fmt.Sprintf(`-accepteula -ma "%s" %s`, d.target, d.fileName()),
+		outputFileName:  d.fileName(),
+		cmdProducesFile: true,
+		admin:           adminRequired,
+	}.run(ctx)
+}
@@ -0,0 +1,98 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withProcdump(t *testing.T, present bool) func() {
+	old := procdumpPath
+	procdumpPath = filepath.Join(tmpFolder, "procdump.exe")
+	if present {
+		if err := ioutil.WriteFile(procdumpPath, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() { procdumpPath = old }
+}
+
+func TestGatherCrashDumpLogsProcessDump(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withProcdump(t, true)()
+	fake.writeFiles = true
+	opts.dumpProcess = "my service.exe"
+
+	folder := runGatherer(t, gatherCrashDumpLogs)
+	dump := filepath.Join(tmpFolder, "process_my_service.exe.dmp")
+	if !stringArrayIncludesString(folder.files, dump) {
+		t.Errorf("expected %s in the CrashDump folder, got %v", dump, folder.files)
+	}
+	if call := procdumpPath + " -accepteula -ma my service.exe " + dump; fake.callCount(call) != 1 {
+		t.Errorf("expected %q to run, calls: %v", call, fake.calls)
+	}
+}
+
+func TestProcessDumpNotRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		installed bool
+		elevated  bool
+		objects   map[string][]wmiObject
+		wantErr   string
+		wantSkip  bool
+	}{
+		{name: "not installed", target: "app.exe", elevated: true, wantSkip: true},
+		{name: "not elevated", target: "app.exe", installed: true, wantSkip: true},
+		{name: "lsass by name", target: "LSASS.exe", installed: true, elevated: true, wantErr: "refusing to dump the LSA process"},
+		{name: "lsass by PID", target: "640", installed: true, elevated: true, objects: map[string][]wmiObject{
+			"Win32_Process": {{{"Name", "lsass.exe"}, {"ProcessId", uint32(640)}}},
+		}, wantErr: "refusing to dump the LSA process"},
+		{name: "unknown PID", target: "640", installed: true, elevated: true, objects: map[string][]wmiObject{
+			"Win32_Process": {},
+		}, wantErr: "no process with PID 640"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			defer withProcdump(t, tt.installed)()
+			defer func() { elevated = true }()
+			elevated = tt.elevated
+			wmi := &fakeWmiSource{objects: tt.objects}
+			wmiSrc = wmi
+
+			_, err := processDump{tt.target}.run(context.Background())
+			if _, skipped := err.(skipError); skipped != tt.wantSkip {
+				t.Errorf("run() error = %v, want skipped %v", err, tt.wantSkip)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("run() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(fake.calls) != 0 {
+				t.Errorf("expected no dump to be taken, calls: %v", fake.calls)
+			}
+			if tt.objects != nil && wmi.wheres["Win32_Process"] != "ProcessId = 640" {
+				t.Errorf("Win32_Process where = %q, want ProcessId = 640", wmi.wheres["Win32_Process"])
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// gentleStops are the commands that stop a program more cleanly than
+// CTRL_BREAK, by the path of the program. A wpr killed while it holds the
+// kernel logger leaves the session running, -cancel ends it.
+var gentleStops = map[string]string{
+	`C:\Windows\System32\wpr.exe`: "-cancel",
+}
+
+// processGroupAttr starts a program in its own process group, for CTRL_BREAK
+// to reach it and not the tool.
+func processGroupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_PROCESS_GROUP}
+}
+
+// osProcess is a program started by osExecutor.
+type osProcess struct {
+	path    string
+	process *os.Process
+}
+
+func (p osProcess) String() string {
+	return p.path
+}
+
+// interrupt runs the gentle stop of the program, or sends it CTRL_BREAK when
+// it has none.
+func (p osProcess) interrupt() error {
+	if args, ok := gentleStops[p.path]; ok {
+		return exec.Command(p.path, strings.Fields(args)...).Run()
+	}
+	if err := windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(p.process.Pid)); err != nil {
+		return fmt.Errorf("sending CTRL_BREAK: %v", err)
+	}
+	return nil
+}
+
+func (p osProcess) kill() error {
+	return p.process.Kill()
+}
@@ -0,0 +1,94 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProcess is a long-running program that records how it is stopped. It
+// exits when killed, and when interrupted if stopsOnInterrupt is set.
+type fakeProcess struct {
+	mu               sync.Mutex
+	events           []string
+	stopsOnInterrupt bool
+	interruptErr     error
+	done             chan error
+}
+
+func newFakeProcess() *fakeProcess {
+	return &fakeProcess{done: make(chan error, 1)}
+}
+
+func (p *fakeProcess) record(event string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+}
+
+func (p *fakeProcess) interrupt() error {
+	p.record("interrupt")
+	if p.interruptErr != nil {
+		return p.interruptErr
+	}
+	if p.stopsOnInterrupt {
+		p.done <- errors.New("exit status 0xc000013a")
+	}
+	return nil
+}
+
+func (p *fakeProcess) kill() error {
+	p.record("kill")
+	p.done <- errors.New("exit status 1")
+	return nil
+}
+
+func TestStopGracefully(t *testing.T) {
+	const grace = 100 * time.Millisecond
+	for _, tt := range []struct {
+		name             string
+		grace            time.Duration
+		stopsOnInterrupt bool
+		interruptErr     error
+		want             []string
+		wantWait         bool
+	}{
+		{"stops when asked", grace, true, nil, []string{"interrupt"}, false},
+		{"killed after the grace", grace, false, nil, []string{"interrupt", "kill"}, true},
+		{"killed when it can't be asked", grace, false, errors.New("no console"), []string{"interrupt", "kill"}, false},
+		{"no grace", 0, true, nil, []string{"kill"}, false},
+	} {
+		p := newFakeProcess()
+		p.stopsOnInterrupt, p.interruptErr = tt.stopsOnInterrupt, tt.interruptErr
+
+		start := time.Now()
+		stopGracefully(p, p.done, tt.grace)
+		took := time.Since(start)
+
+		if !reflect.DeepEqual(p.events, tt.want) {
+			t.Errorf("%s: stopped with %v, want %v", tt.name, p.events, tt.want)
+		}
+		if tt.wantWait && took < tt.grace {
+			t.Errorf("%s: killed after %v, want the grace of %v first", tt.name, took, tt.grace)
+		}
+		if !tt.wantWait && took >= grace {
+			t.Errorf("%s: took %v to stop, want no wait for the grace", tt.name, took)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profiler profiles the diagnostics tool itself while it runs, to find
+// where the time and memory go on big bundles.
+type profiler struct {
+	cpuFile *os.File
+	memPath string
+}
+
+// startProfiling starts a CPU profile written to cpuPath, and arranges for
+// a heap profile to be written to memPath when stopped. Either path can be
+// empty to skip that profile.
+func startProfiling(cpuPath, memPath string) (*profiler, error) {
+	p := &profiler{memPath: memPath}
+	if cpuPath == "" {
+		return p, nil
+	}
+	f, err := os.Create(cpuPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	p.cpuFile = f
+	return p, nil
+}
+
+// stop finishes the CPU profile and writes the heap profile.
+func (p *profiler) stop() error {
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpuFile.Close(); err != nil {
+			return err
+		}
+	}
+	if p.memPath == "" {
+		return nil
+	}
+	f, err := os.Create(p.memPath)
+	if err != nil {
+		return err
+	}
+	// Get up to date statistics of what is still in use.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fatalf stops the profiles, so that they cover the run up to the failure,
+// and exits like log.Fatalf.
+func (p *profiler) fatalf(format string, v ...interface{}) {
+	if err := p.stop(); err != nil {
+		log.Printf("Error writing the profile: %v", err)
+	}
+	log.Fatalf(format, v...)
+}
@@ -0,0 +1,72 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		cpu, mem string
+	}{
+		{"cpu and mem", filepath.Join(dir, "both.cpu"), filepath.Join(dir, "both.mem")},
+		{"cpu only", filepath.Join(dir, "only.cpu"), ""},
+		{"mem only", "", filepath.Join(dir, "only.mem")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := startProfiling(tt.cpu, tt.mem)
+			if err != nil {
+				t.Fatalf("startProfiling() error = %v", err)
+			}
+			// Some work to profile.
+			var s []string
+			for i := 0; i < 1000; i++ {
+				s = append(s, filepath.Join(dir, "file"))
+			}
+			if err := p.stop(); err != nil {
+				t.Fatalf("stop() error = %v", err)
+			}
+			for _, path := range []string{tt.cpu, tt.mem} {
+				if path == "" {
+					continue
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Errorf("expected a profile at %s: %v", path, err)
+				} else if info.Size() == 0 {
+					t.Errorf("profile %s is empty", path)
+				}
+			}
+		})
+	}
+}
+
+func TestProfilingBadPath(t *testing.T) {
+	if _, err := startProfiling(filepath.Join("does", "not", "exist", "cpu.prof"), ""); err == nil {
+		t.Error("startProfiling() with a bad path succeeded, want an error")
+	}
+}
@@ -0,0 +1,154 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+const (
+	// progressWidth is the number of cells of the progress bar.
+	progressWidth = 30
+	// progressStep is the percent between the progress lines written when
+	// the output isn't a terminal.
+	progressStep = 10
+)
+
+// progress reports how many of the collectors are done, main sets it up
+// once the flags are parsed. Until then, and in tests, nothing is written.
+var progress = newProgressReporter(ioutil.Discard, false)
+
+// progressReporter shows the share of the collectors that are done. On a
+// terminal it is a single bar redrawn in place, otherwise a line is written
+// every progressStep percent so redirected output stays readable. The
+// collectors are counted as the gatherers start them, so the total can grow
+// and the share go back, it only reaches 100% once finish is called.
+type progressReporter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	tty   bool
+	total int
+	done  int
+	// reported is the highest step written as a line.
+	reported int
+	// drawn is the length of the bar on screen, 0 when there is none.
+	drawn int
+}
+
+func newProgressReporter(w io.Writer, tty bool) *progressReporter {
+	return &progressReporter{w: w, tty: tty}
+}
+
+// add counts n more collectors to run.
+func (p *progressReporter) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total += n
+	p.update()
+}
+
+// collected counts a collector as done, whether it succeeded or not.
+func (p *progressReporter) collected() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.update()
+}
+
+// finish reports the collection as complete and ends the bar.
+func (p *progressReporter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = p.total
+	if p.tty {
+		p.draw(100)
+		fmt.Fprint(p.w, "\r\n")
+		p.drawn = 0
+		return
+	}
+	if p.reported < 100 {
+		p.reported = 100
+		fmt.Fprintf(p.w, "Progress: 100%% (%d of %d collectors done)\r\n", p.done, p.total)
+	}
+}
+
+// percent is the share of the collectors done, below 100 until finish.
+func (p *progressReporter) percent() int {
+	if p.total == 0 {
+		return 0
+	}
+	pct := p.done * 100 / p.total
+	if pct > 99 {
+		pct = 99
+	}
+	return pct
+}
+
+func (p *progressReporter) update() {
+	pct := p.percent()
+	if p.tty {
+		p.draw(pct)
+		return
+	}
+	if step := pct - pct%progressStep; step > p.reported {
+		p.reported = step
+		fmt.Fprintf(p.w, "Progress: %d%% (%d of %d collectors done)\r\n", pct, p.done, p.total)
+	}
+}
+
+// draw redraws the bar at pct in place.
+func (p *progressReporter) draw(pct int) {
+	filled := pct * progressWidth / 100
+	bar := fmt.Sprintf("[%s%s] %3d%% (%d of %d collectors done)", strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), pct, p.done, p.total)
+	// Pad over what is left of a longer bar.
+	padding := ""
+	if p.drawn > len(bar) {
+		padding = strings.Repeat(" ", p.drawn-len(bar))
+	}
+	fmt.Fprintf(p.w, "\r%s%s", bar, padding)
+	p.drawn = len(bar)
+}
+
+// logWriter returns a writer for the log to go to. On a terminal it clears
+// the bar before each log line and redraws it after, so they don't end up
+// on the same line.
+func (p *progressReporter) logWriter(w io.Writer) io.Writer {
+	if !p.tty {
+		return w
+	}
+	return progressLogWriter{p, w}
+}
+
+type progressLogWriter struct {
+	p *progressReporter
+	w io.Writer
+}
+
+func (l progressLogWriter) Write(b []byte) (int, error) {
+	l.p.mu.Lock()
+	defer l.p.mu.Unlock()
+	if l.p.drawn > 0 {
+		fmt.Fprintf(l.p.w, "\r%s\r", strings.Repeat(" ", l.p.drawn))
+	}
+	n, err := l.w.Write(b)
+	if l.p.drawn > 0 {
+		l.p.draw(l.p.percent())
+	}
+	return n, err
+}
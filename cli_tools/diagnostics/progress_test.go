@@ -0,0 +1,118 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProgressPlainLines(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressReporter(&buf, false)
+	p.add(20)
+	for i := 0; i < 20; i++ {
+		p.collected()
+	}
+	p.finish()
+
+	got := buf.String()
+	if strings.Contains(got, "\r[") || strings.Contains(got, "#") {
+		t.Errorf("progress not on a terminal drew a bar:\n%q", got)
+	}
+	lines := strings.Split(strings.TrimRight(got, "\r\n"), "\r\n")
+	want := []string{
+		"Progress: 10% (2 of 20 collectors done)",
+		"Progress: 20% (4 of 20 collectors done)",
+		"Progress: 30% (6 of 20 collectors done)",
+		"Progress: 40% (8 of 20 collectors done)",
+		"Progress: 50% (10 of 20 collectors done)",
+		"Progress: 60% (12 of 20 collectors done)",
+		"Progress: 70% (14 of 20 collectors done)",
+		"Progress: 80% (16 of 20 collectors done)",
+		"Progress: 90% (18 of 20 collectors done)",
+		"Progress: 100% (20 of 20 collectors done)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("progress lines:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressReporter(&buf, true)
+	p.add(4)
+	p.collected()
+	p.collected()
+
+	bar := "[###############...............]  50% (2 of 4 collectors done)"
+	if got := buf.String()[strings.LastIndex(buf.String(), "\r"):]; got != "\r"+bar {
+		t.Errorf("progress bar is %q, want %q", got, "\r"+bar)
+	}
+	if strings.Contains(buf.String(), "\n") {
+		t.Errorf("progress bar wrote a new line before finishing:\n%q", buf.String())
+	}
+
+	// The log clears the bar, writes its line and redraws the bar.
+	var logBuf bytes.Buffer
+	buf.Reset()
+	p.logWriter(&logBuf).Write([]byte("Collected something\n"))
+	if logBuf.String() != "Collected something\n" {
+		t.Errorf("log got %q", logBuf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "\r"+strings.Repeat(" ", len(bar))+"\r") {
+		t.Errorf("progress bar not cleared before the log line:\n%q", buf.String())
+	}
+
+	buf.Reset()
+	p.finish()
+	if got, want := buf.String(), "\r[##############################] 100% (4 of 4 collectors done)\r\n"; got != want {
+		t.Errorf("finished progress bar is %q, want %q", got, want)
+	}
+}
+
+func TestProgressNotDoneBeforeFinish(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressReporter(&buf, false)
+	p.add(1)
+	p.collected()
+	if strings.Contains(buf.String(), "100%") {
+		t.Errorf("progress reached 100%% before finish, more collectors could be added:\n%s", buf.String())
+	}
+}
+
+func TestIsTerminalFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f, err := os.Create(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if isTerminal(f) {
+		t.Error("isTerminal of a file is true, want false so the progress is written as lines")
+	}
+	if p := newProgressReporter(f, isTerminal(f)); p.logWriter(os.Stderr) != os.Stderr {
+		t.Error("the log goes through the progress bar when the output isn't a terminal")
+	}
+}
@@ -0,0 +1,113 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const internetSettingsKey = `SOFTWARE\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// proxyValues are the machine wide proxy settings of WinINet.
+var proxyValues = []string{"ProxyEnable", "ProxyServer", "ProxyOverride", "AutoConfigURL", "AutoDetect"}
+
+// maxPACSize caps the PAC script written out, real ones are a few KB.
+const maxPACSize = 1 << 20
+
+// pacClient fetches the PAC script and lookupHost resolves the WPAD host,
+// tests replace them.
+var (
+	pacClient  = &http.Client{Timeout: 10 * time.Second}
+	lookupHost = net.LookupHost
+)
+
+// pacScript fetches the proxy auto-config script set in AutoConfigURL, to see
+// whether it can be reached and what it says.
+type pacScript struct{}
+
+func (pacScript) title() string {
+	return "Proxy auto-config script from AutoConfigURL"
+}
+
+func (pacScript) writeOutput(ctx context.Context, w io.Writer) error {
+	if opts.noNetwork {
+		return errNoNetwork
+	}
+	v, err := reg.value(internetSettingsKey, "AutoConfigURL")
+	if err == registry.ErrNotExist {
+		_, err = io.WriteString(w, "No AutoConfigURL is set.\r\n")
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	url := formatRegistryValue(v)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := pacClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	fmt.Fprintf(w, "GET %s: %s\r\n\r\n", url, resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	_, err = io.Copy(w, io.LimitReader(resp.Body, maxPACSize))
+	return err
+}
+
+// wpadLookup resolves the WPAD host, which is where the proxy settings are
+// looked for when AutoDetect is on.
+type wpadLookup struct{}
+
+func (wpadLookup) title() string {
+	return "WPAD resolution of wpad"
+}
+
+func (wpadLookup) writeOutput(ctx context.Context, w io.Writer) error {
+	if opts.noNetwork {
+		return errNoNetwork
+	}
+	addrs, err := lookupHost("wpad")
+	if err != nil {
+		// Not resolving is the usual case, not an error.
+		_, err = fmt.Fprintf(w, "wpad does not resolve: %v\r\n", err)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "wpad resolves to %s\r\n", strings.Join(addrs, ", "))
+	return err
+}
+
+// proxy reports the WinINet and WinHTTP proxy settings, and what the
+// automatic configuration they point to gives.
+var proxy = group{"proxy.txt", []section{
+	regQuery{key: internetSettingsKey, values: proxyValues},
+	cmd{path: `C:\Windows\System32\netsh.exe`, args: "winhttp show proxy"},
+	// advproxy is only there on recent versions of Windows.
+	cmd{path: `C:\Windows\System32\netsh.exe`, args: "winhttp show advproxy"},
+	pacScript{},
+	wpadLookup{},
+}}
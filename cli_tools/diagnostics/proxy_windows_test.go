@@ -0,0 +1,127 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testPAC = `function FindProxyForURL(url, host) {
+  if (shExpMatch(host, "*.corp.example.com")) return "DIRECT";
+  return "PROXY proxy.corp.example.com:3128";
+}`
+
+// withFakePAC serves testPAC at /proxy.pac and points AutoConfigURL at it,
+// it returns the number of requests served.
+func withFakePAC(t *testing.T) (*int32, func()) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/proxy.pac" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testPAC)
+	}))
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		internetSettingsKey: {
+			"AutoConfigURL": server.URL + "/proxy.pac",
+			"AutoDetect":    uint64(1),
+		},
+	}}
+	return &requests, server.Close
+}
+
+func TestGatherNetworkLogsProxy(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	requests, closeServer := withFakePAC(t)
+	defer closeServer()
+	lookupHost = func(host string) ([]string, error) {
+		if host != "wpad" {
+			t.Errorf("looked up %q, want wpad", host)
+		}
+		return []string{"10.0.0.9"}, nil
+	}
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "proxy.txt")
+	for _, want := range []string{
+		"AutoConfigURL: http://",
+		"AutoDetect: 1",
+		"ProxyServer: (not set)",
+		"/proxy.pac: 200 OK",
+		`return "PROXY proxy.corp.example.com:3128";`,
+		"wpad resolves to 10.0.0.9",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in proxy.txt:\n%s", want, got)
+		}
+	}
+	for _, c := range []string{`C:\Windows\System32\netsh.exe winhttp show proxy`, `C:\Windows\System32\netsh.exe winhttp show advproxy`} {
+		if fake.callCount(c) != 1 {
+			t.Errorf("expected %q to run, calls: %v", c, fake.calls)
+		}
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("PAC server got %d requests, want 1", n)
+	}
+}
+
+func TestGatherNetworkLogsProxyUnreachable(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	_, closeServer := withFakePAC(t)
+	defer closeServer()
+	reg.(*fakeRegistry).keys[internetSettingsKey]["AutoConfigURL"] = "http://127.0.0.1:1/missing.pac"
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "proxy.txt")
+	for _, want := range []string{"Error: fetching http://127.0.0.1:1/missing.pac", "wpad does not resolve"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in proxy.txt:\n%s", want, got)
+		}
+	}
+}
+
+func TestGatherNetworkLogsProxyNoNetwork(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	requests, closeServer := withFakePAC(t)
+	defer closeServer()
+	lookups := 0
+	lookupHost = func(host string) ([]string, error) {
+		lookups++
+		return nil, nil
+	}
+	opts.noNetwork = true
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "proxy.txt")
+	if n := atomic.LoadInt32(requests); n != 0 || lookups != 0 {
+		t.Errorf("expected no PAC fetch or WPAD lookup with -no-network, got %d requests and %d lookups", n, lookups)
+	}
+	if strings.Count(got, "Skipped: "+errNoNetwork.Error()) != 2 {
+		t.Errorf("expected the PAC fetch and WPAD lookup to be skipped in proxy.txt:\n%s", got)
+	}
+	if !strings.Contains(got, "AutoConfigURL: http://") {
+		t.Errorf("expected the proxy settings to still be recorded:\n%s", got)
+	}
+}
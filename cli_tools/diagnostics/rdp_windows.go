@@ -0,0 +1,89 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	rdpPolicyKey   = `SOFTWARE\Policies\Microsoft\Windows NT\Terminal Services`
+	rdpListenerKey = `SYSTEM\CurrentControlSet\Control\Terminal Server\WinStations\RDP-Tcp`
+)
+
+// rdpRedirections are the values that turn off each device redirection of
+// RDP sessions, set by group policy or on the RDP-Tcp listener, and what
+// they redirect.
+var rdpRedirections = []struct{ value, what string }{
+	{"fDisableClip", "Clipboard"},
+	{"fDisableCdm", "Drives"},
+	{"fDisableCpm", "Printers"},
+	{"fDisableLPT", "LPT ports"},
+	{"fDisableCcm", "COM ports"},
+	{"fDisablePNPRedir", "Plug and Play devices"},
+	{"fDisableCam", "Audio playback"},
+	{"fDisableAudioCapture", "Audio recording"},
+}
+
+func rdpRedirectionValues() []string {
+	values := make([]string, len(rdpRedirections))
+	for i, r := range rdpRedirections {
+		values[i] = r.value
+	}
+	return values
+}
+
+// rdpRedirection works out which redirections RDP sessions get, group
+// policy takes precedence over the listener settings.
+type rdpRedirection struct{}
+
+func (rdpRedirection) title() string {
+	return "Effective RDP redirections"
+}
+
+func (rdpRedirection) writeOutput(ctx context.Context, w io.Writer) error {
+	for _, r := range rdpRedirections {
+		state, source := "allowed", "default"
+		for _, k := range []struct{ key, name string }{{rdpPolicyKey, "group policy"}, {rdpListenerKey, "RDP-Tcp listener"}} {
+			v, err := reg.value(k.key, r.value)
+			if err == registry.ErrNotExist {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if v == uint64(1) {
+				state = "disabled"
+			}
+			source = k.name
+			break
+		}
+		fmt.Fprintf(w, "%s: %s (%s)\r\n", r.what, state, source)
+	}
+	return nil
+}
+
+// rdpRedirectionSettings collects the clipboard and device redirection
+// settings of RDP sessions, behind many a missing clipboard or drive in VDI
+// sessions.
+var rdpRedirectionSettings = group{"rdp_redirection.txt", []section{
+	rdpRedirection{},
+	regQuery{key: rdpPolicyKey, values: rdpRedirectionValues()},
+	regQuery{key: rdpListenerKey, values: rdpRedirectionValues()},
+}}
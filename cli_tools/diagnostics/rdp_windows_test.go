@@ -0,0 +1,53 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatherSystemLogsRdpRedirection(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		rdpPolicyKey: {
+			"fDisableClip": uint64(1),
+			// The policy allowing drives wins over the listener.
+			"fDisableCdm": uint64(0),
+		},
+		rdpListenerKey: {
+			"fDisableCdm":  uint64(1),
+			"fDisableCpm":  uint64(1),
+			"fDisableClip": uint64(0),
+		},
+	}}
+
+	folder := runGatherer(t, gatherSystemLogs)
+	got := readFolderFile(t, folder, "rdp_redirection.txt")
+	for _, want := range []string{
+		"Clipboard: disabled (group policy)",
+		"Drives: allowed (group policy)",
+		"Printers: disabled (RDP-Tcp listener)",
+		"COM ports: allowed (default)",
+		`Read registry values from HKLM\` + rdpPolicyKey,
+		`Read registry values from HKLM\` + rdpListenerKey,
+		"fDisableAudioCapture: (not set)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in rdp_redirection.txt:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// reg reads the registry, tests replace it with a fake.
+var reg registryReader = hklmReader{}
+
+// registryReader reads keys under HKEY_LOCAL_MACHINE. Missing keys and values
+// are reported with registry.ErrNotExist.
+type registryReader interface {
+	// value returns the named value of key as a string, uint64, []string
+	// or []byte depending on its type.
+	value(key, name string) (interface{}, error)
+	valueNames(key string) ([]string, error)
+	subKeys(key string) ([]string, error)
+}
+
+type hklmReader struct{}
+
+func (hklmReader) value(key, name string) (interface{}, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	_, valtype, err := k.GetValue(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch valtype {
+	case registry.SZ, registry.EXPAND_SZ:
+		v, _, err := k.GetStringValue(name)
+		return v, err
+	case registry.DWORD, registry.QWORD:
+		v, _, err := k.GetIntegerValue(name)
+		return v, err
+	case registry.MULTI_SZ:
+		v, _, err := k.GetStringsValue(name)
+		return v, err
+	default:
+		v, _, err := k.GetBinaryValue(name)
+		return v, err
+	}
+}
+
+func (hklmReader) valueNames(key string) ([]string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	return k.ReadValueNames(-1)
+}
+
+func (hklmReader) subKeys(key string) ([]string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	return k.ReadSubKeyNames(-1)
+}
+
+// formatRegistryValue formats a value returned by registryReader.value.
+func formatRegistryValue(v interface{}) string {
+	switch v := v.(type) {
+	case []string:
+		return strings.Join(v, "; ")
+	case []byte:
+		return fmt.Sprintf("%x", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// regQuery reads values of a key under HKEY_LOCAL_MACHINE. Only the listed
+// values are read, or every value of the key when none are listed.
+type regQuery struct {
+	key            string
+	values         []string
+	outputFileName string
+}
+
+func (query regQuery) title() string {
+	return fmt.Sprintf(`Read registry values from HKLM\%s`, query.key)
+}
+
+func (query regQuery) writeOutput(ctx context.Context, w io.Writer) error {
+	names := query.values
+	if len(names) == 0 {
+		var err error
+		if names, err = reg.valueNames(query.key); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		v, err := reg.value(query.key, name)
+		switch {
+		case err == registry.ErrNotExist:
+			fmt.Fprintf(w, "%s: (not set)\r\n", name)
+		case err != nil:
+			fmt.Fprintf(w, "%s: error reading value: %v\r\n", name, err)
+		default:
+			fmt.Fprintf(w, "%s: %s\r\n", name, formatRegistryValue(v))
+		}
+	}
+	return nil
+}
+
+func (query regQuery) run(ctx context.Context) (string, error) {
+	outPath := filepath.Join(tmpFolder, query.outputFileName)
+	outFile, err := createOutput(ctx, outPath)
+	if err != nil {
+		return outPath, err
+	}
+	defer outFile.Close()
+
+	if _, err := io.WriteString(outFile, query.title()+"\r\n\r\n"); err != nil {
+		return outPath, err
+	}
+	return outPath, query.writeOutput(ctx, outFile)
+}
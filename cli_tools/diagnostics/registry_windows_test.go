@@ -0,0 +1,102 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// fakeRegistry serves values from keys and records every value read.
+type fakeRegistry struct {
+	mu   sync.Mutex
+	keys map[string]map[string]interface{}
+	// subkeys lists the subkeys of a key, keys not listed have none.
+	subkeys map[string][]string
+	read    []string
+}
+
+func (f *fakeRegistry) value(key, name string) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.read = append(f.read, key+`\`+name)
+	values, ok := f.keys[key]
+	if !ok {
+		return nil, registry.ErrNotExist
+	}
+	v, ok := values[name]
+	if !ok {
+		return nil, registry.ErrNotExist
+	}
+	return v, nil
+}
+
+func (f *fakeRegistry) valueNames(key string) ([]string, error) {
+	values, ok := f.keys[key]
+	if !ok {
+		return nil, registry.ErrNotExist
+	}
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *fakeRegistry) subKeys(key string) ([]string, error) {
+	if _, ok := f.keys[key]; !ok && f.subkeys[key] == nil {
+		return nil, registry.ErrNotExist
+	}
+	return f.subkeys[key], nil
+}
+
+func TestRegQueryWriteOutput(t *testing.T) {
+	oldReg := reg
+	defer func() { reg = oldReg }()
+	reg = &fakeRegistry{keys: map[string]map[string]interface{}{
+		`SOFTWARE\Test`: {
+			"Str":   "value",
+			"Num":   uint64(42),
+			"Multi": []string{"a", "b"},
+			"Bin":   []byte{0xde, 0xad},
+		},
+	}}
+
+	tests := []struct {
+		name  string
+		query regQuery
+		want  string
+	}{
+		{"All values", regQuery{key: `SOFTWARE\Test`}, "Bin: dead\r\nMulti: a; b\r\nNum: 42\r\nStr: value\r\n"},
+		{"Listed values", regQuery{key: `SOFTWARE\Test`, values: []string{"Num", "Missing"}}, "Num: 42\r\nMissing: (not set)\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.query.writeOutput(context.Background(), &b); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("writeOutput() = %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
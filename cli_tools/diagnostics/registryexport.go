@@ -0,0 +1,86 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// registryRoots maps the root keys reg export takes, by their short and long
+// names, to the short name.
+var registryRoots = map[string]string{
+	"HKLM":                "HKLM",
+	"HKEY_LOCAL_MACHINE":  "HKLM",
+	"HKCU":                "HKCU",
+	"HKEY_CURRENT_USER":   "HKCU",
+	"HKCR":                "HKCR",
+	"HKEY_CLASSES_ROOT":   "HKCR",
+	"HKU":                 "HKU",
+	"HKEY_USERS":          "HKU",
+	"HKCC":                "HKCC",
+	"HKEY_CURRENT_CONFIG": "HKCC",
+}
+
+// registryHiveRoots are the roots whose subkeys are whole hives, such as
+// HKLM\SOFTWARE or the profile of a user under HKU. A key needs to be at
+// least a level below those.
+var registryHiveRoots = map[string]bool{"HKLM": true, "HKU": true}
+
+// parseRegistryExports checks the keys given with -export-registry and
+// returns them with short root names. A root or a whole hive is refused,
+// exporting it would take minutes and hundreds of megabytes.
+func parseRegistryExports(keys []string) ([]string, error) {
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		k, err := parseRegistryKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if seen[strings.ToLower(k)] {
+			return nil, fmt.Errorf("%s is given twice", key)
+		}
+		seen[strings.ToLower(k)] = true
+		parsed = append(parsed, k)
+	}
+	return parsed, nil
+}
+
+func parseRegistryKey(key string) (string, error) {
+	parts := strings.Split(strings.Trim(strings.TrimSpace(key), `\`), `\`)
+	root, ok := registryRoots[strings.ToUpper(parts[0])]
+	if !ok {
+		return "", fmt.Errorf("%q doesn't start with a root key, expected HKLM, HKCU, HKCR, HKU or HKCC", key)
+	}
+	for _, p := range parts[1:] {
+		if p == "" || strings.Contains(p, `"`) {
+			return "", fmt.Errorf("%q is not a valid key", key)
+		}
+	}
+	minDepth := 1
+	if registryHiveRoots[root] {
+		minDepth = 2
+	}
+	if len(parts)-1 < minDepth {
+		return "", fmt.Errorf("%s is a whole hive, give a key under it", key)
+	}
+	return strings.Join(append([]string{root}, parts[1:]...), `\`), nil
+}
+
+// registryExportFileName is the name of the .reg file key is exported to.
+func registryExportFileName(key string) string {
+	return safeFileName(key) + ".reg"
+}
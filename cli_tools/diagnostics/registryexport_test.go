@@ -0,0 +1,55 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRegistryExports(t *testing.T) {
+	for _, tt := range []struct {
+		keys    []string
+		want    []string
+		wantErr bool
+	}{
+		{[]string{`HKLM\SYSTEM\CurrentControlSet\Services\Tcpip`}, []string{`HKLM\SYSTEM\CurrentControlSet\Services\Tcpip`}, false},
+		{[]string{`HKEY_LOCAL_MACHINE\Software\Google\`, `hkcu\Console`}, []string{`HKLM\Software\Google`, `HKCU\Console`}, false},
+		{[]string{`HKCR\.ps1`, `HKEY_CURRENT_CONFIG\System`}, []string{`HKCR\.ps1`, `HKCC\System`}, false},
+		{[]string{`HKLM`}, nil, true},
+		{[]string{`HKLM\SOFTWARE`}, nil, true},
+		{[]string{`HKU\S-1-5-18`}, nil, true},
+		{[]string{`HKCU`}, nil, true},
+		{[]string{`SYSTEM\CurrentControlSet`}, nil, true},
+		{[]string{`HKLM\SYSTEM\\Select`}, nil, true},
+		{[]string{`HKLM\SYSTEM\"Select`}, nil, true},
+		{[]string{`HKLM\SYSTEM\Select`, `HKEY_LOCAL_MACHINE\system\select`}, nil, true},
+	} {
+		got, err := parseRegistryExports(tt.keys)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRegistryExports(%q) error = %v, want error %t", tt.keys, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRegistryExports(%q) = %q, want %q", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryExportFileName(t *testing.T) {
+	if got, want := registryExportFileName(`HKLM\SYSTEM\CurrentControlSet\Services\Tcpip`), "HKLM_SYSTEM_CurrentControlSet_Services_Tcpip.reg"; got != want {
+		t.Errorf("registryExportFileName = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+const regExe = `C:\Windows\System32\reg.exe`
+
+// registryExport exports a registry subtree with reg export. An export over
+// maxBytes is deleted rather than bundled, a key given too high up the tree
+// can take most of a hive.
+type registryExport struct {
+	key      string
+	export   cmd
+	maxBytes int64
+}
+
+func newRegistryExport(key string, maxBytes int64) registryExport {
+	name := registryExportFileName(key)
+	return registryExport{
+		key:      key,
+		export:   cmd{path: regExe, args: fmt.Sprintf(`export "%s" %s /y`, key, name), outputFileName: name, cmdProducesFile: true},
+		maxBytes: maxBytes,
+	}
+}
+
+func (r registryExport) run(ctx context.Context) (string, error) {
+	outPath, err := r.export.run(ctx)
+	if err != nil {
+		return outPath, err
+	}
+	fi, err := os.Stat(outPath)
+	if err != nil {
+		return outPath, err
+	}
+	if fi.Size() > r.maxBytes {
+		if err := os.Remove(outPath); err != nil {
+			return outPath, err
+		}
+		return outPath, fmt.Errorf("the export of %s is %d bytes, over the -export-registry-max-bytes cap of %d, export a key further down the tree", r.key, fi.Size(), r.maxBytes)
+	}
+	return outPath, nil
+}
+
+// registryExportRunners export the registry subtrees given with
+// -export-registry.
+func registryExportRunners() []runner {
+	var commands []runner
+	for _, key := range opts.registryExports {
+		commands = append(commands, newRegistryExport(key, opts.maxRegistryExportBytes))
+	}
+	return commands
+}
+
+// gatherRegistryExports exports the registry subtrees given with
+// -export-registry into System/registry.
+func gatherRegistryExports(ctx context.Context, logs chan logFolder, errs chan error) {
+	logs <- logFolder{name: "System/registry", files: resultPaths(runAll(ctx, registryExportRunners(), errs))}
+}
@@ -0,0 +1,83 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGatherRegistryExports(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.writeFiles = true
+	opts.registryExports = stringList{`HKLM\SYSTEM\CurrentControlSet\Services\Tcpip`, `HKLM\SOFTWARE\Policies\Microsoft`}
+	opts.maxRegistryExportBytes = 100
+	tcpip := filepath.Join(tmpFolder, "HKLM_SYSTEM_CurrentControlSet_Services_Tcpip.reg")
+	policies := filepath.Join(tmpFolder, "HKLM_SOFTWARE_Policies_Microsoft.reg")
+	tcpipCall := `C:\Windows\System32\reg.exe export HKLM\SYSTEM\CurrentControlSet\Services\Tcpip ` + tcpip + ` /y`
+	policiesCall := `C:\Windows\System32\reg.exe export HKLM\SOFTWARE\Policies\Microsoft ` + policies + ` /y`
+	fake.outputs = map[string]string{
+		tcpipCall:    "Windows Registry Editor Version 5.00\r\n",
+		policiesCall: strings.Repeat("x", 101),
+	}
+
+	logs := make(chan logFolder, 1)
+	errs := make(chan error, 10)
+	gatherRegistryExports(context.Background(), logs, errs)
+	folder := <-logs
+
+	if folder.name != "System/registry" {
+		t.Errorf("registry exports went to %s, want System/registry", folder.name)
+	}
+	for _, call := range []string{tcpipCall, policiesCall} {
+		if fake.callCount(call) != 1 {
+			t.Errorf("expected %q, got calls %v", call, fake.calls)
+		}
+	}
+	got := readFolderFile(t, folder, filepath.Base(tcpip))
+	if !strings.Contains(got, "Windows Registry Editor") {
+		t.Errorf("expected the export in %s, got %q", tcpip, got)
+	}
+
+	// The export over the cap is dropped and reported.
+	if stringArrayIncludesString(folder.files, policies) {
+		t.Errorf("expected the export over -export-registry-max-bytes left out, got %v", folder.files)
+	}
+	if _, err := os.Stat(policies); !os.IsNotExist(err) {
+		t.Errorf("expected the export over the cap deleted, got %v", err)
+	}
+	close(errs)
+	var errStrings []string
+	for err := range errs {
+		errStrings = append(errStrings, err.Error())
+	}
+	if len(errStrings) != 1 || !strings.Contains(errStrings[0], "101 bytes, over the -export-registry-max-bytes cap of 100") {
+		t.Errorf("expected the export over the cap as an error, got %q", errStrings)
+	}
+}
+
+func TestGatherersRegistryExports(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	without := len(gatherers())
+	opts.registryExports = stringList{`HKLM\SYSTEM\Select`}
+	if got := len(gatherers()); got != without+1 {
+		t.Errorf("expected the registry exports gatherer with -export-registry, got %d gatherers, want %d", got, without+1)
+	}
+}
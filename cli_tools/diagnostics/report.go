@@ -0,0 +1,130 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"html/template"
+	"os"
+	"runtime"
+)
+
+const reportFileName = "report.html"
+
+// reportTemplate renders the bundle as a page for people who would rather not
+// dig through the folders, links are relative to the root of the bundle.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Diagnostics for {{.Hostname}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+th { text-align: left; padding-right: 1em; }
+.errors { color: #b00020; }
+.warnings { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Diagnostics for {{.Hostname}}</h1>
+<table>
+<tr><th>Collected</th><td>{{.Collected}}</td></tr>
+<tr><th>Tool version</th><td>{{.Version}}</td></tr>
+<tr><th>Platform</th><td>{{.Platform}}</td></tr>
+</table>
+
+<h2 class="errors">Errors ({{len .Errors}})</h2>
+<ul>{{range .Errors}}
+<li>{{.}}</li>{{end}}
+</ul>
+<h2 class="warnings">Warnings ({{len .Warnings}})</h2>
+<ul>{{range .Warnings}}
+<li>{{.}}</li>{{end}}
+</ul>
+<h2>Notes ({{len .Notes}})</h2>
+<ul>{{range .Notes}}
+<li>{{.}}</li>{{end}}
+</ul>
+
+<h2>Collected files</h2>
+{{range .Folders}}
+<h3>{{if .Name}}{{.Name}}{{else}}Bundle root{{end}}: {{len .Files}} files{{if .Errors}}, {{len .Errors}} errors{{end}}</h3>
+<ul>{{range .Files}}
+<li><a href="{{.}}">{{.}}</a></li>{{end}}
+</ul>{{if .Errors}}
+<ul class="errors">{{range .Errors}}
+<li>{{.}}</li>{{end}}
+</ul>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type reportFolder struct {
+	Name string
+	// Files are the paths of the files within the bundle.
+	Files  []string
+	Errors []string
+}
+
+type reportData struct {
+	Hostname  string
+	Collected string
+	Version   string
+	Platform  string
+	Errors    []string
+	Warnings  []string
+	Notes     []string
+	Folders   []reportFolder
+}
+
+// newReportData gathers what the report shows from the collected folders and
+// the summary.
+func newReportData(folders []logFolder, s *runSummary) reportData {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	data := reportData{
+		Hostname:  hostname,
+		Collected: collectionTime(),
+		Version:   buildInfo().String(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	data.Errors, data.Warnings, data.Notes = s.lines()
+	for _, folder := range folders {
+		rf := reportFolder{Name: folder.name}
+		for _, path := range folder.files {
+			rf.Files = append(rf.Files, archivePath(folder.name, path))
+		}
+		for _, err := range folder.errs {
+			rf.Errors = append(rf.Errors, err.Error())
+		}
+		data.Folders = append(data.Folders, rf)
+	}
+	return data
+}
+
+// writeReport renders the report of folders and s to path.
+func writeReport(path string, folders []logFolder, s *runSummary) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(f, newReportData(folders, s)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
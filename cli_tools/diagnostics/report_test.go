@@ -0,0 +1,73 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	folders := []logFolder{
+		{name: "System", files: []string{filepath.Join(dir, "systeminfo.txt"), filepath.Join(dir, "power.txt")}},
+		{name: "GCE/startup_scripts", files: []string{filepath.Join(dir, "metadata_scripts.txt")}},
+		{name: "Network", errs: []error{errors.New(`ping failed <script>alert("x")</script>`)}},
+		{name: "", files: []string{filepath.Join(dir, summaryFileName)}},
+	}
+	s := &runSummary{}
+	s.warnf("VSS writer %q is failed", "<b>SqlServerWriter</b>")
+	s.notef("Boot trace registered & waiting")
+
+	path := filepath.Join(dir, reportFileName)
+	if err := writeReport(path, folders, s); err != nil {
+		t.Fatalf("writeReport() error = %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+
+	for _, want := range []string{
+		`<a href="System/systeminfo.txt">System/systeminfo.txt</a>`,
+		`<a href="System/power.txt">System/power.txt</a>`,
+		`<a href="GCE/startup_scripts/metadata_scripts.txt">GCE/startup_scripts/metadata_scripts.txt</a>`,
+		`<a href="summary.txt">summary.txt</a>`,
+		"Warnings (1)",
+		"&lt;b&gt;SqlServerWriter&lt;/b&gt;",
+		"Boot trace registered &amp; waiting",
+		"Network: 0 files, 1 errors",
+		"&lt;script&gt;",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in the report:\n%s", want, got)
+		}
+	}
+	for _, notWant := range []string{"<script>", "<b>SqlServerWriter"} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("unescaped %q in the report:\n%s", notWant, got)
+		}
+	}
+}
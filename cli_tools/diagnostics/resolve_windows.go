@@ -0,0 +1,93 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// hostResolver resolves a name to its addresses, as net.Resolver does.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// nameResolver resolves the names of -resolve-name, tests replace it.
+var nameResolver hostResolver = net.DefaultResolver
+
+// nameResolution looks up each of names with the resolver of the machine,
+// which is what its applications go through.
+type nameResolution struct {
+	names []string
+}
+
+func (nameResolution) title() string {
+	return "Resolution of the -resolve-name names"
+}
+
+func (n nameResolution) writeOutput(ctx context.Context, w io.Writer) error {
+	if opts.noNetwork {
+		return errNoNetwork
+	}
+	fmt.Fprintf(w, "Resolver: %s, timeout %v per name.\r\n\r\n", resolverName(nameResolver), opts.resolveTimeout)
+	for _, name := range n.names {
+		lookupCtx, cancel := context.WithTimeout(ctx, opts.resolveTimeout)
+		start := time.Now()
+		addrs, err := nameResolver.LookupHost(lookupCtx, name)
+		took := time.Since(start).Round(time.Millisecond)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// A name not resolving is what is looked for, not an error of the
+		// collector.
+		if err != nil {
+			if lookupCtx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("timed out after %v", opts.resolveTimeout)
+			}
+			fmt.Fprintf(w, "%s: failed in %v: %v\r\n", name, took, err)
+			summary.warnf("%s does not resolve, see Network/name_resolution.txt: %v", name, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s in %v\r\n", name, strings.Join(addrs, ", "), took)
+	}
+	return nil
+}
+
+// resolverName describes r for name_resolution.txt.
+func resolverName(r hostResolver) string {
+	nr, ok := r.(*net.Resolver)
+	switch {
+	case !ok:
+		return fmt.Sprintf("%T", r)
+	case nr.PreferGo:
+		return "Go DNS resolver"
+	}
+	// On Windows, the net package resolves through GetAddrInfoW.
+	return "Windows resolver (GetAddrInfoW), which applies the hosts file, the DNS suffix search list and the NRPT"
+}
+
+// nameResolutions resolves the names of -resolve-name and lists the DNS
+// servers the resolver queries for them.
+func nameResolutions(names []string) runner {
+	return group{"name_resolution.txt", []section{
+		nameResolution{names},
+		cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-DnsClientServerAddress | Format-Table -AutoSize"`},
+	}}
+}
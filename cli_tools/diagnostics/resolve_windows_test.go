@@ -0,0 +1,100 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeResolver resolves the names it has addresses for, fails the others,
+// and hangs on the names in hang until the lookup times out.
+type fakeResolver struct {
+	addrs   map[string][]string
+	hang    map[string]bool
+	lookups []string
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.lookups = append(f.lookups, host)
+	if f.hang[host] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if addrs, ok := f.addrs[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestGatherNetworkLogsNameResolution(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	oldResolver := nameResolver
+	defer func() { nameResolver = oldResolver }()
+	resolver := &fakeResolver{
+		addrs: map[string][]string{"db.corp.example.com": {"10.0.0.5", "10.0.0.6"}},
+		hang:  map[string]bool{"slow.corp.example.com": true},
+	}
+	nameResolver = resolver
+	opts.resolveNames = stringList{"db.corp.example.com", "missing.corp.example.com", "slow.corp.example.com"}
+	opts.resolveTimeout = 50 * time.Millisecond
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "name_resolution.txt")
+	for _, want := range []string{
+		"Resolver: *main.fakeResolver, timeout 50ms per name.",
+		"db.corp.example.com: 10.0.0.5, 10.0.0.6 in ",
+		"missing.corp.example.com: failed in ",
+		"no such host",
+		"slow.corp.example.com: failed in ",
+		"timed out after 50ms",
+		"Get-DnsClientServerAddress",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in name_resolution.txt:\n%s", want, got)
+		}
+	}
+	if s := summary.String(); !strings.Contains(s, "missing.corp.example.com does not resolve") || strings.Contains(s, "db.corp.example.com does not resolve") {
+		t.Errorf("expected only the names that don't resolve in the summary:\n%s", s)
+	}
+
+	t.Run("no network", func(t *testing.T) {
+		resolver.lookups = nil
+		opts.noNetwork = true
+		defer func() { opts.noNetwork = false }()
+		folder := runGatherer(t, gatherNetworkLogs)
+		got := readFolderFile(t, folder, "name_resolution.txt")
+		if len(resolver.lookups) != 0 {
+			t.Errorf("expected no lookups with -no-network, got %v", resolver.lookups)
+		}
+		if !strings.Contains(got, "Skipped: "+string(errNoNetwork)) {
+			t.Errorf("expected the resolution skipped in name_resolution.txt:\n%s", got)
+		}
+	})
+}
+
+func TestResolverName(t *testing.T) {
+	if got := resolverName(&net.Resolver{}); !strings.Contains(got, "GetAddrInfoW") {
+		t.Errorf("resolverName of the default resolver = %q, want the Windows resolver", got)
+	}
+	if got := resolverName(&net.Resolver{PreferGo: true}); got != "Go DNS resolver" {
+		t.Errorf("resolverName of the Go resolver = %q", got)
+	}
+}
@@ -0,0 +1,142 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Address families of MSFT_NetRoute and MSFT_NetIPInterface.
+const (
+	afInet  = 2
+	afInet6 = 23
+)
+
+// routeTable lists the active IPv4 and IPv6 routes with the names of their
+// interfaces and the metric Windows picks routes by, the route metric plus
+// the interface metric. route print shows interface indexes only.
+type routeTable struct{}
+
+func (routeTable) title() string {
+	return "IPv4 and IPv6 routes (MSFT_NetRoute, MSFT_NetIPInterface)"
+}
+
+// netInterfaceKey identifies an IP interface, each address family of an
+// adapter is one.
+type netInterfaceKey struct {
+	index  int64
+	family int64
+}
+
+type netRoute struct {
+	family          int64
+	destination     string
+	nextHop         string
+	iface           string
+	routeMetric     int64
+	interfaceMetric int64
+	effectiveMetric int64
+}
+
+// wmiInt returns the named property of o as an integer, 0 if it isn't one.
+func wmiInt(o wmiObject, name string) int64 {
+	v, _ := strconv.ParseInt(fmt.Sprint(o.get(name)), 10, 64)
+	return v
+}
+
+func (routeTable) writeOutput(ctx context.Context, w io.Writer) error {
+	interfaces, err := wmiQuery{class: "MSFT_NetIPInterface", namespace: `root\StandardCimv2`}.objects(ctx)
+	if err != nil {
+		return err
+	}
+	// Only the active routes, the persistent store repeats the static ones.
+	routes, err := wmiQuery{class: "MSFT_NetRoute", namespace: `root\StandardCimv2`, where: "Store = 1"}.objects(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, formatRoutes(resolveRoutes(routes, interfaces)))
+	return err
+}
+
+// resolveRoutes names the interface of each route and computes its metric,
+// sorting the routes by family, then by the metric Windows uses them in.
+func resolveRoutes(routes, interfaces []wmiObject) []netRoute {
+	type ipInterface struct {
+		alias  string
+		metric int64
+	}
+	byKey := make(map[netInterfaceKey]ipInterface)
+	for _, i := range interfaces {
+		key := netInterfaceKey{wmiInt(i, "InterfaceIndex"), wmiInt(i, "AddressFamily")}
+		byKey[key] = ipInterface{fmt.Sprint(i.get("InterfaceAlias")), wmiInt(i, "InterfaceMetric")}
+	}
+
+	var resolved []netRoute
+	for _, r := range routes {
+		index := wmiInt(r, "InterfaceIndex")
+		route := netRoute{
+			family:      wmiInt(r, "AddressFamily"),
+			destination: fmt.Sprint(r.get("DestinationPrefix")),
+			nextHop:     fmt.Sprint(r.get("NextHop")),
+			routeMetric: wmiInt(r, "RouteMetric"),
+		}
+		if i, ok := byKey[netInterfaceKey{index, route.family}]; ok {
+			route.iface, route.interfaceMetric = i.alias, i.metric
+		} else {
+			route.iface = fmt.Sprintf("unknown (index %d)", index)
+		}
+		route.effectiveMetric = route.routeMetric + route.interfaceMetric
+		resolved = append(resolved, route)
+	}
+	sort.SliceStable(resolved, func(i, j int) bool {
+		a, b := resolved[i], resolved[j]
+		if a.family != b.family {
+			return a.family < b.family
+		}
+		if a.effectiveMetric != b.effectiveMetric {
+			return a.effectiveMetric < b.effectiveMetric
+		}
+		return a.destination < b.destination
+	})
+	return resolved
+}
+
+// formatRoutes formats the routes into a table.
+func formatRoutes(routes []netRoute) string {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprint(tw, "Family\tDestination\tNext hop\tInterface\tRoute metric\tInterface metric\tMetric\r\n")
+	for _, r := range routes {
+		family := strconv.FormatInt(r.family, 10)
+		switch r.family {
+		case afInet:
+			family = "IPv4"
+		case afInet6:
+			family = "IPv6"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\r\n", family, r.destination, r.nextHop, r.iface, r.routeMetric, r.interfaceMetric, r.effectiveMetric)
+	}
+	tw.Flush()
+	return b.String()
+}
+
+// resolvedRoutes is the route table with the interfaces resolved.
+var resolvedRoutes = group{"routes.txt", []section{routeTable{}}}
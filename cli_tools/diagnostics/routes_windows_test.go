@@ -0,0 +1,61 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGatherNetworkLogsRoutes(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	wmiSrc = &fakeWmiSource{objects: map[string][]wmiObject{
+		"MSFT_NetIPInterface": {
+			{{"InterfaceIndex", uint32(4)}, {"InterfaceAlias", "Ethernet"}, {"AddressFamily", uint16(afInet)}, {"InterfaceMetric", uint32(15)}},
+			{{"InterfaceIndex", uint32(4)}, {"InterfaceAlias", "Ethernet"}, {"AddressFamily", uint16(afInet6)}, {"InterfaceMetric", uint32(5)}},
+			{{"InterfaceIndex", uint32(1)}, {"InterfaceAlias", "Loopback Pseudo-Interface 1"}, {"AddressFamily", uint16(afInet)}, {"InterfaceMetric", uint32(75)}},
+		},
+		"MSFT_NetRoute": {
+			{{"DestinationPrefix", "127.0.0.0/8"}, {"NextHop", "0.0.0.0"}, {"InterfaceIndex", uint32(1)}, {"AddressFamily", uint16(afInet)}, {"RouteMetric", uint16(256)}},
+			{{"DestinationPrefix", "0.0.0.0/0"}, {"NextHop", "10.128.0.1"}, {"InterfaceIndex", uint32(4)}, {"AddressFamily", uint16(afInet)}, {"RouteMetric", uint16(0)}},
+			{{"DestinationPrefix", "::/0"}, {"NextHop", "fe80::1"}, {"InterfaceIndex", uint32(4)}, {"AddressFamily", uint16(afInet6)}, {"RouteMetric", uint16(256)}},
+			{{"DestinationPrefix", "10.8.0.0/24"}, {"NextHop", "0.0.0.0"}, {"InterfaceIndex", uint32(9)}, {"AddressFamily", uint16(afInet)}, {"RouteMetric", uint16(1)}},
+		},
+	}}
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "routes.txt")
+	space := regexp.MustCompile(` +`)
+	var rows []string
+	for _, line := range strings.Split(got, "\r\n") {
+		if strings.HasPrefix(line, "IPv") {
+			rows = append(rows, space.ReplaceAllString(strings.TrimSpace(line), " "))
+		}
+	}
+	want := []string{
+		"IPv4 10.8.0.0/24 0.0.0.0 unknown (index 9) 1 0 1",
+		"IPv4 0.0.0.0/0 10.128.0.1 Ethernet 0 15 15",
+		"IPv4 127.0.0.0/8 0.0.0.0 Loopback Pseudo-Interface 1 256 75 331",
+		"IPv6 ::/0 fe80::1 Ethernet 256 5 261",
+	}
+	if strings.Join(rows, "\n") != strings.Join(want, "\n") {
+		t.Errorf("routes.txt rows =\n%s\nwant\n%s\nin:\n%s", strings.Join(rows, "\n"), strings.Join(want, "\n"), got)
+	}
+	if !strings.Contains(got, "Interface metric") {
+		t.Errorf("expected a header row in routes.txt:\n%s", got)
+	}
+}
@@ -0,0 +1,100 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const schannelProtocolsKey = `SYSTEM\CurrentControlSet\Control\SecurityProviders\SCHANNEL\Protocols`
+
+// schannelProtocols lists the protocols configured for SChannel, with the
+// client and server side of each and their effective state.
+type schannelProtocols struct{}
+
+func (schannelProtocols) title() string {
+	return fmt.Sprintf(`Effective SChannel protocols from HKLM\%s`, schannelProtocolsKey)
+}
+
+func (schannelProtocols) writeOutput(ctx context.Context, w io.Writer) error {
+	protocols, err := reg.subKeys(schannelProtocolsKey)
+	if err != nil && err != registry.ErrNotExist {
+		return err
+	}
+	if len(protocols) == 0 {
+		fmt.Fprint(w, "No protocol is configured, SChannel uses the defaults of this Windows version.\r\n")
+		return nil
+	}
+	sort.Strings(protocols)
+	for _, protocol := range protocols {
+		for _, side := range []string{"Client", "Server"} {
+			key := schannelProtocolsKey + `\` + protocol + `\` + side
+			enabled, err := reg.value(key, "Enabled")
+			if err != nil && err != registry.ErrNotExist {
+				return err
+			}
+			disabledByDefault, err := reg.value(key, "DisabledByDefault")
+			if err != nil && err != registry.ErrNotExist {
+				return err
+			}
+			fmt.Fprintf(w, "%s %s: %s (Enabled=%s, DisabledByDefault=%s)\r\n", protocol, side, schannelState(enabled, disabledByDefault), schannelValue(enabled), schannelValue(disabledByDefault))
+		}
+	}
+	return nil
+}
+
+// schannelState is the state of a protocol given its Enabled and
+// DisabledByDefault values, nil when they aren't set.
+func schannelState(enabled, disabledByDefault interface{}) string {
+	switch {
+	case enabled == uint64(0):
+		return "disabled"
+	case disabledByDefault == uint64(1):
+		return "disabled by default, only used by applications asking for it"
+	case enabled != nil:
+		return "enabled"
+	}
+	return "Windows default"
+}
+
+func schannelValue(v interface{}) string {
+	if v == nil {
+		return "(not set)"
+	}
+	return formatRegistryValue(v)
+}
+
+// dotNetCryptoValues make .NET Framework applications use the TLS versions
+// of the system rather than their own defaults, SSL 3 and TLS 1.0 for the
+// older targets.
+var dotNetCryptoValues = []string{"SchUseStrongCrypto", "SystemDefaultTlsVersions"}
+
+// schannel collects the TLS protocols SChannel allows and whether .NET
+// applications follow them, behind many TLS handshake failures.
+var schannel = group{"schannel.txt", []section{
+	schannelProtocols{},
+	// The cipher suite order set by group policy, the local order applies
+	// when it isn't set.
+	regQuery{key: `SOFTWARE\Policies\Microsoft\Cryptography\Configuration\SSL\00010002`, values: []string{"Functions"}},
+	regQuery{key: `SOFTWARE\Microsoft\.NETFramework\v4.0.30319`, values: dotNetCryptoValues},
+	regQuery{key: `SOFTWARE\WOW6432Node\Microsoft\.NETFramework\v4.0.30319`, values: dotNetCryptoValues},
+	regQuery{key: `SOFTWARE\Microsoft\.NETFramework\v2.0.50727`, values: dotNetCryptoValues},
+	regQuery{key: `SOFTWARE\WOW6432Node\Microsoft\.NETFramework\v2.0.50727`, values: dotNetCryptoValues},
+}}
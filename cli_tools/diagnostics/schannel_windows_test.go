@@ -0,0 +1,67 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatherNetworkLogsSchannel(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	reg = &fakeRegistry{
+		keys: map[string]map[string]interface{}{
+			schannelProtocolsKey + `\TLS 1.0\Client`:      {"Enabled": uint64(0), "DisabledByDefault": uint64(1)},
+			schannelProtocolsKey + `\TLS 1.0\Server`:      {"Enabled": uint64(0)},
+			schannelProtocolsKey + `\TLS 1.2\Client`:      {"Enabled": uint64(1), "DisabledByDefault": uint64(0)},
+			schannelProtocolsKey + `\TLS 1.2\Server`:      {"DisabledByDefault": uint64(1)},
+			`SOFTWARE\Microsoft\.NETFramework\v4.0.30319`: {"SchUseStrongCrypto": uint64(1)},
+		},
+		subkeys: map[string][]string{
+			schannelProtocolsKey: {"TLS 1.2", "TLS 1.0"},
+		},
+	}
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	got := readFolderFile(t, folder, "schannel.txt")
+	for _, want := range []string{
+		"TLS 1.0 Client: disabled (Enabled=0, DisabledByDefault=1)",
+		"TLS 1.0 Server: disabled (Enabled=0, DisabledByDefault=(not set))",
+		"TLS 1.2 Client: enabled (Enabled=1, DisabledByDefault=0)",
+		"TLS 1.2 Server: disabled by default, only used by applications asking for it (Enabled=(not set), DisabledByDefault=1)",
+		`Read registry values from HKLM\SOFTWARE\Microsoft\.NETFramework\v4.0.30319`,
+		"SchUseStrongCrypto: 1",
+		"SystemDefaultTlsVersions: (not set)",
+		`Read registry values from HKLM\SOFTWARE\WOW6432Node\Microsoft\.NETFramework\v4.0.30319`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in schannel.txt:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "TLS 1.0 Client") > strings.Index(got, "TLS 1.2 Client") {
+		t.Errorf("expected the protocols sorted in schannel.txt:\n%s", got)
+	}
+}
+
+func TestSchannelProtocolsNotConfigured(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+
+	folder := runGatherer(t, gatherNetworkLogs)
+	if got := readFolderFile(t, folder, "schannel.txt"); !strings.Contains(got, "No protocol is configured, SChannel uses the defaults of this Windows version.") {
+		t.Errorf("expected the defaults noted without a Protocols key:\n%s", got)
+	}
+}
@@ -0,0 +1,91 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pantherRoots hold the logs of Windows setup and sysprep, the first place
+// to look when an image fails to build or an instance fails to specialize.
+var pantherRoots = []string{
+	`C:\Windows\Panther`,
+	`C:\Windows\System32\Sysprep\Panther`,
+}
+
+// maxSetupErrLines caps the lines of setuperr.log echoed in the summary, the
+// last ones are kept.
+const maxSetupErrLines = 20
+
+// echoSetupErrors copies the last lines of the setuperr.log at path into the
+// summary, an empty one means setup went fine.
+func echoSetupErrors(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var lines []string
+	total := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+		total++
+		lines = append(lines, line)
+		if len(lines) > maxSetupErrLines {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if total > len(lines) {
+		summary.warnf("%s has %d lines, the last %d follow", path, total, len(lines))
+	}
+	for _, line := range lines {
+		summary.warnf("%s: %s", path, line)
+	}
+	return nil
+}
+
+// gatherSetupLogs collects the setup and sysprep logs, and echoes their
+// errors in the summary.
+func gatherSetupLogs(ctx context.Context, logs chan logFolder, errs chan error) {
+	noteIgnoresSince("The setup logs")
+	filePaths, ers := collectFilePaths(pantherRoots)
+	for _, err := range ers {
+		if os.IsNotExist(err) {
+			summary.notef("Not collected, it does not exist: %v", err)
+			continue
+		}
+		errs <- err
+	}
+	for _, path := range filePaths {
+		if strings.EqualFold(filepath.Base(path), "setuperr.log") {
+			if err := echoSetupErrors(path); err != nil {
+				errs <- err
+			}
+		}
+	}
+	logs <- logFolder{name: "Setup", files: filePaths}
+}
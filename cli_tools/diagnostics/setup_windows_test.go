@@ -0,0 +1,93 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withPanther(t *testing.T, files map[string]string) func() {
+	old := pantherRoots
+	pantherRoots = []string{filepath.Join(tmpFolder, "Panther"), filepath.Join(tmpFolder, "Sysprep", "Panther")}
+	for name, content := range files {
+		p := filepath.Join(tmpFolder, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() { pantherRoots = old }
+}
+
+func TestGatherSetupLogs(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	defer withPanther(t, map[string]string{
+		filepath.Join("Panther", "setupact.log"): "2019-06-01 08:00:00, Info [Setup] Setup started\r\n",
+		filepath.Join("Panther", "setuperr.log"): "",
+		filepath.Join("Sysprep", "Panther", "setuperr.log"): "\ufeff2019-06-01 08:01:00, Error SYSPRP Package Microsoft.BingWeather was installed for a user, but not provisioned for all users.\r\n" +
+			"\r\n2019-06-01 08:01:01, Error SYSPRP Failed to remove apps for the current user: 0x80073cf2.\r\n",
+	})()
+
+	folder := runGatherer(t, gatherSetupLogs)
+	if folder.name != "Setup" || len(folder.files) != 3 {
+		t.Errorf("expected the 3 setup logs in the Setup folder, got %v", folder)
+	}
+	s := summary.String()
+	sysprepErr := filepath.Join(pantherRoots[1], "setuperr.log")
+	for _, want := range []string{
+		sysprepErr + ": 2019-06-01 08:01:00, Error SYSPRP Package Microsoft.BingWeather was installed",
+		sysprepErr + ": 2019-06-01 08:01:01, Error SYSPRP Failed to remove apps",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in the summary:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, filepath.Join(pantherRoots[0], "setuperr.log")) {
+		t.Errorf("an empty setuperr.log should not be in the summary:\n%s", s)
+	}
+	if strings.Contains(s, "\ufeff") {
+		t.Errorf("the byte order mark should not be in the summary:\n%s", s)
+	}
+}
+
+func TestGatherSetupLogsLongSetupErr(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	var b strings.Builder
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&b, "Error line %d\r\n", i)
+	}
+	defer withPanther(t, map[string]string{filepath.Join("Panther", "setuperr.log"): b.String()})()
+
+	runGatherer(t, gatherSetupLogs)
+	_, warnings, notes := summary.lines()
+	if len(warnings) != maxSetupErrLines+1 {
+		t.Errorf("expected %d warnings, got %d: %v", maxSetupErrLines+1, len(warnings), warnings)
+	}
+	if !strings.Contains(warnings[0], "has 50 lines, the last 20 follow") || !strings.HasSuffix(warnings[len(warnings)-1], "Error line 50") {
+		t.Errorf("expected the last 20 lines of setuperr.log, got %v", warnings)
+	}
+	if len(notes) == 0 || !strings.Contains(notes[0], "does not exist") {
+		t.Errorf("expected the missing sysprep folder to be noted, got %v", notes)
+	}
+}
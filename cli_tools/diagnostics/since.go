@@ -0,0 +1,69 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseSince parses the -since flag, either an RFC3339 time or a duration
+// before now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 time nor a positive duration", s)
+	}
+	return now.Add(-d), nil
+}
+
+// sinceXPath adds the -since lower bound to an event log XPath query of the
+// form *[System[...]], an empty query selects every event.
+func sinceXPath(xpath string) string {
+	if opts.since.IsZero() {
+		return xpath
+	}
+	timeCond := fmt.Sprintf("TimeCreated[@SystemTime>='%s']", opts.since.UTC().Format("2006-01-02T15:04:05.000Z"))
+	if xpath == "" {
+		return "*[System[" + timeCond + "]]"
+	}
+	cond := strings.TrimSuffix(strings.TrimPrefix(xpath, "*[System["), "]]")
+	return "*[System[(" + cond + ") and " + timeCond + "]]"
+}
+
+// sinceWQL adds the -since lower bound on property, a CIM datetime, to a WQL
+// condition.
+func sinceWQL(where, property string) string {
+	if opts.since.IsZero() {
+		return where
+	}
+	timeCond := fmt.Sprintf("%s >= '%s'", property, opts.since.UTC().Format("20060102150405.000000-000"))
+	if where == "" {
+		return timeCond
+	}
+	return "(" + where + ") AND " + timeCond
+}
+
+// noteIgnoresSince notes in the summary that what is collected can't be
+// limited by -since.
+func noteIgnoresSince(what string) {
+	if !opts.since.IsZero() {
+		summary.notef("%s can't be filtered by time, -since was ignored for it", what)
+	}
+}
@@ -0,0 +1,77 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2019, 6, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2019-06-01T00:00:00Z", time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), false},
+		{"24h", time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC), false},
+		{"90m", time.Date(2019, 6, 2, 10, 30, 0, 0, time.UTC), false},
+		{"-1h", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.in, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSince(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSinceFilters(t *testing.T) {
+	oldOpts := opts
+	defer func() { opts = oldOpts }()
+
+	if got := sinceXPath("*[System[(EventID=41)]]"); got != "*[System[(EventID=41)]]" {
+		t.Errorf("sinceXPath() without -since = %q, want it unchanged", got)
+	}
+	if got := sinceWQL("SourceName = 'x'", "TimeGenerated"); got != "SourceName = 'x'" {
+		t.Errorf("sinceWQL() without -since = %q, want it unchanged", got)
+	}
+
+	opts.since = time.Date(2019, 6, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	xpaths := []struct{ in, want string }{
+		{"", "*[System[TimeCreated[@SystemTime>='2019-06-01T12:00:00.000Z']]]"},
+		{"*[System[(EventID=41 or EventID=6008)]]", "*[System[((EventID=41 or EventID=6008)) and TimeCreated[@SystemTime>='2019-06-01T12:00:00.000Z']]]"},
+		{"*[System[Provider[@Name='GCEGuestAgent']]]", "*[System[(Provider[@Name='GCEGuestAgent']) and TimeCreated[@SystemTime>='2019-06-01T12:00:00.000Z']]]"},
+	}
+	for _, tt := range xpaths {
+		if got := sinceXPath(tt.in); got != tt.want {
+			t.Errorf("sinceXPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	wqls := []struct{ in, want string }{
+		{"", "TimeGenerated >= '20190601120000.000000-000'"},
+		{"SourceName = 'x'", "(SourceName = 'x') AND TimeGenerated >= '20190601120000.000000-000'"},
+	}
+	for _, tt := range wqls {
+		if got := sinceWQL(tt.in, "TimeGenerated"); got != tt.want {
+			t.Errorf("sinceWQL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"strings"
+)
+
+// smb is the effective configuration of the SMB client and server and the
+// open connections to file shares.
+var smb = group{"smb.txt", []section{
+	cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-SmbClientConfiguration | Format-List *"`},
+	cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-SmbServerConfiguration | Format-List *"`, inspect: checkSmb1},
+	cmd{path: powershell, args: `-NoProfile -NonInteractive -Command "Get-SmbConnection | Format-List *"`, admin: adminRequired},
+}}
+
+// checkSmb1 raises in the summary an SMB server that still accepts SMB1,
+// which is deprecated and insecure.
+func checkSmb1(output string) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "EnableSMB1Protocol" {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(parts[1]), "True") {
+			summary.warnf("SMB1 is enabled on the SMB server, it is deprecated and insecure")
+		}
+		return
+	}
+}
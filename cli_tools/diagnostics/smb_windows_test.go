@@ -0,0 +1,57 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	getSmbServerConfiguration = powershell + ` -NoProfile -NonInteractive -Command Get-SmbServerConfiguration | Format-List *`
+	sampleSmbServerConfig     = `
+AnnounceServer                  : False
+EnableSMB1Protocol              : %s
+EnableSMB2Protocol              : True
+RequireSecuritySignature        : False
+`
+)
+
+func TestGatherNetworkLogsSmb(t *testing.T) {
+	for _, tc := range []struct {
+		smb1 string
+		warn bool
+	}{
+		{"True", true},
+		{"False", false},
+	} {
+		t.Run("EnableSMB1Protocol="+tc.smb1, func(t *testing.T) {
+			fake, cleanup := withFakeExecutor(t)
+			defer cleanup()
+			fake.outputs = map[string]string{getSmbServerConfiguration: strings.Replace(sampleSmbServerConfig, "%s", tc.smb1, 1)}
+
+			folder := runGatherer(t, gatherNetworkLogs)
+			got := readFolderFile(t, folder, "smb.txt")
+			for _, want := range []string{"Get-SmbClientConfiguration", "Get-SmbServerConfiguration", "Get-SmbConnection", "EnableSMB1Protocol              : " + tc.smb1} {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected %q in smb.txt:\n%s", want, got)
+				}
+			}
+			if warned := strings.Contains(summary.String(), "SMB1 is enabled"); warned != tc.warn {
+				t.Errorf("SMB1 warning = %v, want %v:\n%s", warned, tc.warn, summary.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// systemVolume is the volume walked for the space usage.
+var systemVolume = `C:\`
+
+const (
+	// spaceUsageDepth is how deep the directories are listed, the size of
+	// the deeper ones counts in their ancestor at this depth.
+	spaceUsageDepth = 3
+	// spaceUsageTop is the number of directories listed.
+	spaceUsageTop = 40
+	// spaceUsageMaxDuration and spaceUsageMaxFiles bound the walk, a large
+	// volume holds millions of files.
+	spaceUsageMaxDuration = 3 * time.Minute
+	spaceUsageMaxFiles    = 2000000
+)
+
+// errWalkLimit stops a walk that reached its bounds.
+var errWalkLimit = errors.New("walk limit reached")
+
+// directorySizes is the outcome of a walk: the size of every directory down
+// to its depth, by path, and what the walk left out.
+type directorySizes struct {
+	sizes      map[string]int64
+	total      int64
+	files      int
+	unreadable int
+	// stopped is why the walk stopped early, "" when it went through.
+	stopped string
+}
+
+// walkDirectorySizes adds up the size of the files under root into their
+// ancestors up to depth levels below root. It stops at the first of ctx
+// being done, maxDuration or maxFiles, the sizes are then lower bounds.
+// Directories that can't be read are counted and skipped, links are not
+// followed.
+func walkDirectorySizes(ctx context.Context, root string, depth int, maxDuration time.Duration, maxFiles int) directorySizes {
+	d := directorySizes{sizes: make(map[string]int64)}
+	deadline := time.Now().Add(maxDuration)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			d.unreadable++
+			return nil
+		}
+		if info.IsDir() || !info.Mode().IsRegular() {
+			return nil
+		}
+		if ctx.Err() != nil {
+			d.stopped = ctx.Err().Error()
+			return errWalkLimit
+		}
+		if d.files >= maxFiles {
+			d.stopped = fmt.Sprintf("it reached %d files", maxFiles)
+			return errWalkLimit
+		}
+		if d.files%1000 == 0 && time.Now().After(deadline) {
+			d.stopped = fmt.Sprintf("it ran for %v", maxDuration)
+			return errWalkLimit
+		}
+		d.files++
+		d.total += info.Size()
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil || rel == "." {
+			return nil
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		for i := 1; i <= len(parts) && i <= depth; i++ {
+			d.sizes[filepath.Join(root, filepath.Join(parts[:i]...))] += info.Size()
+		}
+		return nil
+	})
+	if err != nil && err != errWalkLimit {
+		d.stopped = err.Error()
+	}
+	return d
+}
+
+// largest returns the n largest directories, largest first.
+func (d directorySizes) largest(n int) []string {
+	var paths []string
+	for path := range d.sizes {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if d.sizes[paths[i]] != d.sizes[paths[j]] {
+			return d.sizes[paths[i]] > d.sizes[paths[j]]
+		}
+		return paths[i] < paths[j]
+	})
+	if len(paths) > n {
+		paths = paths[:n]
+	}
+	return paths
+}
+
+// spaceUsage lists the largest directories of the system volume, the first
+// question of a full disk.
+type spaceUsage struct {
+	outputFileName string
+}
+
+func (s spaceUsage) run(ctx context.Context) (string, error) {
+	outPath := filepath.Join(tmpFolder, s.outputFileName)
+	start := time.Now()
+	d := walkDirectorySizes(ctx, systemVolume, spaceUsageDepth, spaceUsageMaxDuration, spaceUsageMaxFiles)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Largest directories of %s, down to %d levels, walked in %v\r\n\r\n", systemVolume, spaceUsageDepth, time.Since(start).Round(time.Second))
+	for _, path := range d.largest(spaceUsageTop) {
+		fmt.Fprintf(&b, "%10d MB  %s\r\n", d.sizes[path]>>20, path)
+	}
+	fmt.Fprintf(&b, "\r\nTotal: %d MB in %d files.\r\n", d.total>>20, d.files)
+	if d.unreadable > 0 {
+		fmt.Fprintf(&b, "%d files or directories could not be read and are not counted.\r\n", d.unreadable)
+	}
+	if d.stopped != "" {
+		fmt.Fprintf(&b, "The walk stopped early, %s, the sizes are lower bounds.\r\n", d.stopped)
+		summary.notef("The walk of %s for Disk/%s stopped early, %s, the sizes are lower bounds", systemVolume, s.outputFileName, d.stopped)
+	}
+
+	outFile, err := createOutput(ctx, outPath)
+	if err != nil {
+		return outPath, err
+	}
+	defer outFile.Close()
+	_, err = io.WriteString(outFile, b.String())
+	return outPath, err
+}
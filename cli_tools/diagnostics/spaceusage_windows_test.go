@@ -0,0 +1,120 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSizedFile writes a file of size bytes under root.
+func writeSizedFile(t *testing.T, root, rel string, size int) {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func spaceUsageTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "space_usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSizedFile(t, root, "pagefile.sys", 50)
+	writeSizedFile(t, root, filepath.Join("Windows", "System32", "a.dll"), 300)
+	writeSizedFile(t, root, filepath.Join("Windows", "System32", "drivers", "etc", "hosts"), 100)
+	writeSizedFile(t, root, filepath.Join("Windows", "WinSxS", "b.dll"), 250)
+	writeSizedFile(t, root, filepath.Join("Users", "alice", "Downloads", "big.iso"), 1000)
+	writeSizedFile(t, root, filepath.Join("Temp", "x.tmp"), 10)
+	return root
+}
+
+func TestWalkDirectorySizes(t *testing.T) {
+	root := spaceUsageTree(t)
+	defer os.RemoveAll(root)
+
+	d := walkDirectorySizes(context.Background(), root, 2, time.Minute, 100)
+	for rel, want := range map[string]int64{
+		"Windows":                            650,
+		filepath.Join("Windows", "System32"): 400,
+		filepath.Join("Windows", "WinSxS"):   250,
+		"Users":                              1000,
+		filepath.Join("Users", "alice"):      1000,
+		"Temp":                               10,
+	} {
+		if got := d.sizes[filepath.Join(root, rel)]; got != want {
+			t.Errorf("size of %s = %d, want %d", rel, got, want)
+		}
+	}
+	// The deeper directories count in their ancestors only.
+	if _, ok := d.sizes[filepath.Join(root, "Windows", "System32", "drivers")]; ok {
+		t.Errorf("expected no directory deeper than 2 levels, got %v", d.sizes)
+	}
+	if d.total != 1710 || d.files != 6 || d.stopped != "" {
+		t.Errorf("walk = %d bytes in %d files, stopped %q, want 1710 bytes in 6 files, not stopped", d.total, d.files, d.stopped)
+	}
+	want := []string{filepath.Join(root, "Users"), filepath.Join(root, "Users", "alice"), filepath.Join(root, "Windows")}
+	if got := d.largest(3); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("largest(3) = %v, want %v", got, want)
+	}
+}
+
+func TestWalkDirectorySizesBounded(t *testing.T) {
+	root := spaceUsageTree(t)
+	defer os.RemoveAll(root)
+
+	d := walkDirectorySizes(context.Background(), root, 2, time.Minute, 3)
+	if d.files != 3 || d.stopped != "it reached 3 files" {
+		t.Errorf("walk bounded to 3 files counted %d, stopped %q", d.files, d.stopped)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if d := walkDirectorySizes(ctx, root, 2, time.Minute, 100); d.files != 0 || d.stopped == "" {
+		t.Errorf("walk with a done context counted %d files, stopped %q", d.files, d.stopped)
+	}
+}
+
+func TestGatherDiskLogsSpaceUsage(t *testing.T) {
+	_, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	root := spaceUsageTree(t)
+	defer os.RemoveAll(root)
+	systemVolume = root
+
+	folder := runGatherer(t, gatherDiskLogs)
+	got := readFolderFile(t, folder, "space_usage.txt")
+	for _, want := range []string{
+		"Largest directories of " + root + ", down to 3 levels",
+		"0 MB  " + filepath.Join(root, "Users", "alice", "Downloads"),
+		"0 MB  " + filepath.Join(root, "Windows", "System32", "drivers"),
+		"Total: 0 MB in 6 files.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in space_usage.txt:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, filepath.Join(root, "Users")) > strings.Index(got, filepath.Join(root, "Windows")) {
+		t.Errorf("expected the directories largest first:\n%s", got)
+	}
+}
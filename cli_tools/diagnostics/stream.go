@@ -0,0 +1,174 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// stream is the bundle being written as the logs are collected with
+// -stream, nil otherwise.
+var stream *streamArchive
+
+// streamArchive is a zip bundle the collectors write their output straight
+// into, through createOutput, rather than into files in tmpFolder that are
+// archived at the end. It spares the disk space of the uncompressed outputs
+// on machines short of it. A zip only takes one file at a time, so the
+// collectors take turns: each holds the archive from creating its output
+// until closing it, and the ones waiting for it give up when their context
+// is done. The files collected whole and the commands that write
+// their own file, such as traces, are added when the collection is done.
+type streamArchive struct {
+	// turn holds a value while a file of the archive is being written.
+	turn chan struct{}
+	f    *os.File
+	zip  zipArchive
+
+	sizesMu sync.Mutex
+	// sizes holds the size of each output streamed, by the path in
+	// tmpFolder it stands for.
+	sizes map[string]int64
+}
+
+// createStreamArchive creates the zip bundle at path, with the given
+// compression level.
+func createStreamArchive(path string, level int) (*streamArchive, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newArchiveWriter(f, formatZip, level)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &streamArchive{turn: make(chan struct{}, 1), f: f, zip: w.(zipArchive), sizes: make(map[string]int64)}, nil
+}
+
+// create starts the file name of the archive for the output that would have
+// been written to path, waiting for the file being written, if any, to be
+// closed. It returns the error of ctx if ctx is done first.
+func (s *streamArchive) create(ctx context.Context, name, path string) (io.WriteCloser, error) {
+	select {
+	case s.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	w, err := s.zip.create(name, time.Now())
+	if err != nil {
+		<-s.turn
+		return nil, err
+	}
+	return &streamEntry{s: s, path: path, w: w}, nil
+}
+
+// size returns the size of the output streamed for path, ok is false when
+// path wasn't streamed.
+func (s *streamArchive) size(path string) (n int64, ok bool) {
+	s.sizesMu.Lock()
+	defer s.sizesMu.Unlock()
+	n, ok = s.sizes[path]
+	return n, ok
+}
+
+// finish adds the files of logs that weren't streamed and closes the
+// archive. Like archiveFiles, it returns errNonFatal when some files
+// couldn't be added.
+func (s *streamArchive) finish(logs []logFolder) (err error) {
+	s.turn <- struct{}{}
+	defer func() { <-s.turn }()
+	var entries []archiveEntry
+	for _, e := range archiveEntries(logs) {
+		if _, ok := s.size(e.path); !ok {
+			entries = append(entries, e)
+		}
+	}
+	err = writeEntries(s.zip, entries)
+	if cErr := s.zip.close(); cErr != nil {
+		s.f.Close()
+		return cErr
+	}
+	if cErr := s.f.Close(); cErr != nil {
+		return cErr
+	}
+	return err
+}
+
+// streamEntry is a file of a streamArchive being written.
+type streamEntry struct {
+	s    *streamArchive
+	path string
+	w    io.Writer
+	n    int64
+	once sync.Once
+}
+
+func (e *streamEntry) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	e.n += int64(n)
+	return n, err
+}
+
+// Close ends the file, letting the next collector have the archive.
+func (e *streamEntry) Close() error {
+	e.once.Do(func() {
+		e.s.sizesMu.Lock()
+		e.s.sizes[e.path] = e.n
+		e.s.sizesMu.Unlock()
+		<-e.s.turn
+	})
+	return nil
+}
+
+type folderKey struct{}
+
+// inFolder returns ctx for the collectors of folder, which need to know it
+// up front when their output is streamed.
+func inFolder(ctx context.Context, folder string) context.Context {
+	return context.WithValue(ctx, folderKey{}, folder)
+}
+
+// folderOf returns the folder of the collectors run with ctx.
+func folderOf(ctx context.Context) string {
+	folder, _ := ctx.Value(folderKey{}).(string)
+	return folder
+}
+
+// createOutput creates the output file at path in tmpFolder of a collector
+// run with ctx, or, with -stream, the file of the bundle that stands for it.
+func createOutput(ctx context.Context, path string) (io.WriteCloser, error) {
+	if stream == nil {
+		return os.Create(path)
+	}
+	return stream.create(ctx, archivePath(folderOf(ctx), path), path)
+}
+
+// outputSize returns the size of the output at path, wherever it went.
+func outputSize(path string) (int64, error) {
+	if stream != nil {
+		if n, ok := stream.size(path); ok {
+			return n, nil
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,179 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStreamArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics_stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldTmp := tmpFolder
+	defer func() { tmpFolder, stream = oldTmp, nil }()
+	tmpFolder = filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tmpFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(tmpFolder, archiveFileName(formatZip))
+	if stream, err = createStreamArchive(archive, flate.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+
+	// Collectors of several folders write their outputs at the same time,
+	// in several writes each.
+	want := make(map[string]string)
+	var folders []logFolder
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		folder := fmt.Sprintf("Folder%d", i%3)
+		path := filepath.Join(tmpFolder, fmt.Sprintf("output%d.txt", i))
+		want[folder+"/"+filepath.Base(path)] = fmt.Sprintf("line 1 of %d\r\nline 2 of %d\r\n", i, i)
+		folders = append(folders, logFolder{name: folder, files: []string{path}})
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w, err := createOutput(inFolder(context.Background(), folder), path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			fmt.Fprintf(w, "line 1 of %d\r\n", i)
+			fmt.Fprintf(w, "line 2 of %d\r\n", i)
+			w.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	// A file collected whole is added at the end.
+	collected := filepath.Join(dir, "System.evtx")
+	if err := ioutil.WriteFile(collected, []byte("evtx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want["Event/System.evtx"] = "evtx"
+	folders = append(folders, logFolder{name: "Event", files: []string{collected}})
+
+	for _, f := range folders[:8] {
+		n, err := outputSize(f.files[0])
+		if err != nil || n != int64(len(want[f.name+"/"+filepath.Base(f.files[0])])) {
+			t.Errorf("outputSize(%s) = %d, %v", f.files[0], n, err)
+		}
+	}
+	if err := stream.finish(folders); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing but the bundle landed in tmpFolder.
+	infos, err := ioutil.ReadDir(tmpFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != archiveFileName(formatZip) {
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		t.Errorf("expected only the bundle in the temporary folder, got %v", names)
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		got[f.Name] = string(data)
+	}
+	if len(got) != len(want) {
+		t.Errorf("bundle has %d files, want %d: %v", len(got), len(want), got)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestStreamArchiveWaitCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics_stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldTmp := tmpFolder
+	defer func() { tmpFolder, stream = oldTmp, nil }()
+	tmpFolder = dir
+	if stream, err = createStreamArchive(filepath.Join(dir, archiveFileName(formatZip)), flate.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+
+	// A slow collector holds the archive while another waits for it.
+	slow, err := createOutput(inFolder(context.Background(), "System"), filepath.Join(dir, "msinfo32.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(inFolder(context.Background(), "Network"), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		w, err := createOutput(ctx, filepath.Join(dir, "ipconfig.txt"))
+		if err == nil {
+			w.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("waiting for the archive returned %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiting collector ignored its timeout")
+	}
+
+	// The archive is still usable once the slow collector is done.
+	slow.Close()
+	w, err := createOutput(inFolder(context.Background(), "Network"), filepath.Join(dir, "ipconfig.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := stream.finish(nil); err != nil {
+		t.Fatal(err)
+	}
+}
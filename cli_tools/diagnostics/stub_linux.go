@@ -14,8 +14,34 @@
 
 package main
 
-import ()
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
 
-func gatherLogs(trace bool) ([]logFolder, error) {
-	return nil, nil
+func gatherLogs() []logFolder {
+	return nil
+}
+
+type unsupportedTransport struct{}
+
+func (unsupportedTransport) collect(ctx context.Context, host, dir string) (string, error) {
+	return "", errors.New("collecting from remote hosts is only supported on Windows")
+}
+
+var remoteTransport hostTransport = unsupportedTransport{}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func listCollectors(w io.Writer, asJSON bool) error {
+	return errors.New("listing the collectors is only supported on Windows")
+}
+
+func checkCollectorNames() error {
+	return nil
 }
@@ -0,0 +1,100 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const summaryFileName = "summary.txt"
+
+// runSummary collects the errors, warnings and notes of a run that are worth
+// calling out to whoever reads the bundle. It is safe for concurrent use by
+// the gatherers.
+type runSummary struct {
+	mu       sync.Mutex
+	errors   []string
+	warnings []string
+	notes    []string
+}
+
+var summary = &runSummary{}
+
+func (s *runSummary) errorf(format string, a ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = append(s.errors, fmt.Sprintf(format, a...))
+}
+
+func (s *runSummary) warnf(format string, a ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warnings = append(s.warnings, fmt.Sprintf(format, a...))
+}
+
+// notef records something the reader should know that isn't a problem.
+func (s *runSummary) notef(format string, a ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notes = append(s.notes, fmt.Sprintf(format, a...))
+}
+
+// lines returns a copy of the errors, warnings and notes, with the
+// temporary folder left out under -reproducible.
+func (s *runSummary) lines() (errors, warnings, notes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clean := func(lines []string) []string {
+		out := make([]string, len(lines))
+		for i, l := range lines {
+			out[i] = reproduciblePaths(l)
+		}
+		return out
+	}
+	return clean(s.errors), clean(s.warnings), clean(s.notes)
+}
+
+func (s *runSummary) String() string {
+	errors, warnings, notes := s.lines()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Diagnostics collected at %s\r\n", collectionTime())
+	writeSection := func(title string, lines []string) {
+		fmt.Fprintf(&b, "\r\n%s (%d):\r\n", title, len(lines))
+		for _, l := range lines {
+			fmt.Fprintf(&b, "  %s\r\n", l)
+		}
+	}
+	writeSection("Errors", errors)
+	writeSection("Warnings", warnings)
+	writeSection("Notes", notes)
+	return b.String()
+}
+
+// write saves the summary to path.
+func (s *runSummary) write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(s.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,64 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// throttledReader reads from r at no more than rate bytes per second on
+// average, sleeping when it gets ahead. It keeps the upload of a big bundle
+// from saturating the egress of a busy instance.
+type throttledReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+	// now and sleep are the clock, tests replace them.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// throttleNow and throttleSleep are the clock of new throttled readers,
+// tests replace them.
+var (
+	throttleNow   = time.Now
+	throttleSleep = time.Sleep
+)
+
+func newThrottledReader(r io.Reader, rate int64) *throttledReader {
+	return &throttledReader{r: r, rate: rate, now: throttleNow, sleep: throttleSleep}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = t.now()
+	}
+	// Read at most a tenth of a second worth at a time, so the pace is
+	// smooth rather than bursts of large reads.
+	if max := t.rate / 10; max > 0 && int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	// Wait until the bytes read so far are within the rate.
+	due := t.start.Add(time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second)))
+	if wait := due.Sub(t.now()); wait > 0 {
+		t.sleep(wait)
+	}
+	return n, err
+}
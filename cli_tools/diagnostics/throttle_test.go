@@ -0,0 +1,151 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottledReader(t *testing.T) {
+	const (
+		size = 1 << 20
+		rate = 100 * 1024
+	)
+	payload := bytes.Repeat([]byte("x"), size)
+
+	// A fake clock that only moves when the reader sleeps, as if reading
+	// took no time at all.
+	clock := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	start := clock
+	r := newThrottledReader(bytes.NewReader(payload), rate)
+	r.now = func() time.Time { return clock }
+	r.sleep = func(d time.Duration) { clock = clock.Add(d) }
+
+	var got bytes.Buffer
+	maxRate := 0.0
+	buf := make([]byte, 256*1024)
+	for {
+		n, err := r.Read(buf)
+		got.Write(buf[:n])
+		if elapsed := clock.Sub(start).Seconds(); elapsed > 0 {
+			if current := float64(got.Len()) / elapsed; current > maxRate {
+				maxRate = current
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if !bytes.Equal(got.Bytes(), payload) {
+		t.Fatalf("read %d bytes, want the %d byte payload", got.Len(), size)
+	}
+	if maxRate > rate*1.001 {
+		t.Errorf("effective rate reached %.0f B/s, over the %d B/s limit", maxRate, rate)
+	}
+	if elapsed, want := clock.Sub(start), time.Duration(size)*time.Second/rate; elapsed < want {
+		t.Errorf("reading took %v, want at least %v", elapsed, want)
+	}
+}
+
+func TestThrottledReaderRealClock(t *testing.T) {
+	const (
+		size = 50 * 1024
+		rate = 200 * 1024
+	)
+	start := time.Now()
+	n, err := ioutil.ReadAll(newThrottledReader(bytes.NewReader(make([]byte, size)), rate))
+	if err != nil || len(n) != size {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(n), err)
+	}
+	if elapsed, want := time.Since(start), time.Duration(size)*time.Second/rate; elapsed < want {
+		t.Errorf("reading took %v, want at least %v", elapsed, want)
+	}
+}
+
+func TestUploadToSignedURLThrottled(t *testing.T) {
+	const (
+		size = 1 << 20
+		rate = 64 * 1024
+	)
+	oldOpts, oldTimeout, oldNow, oldSleep := opts, uploadTimeout, throttleNow, throttleSleep
+	defer func() { opts, uploadTimeout, throttleNow, throttleSleep = oldOpts, oldTimeout, oldNow, oldSleep }()
+	opts.uploadRateLimit = rate
+	// A 10s timeout scaled down along with the clock: the fake clock moves
+	// 50 times faster than the real one, so the 16s the limit makes the
+	// upload take are 320ms, well past a timeout of 200ms.
+	uploadTimeout = 200 * time.Millisecond
+	clock := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	start := clock
+	var mu sync.Mutex
+	throttleNow = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return clock
+	}
+	throttleSleep = func(d time.Duration) {
+		mu.Lock()
+		clock = clock.Add(d)
+		mu.Unlock()
+		time.Sleep(d / 50)
+	}
+
+	var uploaded int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.Header().Set("Location", "http://"+r.Host+"/upload")
+		case "PUT":
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			uploaded = len(data)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "diagnostics_upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "logs.zip")
+	if err := ioutil.WriteFile(bundle, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uploadToSignedURL(bundle, server.URL+"/signed"); err != nil {
+		t.Fatalf("uploadToSignedURL() error = %v, want the throttled upload to complete", err)
+	}
+	if uploaded != size {
+		t.Errorf("uploaded %d bytes, want %d", uploaded, size)
+	}
+	if elapsed := clock.Sub(start); elapsed < 10*time.Second {
+		t.Errorf("the upload took %v on the fake clock, want it past 10s", elapsed)
+	}
+	if d := uploadDuration(size); d < 16*time.Second {
+		t.Errorf("uploadDuration(%d) = %v, want at least the 16s the limit makes it take", size, d)
+	}
+}
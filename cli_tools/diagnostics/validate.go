@@ -0,0 +1,45 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// validateOutputs looks for collected files that are empty or smaller than
+// expected, which usually means the command that produced them silently
+// failed. minSizes holds the expected minimum size keyed by file name, any
+// other file only needs to be non empty. A warning is returned per suspicious
+// file.
+func validateOutputs(folders []logFolder, minSizes map[string]int64) []string {
+	var warnings []string
+	for _, folder := range folders {
+		for _, path := range folder.files {
+			size, err := outputSize(path)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s/%s: %v", folder.name, filepath.Base(path), err))
+				continue
+			}
+			name := filepath.Base(path)
+			if size == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s/%s is empty", folder.name, name))
+			} else if min, ok := minSizes[name]; ok && size < min {
+				warnings = append(warnings, fmt.Sprintf("%s/%s is only %d bytes, expected at least %d", folder.name, name, size, min))
+			}
+		}
+	}
+	return warnings
+}
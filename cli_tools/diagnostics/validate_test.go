@@ -0,0 +1,60 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestValidateOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"systeminfo.txt": "",
+		"bcdedit.txt":    "Windows Boot Manager",
+		"ipconfig.txt":   "short",
+		"route.txt":      strings.Repeat("route ", 100),
+	}
+	var paths []string
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	folders := []logFolder{{name: "System", files: paths}}
+	minSizes := map[string]int64{"ipconfig.txt": 256, "route.txt": 256}
+
+	got := validateOutputs(folders, minSizes)
+	want := []string{
+		"System/ipconfig.txt is only 5 bytes, expected at least 256",
+		"System/systeminfo.txt is empty",
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("validateOutputs() = %q, want %q", got, want)
+	}
+}
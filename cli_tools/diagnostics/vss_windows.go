@@ -0,0 +1,61 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"strings"
+)
+
+type vssWriter struct {
+	name      string
+	state     string
+	lastError string
+}
+
+// failed reports whether the writer is in one of the "Failed at ..." states
+// or reported an error, either of which breaks backups.
+func (w vssWriter) failed() bool {
+	return strings.Contains(w.state, "Failed") || (w.lastError != "" && w.lastError != "No error")
+}
+
+// parseVssWriters parses the output of "vssadmin list writers".
+func parseVssWriters(output string) []vssWriter {
+	var writers []vssWriter
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Writer name:"):
+			name := strings.TrimSpace(strings.TrimPrefix(line, "Writer name:"))
+			writers = append(writers, vssWriter{name: strings.Trim(name, "'")})
+		case len(writers) == 0:
+		case strings.HasPrefix(line, "State:"):
+			writers[len(writers)-1].state = strings.TrimSpace(strings.TrimPrefix(line, "State:"))
+		case strings.HasPrefix(line, "Last error:"):
+			writers[len(writers)-1].lastError = strings.TrimSpace(strings.TrimPrefix(line, "Last error:"))
+		}
+	}
+	return writers
+}
+
+// checkVssWriters raises the failed VSS writers in the summary.
+func checkVssWriters(output string) {
+	for _, w := range parseVssWriters(output) {
+		if w.failed() {
+			summary.warnf("VSS writer %q is in state %q with last error %q", w.name, w.state, w.lastError)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+//  Copyright 2019 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleVssWriters = `vssadmin 1.1 - Volume Shadow Copy Service administrative command-line tool
+(C) Copyright 2001-2013 Microsoft Corp.
+
+Writer name: 'Task Scheduler Writer'
+   Writer Id: {d61d61c8-d73a-4eee-8cdd-f6f9786b7124}
+   Writer Instance Id: {1bddd48e-5052-49db-9b07-b96f96727e6b}
+   State: [1] Stable
+   Last error: No error
+
+Writer name: 'SqlServerWriter'
+   Writer Id: {a65faa63-5ea8-4ebc-9dbd-a0c4db26912a}
+   Writer Instance Id: {2f7ab9a2-5a5e-4e5f-8a8e-0c5a3e9e8b3c}
+   State: [8] Failed
+   Last error: Non-retryable error
+
+Writer name: 'Registry Writer'
+   Writer Id: {afbab4a2-367d-4d15-a586-71dbb18f8485}
+   Writer Instance Id: {684a5ef8-bd31-4a40-a9f7-b4bc4c4ef9dd}
+   State: [1] Stable
+   Last error: Timed out
+`
+
+func TestParseVssWriters(t *testing.T) {
+	got := parseVssWriters(sampleVssWriters)
+	want := []vssWriter{
+		{"Task Scheduler Writer", "[1] Stable", "No error"},
+		{"SqlServerWriter", "[8] Failed", "Non-retryable error"},
+		{"Registry Writer", "[1] Stable", "Timed out"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVssWriters() = %v, want %v", got, want)
+	}
+}
+
+func TestGatherDiskLogsVss(t *testing.T) {
+	fake, cleanup := withFakeExecutor(t)
+	defer cleanup()
+	fake.outputs = map[string]string{`C:\Windows\System32\vssadmin.exe list writers`: sampleVssWriters}
+
+	folder := runGatherer(t, gatherDiskLogs)
+	got := readFolderFile(t, folder, "vss.txt")
+	if !strings.Contains(got, "Writer name: 'SqlServerWriter'") || !strings.Contains(got, "vssadmin.exe list shadows") {
+		t.Errorf("expected writers and shadows in vss.txt:\n%s", got)
+	}
+
+	s := summary.String()
+	for _, w := range []string{"SqlServerWriter", "Registry Writer"} {
+		if !strings.Contains(s, w) {
+			t.Errorf("expected failed writer %q in the summary:\n%s", w, s)
+		}
+	}
+	if strings.Contains(s, "Task Scheduler Writer") {
+		t.Errorf("stable writer should not be in the summary:\n%s", s)
+	}
+}
@@ -17,6 +17,8 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"runtime"
+	"sync"
 
 	"github.com/go-ole/go-ole"
 	"github.com/go-ole/go-ole/oleutil"
@@ -44,19 +46,76 @@ func getItemProperties(item *ole.IDispatch) ([]string, error) {
 	return properties, err
 }
 
-func printWmiObjects(class string, namespace string) (string, error) {
-	ole.CoInitialize(0)
-	defer ole.CoUninitialize()
+// wmiProperty is a single property of a WMI object.
+type wmiProperty struct {
+	name  string
+	value interface{}
+}
+
+// wmiObject holds the properties of a WMI object in the order WMI lists them.
+type wmiObject []wmiProperty
+
+// get returns the value of the named property, or nil if there is none.
+func (o wmiObject) get(name string) interface{} {
+	for _, p := range o {
+		if p.name == name {
+			return p.value
+		}
+	}
+	return nil
+}
+
+// formatWmiObjects formats the objects into a readable list.
+func formatWmiObjects(objects []wmiObject) string {
+	var bfr bytes.Buffer
+	for _, object := range objects {
+		bfr.WriteString("\r\n\r\n")
+		for _, p := range object {
+			v := p.value
+			if v == nil {
+				v = ""
+			}
+			bfr.WriteString(fmt.Sprintf("%s: %v\r\n", p.name, v))
+		}
+	}
+	return bfr.String()
+}
+
+// comInit joins the calling thread to the multithreaded apartment, where the
+// cached WMI connections can be used from any goroutine. The returned func
+// leaves it.
+func comInit() func() {
+	runtime.LockOSThread()
+	ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
+	return func() {
+		ole.CoUninitialize()
+		runtime.UnlockOSThread()
+	}
+}
+
+// keepApartment keeps the multithreaded apartment up for the whole run, the
+// cached connections would be torn down with it otherwise.
+var keepApartment sync.Once
+
+// oleWmiConnection is a connection to a WMI namespace through COM.
+type oleWmiConnection struct {
+	service *ole.IDispatch
+}
+
+// connectWmi connects to the WMI namespace, root\default if it is empty.
+func connectWmi(namespace string) (wmiConnection, error) {
+	keepApartment.Do(func() { ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED) })
+	defer comInit()()
 
 	unknown, err := oleutil.CreateObject("WbemScripting.SWbemLocator")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer unknown.Release()
 
 	wmi, err := unknown.QueryInterface(ole.IID_IDispatch)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer wmi.Release()
 
@@ -65,21 +124,26 @@ func printWmiObjects(class string, namespace string) (string, error) {
 	}
 	serviceRaw, err := oleutil.CallMethod(wmi, "ConnectServer", nil, namespace)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	service := serviceRaw.ToIDispatch()
-	defer service.Release()
+	return oleWmiConnection{serviceRaw.ToIDispatch()}, nil
+}
+
+func (c oleWmiConnection) query(class, where string) ([]wmiObject, error) {
+	defer comInit()()
 
 	query := fmt.Sprintf("SELECT * FROM %s", class)
-	resultRaw, err := oleutil.CallMethod(service, "ExecQuery", query)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	resultRaw, err := oleutil.CallMethod(c.service, "ExecQuery", query)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	items := resultRaw.ToIDispatch()
 	defer items.Release()
 
-	// Format the items into a readable list
-	var bfr bytes.Buffer
+	var objects []wmiObject
 	var properties []string
 	err = oleutil.ForEach(items, func(itemRaw *ole.VARIANT) error {
 		item := itemRaw.ToIDispatch()
@@ -93,19 +157,16 @@ func printWmiObjects(class string, namespace string) (string, error) {
 			}
 		}
 
-		bfr.WriteString("\r\n\r\n")
+		object := make(wmiObject, 0, len(properties))
 		for _, property := range properties {
 			itemProp, err := oleutil.GetProperty(item, property)
 			if err != nil {
 				return err
 			}
-			p := itemProp.Value()
-			if p == nil {
-				p = ""
-			}
-			bfr.WriteString(fmt.Sprintf("%s: %v\r\n", property, p))
+			object = append(object, wmiProperty{property, itemProp.Value()})
 		}
+		objects = append(objects, object)
 		return nil
 	})
-	return bfr.String(), err
+	return objects, err
 }